@@ -0,0 +1,189 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"path"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// An encrypted bundle is a zip of configurations, encrypted with XChaCha20-Poly1305 under a key derived
+// from a passphrase with Argon2id. It starts with a header, which is authenticated as additional data:
+//
+//	magic    [8]byte  "WGBUNDLE"
+//	version  uint8    1
+//	time     uint32   Argon2id passes, big endian
+//	memory   uint32   Argon2id memory in KiB, big endian
+//	threads  uint8    Argon2id parallelism
+//	salt     [16]byte
+//	nonce    [24]byte
+const (
+	bundleMagic      = "WGBUNDLE"
+	bundleVersion    = 1
+	bundleHeaderSize = len(bundleMagic) + 1 + 4 + 4 + 1 + passphraseSaltSize + chacha20poly1305.NonceSizeX
+)
+
+// Bundles with key derivation parameters beyond these are rejected rather than allowed to exhaust the
+// machine that imports them.
+const (
+	bundleMaxArgonTime   = 64
+	bundleMaxArgonMemory = 1024 * 1024
+)
+
+// EncryptedBundleExtension is the file extension of encrypted bundles.
+const EncryptedBundleExtension = ".wgbundle"
+
+var ErrUnsupportedBundle = errors.New("The bundle was made by a newer version or is corrupt")
+
+// IsEncryptedBundle reports whether data starts like an encrypted bundle.
+func IsEncryptedBundle(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(bundleMagic))
+}
+
+// EncryptBundle encrypts plaintext into an encrypted bundle with a key derived from passphrase.
+func EncryptBundle(plaintext []byte, passphrase string) ([]byte, error) {
+	header := make([]byte, bundleHeaderSize)
+	copy(header, bundleMagic)
+	fields := header[len(bundleMagic):]
+	fields[0] = bundleVersion
+	binary.BigEndian.PutUint32(fields[1:5], passphraseArgonTime)
+	binary.BigEndian.PutUint32(fields[5:9], passphraseArgonMemory)
+	fields[9] = passphraseArgonThreads
+	random := fields[10:]
+	_, err := rand.Read(random)
+	if err != nil {
+		return nil, err
+	}
+	salt, nonce := random[:passphraseSaltSize], random[passphraseSaltSize:]
+	key := argon2.IDKey([]byte(passphrase), salt, passphraseArgonTime, passphraseArgonMemory, passphraseArgonThreads, chacha20poly1305.KeySize)
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(header, nonce, plaintext, header), nil
+}
+
+// DecryptBundle decrypts an encrypted bundle made by EncryptBundle, returning ErrWrongPassphrase if
+// passphrase is wrong or the bundle has been tampered with.
+func DecryptBundle(data []byte, passphrase string) ([]byte, error) {
+	if !IsEncryptedBundle(data) || len(data) < bundleHeaderSize {
+		return nil, ErrUnsupportedBundle
+	}
+	header := data[:bundleHeaderSize]
+	fields := header[len(bundleMagic):]
+	if fields[0] != bundleVersion {
+		return nil, ErrUnsupportedBundle
+	}
+	time, memory, threads := binary.BigEndian.Uint32(fields[1:5]), binary.BigEndian.Uint32(fields[5:9]), fields[9]
+	if time == 0 || time > bundleMaxArgonTime || memory == 0 || memory > bundleMaxArgonMemory || threads == 0 {
+		return nil, ErrUnsupportedBundle
+	}
+	salt := fields[10 : 10+passphraseSaltSize]
+	nonce := fields[10+passphraseSaltSize:]
+	key := argon2.IDKey([]byte(passphrase), salt, time, memory, threads, chacha20poly1305.KeySize)
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, nonce, data[bundleHeaderSize:], header)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return plaintext, nil
+}
+
+// WriteBundle writes configs to w as a zip of wg-quick files, or of JSON files if asJSON is set. If
+// passphrase is not empty, the zip is written as an encrypted bundle.
+func WriteBundle(w io.Writer, configs []*Config, asJSON bool, passphrase string) error {
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	for _, config := range configs {
+		name, text := config.Name+".conf", config.ToWgQuick()
+		if asJSON {
+			name, text = config.Name+".json", config.ToJSON()
+		}
+		f, err := writer.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write([]byte(text))
+		if err != nil {
+			return err
+		}
+	}
+	err := writer.Close()
+	if err != nil {
+		return err
+	}
+	data := buffer.Bytes()
+	if passphrase != "" {
+		data, err = EncryptBundle(data, passphrase)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// BundleFile is a configuration file read from a bundle, which has yet to be parsed.
+type BundleFile struct {
+	Name     string
+	Contents []byte
+	JSON     bool
+}
+
+// Parse parses the file in the format indicated by its extension, named after the file.
+func (file *BundleFile) Parse() (*Config, error) {
+	if file.JSON {
+		return FromJSON(string(file.Contents), file.Name)
+	}
+	return FromWgQuickWithUnknownEncoding(string(file.Contents), file.Name)
+}
+
+// ReadBundle returns the .conf and .json files of a zip, decrypting it with passphrase first if it is an
+// encrypted bundle.
+func ReadBundle(data []byte, passphrase string) ([]BundleFile, error) {
+	if IsEncryptedBundle(data) {
+		var err error
+		data, err = DecryptBundle(data, passphrase)
+		if err != nil {
+			return nil, err
+		}
+	}
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	var files []BundleFile
+	for _, f := range r.File {
+		ext := strings.ToLower(path.Ext(f.Name))
+		if ext != ".conf" && ext != ".json" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		contents, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		base := path.Base(strings.ReplaceAll(f.Name, "\\", "/"))
+		files = append(files, BundleFile{Name: strings.TrimSuffix(base, path.Ext(base)), Contents: contents, JSON: ext == ".json"})
+	}
+	return files, nil
+}
@@ -0,0 +1,69 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBundleRoundTrip(t *testing.T) {
+	c, err := FromWgQuick(testInput, "golangTest")
+	if !noError(t, err) {
+		return
+	}
+	for _, asJSON := range []bool{false, true} {
+		for _, passphrase := range []string{"", "correct horse battery staple"} {
+			var buffer bytes.Buffer
+			if !noError(t, WriteBundle(&buffer, []*Config{c}, asJSON, passphrase)) {
+				return
+			}
+			equal(t, passphrase != "", IsEncryptedBundle(buffer.Bytes()))
+			files, err := ReadBundle(buffer.Bytes(), passphrase)
+			if !noError(t, err) || !equal(t, 1, len(files)) {
+				return
+			}
+			equal(t, "golangTest", files[0].Name)
+			equal(t, asJSON, files[0].JSON)
+			parsed, err := files[0].Parse()
+			if noError(t, err) {
+				equal(t, c.ToJSON(), parsed.ToJSON())
+			}
+		}
+	}
+}
+
+func TestDecryptBundleErrors(t *testing.T) {
+	bundle, err := EncryptBundle([]byte("hello"), "correct horse battery staple")
+	if !noError(t, err) {
+		return
+	}
+	if _, err := DecryptBundle(bundle, "incorrect horse battery staple"); err != ErrWrongPassphrase {
+		t.Errorf("Decrypting with the wrong passphrase should fail with ErrWrongPassphrase, but got %v", err)
+	}
+	tampered := append([]byte(nil), bundle...)
+	tampered[len(bundleMagic)+1+4+4+1] ^= 1
+	if _, err := DecryptBundle(tampered, "correct horse battery staple"); err != ErrWrongPassphrase {
+		t.Errorf("Decrypting with a tampered salt should fail with ErrWrongPassphrase, but got %v", err)
+	}
+	newer := append([]byte(nil), bundle...)
+	newer[len(bundleMagic)] = bundleVersion + 1
+	if _, err := DecryptBundle(newer, "correct horse battery staple"); err != ErrUnsupportedBundle {
+		t.Errorf("Decrypting a newer bundle should fail with ErrUnsupportedBundle, but got %v", err)
+	}
+	greedy := append([]byte(nil), bundle...)
+	greedy[len(bundleMagic)+5] = 0xff
+	if _, err := DecryptBundle(greedy, "correct horse battery staple"); err != ErrUnsupportedBundle {
+		t.Errorf("Decrypting a bundle demanding too much memory should fail with ErrUnsupportedBundle, but got %v", err)
+	}
+	if _, err := DecryptBundle(bundle[:bundleHeaderSize-1], "correct horse battery staple"); err != ErrUnsupportedBundle {
+		t.Errorf("Decrypting a truncated bundle should fail with ErrUnsupportedBundle, but got %v", err)
+	}
+	plaintext, err := DecryptBundle(bundle, "correct horse battery staple")
+	if noError(t, err) {
+		equal(t, "hello", string(plaintext))
+	}
+}
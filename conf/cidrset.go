@@ -0,0 +1,127 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"bytes"
+	"net"
+	"sort"
+)
+
+// The functions in this file treat a []IPCidr as the set of addresses that its prefixes cover. The
+// results are always normalized, which means that they are sorted, with IPv4 before IPv6, and made
+// of the fewest prefixes that cover the same addresses.
+
+func (r IPCidr) masked() IPCidr {
+	ip := r.IP.To4()
+	if ip == nil {
+		ip = r.IP.To16()
+	}
+	masked := IPCidr{make(net.IP, len(ip)), r.Cidr}
+	mask := net.CIDRMask(int(r.Cidr), len(ip)*8)
+	for i := range ip {
+		masked.IP[i] = ip[i] & mask[i]
+	}
+	return masked
+}
+
+func (r *IPCidr) contains(o *IPCidr) bool {
+	if r.Bits() != o.Bits() || r.Cidr > o.Cidr {
+		return false
+	}
+	network := r.IPNet()
+	return network.Contains(o.IP)
+}
+
+// halves splits a masked prefix into the two prefixes that are one bit longer.
+func (r *IPCidr) halves() (IPCidr, IPCidr) {
+	lower := IPCidr{append(net.IP(nil), r.IP...), r.Cidr + 1}
+	upper := IPCidr{append(net.IP(nil), r.IP...), r.Cidr + 1}
+	upper.IP[r.Cidr/8] |= 0x80 >> (r.Cidr % 8)
+	return lower, upper
+}
+
+// parent returns the prefix that is one bit shorter, or false if r covers the whole address family.
+func (r *IPCidr) parent() (IPCidr, bool) {
+	if r.Cidr == 0 {
+		return IPCidr{}, false
+	}
+	return IPCidr{r.IP, r.Cidr - 1}.masked(), true
+}
+
+func compareIPCidrs(a, b *IPCidr) int {
+	if len(a.IP) != len(b.IP) {
+		return len(a.IP) - len(b.IP)
+	}
+	if c := bytes.Compare(a.IP, b.IP); c != 0 {
+		return c
+	}
+	return int(a.Cidr) - int(b.Cidr)
+}
+
+// NormalizeIPCidrs returns the smallest sorted list of prefixes covering the same addresses as cidrs,
+// by masking off host bits, dropping prefixes contained in others, and merging adjacent prefixes.
+func NormalizeIPCidrs(cidrs []IPCidr) []IPCidr {
+	sorted := make([]IPCidr, len(cidrs))
+	for i := range cidrs {
+		sorted[i] = cidrs[i].masked()
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return compareIPCidrs(&sorted[i], &sorted[j]) < 0
+	})
+	var normalized []IPCidr
+	for _, cidr := range sorted {
+		if len(normalized) > 0 && normalized[len(normalized)-1].contains(&cidr) {
+			continue
+		}
+		normalized = append(normalized, cidr)
+		for len(normalized) >= 2 {
+			last, previous := &normalized[len(normalized)-1], &normalized[len(normalized)-2]
+			if last.Cidr != previous.Cidr || last.Bits() != previous.Bits() {
+				break
+			}
+			lastParent, ok := last.parent()
+			if !ok {
+				break
+			}
+			previousParent, _ := previous.parent()
+			if compareIPCidrs(&lastParent, &previousParent) != 0 {
+				break
+			}
+			normalized = append(normalized[:len(normalized)-2], lastParent)
+		}
+	}
+	return normalized
+}
+
+// UnionIPCidrs returns the addresses that are in a or b.
+func UnionIPCidrs(a, b []IPCidr) []IPCidr {
+	return NormalizeIPCidrs(append(append([]IPCidr(nil), a...), b...))
+}
+
+func subtractIPCidr(from IPCidr, cidr *IPCidr) []IPCidr {
+	if cidr.contains(&from) {
+		return nil
+	}
+	if !from.contains(cidr) {
+		return []IPCidr{from}
+	}
+	lower, upper := from.halves()
+	return append(subtractIPCidr(lower, cidr), subtractIPCidr(upper, cidr)...)
+}
+
+// SubtractIPCidrs returns the addresses that are in a but not in b.
+func SubtractIPCidrs(a, b []IPCidr) []IPCidr {
+	remaining := NormalizeIPCidrs(a)
+	for _, cidr := range NormalizeIPCidrs(b) {
+		var next []IPCidr
+		for _, from := range remaining {
+			next = append(next, subtractIPCidr(from, &cidr)...)
+		}
+		remaining = next
+	}
+	return NormalizeIPCidrs(remaining)
+}
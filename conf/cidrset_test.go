@@ -0,0 +1,80 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"strings"
+	"testing"
+)
+
+func parseIPCidrs(t *testing.T, s string) []IPCidr {
+	var cidrs []IPCidr
+	for _, element := range strings.Fields(s) {
+		cidr, err := parseIPCidr(element)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cidrs = append(cidrs, *cidr)
+	}
+	return cidrs
+}
+
+func formatIPCidrs(cidrs []IPCidr) string {
+	s := make([]string, len(cidrs))
+	for i := range cidrs {
+		s[i] = cidrs[i].String()
+	}
+	return strings.Join(s, " ")
+}
+
+func TestNormalizeIPCidrs(t *testing.T) {
+	for _, tt := range []struct{ input, output string }{
+		{"", ""},
+		{"10.0.0.1/8", "10.0.0.0/8"},
+		{"10.1.0.0/16 10.0.0.0/8 ::/0 10.0.0.0/8", "10.0.0.0/8 ::/0"},
+		{"0.0.0.0/1 128.0.0.0/1", "0.0.0.0/0"},
+		{"10.0.0.0/24 10.0.1.0/24 10.0.2.0/23", "10.0.0.0/22"},
+		{"10.0.1.0/24 10.0.2.0/24", "10.0.1.0/24 10.0.2.0/24"},
+		{"fd00::1/128 fd00::/128", "fd00::/127"},
+	} {
+		equal(t, tt.output, formatIPCidrs(NormalizeIPCidrs(parseIPCidrs(t, tt.input))))
+	}
+}
+
+func TestUnionIPCidrs(t *testing.T) {
+	equal(t, "10.0.0.0/23 192.168.0.0/16", formatIPCidrs(UnionIPCidrs(parseIPCidrs(t, "10.0.1.0/24 192.168.0.0/16"), parseIPCidrs(t, "10.0.0.0/24"))))
+}
+
+func TestSubtractIPCidrs(t *testing.T) {
+	for _, tt := range []struct{ a, b, output string }{
+		{"10.0.0.0/8", "10.0.0.0/8", ""},
+		{"10.0.0.0/8", "192.168.0.0/16 ::/0", "10.0.0.0/8"},
+		{"10.0.0.0/30", "10.0.0.1/32", "10.0.0.0/32 10.0.0.2/31"},
+		{"0.0.0.0/0", "128.0.0.0/1", "0.0.0.0/1"},
+		{"0.0.0.0/0 ::/0", "10.0.0.0/8 192.168.0.0/16", "0.0.0.0/5 8.0.0.0/7 11.0.0.0/8 12.0.0.0/6 16.0.0.0/4 32.0.0.0/3 64.0.0.0/2 128.0.0.0/2 192.0.0.0/9 192.128.0.0/11 192.160.0.0/13 192.169.0.0/16 192.170.0.0/15 192.172.0.0/14 192.176.0.0/12 192.192.0.0/10 193.0.0.0/8 194.0.0.0/7 196.0.0.0/6 200.0.0.0/5 208.0.0.0/4 224.0.0.0/3 ::/0"},
+	} {
+		equal(t, tt.output, formatIPCidrs(SubtractIPCidrs(parseIPCidrs(t, tt.a), parseIPCidrs(t, tt.b))))
+	}
+}
+
+func TestDisallowedIPs(t *testing.T) {
+	const input = "[Interface]\nPrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=\n\n" +
+		"[Peer]\nPublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=\n" +
+		"AllowedIPs = 0.0.0.0/0\nDisallowedIPs = 128.0.0.0/1\n"
+	conf, err := FromWgQuick(input, "test")
+	if !noError(t, err) {
+		return
+	}
+	equal(t, "128.0.0.0/1", formatIPCidrs(conf.Peers[0].DisallowedIPs))
+	equal(t, "0.0.0.0/1", formatIPCidrs(conf.Peers[0].EffectiveAllowedIPs()))
+	equal(t, input, conf.ToWgQuick())
+	conf.Document = nil
+	equal(t, input, conf.ToWgQuick())
+	uapi, err := conf.ToUAPI()
+	if noError(t, err) && !strings.HasSuffix(uapi, "replace_allowed_ips=true\nallowed_ip=0.0.0.0/1\n") {
+		t.Errorf("Wrong allowed IPs in UAPI configuration:\n%s", uapi)
+	}
+}
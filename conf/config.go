@@ -38,28 +38,51 @@ type Bytes uint64
 
 type Config struct {
 	Name      string
+	Metadata  Metadata
 	Interface Interface
 	Peers     []Peer
+	Document  *Document
 }
 
 type Interface struct {
-	PrivateKey Key
-	Addresses  []IPCidr
-	ListenPort uint16
-	MTU        uint16
-	DNS        []net.IP
-	DNSSearch  []string
-	PreUp      string
-	PostUp     string
-	PreDown    string
-	PostDown   string
+	PrivateKey  Key
+	Addresses   []IPCidr
+	ListenPort  uint16
+	MTU         uint16 // The MTU of both families, unless they have their own
+	IPv4MTU     uint16
+	IPv6MTU     uint16
+	DNS         []net.IP
+	DNSSearch   []string
+	DNSMatch    []string // Only names in these domains use the DNS servers, if any are given
+	DoHTemplate string   // The DNS servers are queried over HTTPS with this URL template, if set
+	DoTName     string   // The DNS servers are queried over TLS as this host name, if set
+	PreUp       string
+	PostUp      string
+	PreDown     string
+	PostDown    string
+	TableOff    bool
+	TableMetric uint32
+	SaveConfig  bool
+}
+
+// EffectiveMTU returns the MTU of IPv6 or IPv4, which is its own if it has one, or the shared one
+// otherwise. Zero means that it is determined automatically.
+func (iface *Interface) EffectiveMTU(ipv6 bool) uint16 {
+	if ipv6 && iface.IPv6MTU > 0 {
+		return iface.IPv6MTU
+	} else if !ipv6 && iface.IPv4MTU > 0 {
+		return iface.IPv4MTU
+	}
+	return iface.MTU
 }
 
 type Peer struct {
 	PublicKey           Key
 	PresharedKey        Key
 	AllowedIPs          []IPCidr
+	DisallowedIPs       []IPCidr
 	Endpoint            Endpoint
+	BackupEndpoints     []Endpoint // Tried in order when handshakes with Endpoint stop completing
 	PersistentKeepalive uint16
 
 	RxBytes           Bytes
@@ -67,6 +90,32 @@ type Peer struct {
 	LastHandshakeTime HandshakeTime
 }
 
+// Endpoints returns the endpoint of the peer followed by its backup endpoints, in priority order.
+func (peer *Peer) Endpoints() []Endpoint {
+	if peer.Endpoint.IsEmpty() {
+		return nil
+	}
+	return append([]Endpoint{peer.Endpoint}, peer.BackupEndpoints...)
+}
+
+// HasEndpoint returns whether e is the endpoint of the peer or one of its backup endpoints.
+func (peer *Peer) HasEndpoint(e Endpoint) bool {
+	for _, endpoint := range peer.Endpoints() {
+		if endpoint == e {
+			return true
+		}
+	}
+	return false
+}
+
+// Title returns the display name of the tunnel, or its name if it does not have one.
+func (config *Config) Title() string {
+	if len(config.Metadata.DisplayName) > 0 {
+		return config.Metadata.DisplayName
+	}
+	return config.Name
+}
+
 func (r *IPCidr) String() string {
 	return fmt.Sprintf("%s/%d", r.IP.String(), r.Cidr)
 }
@@ -85,6 +134,15 @@ func (r *IPCidr) IPNet() net.IPNet {
 	}
 }
 
+// Overlaps returns whether the networks r and o have any address in common.
+func (r *IPCidr) Overlaps(o *IPCidr) bool {
+	if r.Bits() != o.Bits() {
+		return false
+	}
+	a, b := r.IPNet(), o.IPNet()
+	return a.Contains(o.IP) || b.Contains(r.IP)
+}
+
 func (r *IPCidr) MaskSelf() {
 	bits := int(r.Bits())
 	mask := net.CIDRMask(int(r.Cidr), bits)
@@ -93,6 +151,15 @@ func (r *IPCidr) MaskSelf() {
 	}
 }
 
+// EffectiveAllowedIPs returns the AllowedIPs of the peer without its DisallowedIPs. If there are no
+// DisallowedIPs, the AllowedIPs are returned as they are.
+func (peer *Peer) EffectiveAllowedIPs() []IPCidr {
+	if len(peer.DisallowedIPs) == 0 {
+		return peer.AllowedIPs
+	}
+	return SubtractIPCidrs(peer.AllowedIPs, peer.DisallowedIPs)
+}
+
 func (e *Endpoint) String() string {
 	if strings.IndexByte(e.Host, ':') > 0 {
 		return fmt.Sprintf("[%s]:%d", e.Host, e.Port)
@@ -244,6 +311,7 @@ func (conf *Config) DeduplicateNetworkEntries() {
 }
 
 func (conf *Config) Redact() {
+	conf.Document = nil
 	conf.Interface.PrivateKey = Key{}
 	for i := range conf.Peers {
 		conf.Peers[i].PublicKey = Key{}
@@ -0,0 +1,97 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.zx2c4.com/wireguard/windows/l18n"
+)
+
+// CounterpartPeer returns the peer that the remote side of the peer at index needs to talk to this
+// configuration: the public key of this configuration, the preshared key of that peer, if there is one,
+// the addresses of this configuration as AllowedIPs, and endpoint, unless it is empty.
+func (conf *Config) CounterpartPeer(index int, endpoint Endpoint) Peer {
+	peer := Peer{
+		PublicKey: *conf.Interface.PrivateKey.Public(),
+		Endpoint:  endpoint,
+	}
+	if index < len(conf.Peers) {
+		peer.PresharedKey = conf.Peers[index].PresharedKey
+	}
+	for _, address := range conf.Interface.Addresses {
+		peer.AllowedIPs = append(peer.AllowedIPs, IPCidr{address.IP, address.Bits()})
+	}
+	return peer
+}
+
+// CounterpartPeers renders the [Peer] section that each peer needs to talk to this configuration, as
+// returned by CounterpartPeer, or the one that a new peer needs if there are none yet. If there are
+// several peers, each section is preceded by a comment that says which peer it is for.
+func (conf *Config) CounterpartPeers(endpoint Endpoint) string {
+	var output strings.Builder
+	for i := 0; i < len(conf.Peers) || i == 0; i++ {
+		if i > 0 {
+			output.WriteString("\n")
+		}
+		if len(conf.Peers) > 1 {
+			output.WriteString(fmt.Sprintf("# %s\n", l18n.Sprintf("For peer %s", conf.Peers[i].PublicKey.String())))
+		}
+		peer := conf.CounterpartPeer(i, endpoint)
+		output.WriteString("[Peer]\n")
+		for _, field := range peer.wgQuickFields() {
+			output.WriteString(fmt.Sprintf("%s = %s\n", field.key, field.value))
+		}
+	}
+	return output.String()
+}
+
+// CounterpartConfig renders a skeleton of the configuration of the peer at index, as a client of this
+// configuration. Its addresses are the AllowedIPs of the peer that are single addresses, and its peer is
+// this configuration, which takes the networks of the addresses of this configuration. As only the
+// client knows its private key, it is left as a comment to be replaced, as is the endpoint, if it is empty
+// and this configuration has a ListenPort.
+func (conf *Config) CounterpartConfig(index int, endpoint Endpoint) string {
+	peer := &conf.Peers[index]
+	var client Interface
+	for _, allowedIP := range peer.AllowedIPs {
+		if allowedIP.Cidr == allowedIP.Bits() {
+			client.Addresses = append(client.Addresses, allowedIP)
+		}
+	}
+	server := Peer{
+		PublicKey:    *conf.Interface.PrivateKey.Public(),
+		PresharedKey: peer.PresharedKey,
+		Endpoint:     endpoint,
+	}
+	for _, address := range conf.Interface.Addresses {
+		network := IPCidr{IP: append(net.IP(nil), address.IP...), Cidr: address.Cidr}
+		if ip4 := network.IP.To4(); ip4 != nil {
+			network.IP = ip4
+		}
+		network.MaskSelf()
+		server.AllowedIPs = append(server.AllowedIPs, network)
+	}
+
+	var output strings.Builder
+	output.WriteString("[Interface]\n")
+	output.WriteString(fmt.Sprintf("# PrivateKey = %s\n", l18n.Sprintf("(the private key whose public key is %s)", peer.PublicKey.String())))
+	for _, field := range client.wgQuickFields() {
+		if field.key != "PrivateKey" {
+			output.WriteString(fmt.Sprintf("%s = %s\n", field.key, field.value))
+		}
+	}
+	output.WriteString("\n[Peer]\n")
+	for _, field := range server.wgQuickFields() {
+		output.WriteString(fmt.Sprintf("%s = %s\n", field.key, field.value))
+	}
+	if endpoint.IsEmpty() && conf.Interface.ListenPort > 0 {
+		output.WriteString(fmt.Sprintf("# Endpoint = %s:%d\n", l18n.Sprintf("(the address of this server)"), conf.Interface.ListenPort))
+	}
+	return output.String()
+}
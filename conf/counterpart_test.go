@@ -0,0 +1,105 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"strings"
+	"testing"
+)
+
+const counterpartServerInput = `[Interface]
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+Address = 10.192.122.1/24, fd00::1/64
+ListenPort = 51820
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+PresharedKey = /UwcSPg38hW/D9Y3tcS1FOV0K1wuURMbS0sesJEP5ak=
+AllowedIPs = 10.192.122.3/32, 10.192.124.0/24, fd00::3/128
+
+[Peer]
+PublicKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+AllowedIPs = 10.192.122.4/32
+`
+
+func TestCounterpartPeers(t *testing.T) {
+	conf, err := FromWgQuick(counterpartServerInput, "server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey := conf.Interface.PrivateKey.Public().String()
+	expected := `# For peer xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+[Peer]
+PublicKey = ` + publicKey + `
+PresharedKey = /UwcSPg38hW/D9Y3tcS1FOV0K1wuURMbS0sesJEP5ak=
+AllowedIPs = 10.192.122.1/32, fd00::1/128
+Endpoint = vpn.example.com:51820
+
+# For peer TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+[Peer]
+PublicKey = ` + publicKey + `
+AllowedIPs = 10.192.122.1/32, fd00::1/128
+Endpoint = vpn.example.com:51820
+`
+	actual := conf.CounterpartPeers(Endpoint{"vpn.example.com", 51820})
+	if actual != expected {
+		t.Errorf("Wrong counterpart peers:\n%s\nexpected:\n%s", actual, expected)
+	}
+
+	conf.Peers = conf.Peers[1:]
+	expected = `[Peer]
+PublicKey = ` + publicKey + `
+AllowedIPs = 10.192.122.1/32, fd00::1/128
+`
+	actual = conf.CounterpartPeers(Endpoint{})
+	if actual != expected {
+		t.Errorf("Wrong counterpart peer:\n%s\nexpected:\n%s", actual, expected)
+	}
+
+	conf.Peers = nil
+	actual = conf.CounterpartPeers(Endpoint{})
+	if actual != expected {
+		t.Errorf("Wrong counterpart peer without peers:\n%s\nexpected:\n%s", actual, expected)
+	}
+}
+
+func TestCounterpartConfig(t *testing.T) {
+	conf, err := FromWgQuick(counterpartServerInput, "server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey := conf.Interface.PrivateKey.Public().String()
+	expected := `[Interface]
+# PrivateKey = (the private key whose public key is xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=)
+Address = 10.192.122.3/32, fd00::3/128
+
+[Peer]
+PublicKey = ` + publicKey + `
+PresharedKey = /UwcSPg38hW/D9Y3tcS1FOV0K1wuURMbS0sesJEP5ak=
+AllowedIPs = 10.192.122.0/24, fd00::/64
+# Endpoint = (the address of this server):51820
+`
+	actual := conf.CounterpartConfig(0, Endpoint{})
+	if actual != expected {
+		t.Errorf("Wrong counterpart configuration:\n%s\nexpected:\n%s", actual, expected)
+	}
+	if conf.Interface.Addresses[0].String() != "10.192.122.1/24" {
+		t.Errorf("The addresses of the configuration were changed: %v", conf.Interface.Addresses)
+	}
+
+	actual = conf.CounterpartConfig(1, Endpoint{"vpn.example.com", 51820})
+	_, diagnostics := Validate(actual, "client")
+	if len(diagnostics) != 1 || !strings.HasPrefix(diagnostics[0].Message, "An interface must have a private key") {
+		t.Errorf("The skeleton does not lack only the private key: %v", diagnostics)
+	}
+	client, err := FromWgQuick("[Interface]\nPrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=\n"+actual[len("[Interface]\n"):], "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(client.Peers) != 1 || client.Peers[0].Endpoint.String() != "vpn.example.com:51820" || len(client.Interface.Addresses) != 1 {
+		t.Errorf("Wrong client configuration: %+v", client)
+	}
+}
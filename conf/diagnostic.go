@@ -0,0 +1,96 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/unicode"
+
+	"golang.zx2c4.com/wireguard/windows/l18n"
+)
+
+type DiagnosticSeverity int
+
+const (
+	DiagnosticError DiagnosticSeverity = iota
+	DiagnosticWarning
+)
+
+// Diagnostic is a problem found while validating a configuration, along with where it occurs. Line and
+// Column are 1-based, with Column counted in characters, and Offset and Length are the byte span in the
+// input. A Line of 0 means that the problem does not pertain to any particular line.
+type Diagnostic struct {
+	Severity DiagnosticSeverity
+	Message  string
+	Line     int
+	Column   int
+	Offset   int
+	Length   int
+
+	err error
+}
+
+func newDiagnostic(s string, severity DiagnosticSeverity, err error, line, start, end int) Diagnostic {
+	d := Diagnostic{Severity: severity, Message: err.Error(), err: err}
+	if line > 0 {
+		lineStart := strings.LastIndexByte(s[:start], '\n') + 1
+		d.Line, d.Column, d.Offset, d.Length = line, utf8.RuneCountInString(s[lineStart:start])+1, start, end-start
+	}
+	return d
+}
+
+func (d *Diagnostic) Error() string {
+	if d.Line == 0 {
+		return d.Message
+	}
+	if d.Severity == DiagnosticWarning {
+		return l18n.Sprintf("Line %d, column %d: warning: %s", d.Line, d.Column, d.Message)
+	}
+	return l18n.Sprintf("Line %d, column %d: %s", d.Line, d.Column, d.Message)
+}
+
+// Unwrap returns the underlying error, which is usually a *ParseError. It is not preserved across IPC.
+func (d *Diagnostic) Unwrap() error {
+	return d.err
+}
+
+func firstError(diagnostics []Diagnostic) error {
+	for i := range diagnostics {
+		if diagnostics[i].Severity == DiagnosticError {
+			return diagnostics[i].err
+		}
+	}
+	return nil
+}
+
+// HasErrors reports whether any of the diagnostics is an error rather than a warning.
+func HasErrors(diagnostics []Diagnostic) bool {
+	for i := range diagnostics {
+		if diagnostics[i].Severity == DiagnosticError {
+			return true
+		}
+	}
+	return false
+}
+
+func ValidateWithUnknownEncoding(s string, name string) (*Config, []Diagnostic) {
+	c, firstDiagnostics := Validate(s, name)
+	if !HasErrors(firstDiagnostics) {
+		return c, firstDiagnostics
+	}
+	for _, encoding := range unicode.All {
+		decoded, err := encoding.NewDecoder().String(s)
+		if err == nil {
+			c, diagnostics := Validate(decoded, name)
+			if !HasErrors(diagnostics) {
+				return c, diagnostics
+			}
+		}
+	}
+	return nil, firstDiagnostics
+}
@@ -0,0 +1,130 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"fmt"
+	"strings"
+)
+
+const diffContext = 3
+
+type diffOp struct {
+	kind byte // ' ' for a line in both, '-' for a line only in the old text, '+' for a line only in the new.
+	line string
+	old  int // The number of lines of the old text that come before this one.
+	new  int // The number of lines of the new text that come before this one.
+}
+
+func splitDiffLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffOps returns the shortest edit script that turns a into b, found through their longest common
+// subsequence, with removals ahead of additions where both are possible.
+func diffOps(a, b []string) []diffOp {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i], i, j})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{'-', a[i], i, j})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j], i, j})
+			j++
+		}
+	}
+	return ops
+}
+
+// DiffLines returns a unified diff, with three lines of context, that turns a into b, or an empty
+// string if they are the same.
+func DiffLines(a, b, labelA, labelB string) string {
+	ops := diffOps(splitDiffLines(a), splitDiffLines(b))
+	var output strings.Builder
+	for k := 0; k < len(ops); {
+		if ops[k].kind == ' ' {
+			k++
+			continue
+		}
+		if output.Len() == 0 {
+			output.WriteString(fmt.Sprintf("--- %s\n+++ %s\n", labelA, labelB))
+		}
+		start, end := k-diffContext, k
+		if start < 0 {
+			start = 0
+		}
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			run := 0
+			for end+run < len(ops) && ops[end+run].kind == ' ' {
+				run++
+			}
+			if end+run == len(ops) || run > diffContext*2 {
+				if run > diffContext {
+					run = diffContext
+				}
+				end += run
+				break
+			}
+			end += run
+		}
+
+		oldCount, newCount := 0, 0
+		for _, op := range ops[start:end] {
+			if op.kind != '+' {
+				oldCount++
+			}
+			if op.kind != '-' {
+				newCount++
+			}
+		}
+		oldStart, newStart := ops[start].old, ops[start].new
+		if oldCount > 0 {
+			oldStart++
+		}
+		if newCount > 0 {
+			newStart++
+		}
+		output.WriteString(fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount))
+		for _, op := range ops[start:end] {
+			output.WriteByte(op.kind)
+			output.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				output.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		k = end
+	}
+	return output.String()
+}
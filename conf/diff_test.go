@@ -0,0 +1,36 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	a := "[Interface]\nPrivateKey = a\nAddress = 10.0.0.1/24\n\n[Peer]\nPublicKey = b\nAllowedIPs = 10.0.0.2/32\nEndpoint = 192.0.2.1:51820\n\n[Peer]\nPublicKey = c\nAllowedIPs = 10.0.0.3/32\n"
+	b := "[Interface]\nPrivateKey = a\nAddress = 10.0.0.1/24\nDNS = 10.0.0.53\n\n[Peer]\nPublicKey = b\nAllowedIPs = 10.0.0.2/32\nEndpoint = 192.0.2.1:51820\n\n[Peer]\nPublicKey = c\nAllowedIPs = 10.0.0.4/32"
+	expected := `--- old
++++ new
+@@ -1,6 +1,7 @@
+ [Interface]
+ PrivateKey = a
+ Address = 10.0.0.1/24
++DNS = 10.0.0.53
+ 
+ [Peer]
+ PublicKey = b
+@@ -9,4 +10,4 @@
+ 
+ [Peer]
+ PublicKey = c
+-AllowedIPs = 10.0.0.3/32
++AllowedIPs = 10.0.0.4/32
+\ No newline at end of file
+`
+	equal(t, expected, DiffLines(a, b, "old", "new"))
+	equal(t, "", DiffLines(a, a, "old", "new"))
+	equal(t, "--- old\n+++ new\n@@ -0,0 +1,1 @@\n+x\n", DiffLines("", "x\n", "old", "new"))
+}
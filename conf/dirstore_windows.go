@@ -0,0 +1,258 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.zx2c4.com/wireguard/windows/conf/dpapi"
+)
+
+// directoryStore is the default Store, which keeps each configuration and its metadata in files in the
+// configuration directory, and the revisions of each tunnel in a directory of their own in the history
+// directory.
+type directoryStore struct{}
+
+// dpapiEncrypter is the default Encrypter, which encrypts configurations with DPAPI for the machine.
+type dpapiEncrypter struct{}
+
+func defaultStore() (Store, Encrypter) {
+	return directoryStore{}, dpapiEncrypter{}
+}
+
+func (dpapiEncrypter) Encrypt(data []byte, name string) ([]byte, error) {
+	return dpapi.Encrypt(data, name)
+}
+
+func (dpapiEncrypter) Decrypt(data []byte, name string) ([]byte, error) {
+	return dpapi.Decrypt(data, name)
+}
+
+func (directoryStore) Names() ([]string, error) {
+	configFileDir, err := tunnelConfigurationsDirectory()
+	if err != nil {
+		return nil, err
+	}
+	files, err := os.ReadDir(configFileDir)
+	if err != nil {
+		return nil, err
+	}
+	configs := make([]string, len(files))
+	i := 0
+	for _, file := range files {
+		name := filepath.Base(file.Name())
+		if len(name) <= len(configFileSuffix) || !strings.HasSuffix(name, configFileSuffix) {
+			continue
+		}
+		if !file.Type().IsRegular() {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		if info.Mode().Perm()&0444 == 0 {
+			continue
+		}
+		name = strings.TrimSuffix(name, configFileSuffix)
+		if !TunnelNameIsValid(name) {
+			continue
+		}
+		configs[i] = name
+		i++
+	}
+	return configs[:i], nil
+}
+
+func (directoryStore) path(name string) (string, error) {
+	configFileDir, err := tunnelConfigurationsDirectory()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configFileDir, name+configFileSuffix), nil
+}
+
+func (d directoryStore) Read(name string) ([]byte, time.Time, error) {
+	path, err := d.path(name)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return bytes, info.ModTime(), nil
+}
+
+func (d directoryStore) Write(name string, data []byte, overwrite bool) error {
+	path, err := d.path(name)
+	if err != nil {
+		return err
+	}
+	return writeLockedDownFile(path, overwrite, data)
+}
+
+func (d directoryStore) Delete(name string) error {
+	path, err := d.path(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+func (directoryStore) Lock(name string) (func(), error) {
+	return lockStoreName(name)
+}
+
+func (directoryStore) metadataPath(name string) (string, error) {
+	configFileDir, err := tunnelConfigurationsDirectory()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configFileDir, name+metadataFileSuffix), nil
+}
+
+func (d directoryStore) ReadMetadata(name string) ([]byte, error) {
+	path, err := d.metadataPath(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+func (d directoryStore) WriteMetadata(name string, data []byte) error {
+	path, err := d.metadataPath(name)
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		err = os.Remove(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return writeLockedDownFile(path, true, data)
+}
+
+func (directoryStore) Revisions(name string) ([]string, error) {
+	dir, err := tunnelHistoryDirectory(name)
+	if err != nil {
+		return nil, err
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(files))
+	for _, file := range files {
+		id := strings.TrimSuffix(file.Name(), configFileSuffix)
+		if id != file.Name() && file.Type().IsRegular() {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (directoryStore) ReadRevision(name, id string) ([]byte, error) {
+	dir, err := tunnelHistoryDirectory(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(filepath.Join(dir, id+configFileSuffix))
+}
+
+func (directoryStore) WriteRevision(name, id string, data []byte) error {
+	dir, err := tunnelHistoryDirectory(name)
+	if err != nil {
+		return err
+	}
+	return writeLockedDownFile(filepath.Join(dir, id+configFileSuffix), false, data)
+}
+
+func (directoryStore) DeleteRevision(name, id string) error {
+	dir, err := tunnelHistoryDirectory(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(filepath.Join(dir, id+configFileSuffix))
+}
+
+func (directoryStore) startWatching() {
+	startWatchingConfigDir()
+}
+
+// ReadConfigFile returns the contents of the configuration file at path, which are decrypted if it is
+// encrypted, along with the name of its tunnel. A path in the configuration directory, as the tunnel
+// services are given, is read through the store, like LoadFromName, and other files are read directly.
+func ReadConfigFile(path string) (name string, contents string, err error) {
+	name, err = NameFromPath(path)
+	if err != nil {
+		return
+	}
+	if IsStoredPath(path) {
+		contents, err = readStoredConfig(name)
+		return
+	}
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	if strings.HasSuffix(path, configFileSuffix) {
+		bytes, err = dpapi.Decrypt(bytes, name)
+		if err != nil {
+			return
+		}
+	}
+	contents = string(bytes)
+	return
+}
+
+// IsStoredPath reports whether path is the file in which the default store keeps the configuration of
+// its tunnel, rather than a configuration file elsewhere.
+func IsStoredPath(path string) bool {
+	name, err := NameFromPath(path)
+	if err != nil {
+		return false
+	}
+	storedPath, err := directoryStore{}.path(name)
+	return err == nil && strings.EqualFold(filepath.Clean(path), storedPath)
+}
+
+func LoadFromPath(path string) (*Config, error) {
+	name, contents, err := ReadConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return FromWgQuickWithUnknownEncoding(contents, name)
+}
+
+// ValidatePath reads the configuration at path, like LoadFromPath, and validates it like Validate.
+func ValidatePath(path string) (*Config, []Diagnostic, error) {
+	name, contents, err := ReadConfigFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, diagnostics := ValidateWithUnknownEncoding(contents, name)
+	return c, diagnostics, nil
+}
+
+// Path returns the path of the file in which the default store keeps the configuration, which is
+// where the tunnel service loads it from.
+func (config *Config) Path() (string, error) {
+	if !TunnelNameIsValid(config.Name) {
+		return "", errors.New("Tunnel name is not valid")
+	}
+	return directoryStore{}.path(config.Name)
+}
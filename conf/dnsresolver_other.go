@@ -0,0 +1,37 @@
+// +build !windows
+
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"net"
+)
+
+// The configurations are only resolved by the tunnel services, which run on Windows, so elsewhere,
+// where this package is built for testing and for external consumers, resolving is not retried.
+
+func resolveHostname(name string) (resolvedIPString string, err error) {
+	return resolveHostnameOnce(name)
+}
+
+// ResolveHostnameOnce resolves name to an IP address, preferring IPv4, without retrying on failure.
+func ResolveHostnameOnce(name string) (resolvedIPString string, err error) {
+	return resolveHostnameOnce(name)
+}
+
+func resolveHostnameOnce(name string) (resolvedIPString string, err error) {
+	ips, err := net.LookupIP(name)
+	if err != nil {
+		return
+	}
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			return ip.String(), nil
+		}
+	}
+	return ips[0].String(), nil
+}
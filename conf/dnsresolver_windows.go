@@ -46,6 +46,11 @@ func resolveHostname(name string) (resolvedIPString string, err error) {
 	return
 }
 
+// ResolveHostnameOnce resolves name to an IP address, preferring IPv4, without retrying on failure.
+func ResolveHostnameOnce(name string) (resolvedIPString string, err error) {
+	return resolveHostnameOnce(name)
+}
+
 func resolveHostnameOnce(name string) (resolvedIPString string, err error) {
 	hints := windows.AddrinfoW{
 		Family:   windows.AF_UNSPEC,
@@ -0,0 +1,398 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// Document is a lossless representation of a configuration in wg-quick format. It retains comments,
+// blank lines, and the order, casing, and spacing of keys, so that a document which has not been
+// changed serializes back to exactly the bytes it was parsed from.
+type Document struct {
+	lines []string // Each line includes its terminator, except possibly the last one.
+}
+
+// DocumentSection refers to the nth [Interface] or [Peer] section of a Document.
+type DocumentSection struct {
+	doc   *Document
+	state parserState
+	n     int
+}
+
+type documentLineKind int
+
+const (
+	documentLineBlank documentLineKind = iota
+	documentLineComment
+	documentLineSection
+	documentLineKeyValue
+	documentLineInvalid
+)
+
+type documentLine struct {
+	kind       documentLineKind
+	section    parserState
+	key        string
+	valueStart int
+	valueEnd   int
+}
+
+type documentSectionBounds struct {
+	state  parserState
+	start  int
+	header int
+	end    int
+}
+
+func ParseDocument(s string) *Document {
+	lines := strings.SplitAfter(s, "\n")
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	return &Document{lines}
+}
+
+func (d *Document) String() string {
+	return strings.Join(d.lines, "")
+}
+
+func (d *Document) Clone() *Document {
+	return &Document{append([]string(nil), d.lines...)}
+}
+
+// Config derives a configuration from the document, which is attached to the result.
+func (d *Document) Config(name string) (*Config, error) {
+	return FromWgQuick(d.String(), name)
+}
+
+func (d *Document) GobEncode() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Document) GobDecode(b []byte) error {
+	*d = *ParseDocument(string(b))
+	return nil
+}
+
+func parseDocumentLine(raw string) (line documentLine) {
+	code := strings.TrimSuffix(raw, "\n")
+	pound := strings.IndexByte(code, '#')
+	if pound >= 0 {
+		code = code[:pound]
+	}
+	trimmed := strings.TrimSpace(code)
+	if len(trimmed) == 0 {
+		if pound >= 0 {
+			line.kind = documentLineComment
+		} else {
+			line.kind = documentLineBlank
+		}
+		return
+	}
+	switch strings.ToLower(trimmed) {
+	case "[interface]":
+		line.kind, line.section = documentLineSection, inInterfaceSection
+		return
+	case "[peer]":
+		line.kind, line.section = documentLineSection, inPeerSection
+		return
+	}
+	equals := strings.IndexByte(code, '=')
+	if equals < 0 {
+		line.kind = documentLineInvalid
+		return
+	}
+	line.kind = documentLineKeyValue
+	line.key = strings.ToLower(strings.TrimSpace(code[:equals]))
+	rest := code[equals+1:]
+	line.valueStart = equals + 1 + len(rest) - len(strings.TrimLeftFunc(rest, unicode.IsSpace))
+	line.valueEnd = equals + 1 + len(strings.TrimRightFunc(rest, unicode.IsSpace))
+	if line.valueEnd < line.valueStart {
+		line.valueEnd = line.valueStart
+	}
+	return
+}
+
+func (d *Document) lineTerminator() string {
+	for _, line := range d.lines {
+		if strings.HasSuffix(line, "\r\n") {
+			return "\r\n"
+		}
+	}
+	return "\n"
+}
+
+// sections returns the bounds of each section. A section begins with the comment lines immediately
+// preceding its header, so that annotations above a section stay with it, and ends where the next
+// section begins.
+func (d *Document) sections() []documentSectionBounds {
+	var sections []documentSectionBounds
+	for i, raw := range d.lines {
+		line := parseDocumentLine(raw)
+		if line.kind != documentLineSection {
+			continue
+		}
+		start := i
+		for start > 0 && parseDocumentLine(d.lines[start-1]).kind == documentLineComment {
+			start--
+		}
+		if len(sections) > 0 {
+			if start < sections[len(sections)-1].header+1 {
+				start = sections[len(sections)-1].header + 1
+			}
+			sections[len(sections)-1].end = start
+		}
+		sections = append(sections, documentSectionBounds{line.section, start, i, len(d.lines)})
+	}
+	return sections
+}
+
+func (d *Document) sectionsOfType(state parserState) []*DocumentSection {
+	var sections []*DocumentSection
+	for _, bounds := range d.sections() {
+		if bounds.state == state {
+			sections = append(sections, &DocumentSection{d, state, len(sections)})
+		}
+	}
+	return sections
+}
+
+// Interface returns the first [Interface] section, or nil if there is none.
+func (d *Document) Interface() *DocumentSection {
+	sections := d.sectionsOfType(inInterfaceSection)
+	if len(sections) == 0 {
+		return nil
+	}
+	return sections[0]
+}
+
+func (d *Document) Peers() []*DocumentSection {
+	return d.sectionsOfType(inPeerSection)
+}
+
+// Peer returns the first [Peer] section with the given public key, or nil if there is none.
+func (d *Document) Peer(publicKey *Key) *DocumentSection {
+	for _, peer := range d.Peers() {
+		val, ok := peer.Get("PublicKey")
+		if !ok {
+			continue
+		}
+		k, err := parseKeyBase64(val)
+		if err == nil && *k == *publicKey {
+			return peer
+		}
+	}
+	return nil
+}
+
+// AddPeer appends an empty [Peer] section to the end of the document.
+func (d *Document) AddPeer() *DocumentSection {
+	eol := d.lineTerminator()
+	if len(d.lines) > 0 {
+		last := d.lines[len(d.lines)-1]
+		if !strings.HasSuffix(last, "\n") {
+			d.lines[len(d.lines)-1] = last + eol
+		}
+		if parseDocumentLine(d.lines[len(d.lines)-1]).kind != documentLineBlank {
+			d.lines = append(d.lines, eol)
+		}
+	}
+	d.lines = append(d.lines, "[Peer]"+eol)
+	return &DocumentSection{d, inPeerSection, len(d.Peers()) - 1}
+}
+
+func (s *DocumentSection) bounds() (documentSectionBounds, bool) {
+	n := 0
+	for _, bounds := range s.doc.sections() {
+		if bounds.state != s.state {
+			continue
+		}
+		if n == s.n {
+			return bounds, true
+		}
+		n++
+	}
+	return documentSectionBounds{}, false
+}
+
+// Get returns the value of the first occurrence of key in the section.
+func (s *DocumentSection) Get(key string) (string, bool) {
+	bounds, ok := s.bounds()
+	if !ok {
+		return "", false
+	}
+	key = strings.ToLower(key)
+	for i := bounds.header + 1; i < bounds.end; i++ {
+		line := parseDocumentLine(s.doc.lines[i])
+		if line.kind == documentLineKeyValue && line.key == key {
+			return s.doc.lines[i][line.valueStart:line.valueEnd], true
+		}
+	}
+	return "", false
+}
+
+// Set replaces the value of the first occurrence of key in the section, keeping its spacing and
+// trailing comment, and removes any further occurrences. If the key is not present, it is added
+// after the last key of the section.
+func (s *DocumentSection) Set(key, value string) {
+	bounds, ok := s.bounds()
+	if !ok {
+		return
+	}
+	lowerKey := strings.ToLower(key)
+	found := false
+	insertAt := bounds.header + 1
+	for i := bounds.header + 1; i < bounds.end; i++ {
+		raw := s.doc.lines[i]
+		line := parseDocumentLine(raw)
+		if line.kind != documentLineKeyValue {
+			continue
+		}
+		if line.key != lowerKey {
+			insertAt = i + 1
+			continue
+		}
+		if found {
+			s.doc.lines = append(s.doc.lines[:i], s.doc.lines[i+1:]...)
+			i--
+			bounds.end--
+			continue
+		}
+		found = true
+		s.doc.lines[i] = raw[:line.valueStart] + value + raw[line.valueEnd:]
+	}
+	if found {
+		return
+	}
+	eol := s.doc.lineTerminator()
+	if !strings.HasSuffix(s.doc.lines[insertAt-1], "\n") {
+		s.doc.lines[insertAt-1] += eol
+	}
+	s.doc.lines = append(s.doc.lines[:insertAt], append([]string{key + " = " + value + eol}, s.doc.lines[insertAt:]...)...)
+}
+
+// Delete removes all occurrences of key from the section.
+func (s *DocumentSection) Delete(key string) {
+	bounds, ok := s.bounds()
+	if !ok {
+		return
+	}
+	key = strings.ToLower(key)
+	for i := bounds.header + 1; i < bounds.end; i++ {
+		line := parseDocumentLine(s.doc.lines[i])
+		if line.kind == documentLineKeyValue && line.key == key {
+			s.doc.lines = append(s.doc.lines[:i], s.doc.lines[i+1:]...)
+			i--
+			bounds.end--
+		}
+	}
+}
+
+// Remove deletes the section from the document, along with the comments immediately preceding it.
+// Other DocumentSections of the same type that come after it then refer to the following section.
+func (s *DocumentSection) Remove() {
+	bounds, ok := s.bounds()
+	if !ok {
+		return
+	}
+	s.doc.lines = append(s.doc.lines[:bounds.start], s.doc.lines[bounds.end:]...)
+}
+
+func applyFields(sections []*DocumentSection, oldFields, newFields []wgQuickField) {
+	oldValues := make(map[string]string, len(oldFields))
+	for _, field := range oldFields {
+		oldValues[strings.ToLower(field.key)] = field.value
+	}
+	newValues := make(map[string]string, len(newFields))
+	for _, field := range newFields {
+		newValues[strings.ToLower(field.key)] = field.value
+	}
+	seen := make(map[string]bool, len(newFields))
+	for _, section := range sections {
+		bounds, ok := section.bounds()
+		if !ok {
+			continue
+		}
+		doc := section.doc
+		for i := bounds.header + 1; i < bounds.end; i++ {
+			raw := doc.lines[i]
+			line := parseDocumentLine(raw)
+			if line.kind != documentLineKeyValue {
+				continue
+			}
+			oldValue, wasPresent := oldValues[line.key]
+			newValue, isPresent := newValues[line.key]
+			changed := !wasPresent || !isPresent || oldValue != newValue
+			if (!isPresent && wasPresent) || (seen[line.key] && changed) {
+				doc.lines = append(doc.lines[:i], doc.lines[i+1:]...)
+				i--
+				bounds.end--
+				continue
+			}
+			if !isPresent {
+				continue
+			}
+			if !seen[line.key] && changed {
+				doc.lines[i] = raw[:line.valueStart] + newValue + raw[line.valueEnd:]
+			}
+			seen[line.key] = true
+		}
+	}
+	for _, field := range newFields {
+		if !seen[strings.ToLower(field.key)] {
+			sections[0].Set(field.key, field.value)
+		}
+	}
+}
+
+// Apply writes the fields of c into the document. Lines whose values are unchanged are left untouched,
+// changed values are replaced in place, peers are matched by public key, removed peers are deleted along
+// with their comments, and new peers are appended.
+func (d *Document) Apply(c *Config) error {
+	current, diagnostics := fromWgQuick(d.String(), c.Name)
+	if err := firstError(diagnostics); err != nil {
+		return err
+	}
+	interfaces := d.sectionsOfType(inInterfaceSection)
+	peers := d.Peers()
+	if len(interfaces) == 0 || len(peers) != len(current.Peers) {
+		return errors.New("Document sections do not match its configuration")
+	}
+
+	applyFields(interfaces, current.Interface.wgQuickFields(), c.Interface.wgQuickFields())
+
+	used := make([]bool, len(c.Peers))
+	matched := make([]bool, len(peers))
+	for i := range peers {
+		for j := range c.Peers {
+			if used[j] || c.Peers[j].PublicKey != current.Peers[i].PublicKey {
+				continue
+			}
+			used[j] = true
+			matched[i] = true
+			applyFields(peers[i:i+1], current.Peers[i].wgQuickFields(), c.Peers[j].wgQuickFields())
+			break
+		}
+	}
+	for i := len(peers) - 1; i >= 0; i-- {
+		if !matched[i] {
+			peers[i].Remove()
+		}
+	}
+	for j := range c.Peers {
+		if used[j] {
+			continue
+		}
+		peer := d.AddPeer()
+		for _, field := range c.Peers[j].wgQuickFields() {
+			peer.Set(field.key, field.value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"bytes"
+	"encoding/gob"
+	"strings"
+	"testing"
+)
+
+const testDocumentInput = `# Site-to-site link, managed by netops
+[Interface]
+privatekey=yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+Address = 10.192.122.1/24
+Address = 10.10.0.1/16   # legacy range
+ListenPort = 51820
+
+# owner: netops
+[Peer]
+PublicKey   =   xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+Endpoint = 192.95.5.67:1234
+AllowedIPs = 10.192.122.3/32, 10.192.124.1/24
+
+[Peer]
+# owner: helpdesk
+PublicKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+AllowedIPs = 10.192.122.4/32
+PersistentKeepalive = off
+`
+
+func TestDocumentRoundTrip(t *testing.T) {
+	for _, input := range []string{testDocumentInput, testInput, strings.ReplaceAll(testDocumentInput, "\n", "\r\n"), strings.TrimSuffix(testDocumentInput, "\n"), ""} {
+		equal(t, input, ParseDocument(input).String())
+	}
+	conf, err := FromWgQuick(testDocumentInput, "test")
+	if noError(t, err) {
+		equal(t, testDocumentInput, conf.ToWgQuick())
+	}
+}
+
+func TestDocumentApply(t *testing.T) {
+	conf, err := FromWgQuick(testDocumentInput, "test")
+	if !noError(t, err) {
+		return
+	}
+	conf.Interface.ListenPort = 51821
+	conf.Interface.MTU = 1420
+	conf.Peers[0].PersistentKeepalive = 25
+	conf.Peers = conf.Peers[:1]
+	psk, _ := NewPresharedKey()
+	conf.Peers = append(conf.Peers, Peer{PublicKey: *psk, AllowedIPs: []IPCidr{{IP: []byte{10, 0, 0, 2}, Cidr: 32}}})
+	expected := `# Site-to-site link, managed by netops
+[Interface]
+privatekey=yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+Address = 10.192.122.1/24
+Address = 10.10.0.1/16   # legacy range
+ListenPort = 51821
+MTU = 1420
+
+# owner: netops
+[Peer]
+PublicKey   =   xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+Endpoint = 192.95.5.67:1234
+AllowedIPs = 10.192.122.3/32, 10.192.124.1/24
+PersistentKeepalive = 25
+
+[Peer]
+PublicKey = ` + psk.String() + `
+AllowedIPs = 10.0.0.2/32
+`
+	equal(t, expected, conf.ToWgQuick())
+	equal(t, testDocumentInput, conf.Document.String())
+	noError(t, conf.Document.Apply(conf))
+	equal(t, expected, conf.Document.String())
+
+	conf.Interface.Addresses = conf.Interface.Addresses[:1]
+	noError(t, conf.Document.Apply(conf))
+	equal(t, strings.Replace(expected, "Address = 10.192.122.1/24\nAddress = 10.10.0.1/16   # legacy range\n", "Address = 10.192.122.1/24\n", 1), conf.Document.String())
+}
+
+func TestDocumentSections(t *testing.T) {
+	doc := ParseDocument(strings.ReplaceAll(testDocumentInput, "\n", "\r\n"))
+	iface := doc.Interface()
+	val, ok := iface.Get("PRIVATEKEY")
+	equal(t, true, ok)
+	equal(t, "yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=", val)
+	iface.Set("Address", "192.168.0.1/24")
+	iface.Delete("ListenPort")
+	k, _ := parseKeyBase64("TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=")
+	doc.Peer(k).Remove()
+	lenTest(t, doc.Peers(), 1)
+	doc.AddPeer().Set("PublicKey", "gN65BkIKy1eCE9pP1wdc8ROUtkHLF2PfAqYdyYBz6EA=")
+	expected := `# Site-to-site link, managed by netops
+[Interface]
+privatekey=yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+Address = 192.168.0.1/24
+
+# owner: netops
+[Peer]
+PublicKey   =   xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+Endpoint = 192.95.5.67:1234
+AllowedIPs = 10.192.122.3/32, 10.192.124.1/24
+
+[Peer]
+PublicKey = gN65BkIKy1eCE9pP1wdc8ROUtkHLF2PfAqYdyYBz6EA=
+`
+	equal(t, strings.ReplaceAll(expected, "\n", "\r\n"), doc.String())
+	conf, err := doc.Config("test")
+	if noError(t, err) {
+		lenTest(t, conf.Interface.Addresses, 1)
+		lenTest(t, conf.Peers, 2)
+	}
+}
+
+func TestDocumentGob(t *testing.T) {
+	conf, err := FromWgQuick(testDocumentInput, "test")
+	if !noError(t, err) {
+		return
+	}
+	var buf bytes.Buffer
+	noError(t, gob.NewEncoder(&buf).Encode(conf))
+	var decoded Config
+	noError(t, gob.NewDecoder(&buf).Decode(&decoded))
+	equal(t, testDocumentInput, decoded.ToWgQuick())
+}
@@ -0,0 +1,200 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRevisions is the number of revisions that are kept of each tunnel, including the current one.
+const maxRevisions = 20
+
+// Revision is a saved version of the configuration of a tunnel. Every save of a configuration adds a
+// revision, encrypted like the configuration itself, and the newest one is what is currently stored.
+// The history of a tunnel outlives its deletion, so that a deleted tunnel can be restored as well.
+// Revisions are ordered by their IDs, which are sequence numbers, rather than by when they were
+// saved, as the clock may go backwards.
+type Revision struct {
+	ID   string
+	Time time.Time
+	User string
+}
+
+func revisionID(sequence int64) string {
+	return fmt.Sprintf("%019d", sequence)
+}
+
+// revisionIDs returns the revisions of a tunnel, newest first.
+func revisionIDs(s Store, name string) ([]string, error) {
+	all, err := s.Revisions(name)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(all))
+	for _, id := range all {
+		if _, err := strconv.ParseInt(id, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+	return ids, nil
+}
+
+// recordRevision adds contents, which was just written, as the newest revision of a tunnel, and
+// removes the revisions beyond maxRevisions. If the tunnel has no history yet, previous, the encrypted
+// configuration that was overwritten, if any, is recorded first, so that it is not lost to the save.
+// It must be called with the store locked.
+func recordRevision(name, contents, user string, previous []byte, previousModified time.Time) error {
+	s, e := currentStore()
+	ids, err := revisionIDs(s, name)
+	if err != nil {
+		return err
+	}
+	write := func(when time.Time, user, contents string) error {
+		bytes, err := e.Encrypt([]byte(fmt.Sprintf("%s\n%d\n%s", user, when.UnixNano(), contents)), name)
+		if err != nil {
+			return err
+		}
+		sequence := int64(1)
+		if len(ids) > 0 {
+			newest, _ := strconv.ParseInt(ids[0], 10, 64)
+			sequence = newest + 1
+		}
+		id := revisionID(sequence)
+		err = s.WriteRevision(name, id, bytes)
+		if err != nil {
+			return err
+		}
+		ids = append([]string{id}, ids...)
+		return nil
+	}
+	if len(ids) == 0 && previous != nil {
+		previous, err = e.Decrypt(previous, name)
+		if err == nil {
+			err = write(previousModified, "", string(previous))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	err = write(time.Now(), user, contents)
+	if err != nil {
+		return err
+	}
+	for len(ids) > maxRevisions {
+		s.DeleteRevision(name, ids[len(ids)-1])
+		ids = ids[:len(ids)-1]
+	}
+	return nil
+}
+
+// readRevision returns a revision of a tunnel, which is stored as the user who saved it, when it was
+// saved in nanoseconds since the epoch, and the configuration, each on lines of their own.
+func readRevision(name, id string) (revision Revision, contents string, err error) {
+	_, err = strconv.ParseInt(id, 10, 64)
+	if err != nil || !TunnelNameIsValid(name) {
+		err = errors.New("Revision does not exist")
+		return
+	}
+	s, e := currentStore()
+	bytes, err := s.ReadRevision(name, id)
+	if err != nil {
+		return
+	}
+	bytes, err = e.Decrypt(bytes, name)
+	if err != nil {
+		return
+	}
+	fields := strings.SplitN(string(bytes), "\n", 3)
+	if len(fields) != 3 {
+		err = errors.New("Revision is corrupt")
+		return
+	}
+	nanoseconds, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		err = errors.New("Revision is corrupt")
+		return
+	}
+	revision.ID, revision.Time, revision.User = id, time.Unix(0, nanoseconds), fields[0]
+	contents = fields[2]
+	return
+}
+
+// ListRevisions returns the revisions of the tunnel with the given name, newest first.
+func ListRevisions(name string) ([]Revision, error) {
+	if !TunnelNameIsValid(name) {
+		return nil, errors.New("Tunnel name is not valid")
+	}
+	s, _ := currentStore()
+	ids, err := revisionIDs(s, name)
+	if err != nil {
+		return nil, err
+	}
+	revisions := make([]Revision, 0, len(ids))
+	for _, id := range ids {
+		revision, _, err := readRevision(name, id)
+		if err != nil {
+			continue
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, nil
+}
+
+// LoadRevision returns the configuration of a tunnel as it was saved in the given revision.
+func LoadRevision(name, id string) (*Config, error) {
+	_, contents, err := readRevision(name, id)
+	if err != nil {
+		return nil, err
+	}
+	return FromWgQuickWithUnknownEncoding(contents, name)
+}
+
+// DiffRevisions returns a unified diff from one revision of a tunnel to another.
+func DiffRevisions(name, fromID, toID string) (string, error) {
+	from, fromContents, err := readRevision(name, fromID)
+	if err != nil {
+		return "", err
+	}
+	to, toContents, err := readRevision(name, toID)
+	if err != nil {
+		return "", err
+	}
+	label := func(revision Revision) string {
+		return fmt.Sprintf("%s\t%s", revision.ID, revision.Time.Format(time.RFC3339))
+	}
+	return DiffLines(fromContents, toContents, label(from), label(to)), nil
+}
+
+// RollbackToRevision stores the configuration of a tunnel as it was saved in the given revision,
+// replacing the current one atomically, and recording the rollback as a new revision by user.
+func RollbackToRevision(name, id, user string) (*Config, error) {
+	config, err := LoadRevision(name, id)
+	if err != nil {
+		return nil, err
+	}
+	s, _ := currentStore()
+	unlock, err := s.Lock(name)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	// Revisions are of the configuration alone, so the metadata stays as it is.
+	config.Metadata, err = readMetadata(name)
+	if err != nil {
+		return nil, err
+	}
+	err = config.save(true, user)
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
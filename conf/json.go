@@ -0,0 +1,341 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"golang.zx2c4.com/wireguard/windows/l18n"
+)
+
+// jsonConfig is the JSON representation of a configuration. It mirrors the wg-quick format: the
+// names are those of the wg-quick keys, keys are base64 strings, addresses and networks are strings
+// in CIDR notation, lists are arrays, and numbers are numbers. Empty fields are omitted. For example:
+//
+//	{
+//	  "Interface": {
+//	    "PrivateKey": "yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=",
+//	    "Address": ["10.192.122.1/24"],
+//	    "DNS": ["10.192.122.1", "example.com"],
+//	    "Table": "off"
+//	  },
+//	  "Peers": [
+//	    {
+//	      "PublicKey": "xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=",
+//	      "AllowedIPs": ["0.0.0.0/0"],
+//	      "Endpoint": "192.95.5.67:1234",
+//	      "PersistentKeepalive": 25
+//	    }
+//	  ]
+//	}
+//
+// The name of the tunnel is not part of the representation; like that of a .conf file, it comes from
+// the file name. The display name, tags, and folder are, although they are kept in the metadata of the
+// tunnel rather than in its configuration, so that they survive a trip through a bundle.
+type jsonConfig struct {
+	Interface jsonInterface `json:"Interface"`
+	Peers     []jsonPeer    `json:"Peers,omitempty"`
+}
+
+type jsonInterface struct {
+	DisplayName string   `json:"DisplayName,omitempty"`
+	Tags        []string `json:"Tags,omitempty"`
+	Folder      string   `json:"Folder,omitempty"`
+	PrivateKey  string   `json:"PrivateKey"`
+	ListenPort  int      `json:"ListenPort,omitempty"`
+	Address     []string `json:"Address,omitempty"`
+	DNS         []string `json:"DNS,omitempty"`
+	DNSMatch    []string `json:"DNSMatch,omitempty"`
+	DoHTemplate string   `json:"DNSOverHTTPS,omitempty"`
+	DoTName     string   `json:"DNSOverTLS,omitempty"`
+	MTU         int      `json:"MTU,omitempty"`
+	IPv4MTU     int      `json:"IPv4MTU,omitempty"`
+	IPv6MTU     int      `json:"IPv6MTU,omitempty"`
+	Table       string   `json:"Table,omitempty"`
+	SaveConfig  bool     `json:"SaveConfig,omitempty"`
+	PreUp       string   `json:"PreUp,omitempty"`
+	PostUp      string   `json:"PostUp,omitempty"`
+	PreDown     string   `json:"PreDown,omitempty"`
+	PostDown    string   `json:"PostDown,omitempty"`
+}
+
+type jsonPeer struct {
+	PublicKey           string   `json:"PublicKey"`
+	PresharedKey        string   `json:"PresharedKey,omitempty"`
+	AllowedIPs          []string `json:"AllowedIPs,omitempty"`
+	DisallowedIPs       []string `json:"DisallowedIPs,omitempty"`
+	Endpoint            string   `json:"Endpoint,omitempty"`
+	BackupEndpoints     []string `json:"BackupEndpoints,omitempty"`
+	PersistentKeepalive int      `json:"PersistentKeepalive,omitempty"`
+}
+
+func parseIPCidrList(list []string) ([]IPCidr, error) {
+	var cidrs []IPCidr
+	for _, s := range list {
+		cidr, err := parseIPCidr(s)
+		if err != nil {
+			return nil, err
+		}
+		cidrs = append(cidrs, *cidr)
+	}
+	return cidrs, nil
+}
+
+// JSONError is returned for input that is not JSON of the expected shape, and wraps the error of
+// the decoder.
+type JSONError struct {
+	Err error
+}
+
+func (e *JSONError) Error() string {
+	return fmt.Sprintf("%s: %v", l18n.Sprintf("Invalid JSON"), e.Err)
+}
+
+func (e *JSONError) Unwrap() error {
+	return e.Err
+}
+
+// FromJSON parses a configuration in the JSON representation described by jsonConfig, applying the
+// same checks as FromWgQuick. Unknown keys are rejected.
+func FromJSON(s string, name string) (*Config, error) {
+	if !TunnelNameIsValid(name) {
+		return nil, &ParseError{l18n.Sprintf("Tunnel name is not valid"), name}
+	}
+	var j jsonConfig
+	decoder := json.NewDecoder(bytes.NewReader([]byte(s)))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&j)
+	if err == nil && decoder.More() {
+		err = errors.New(l18n.Sprintf("unexpected data after the configuration"))
+	}
+	if err != nil {
+		return nil, &JSONError{err}
+	}
+
+	conf := Config{Name: name}
+	if len(j.Interface.DisplayName) > 0 {
+		conf.Metadata.DisplayName, err = parseDisplayName(j.Interface.DisplayName)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, tag := range j.Interface.Tags {
+		t, err := parseTag(strings.TrimSpace(tag))
+		if err != nil {
+			return nil, err
+		}
+		if !conf.Metadata.HasTag(t) {
+			conf.Metadata.Tags = append(conf.Metadata.Tags, t)
+		}
+	}
+	if len(j.Interface.Folder) > 0 {
+		conf.Metadata.Folder, err = parseFolder(j.Interface.Folder)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(j.Interface.PrivateKey) == 0 {
+		return nil, &ParseError{l18n.Sprintf("An interface must have a private key"), l18n.Sprintf("[none specified]")}
+	}
+	k, err := parseKeyBase64(j.Interface.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	conf.Interface.PrivateKey = *k
+	if j.Interface.ListenPort != 0 {
+		conf.Interface.ListenPort, err = parsePort(strconv.Itoa(j.Interface.ListenPort))
+		if err != nil {
+			return nil, err
+		}
+	}
+	conf.Interface.Addresses, err = parseIPCidrList(j.Interface.Address)
+	if err != nil {
+		return nil, err
+	}
+	for _, address := range j.Interface.DNS {
+		a := net.ParseIP(address)
+		if a == nil {
+			conf.Interface.DNSSearch = append(conf.Interface.DNSSearch, address)
+		} else {
+			conf.Interface.DNS = append(conf.Interface.DNS, a)
+		}
+	}
+	for _, domain := range j.Interface.DNSMatch {
+		d, err := parseDNSMatchDomain(domain)
+		if err != nil {
+			return nil, err
+		}
+		conf.Interface.DNSMatch = append(conf.Interface.DNSMatch, d)
+	}
+	if len(j.Interface.DoHTemplate) > 0 {
+		conf.Interface.DoHTemplate, err = parseDoHTemplate(j.Interface.DoHTemplate)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(j.Interface.DoTName) > 0 {
+		conf.Interface.DoTName, err = parseDoTName(j.Interface.DoTName)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(conf.Interface.DoHTemplate) > 0 && len(conf.Interface.DoTName) > 0 {
+		return nil, &ParseError{l18n.Sprintf("DNS servers cannot be queried over both HTTPS and TLS"), conf.Interface.DoTName}
+	}
+	if j.Interface.MTU != 0 {
+		conf.Interface.MTU, err = parseMTU(strconv.Itoa(j.Interface.MTU))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if j.Interface.IPv4MTU != 0 {
+		conf.Interface.IPv4MTU, err = parseMTU(strconv.Itoa(j.Interface.IPv4MTU))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if j.Interface.IPv6MTU != 0 {
+		conf.Interface.IPv6MTU, err = parseMTU(strconv.Itoa(j.Interface.IPv6MTU))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(j.Interface.Table) > 0 {
+		conf.Interface.TableOff, conf.Interface.TableMetric, err = parseTable(j.Interface.Table)
+		if err != nil {
+			return nil, err
+		}
+	}
+	conf.Interface.SaveConfig = j.Interface.SaveConfig
+	conf.Interface.PreUp = j.Interface.PreUp
+	conf.Interface.PostUp = j.Interface.PostUp
+	conf.Interface.PreDown = j.Interface.PreDown
+	conf.Interface.PostDown = j.Interface.PostDown
+
+	for _, p := range j.Peers {
+		var peer Peer
+		if len(p.PublicKey) == 0 {
+			return nil, &ParseError{l18n.Sprintf("All peers must have public keys"), l18n.Sprintf("[none specified]")}
+		}
+		k, err := parseKeyBase64(p.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		peer.PublicKey = *k
+		if len(p.PresharedKey) > 0 {
+			k, err = parseKeyBase64(p.PresharedKey)
+			if err != nil {
+				return nil, err
+			}
+			peer.PresharedKey = *k
+		}
+		peer.AllowedIPs, err = parseIPCidrList(p.AllowedIPs)
+		if err != nil {
+			return nil, err
+		}
+		peer.DisallowedIPs, err = parseIPCidrList(p.DisallowedIPs)
+		if err != nil {
+			return nil, err
+		}
+		if len(p.Endpoint) > 0 {
+			e, err := parseEndpoint(p.Endpoint)
+			if err != nil {
+				return nil, err
+			}
+			peer.Endpoint = *e
+		}
+		for _, endpoint := range p.BackupEndpoints {
+			if peer.Endpoint.IsEmpty() {
+				return nil, &ParseError{l18n.Sprintf("Backup endpoints require an endpoint"), endpoint}
+			}
+			e, err := parseEndpoint(endpoint)
+			if err != nil {
+				return nil, err
+			}
+			if peer.HasEndpoint(*e) {
+				return nil, &ParseError{l18n.Sprintf("Endpoint is listed more than once"), endpoint}
+			}
+			peer.BackupEndpoints = append(peer.BackupEndpoints, *e)
+		}
+		if p.PersistentKeepalive != 0 {
+			peer.PersistentKeepalive, err = parsePersistentKeepalive(strconv.Itoa(p.PersistentKeepalive))
+			if err != nil {
+				return nil, err
+			}
+		}
+		conf.Peers = append(conf.Peers, peer)
+	}
+	return &conf, nil
+}
+
+func ipCidrStrings(cidrs []IPCidr) []string {
+	var s []string
+	for i := range cidrs {
+		s = append(s, cidrs[i].String())
+	}
+	return s
+}
+
+// ToJSON renders the configuration in the JSON representation described by jsonConfig.
+func (conf *Config) ToJSON() string {
+	j := jsonConfig{
+		Interface: jsonInterface{
+			DisplayName: conf.Metadata.DisplayName,
+			Tags:        conf.Metadata.Tags,
+			Folder:      conf.Metadata.Folder,
+			PrivateKey:  conf.Interface.PrivateKey.String(),
+			ListenPort:  int(conf.Interface.ListenPort),
+			Address:     ipCidrStrings(conf.Interface.Addresses),
+			DNSMatch:    conf.Interface.DNSMatch,
+			DoHTemplate: conf.Interface.DoHTemplate,
+			DoTName:     conf.Interface.DoTName,
+			MTU:         int(conf.Interface.MTU),
+			IPv4MTU:     int(conf.Interface.IPv4MTU),
+			IPv6MTU:     int(conf.Interface.IPv6MTU),
+			SaveConfig:  conf.Interface.SaveConfig,
+			PreUp:       conf.Interface.PreUp,
+			PostUp:      conf.Interface.PostUp,
+			PreDown:     conf.Interface.PreDown,
+			PostDown:    conf.Interface.PostDown,
+		},
+	}
+	for _, address := range conf.Interface.DNS {
+		j.Interface.DNS = append(j.Interface.DNS, address.String())
+	}
+	j.Interface.DNS = append(j.Interface.DNS, conf.Interface.DNSSearch...)
+	if conf.Interface.TableOff {
+		j.Interface.Table = "off"
+	} else if conf.Interface.TableMetric > 0 {
+		j.Interface.Table = fmt.Sprintf("%d", conf.Interface.TableMetric)
+	}
+	for i := range conf.Peers {
+		peer := &conf.Peers[i]
+		p := jsonPeer{
+			PublicKey:           peer.PublicKey.String(),
+			AllowedIPs:          ipCidrStrings(peer.AllowedIPs),
+			DisallowedIPs:       ipCidrStrings(peer.DisallowedIPs),
+			PersistentKeepalive: int(peer.PersistentKeepalive),
+		}
+		if !peer.PresharedKey.IsZero() {
+			p.PresharedKey = peer.PresharedKey.String()
+		}
+		if !peer.Endpoint.IsEmpty() {
+			p.Endpoint = peer.Endpoint.String()
+		}
+		for _, endpoint := range peer.BackupEndpoints {
+			p.BackupEndpoints = append(p.BackupEndpoints, endpoint.String())
+		}
+		j.Peers = append(j.Peers, p)
+	}
+	b, _ := json.MarshalIndent(&j, "", "  ")
+	return string(b) + "\n"
+}
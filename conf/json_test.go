@@ -0,0 +1,115 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testJSONInput = `{
+  "Interface": {
+    "PrivateKey": "yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=",
+    "ListenPort": 51820,
+    "Address": [
+      "10.192.122.1/24",
+      "fd00::1/64"
+    ],
+    "DNS": [
+      "10.192.122.1",
+      "example.com"
+    ],
+    "MTU": 1420,
+    "Table": "off",
+    "PostUp": "echo up"
+  },
+  "Peers": [
+    {
+      "PublicKey": "xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=",
+      "PresharedKey": "TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=",
+      "AllowedIPs": [
+        "0.0.0.0/0"
+      ],
+      "DisallowedIPs": [
+        "192.168.0.0/16"
+      ],
+      "Endpoint": "[2607:5300:60:6b0::c05f:543]:2468",
+      "PersistentKeepalive": 25
+    },
+    {
+      "PublicKey": "gN65BkIKy1eCE9pP1wdc8ROUtkHLF2PfAqYdyYBz6EA=",
+      "AllowedIPs": [
+        "10.10.10.230/32"
+      ],
+      "Endpoint": "test.wireguard.com:18981"
+    }
+  ]
+}
+`
+
+func TestJSONRoundTrip(t *testing.T) {
+	fromJSON, err := FromJSON(testJSONInput, "test")
+	if !noError(t, err) {
+		return
+	}
+	equal(t, testJSONInput, fromJSON.ToJSON())
+
+	fromWgQuick, err := FromWgQuick(fromJSON.ToWgQuick(), "test")
+	if !noError(t, err) {
+		return
+	}
+	fromWgQuick.Document = nil
+	equal(t, fromJSON, fromWgQuick)
+	equal(t, testJSONInput, fromWgQuick.ToJSON())
+
+	fromWgQuick, err = FromWgQuick(testInput, "test")
+	if !noError(t, err) {
+		return
+	}
+	fromJSON, err = FromJSON(fromWgQuick.ToJSON(), "test")
+	if !noError(t, err) {
+		return
+	}
+	fromWgQuick.Document = nil
+	equal(t, fromWgQuick, fromJSON)
+}
+
+func TestFromJSONErrors(t *testing.T) {
+	for _, tt := range []struct{ from, to string }{
+		{`"PrivateKey": "yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk="`, `"PrivateKey": "yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBm="`},
+		{`"PrivateKey": "yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk="`, `"PrivateKey": ""`},
+		{`"ListenPort": 51820`, `"ListenPort": 65536`},
+		{`"MTU": 1420`, `"MTU": 100`},
+		{`"Table": "off"`, `"Table": "main"`},
+		{`"Table": "off"`, `"Tabel": "off"`},
+		{`"fd00::1/64"`, `"fd00::1/129"`},
+		{`"PublicKey": "gN65BkIKy1eCE9pP1wdc8ROUtkHLF2PfAqYdyYBz6EA="`, `"PublicKey": ""`},
+		{`"Endpoint": "test.wireguard.com:18981"`, `"Endpoint": "test.wireguard.com"`},
+		{`"PersistentKeepalive": 25`, `"PersistentKeepalive": -1`},
+		{"  ]\n}\n", "  ]\n}\n{}\n"},
+	} {
+		input := strings.Replace(testJSONInput, tt.from, tt.to, 1)
+		if input == testJSONInput {
+			t.Fatalf("Replacement of %s did not apply", tt.from)
+		}
+		_, err := FromJSON(input, "test")
+		if err == nil {
+			t.Errorf("Error was expected for %s", tt.to)
+		}
+	}
+	_, err := FromJSON(testJSONInput, "invalid name")
+	if err == nil {
+		t.Error("Error was expected for invalid name")
+	}
+	_, err = FromJSON("{]", "test")
+	var jsonErr *JSONError
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &jsonErr) || !errors.As(err, &syntaxErr) {
+		t.Errorf("Invalid JSON was not reported as a JSONError wrapping the error of the decoder: %#v", err)
+	}
+}
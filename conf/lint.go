@@ -0,0 +1,149 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"golang.zx2c4.com/wireguard/windows/l18n"
+)
+
+// LintID identifies the kind of a LintFinding. The values are stable, so that they may be matched on
+// or suppressed by tools that check configurations.
+type LintID string
+
+const (
+	LintOverlappingAllowedIPs   LintID = "overlapping-allowed-ips"
+	LintDuplicatePeer           LintID = "duplicate-peer"
+	LintPeerIsSelf              LintID = "peer-is-self"
+	LintAddressNotAllowed       LintID = "address-not-allowed"
+	LintMTUTooSmallForIPv6      LintID = "mtu-too-small-for-ipv6"
+	LintReusedPresharedKey      LintID = "reused-preshared-key"
+	LintFullTunnelWithoutDNS    LintID = "full-tunnel-without-dns"
+	LintDNSMatchWithoutDNS      LintID = "dns-match-without-dns"
+	LintEncryptedDNSWithoutDNS  LintID = "encrypted-dns-without-dns"
+	LintBackupsWithoutKeepalive LintID = "backups-without-keepalive"
+)
+
+// LintFinding is a problem with a configuration that is syntactically valid. Peers holds the indices
+// of the peers involved, if any.
+type LintFinding struct {
+	ID       LintID
+	Severity DiagnosticSeverity
+	Message  string
+	Peers    []int
+}
+
+func (f *LintFinding) String() string {
+	if f.Severity == DiagnosticWarning {
+		return l18n.Sprintf("warning: %s [%s]", f.Message, f.ID)
+	}
+	return l18n.Sprintf("%s [%s]", f.Message, f.ID)
+}
+
+func (r *IPCidr) sameNetwork(o *IPCidr) bool {
+	return r.Cidr == o.Cidr && r.Overlaps(o)
+}
+
+const minimumIPv6MTU = 1280
+
+// Lint looks for configurations that are valid but likely mistaken or dangerous, such as peers that
+// compete for the same addresses.
+func Lint(c *Config) []LintFinding {
+	var findings []LintFinding
+	add := func(id LintID, severity DiagnosticSeverity, message string, peers ...int) {
+		findings = append(findings, LintFinding{id, severity, message, peers})
+	}
+
+	if !c.Interface.PrivateKey.IsZero() {
+		publicKey := c.Interface.PrivateKey.Public()
+		for i := range c.Peers {
+			if c.Peers[i].PublicKey == *publicKey {
+				add(LintPeerIsSelf, DiagnosticError, l18n.Sprintf("Peer %d has the public key of this interface", i+1), i)
+			}
+		}
+	}
+
+	allowedIPs := make([][]IPCidr, len(c.Peers))
+	for i := range c.Peers {
+		allowedIPs[i] = c.Peers[i].EffectiveAllowedIPs()
+	}
+
+	for i := range c.Peers {
+		for j := i + 1; j < len(c.Peers); j++ {
+			if c.Peers[i].PublicKey == c.Peers[j].PublicKey {
+				add(LintDuplicatePeer, DiagnosticError, l18n.Sprintf("Peers %d and %d have the same public key", i+1, j+1), i, j)
+			}
+			if !c.Peers[i].PresharedKey.IsZero() && c.Peers[i].PresharedKey == c.Peers[j].PresharedKey {
+				add(LintReusedPresharedKey, DiagnosticWarning, l18n.Sprintf("Peers %d and %d have the same preshared key", i+1, j+1), i, j)
+			}
+			for k := range allowedIPs[i] {
+				for l := range allowedIPs[j] {
+					a, b := &allowedIPs[i][k], &allowedIPs[j][l]
+					// Networks that only overlap are fine, as the more specific one wins, such as a
+					// network behind one peer while another takes all traffic.
+					if a.sameNetwork(b) {
+						add(LintOverlappingAllowedIPs, DiagnosticError, l18n.Sprintf("Allowed IPs %s of peer %d are also allowed for peer %d, which takes them over", a.String(), i+1, j+1), i, j)
+					}
+				}
+			}
+		}
+	}
+
+	if len(c.Peers) > 0 {
+		for i := range c.Interface.Addresses {
+			address := &c.Interface.Addresses[i]
+			allowed := false
+			for j := range c.Peers {
+				for k := range allowedIPs[j] {
+					network := allowedIPs[j][k].IPNet()
+					if network.Contains(address.IP) {
+						allowed = true
+						break
+					}
+				}
+			}
+			if !allowed {
+				add(LintAddressNotAllowed, DiagnosticWarning, l18n.Sprintf("Address %s is not within the allowed IPs of any peer", address.String()))
+			}
+		}
+	}
+
+	if mtu := c.Interface.EffectiveMTU(true); mtu != 0 && mtu < minimumIPv6MTU {
+		for i := range c.Interface.Addresses {
+			if c.Interface.Addresses[i].Bits() == 128 {
+				add(LintMTUTooSmallForIPv6, DiagnosticError, l18n.Sprintf("MTU %d is below the minimum of %d for IPv6 address %s", mtu, minimumIPv6MTU, c.Interface.Addresses[i].String()))
+				break
+			}
+		}
+	}
+
+	for i := range c.Peers {
+		if len(c.Peers[i].BackupEndpoints) > 0 && c.Peers[i].PersistentKeepalive == 0 {
+			add(LintBackupsWithoutKeepalive, DiagnosticWarning, l18n.Sprintf("Peer %d has backup endpoints, but no persistent keepalive, so a failing endpoint is only replaced once traffic to the peer goes unanswered", i+1), i)
+		}
+	}
+
+	if len(c.Interface.DNS) == 0 && (len(c.Interface.DoHTemplate) > 0 || len(c.Interface.DoTName) > 0) {
+		add(LintEncryptedDNSWithoutDNS, DiagnosticError, l18n.Sprintf("DNS over HTTPS or TLS is set, but no DNS server addresses are, so there is no server to connect to"))
+	}
+
+	if len(c.Interface.DNS) == 0 && len(c.Interface.DNSMatch) > 0 {
+		add(LintDNSMatchWithoutDNS, DiagnosticWarning, l18n.Sprintf("DNS match domains are set, but no DNS servers are, so they have no effect"))
+	}
+
+	if len(c.Interface.DNS) == 0 {
+	fullTunnel:
+		for i := range c.Peers {
+			for j := range allowedIPs[i] {
+				if allowedIPs[i][j].Cidr == 0 {
+					add(LintFullTunnelWithoutDNS, DiagnosticWarning, l18n.Sprintf("Peer %d receives all traffic, but no DNS servers are set, so queries may go to servers that are unreachable or outside of the tunnel", i+1), i)
+					break fullTunnel
+				}
+			}
+		}
+	}
+
+	return findings
+}
@@ -0,0 +1,112 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"testing"
+)
+
+func lintIDs(findings []LintFinding) map[LintID]DiagnosticSeverity {
+	ids := make(map[LintID]DiagnosticSeverity, len(findings))
+	for _, finding := range findings {
+		if severity, ok := ids[finding.ID]; !ok || finding.Severity < severity {
+			ids[finding.ID] = finding.Severity
+		}
+	}
+	return ids
+}
+
+func TestLintClean(t *testing.T) {
+	conf, err := FromWgQuick(`[Interface]
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+Address = 10.192.122.2/24, fd00::2/64
+DNS = 10.192.122.1
+MTU = 1420
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+PresharedKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+AllowedIPs = 0.0.0.0/0, ::/0
+
+[Peer]
+PublicKey = gN65BkIKy1eCE9pP1wdc8ROUtkHLF2PfAqYdyYBz6EA=
+AllowedIPs = 192.168.1.0/24`, "test")
+	if !noError(t, err) {
+		return
+	}
+	equal(t, map[LintID]DiagnosticSeverity{}, lintIDs(Lint(conf)))
+}
+
+func TestLintAddressNotAllowed(t *testing.T) {
+	conf, err := FromWgQuick(`[Interface]
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+Address = 10.0.0.2/16, 10.1.0.2/16
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 10.0.1.0/24, 10.1.0.0/24`, "test")
+	if !noError(t, err) {
+		return
+	}
+	findings := Lint(conf)
+	if len(findings) != 1 || findings[0].ID != LintAddressNotAllowed {
+		t.Fatalf("Expected only a finding for the address outside of the allowed IPs, but got %+v", findings)
+	}
+	equal(t, "Address 10.0.0.2/16 is not within the allowed IPs of any peer", findings[0].Message)
+}
+
+func TestLint(t *testing.T) {
+	privateKey, _ := NewPrivateKeyFromString("yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=")
+	conf, err := FromWgQuick(`[Interface]
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+Address = 10.192.122.2/32, fd00::2/128
+MTU = 1200
+DNSMatch = corp.example
+DNSOverTLS = dns.corp.example
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+PresharedKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+AllowedIPs = 0.0.0.0/0
+Endpoint = 192.0.2.1:51820, 192.0.2.2:51820
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+PresharedKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+AllowedIPs = 0.0.0.0/0
+
+[Peer]
+PublicKey = `+privateKey.Public().String()+`
+AllowedIPs = 192.168.1.0/24`, "test")
+	if !noError(t, err) {
+		return
+	}
+	findings := Lint(conf)
+	equal(t, map[LintID]DiagnosticSeverity{
+		LintOverlappingAllowedIPs:   DiagnosticError,
+		LintDuplicatePeer:           DiagnosticError,
+		LintPeerIsSelf:              DiagnosticError,
+		LintAddressNotAllowed:       DiagnosticWarning,
+		LintMTUTooSmallForIPv6:      DiagnosticError,
+		LintReusedPresharedKey:      DiagnosticWarning,
+		LintFullTunnelWithoutDNS:    DiagnosticWarning,
+		LintDNSMatchWithoutDNS:      DiagnosticWarning,
+		LintEncryptedDNSWithoutDNS:  DiagnosticError,
+		LintBackupsWithoutKeepalive: DiagnosticWarning,
+	}, lintIDs(findings))
+	for _, finding := range findings {
+		switch finding.ID {
+		case LintPeerIsSelf:
+			equal(t, []int{2}, finding.Peers)
+		case LintBackupsWithoutKeepalive:
+			equal(t, []int{0}, finding.Peers)
+		case LintDuplicatePeer, LintReusedPresharedKey:
+			equal(t, []int{0, 1}, finding.Peers)
+		case LintAddressNotAllowed:
+			equal(t, "Address fd00::2/128 is not within the allowed IPs of any peer", finding.Message)
+		}
+	}
+}
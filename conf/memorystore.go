@@ -0,0 +1,163 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+type memoryFile struct {
+	data     []byte
+	modified time.Time
+}
+
+type memoryStore struct {
+	mutex     sync.Mutex
+	configs   map[string]memoryFile
+	metadata  map[string][]byte
+	revisions map[string]map[string][]byte
+	locks     map[string]*sync.Mutex
+}
+
+// NewMemoryStore returns a Store that keeps configurations in memory, for the lifetime of the process.
+// Changes to it are reported to the callbacks registered with RegisterStoreChangeCallback.
+func NewMemoryStore() Store {
+	return &memoryStore{
+		configs:   make(map[string]memoryFile),
+		metadata:  make(map[string][]byte),
+		revisions: make(map[string]map[string][]byte),
+		locks:     make(map[string]*sync.Mutex),
+	}
+}
+
+func notExist(op, name string) error {
+	return &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+}
+
+func (m *memoryStore) Names() ([]string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	names := make([]string, 0, len(m.configs))
+	for name := range m.configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (m *memoryStore) Read(name string) ([]byte, time.Time, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	file, ok := m.configs[name]
+	if !ok {
+		return nil, time.Time{}, notExist("read", name)
+	}
+	return append([]byte(nil), file.data...), file.modified, nil
+}
+
+func (m *memoryStore) Write(name string, data []byte, overwrite bool) error {
+	m.mutex.Lock()
+	if _, ok := m.configs[name]; ok && !overwrite {
+		m.mutex.Unlock()
+		return &os.PathError{Op: "write", Path: name, Err: os.ErrExist}
+	}
+	m.configs[name] = memoryFile{append([]byte(nil), data...), time.Now()}
+	m.mutex.Unlock()
+	notifyStoreChange()
+	return nil
+}
+
+func (m *memoryStore) Delete(name string) error {
+	m.mutex.Lock()
+	if _, ok := m.configs[name]; !ok {
+		m.mutex.Unlock()
+		return notExist("delete", name)
+	}
+	delete(m.configs, name)
+	m.mutex.Unlock()
+	notifyStoreChange()
+	return nil
+}
+
+func (m *memoryStore) Lock(name string) (func(), error) {
+	m.mutex.Lock()
+	lock, ok := m.locks[name]
+	if !ok {
+		lock = &sync.Mutex{}
+		m.locks[name] = lock
+	}
+	m.mutex.Unlock()
+	lock.Lock()
+	return lock.Unlock, nil
+}
+
+func (m *memoryStore) ReadMetadata(name string) ([]byte, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	data, ok := m.metadata[name]
+	if !ok {
+		return nil, notExist("read", name)
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (m *memoryStore) WriteMetadata(name string, data []byte) error {
+	m.mutex.Lock()
+	if data == nil {
+		delete(m.metadata, name)
+	} else {
+		m.metadata[name] = append([]byte(nil), data...)
+	}
+	m.mutex.Unlock()
+	notifyStoreChange()
+	return nil
+}
+
+func (m *memoryStore) Revisions(name string) ([]string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	ids := make([]string, 0, len(m.revisions[name]))
+	for id := range m.revisions[name] {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (m *memoryStore) ReadRevision(name, id string) ([]byte, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	data, ok := m.revisions[name][id]
+	if !ok {
+		return nil, notExist("read", name+"/"+id)
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (m *memoryStore) WriteRevision(name, id string, data []byte) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.revisions[name] == nil {
+		m.revisions[name] = make(map[string][]byte)
+	}
+	if _, ok := m.revisions[name][id]; ok {
+		return &os.PathError{Op: "write", Path: name + "/" + id, Err: os.ErrExist}
+	}
+	m.revisions[name][id] = append([]byte(nil), data...)
+	return nil
+}
+
+func (m *memoryStore) DeleteRevision(name, id string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.revisions[name][id]; !ok {
+		return notExist("delete", name+"/"+id)
+	}
+	delete(m.revisions[name], id)
+	return nil
+}
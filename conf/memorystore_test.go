@@ -0,0 +1,296 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func useMemoryStore(t *testing.T) {
+	e, err := NewPassphraseEncrypter("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	UseStore(NewMemoryStore(), e)
+}
+
+func TestMemoryStore(t *testing.T) {
+	useMemoryStore(t)
+	defer UseStore(nil, nil)
+
+	c, err := FromWgQuick(testInput, "golangTest")
+	if !noError(t, err) {
+		return
+	}
+	if !noError(t, c.Save(false)) {
+		return
+	}
+	if err := c.Save(false); !os.IsExist(err) {
+		t.Errorf("Saving over an existing configuration without overwrite should fail, but got %v", err)
+	}
+	names, err := ListConfigNames()
+	if noError(t, err) {
+		equal(t, []string{"golangTest"}, names)
+	}
+	loaded, err := LoadFromName("golangTest")
+	if !noError(t, err) {
+		return
+	}
+	equal(t, c.ToWgQuick(), loaded.ToWgQuick())
+
+	original := loaded.Document.String()
+	loaded.Interface.ListenPort = 1234
+	if !noError(t, loaded.SaveIfUnmodified(original)) {
+		return
+	}
+	loaded.Interface.ListenPort = 4321
+	if err := loaded.SaveIfUnmodified(original); err != ErrConfigModified {
+		t.Errorf("Saving over a modified configuration should fail with ErrConfigModified, but got %v", err)
+	}
+
+	if !noError(t, DeleteName("golangTest")) {
+		return
+	}
+	if _, err := LoadFromName("golangTest"); !os.IsNotExist(err) {
+		t.Errorf("Loading a deleted configuration should fail with a not exist error, but got %v", err)
+	}
+	names, err = ListConfigNames()
+	if noError(t, err) {
+		equal(t, 0, len(names))
+	}
+}
+
+func TestSaveLeavesSharedDocument(t *testing.T) {
+	useMemoryStore(t)
+	defer UseStore(nil, nil)
+
+	c, err := FromWgQuick(testInput, "golangTest")
+	if !noError(t, err) {
+		return
+	}
+	original := c.Document.String()
+	copied := *c
+	copied.Interface.ListenPort = 4321
+	if !noError(t, copied.Save(false)) {
+		return
+	}
+	equal(t, original, c.Document.String())
+	if !strings.Contains(copied.Document.String(), "ListenPort = 4321") {
+		t.Errorf("The document of the saved configuration was not updated:\n%s", copied.Document.String())
+	}
+
+	c.Document = ParseDocument("[Interface]\nPrivateKey = nope\n")
+	if err := c.Save(true); err == nil {
+		t.Error("Saving a configuration whose document cannot be applied should fail")
+	}
+	loaded, err := LoadFromName("golangTest")
+	if noError(t, err) {
+		equal(t, copied.Document.String(), loaded.Document.String())
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	useMemoryStore(t)
+	defer UseStore(nil, nil)
+
+	c, err := FromWgQuick(testInput, "golangTest")
+	if !noError(t, err) {
+		return
+	}
+	c.Metadata = Metadata{DisplayName: "Büro Berlin", Tags: []string{"Acme"}, Folder: "Customers"}
+	if !noError(t, c.Save(false)) {
+		return
+	}
+	contents, err := readStoredConfig("golangTest")
+	if noError(t, err) && strings.Contains(contents, "Büro Berlin") {
+		t.Errorf("The metadata was written into the configuration:\n%s", contents)
+	}
+	loaded, err := LoadFromName("golangTest")
+	if !noError(t, err) {
+		return
+	}
+	equal(t, c.Metadata, loaded.Metadata)
+
+	// Saving what the tunnel service loaded, which has no metadata, keeps the stored metadata.
+	fromService, err := FromWgQuick(contents, "golangTest")
+	if !noError(t, err) {
+		return
+	}
+	fromService.Interface.ListenPort = 1234
+	if !noError(t, fromService.SaveIfUnmodified(contents)) {
+		return
+	}
+	metadata, err := LoadMetadata("golangTest")
+	if noError(t, err) {
+		equal(t, c.Metadata, metadata)
+	}
+
+	loaded.Metadata = Metadata{}
+	if !noError(t, loaded.Save(true)) {
+		return
+	}
+	s, _ := currentStore()
+	if _, err := s.ReadMetadata("golangTest"); !os.IsNotExist(err) {
+		t.Errorf("Empty metadata should not be stored, but got %v", err)
+	}
+
+	loaded.Metadata.DisplayName = "Büro Berlin"
+	if !noError(t, loaded.Save(true)) || !noError(t, DeleteName("golangTest")) {
+		return
+	}
+	if _, err := s.ReadMetadata("golangTest"); !os.IsNotExist(err) {
+		t.Errorf("The metadata of a deleted configuration should be gone, but got %v", err)
+	}
+}
+
+func TestRevisions(t *testing.T) {
+	useMemoryStore(t)
+	defer UseStore(nil, nil)
+
+	c, err := FromWgQuick(testInput, "golangTest")
+	if !noError(t, err) {
+		return
+	}
+	if !noError(t, c.SaveEditedBy(false, `TEST\first`)) {
+		return
+	}
+	for port := uint16(1); port <= maxRevisions; port++ {
+		c.Interface.ListenPort = port
+		if !noError(t, c.SaveEditedBy(true, `TEST\second`)) {
+			return
+		}
+	}
+	revisions, err := ListRevisions("golangTest")
+	if !noError(t, err) {
+		return
+	}
+	equal(t, maxRevisions, len(revisions))
+	for i := 1; i < len(revisions); i++ {
+		if revisions[i].ID >= revisions[i-1].ID || revisions[i].Time.After(revisions[i-1].Time) {
+			t.Errorf("Revisions are not sorted newest first: %v", revisions)
+		}
+	}
+	equal(t, `TEST\second`, revisions[0].User)
+
+	oldest, err := LoadRevision("golangTest", revisions[len(revisions)-1].ID)
+	if !noError(t, err) {
+		return
+	}
+	equal(t, uint16(1), oldest.Interface.ListenPort)
+
+	diff, err := DiffRevisions("golangTest", revisions[1].ID, revisions[0].ID)
+	if !noError(t, err) {
+		return
+	}
+	if !strings.Contains(diff, "\n-ListenPort = 19 ") || !strings.Contains(diff, "\n+ListenPort = 20 ") {
+		t.Errorf("Unexpected diff between revisions:\n%s", diff)
+	}
+
+	_, err = RollbackToRevision("golangTest", revisions[len(revisions)-1].ID, `TEST\third`)
+	if !noError(t, err) {
+		return
+	}
+	current, err := LoadFromName("golangTest")
+	if !noError(t, err) {
+		return
+	}
+	equal(t, uint16(1), current.Interface.ListenPort)
+	revisions, err = ListRevisions("golangTest")
+	if noError(t, err) {
+		equal(t, maxRevisions, len(revisions))
+		equal(t, `TEST\third`, revisions[0].User)
+	}
+}
+
+func TestRevisionsWithClockGoneBackwards(t *testing.T) {
+	useMemoryStore(t)
+	defer UseStore(nil, nil)
+
+	_, e := currentStore()
+	contents := "[Interface]\nPrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=\n"
+	previous, err := e.Encrypt([]byte(contents), "golangTest")
+	if !noError(t, err) {
+		return
+	}
+	future := time.Unix(0, time.Now().Add(time.Hour).UnixNano())
+	if !noError(t, recordRevision("golangTest", contents, `TEST\first`, previous, future)) {
+		return
+	}
+	revisions, err := ListRevisions("golangTest")
+	if !noError(t, err) || !equal(t, 2, len(revisions)) {
+		return
+	}
+	equal(t, `TEST\first`, revisions[0].User)
+	equal(t, future, revisions[1].Time)
+	if !revisions[0].Time.Before(future) {
+		t.Errorf("The time of the newest revision should be when it was saved, not %v", revisions[0].Time)
+	}
+}
+
+func TestRevisionsOfExistingConfig(t *testing.T) {
+	useMemoryStore(t)
+	defer UseStore(nil, nil)
+
+	s, e := currentStore()
+	contents := "[Interface]\nPrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=\n"
+	encrypted, err := e.Encrypt([]byte(contents), "golangTest")
+	if !noError(t, err) {
+		return
+	}
+	if !noError(t, s.Write("golangTest", encrypted, false)) {
+		return
+	}
+	c, err := LoadFromName("golangTest")
+	if !noError(t, err) {
+		return
+	}
+	c.Interface.ListenPort = 1234
+	if !noError(t, c.Save(true)) {
+		return
+	}
+	revisions, err := ListRevisions("golangTest")
+	if !noError(t, err) || !equal(t, 2, len(revisions)) {
+		return
+	}
+	equal(t, "", revisions[1].User)
+	previous, err := LoadRevision("golangTest", revisions[1].ID)
+	if noError(t, err) {
+		equal(t, contents, previous.Document.String())
+	}
+}
+
+type failingWriteStore struct {
+	Store
+}
+
+func (failingWriteStore) Write(name string, data []byte, overwrite bool) error {
+	return errors.New("Write failed")
+}
+
+func TestRevisionsOfFailedSave(t *testing.T) {
+	e, err := NewPassphraseEncrypter("correct horse battery staple")
+	if !noError(t, err) {
+		return
+	}
+	UseStore(failingWriteStore{NewMemoryStore()}, e)
+	defer UseStore(nil, nil)
+
+	c, err := FromWgQuick(testInput, "golangTest")
+	if !noError(t, err) {
+		return
+	}
+	if err := c.Save(false); err == nil {
+		t.Error("Saving to a store that cannot be written should fail")
+	}
+	revisions, err := ListRevisions("golangTest")
+	if noError(t, err) {
+		equal(t, 0, len(revisions))
+	}
+}
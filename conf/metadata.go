@@ -0,0 +1,136 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+)
+
+// Metadata is what we keep about a tunnel besides its configuration. It is stored next to the
+// configuration rather than in it, because wg-quick and wg would reject it, so it never ends up in
+// exported configurations.
+type Metadata struct {
+	DisplayName string   `json:",omitempty"`
+	Tags        []string `json:",omitempty"`
+	Folder      string   `json:",omitempty"`
+}
+
+func (m *Metadata) isEmpty() bool {
+	return len(m.DisplayName) == 0 && len(m.Tags) == 0 && len(m.Folder) == 0
+}
+
+func (m *Metadata) validate() error {
+	if len(m.DisplayName) > 0 {
+		if _, err := parseDisplayName(m.DisplayName); err != nil {
+			return err
+		}
+	}
+	for _, tag := range m.Tags {
+		if _, err := parseTag(tag); err != nil {
+			return err
+		}
+	}
+	if len(m.Folder) > 0 {
+		if _, err := parseFolder(m.Folder); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HasTag reports whether the tunnel is tagged with tag, ignoring case.
+func (m *Metadata) HasTag(tag string) bool {
+	for _, t := range m.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTags parses a comma-separated list of tags, dropping those that are repeated.
+func ParseTags(s string) ([]string, error) {
+	var m Metadata
+	if len(strings.TrimSpace(s)) == 0 {
+		return nil, nil
+	}
+	for _, tag := range strings.Split(s, ",") {
+		t, err := parseTag(strings.TrimSpace(tag))
+		if err != nil {
+			return nil, err
+		}
+		if !m.HasTag(t) {
+			m.Tags = append(m.Tags, t)
+		}
+	}
+	return m.Tags, nil
+}
+
+// ParseFolder parses a folder path, whose components are separated by slashes. An empty path means
+// that the tunnel is in no folder.
+func ParseFolder(s string) (string, error) {
+	if len(strings.TrimSpace(s)) == 0 {
+		return "", nil
+	}
+	return parseFolder(s)
+}
+
+// LoadMetadata returns the metadata of a stored tunnel, without loading its configuration. A tunnel
+// without metadata has empty metadata.
+func LoadMetadata(name string) (Metadata, error) {
+	if !TunnelNameIsValid(name) {
+		return Metadata{}, errors.New("Tunnel name is not valid")
+	}
+	return readMetadata(name)
+}
+
+func readMetadata(name string) (Metadata, error) {
+	var m Metadata
+	s, e := currentStore()
+	data, err := s.ReadMetadata(name)
+	if os.IsNotExist(err) {
+		return m, nil
+	} else if err != nil {
+		return m, err
+	}
+	data, err = e.Decrypt(data, name)
+	if err != nil {
+		return m, err
+	}
+	err = json.Unmarshal(data, &m)
+	if err != nil {
+		return Metadata{}, err
+	}
+	err = m.validate()
+	if err != nil {
+		return Metadata{}, err
+	}
+	return m, nil
+}
+
+// writeMetadata replaces the stored metadata of a tunnel, removing it if m is empty.
+func writeMetadata(name string, m Metadata) error {
+	s, e := currentStore()
+	if m.isEmpty() {
+		return s.WriteMetadata(name, nil)
+	}
+	err := m.validate()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	data, err = e.Encrypt(data, name)
+	if err != nil {
+		return err
+	}
+	return s.WriteMetadata(name, data)
+}
@@ -21,11 +21,17 @@ import (
 var migrating sync.Mutex
 var lastMigrationTimer *time.Timer
 
+// MigrateUnencryptedConfigs saves the unencrypted configurations that were put in the configuration
+// directory to the store, and removes them. Only the default store uses the configuration directory,
+// so there is nothing to do for other stores.
 func MigrateUnencryptedConfigs() { migrateUnencryptedConfigs(3) }
 
 func migrateUnencryptedConfigs(sharingBase int) {
 	migrating.Lock()
 	defer migrating.Unlock()
+	if s, _ := currentStore(); s != (directoryStore{}) {
+		return
+	}
 	configFileDir, err := tunnelConfigurationsDirectory()
 	if err != nil {
 		return
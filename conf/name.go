@@ -6,9 +6,13 @@
 package conf
 
 import (
+	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
 )
 
 var reservedNames = []string{
@@ -51,6 +55,66 @@ func TunnelNameIsValid(name string) bool {
 	return allowedNameFormat.MatchString(name)
 }
 
+const maxTunnelNameLength = 32
+
+// TunnelNameFromDisplayName derives a valid tunnel name from a display name, for use when a
+// configuration is known by a name that cannot name a service or an adapter. Accents are dropped,
+// other disallowed characters become dashes, and the result is shortened to fit. If taken reports
+// that the name is already in use, a number is appended until it is not.
+func TunnelNameFromDisplayName(displayName string, taken func(name string) bool) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range norm.NFKD.String(displayName) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			continue
+		case r < 0x80 && allowedNameFormat.MatchString(string(r)):
+			b.WriteRune(r)
+			dash = false
+		case !dash && b.Len() > 0:
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	base := strings.TrimRight(b.String(), "-")
+	if len(base) == 0 {
+		base = "tunnel"
+	}
+	if len(base) > maxTunnelNameLength {
+		base = strings.TrimRight(base[:maxTunnelNameLength], "-")
+	}
+	name := base
+	for i := 2; !TunnelNameIsValid(name) || (taken != nil && taken(name)); i++ {
+		suffix := fmt.Sprintf("-%d", i)
+		if len(base)+len(suffix) > maxTunnelNameLength {
+			base = base[:maxTunnelNameLength-len(suffix)]
+		}
+		name = base + suffix
+	}
+	return name
+}
+
+// DisplayNameIsValid reports whether name can be used as the display name of a tunnel.
+func DisplayNameIsValid(name string) bool {
+	_, err := parseDisplayName(name)
+	return len(name) > 0 && err == nil
+}
+
+// NameForImport returns the tunnel name under which to import a configuration that comes from a file
+// named fileName, without its extension. If fileName is a valid tunnel name, it is used as it is;
+// otherwise a name is derived from it, avoiding those for which taken returns true, and fileName is
+// returned as the display name that the configuration should get if it does not have one already.
+func NameForImport(fileName string, taken func(name string) bool) (name, displayName string) {
+	if TunnelNameIsValid(fileName) {
+		return fileName, ""
+	}
+	name = TunnelNameFromDisplayName(fileName, taken)
+	if DisplayNameIsValid(strings.TrimSpace(fileName)) {
+		displayName = strings.TrimSpace(fileName)
+	}
+	return
+}
+
 type naturalSortToken struct {
 	maybeString string
 	maybeNumber int
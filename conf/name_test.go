@@ -0,0 +1,52 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTunnelNameFromDisplayName(t *testing.T) {
+	for _, tt := range []struct {
+		displayName string
+		name        string
+	}{
+		{"office", "office"},
+		{"Büro Berlin (Failover)", "Buro-Berlin-Failover"},
+		{"  Ünïcödé  ", "Unicode"},
+		{"東京", "tunnel"},
+		{"CON", "CON-2"},
+		{"A very long and descriptive name for a tunnel", "A-very-long-and-descriptive-name"},
+	} {
+		name := TunnelNameFromDisplayName(tt.displayName, nil)
+		equal(t, tt.name, name)
+		if !TunnelNameIsValid(name) {
+			t.Errorf("Derived name %q of %q is not valid", name, tt.displayName)
+		}
+	}
+
+	existing := map[string]bool{"tunnel": true, "tunnel-2": true}
+	equal(t, "tunnel-3", TunnelNameFromDisplayName("東京", func(name string) bool {
+		return existing[name]
+	}))
+	long := strings.Repeat("x", 40)
+	equal(t, strings.Repeat("x", 30)+"-2", TunnelNameFromDisplayName(long, func(name string) bool {
+		return name == strings.Repeat("x", 32)
+	}))
+}
+
+func TestNameForImport(t *testing.T) {
+	name, displayName := NameForImport("office", nil)
+	equal(t, "office", name)
+	equal(t, "", displayName)
+
+	name, displayName = NameForImport("Büro Berlin (Failover)", func(name string) bool {
+		return name == "Buro-Berlin-Failover"
+	})
+	equal(t, "Buro-Berlin-Failover-2", name)
+	equal(t, "Büro Berlin (Failover)", displayName)
+}
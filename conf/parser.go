@@ -11,9 +11,11 @@ import (
 	"encoding/hex"
 	"io"
 	"net"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"golang.org/x/text/encoding/unicode"
 
@@ -51,8 +53,9 @@ func parseIPCidr(s string) (ipcidr *IPCidr, err error) {
 	}
 	if len(cidrStr) > 0 {
 		err = &ParseError{l18n.Sprintf("Invalid network prefix length"), s}
-		cidr, err = strconv.Atoi(cidrStr)
-		if err != nil || cidr < 0 || cidr > 128 {
+		var atoiErr error
+		cidr, atoiErr = strconv.Atoi(cidrStr)
+		if atoiErr != nil || cidr < 0 || cidr > 128 {
 			return
 		}
 		if cidr > 32 && maybeV4 != nil {
@@ -68,6 +71,11 @@ func parseIPCidr(s string) (ipcidr *IPCidr, err error) {
 	return &IPCidr{addr, uint8(cidr)}, nil
 }
 
+// ParseEndpoint parses an endpoint as the Endpoint key takes it, which is a host and a port.
+func ParseEndpoint(s string) (*Endpoint, error) {
+	return parseEndpoint(s)
+}
+
 func parseEndpoint(s string) (*Endpoint, error) {
 	i := strings.LastIndexByte(s, ':')
 	if i < 0 {
@@ -112,6 +120,115 @@ func parseMTU(s string) (uint16, error) {
 	return uint16(m), nil
 }
 
+func parseTable(s string) (off bool, metric uint32, err error) {
+	switch s {
+	case "off":
+		return true, 0, nil
+	case "auto":
+		return false, 0, nil
+	}
+	m, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return false, 0, &ParseError{l18n.Sprintf("Invalid table or route metric"), s}
+	}
+	return false, uint32(m), nil
+}
+
+func parseSaveConfig(s string) (bool, error) {
+	switch s {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, &ParseError{l18n.Sprintf("SaveConfig must be true or false"), s}
+}
+
+// maxDisplayNameLength is generous, but keeps a display name from swamping the windows that show it.
+const maxDisplayNameLength = 256
+
+func parseDisplayName(s string) (string, error) {
+	if !utf8.ValidString(s) || utf8.RuneCountInString(s) > maxDisplayNameLength {
+		return "", &ParseError{l18n.Sprintf("Invalid display name"), s}
+	}
+	for _, r := range s {
+		if r < 0x20 || (r >= 0x7f && r < 0xa0) {
+			return "", &ParseError{l18n.Sprintf("Invalid display name"), s}
+		}
+	}
+	return s, nil
+}
+
+const maxTagLength = 64
+
+func parseTag(s string) (string, error) {
+	if len(s) == 0 || utf8.RuneCountInString(s) > maxTagLength || strings.ContainsRune(s, ',') {
+		return "", &ParseError{l18n.Sprintf("Invalid tag"), s}
+	}
+	if _, err := parseDisplayName(s); err != nil {
+		return "", &ParseError{l18n.Sprintf("Invalid tag"), s}
+	}
+	return s, nil
+}
+
+// parseFolder parses a folder path, whose components are separated by slashes, removing the space
+// around each of them.
+func parseFolder(s string) (string, error) {
+	components := strings.Split(s, "/")
+	for i := range components {
+		components[i] = strings.TrimSpace(components[i])
+		if len(components[i]) == 0 {
+			return "", &ParseError{l18n.Sprintf("Invalid folder"), s}
+		}
+	}
+	folder := strings.Join(components, "/")
+	if _, err := parseDisplayName(folder); err != nil {
+		return "", &ParseError{l18n.Sprintf("Invalid folder"), s}
+	}
+	return folder, nil
+}
+
+// parseDNSMatchDomain parses a domain whose names should be resolved by the DNS servers of the
+// tunnel, which is written "*.example.com" to match only the names under it, or "example.com" to
+// match the domain itself as well.
+func parseDNSMatchDomain(s string) (string, error) {
+	domain := strings.TrimSuffix(strings.ToLower(s), ".")
+	labels := strings.Split(strings.TrimPrefix(domain, "*."), ".")
+	if len(domain) == 0 || len(domain) > 253 {
+		return "", &ParseError{l18n.Sprintf("Invalid DNS match domain"), s}
+	}
+	for _, label := range labels {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return "", &ParseError{l18n.Sprintf("Invalid DNS match domain"), s}
+		}
+		for _, c := range label {
+			if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' && c != '_' {
+				return "", &ParseError{l18n.Sprintf("Invalid DNS match domain"), s}
+			}
+		}
+	}
+	return domain, nil
+}
+
+// parseDoHTemplate parses the URL template of a DNS over HTTPS server, as in RFC 8484, which may end
+// with the "{?dns}" variable, since the queries are always sent as POST requests.
+func parseDoHTemplate(s string) (string, error) {
+	u, err := url.Parse(strings.TrimSuffix(s, "{?dns}"))
+	if err != nil || u.Scheme != "https" || len(u.Hostname()) == 0 || u.User != nil || len(u.RawQuery) > 0 || len(u.Fragment) > 0 {
+		return "", &ParseError{l18n.Sprintf("Invalid DNS over HTTPS URL template"), s}
+	}
+	return s, nil
+}
+
+// parseDoTName parses the host name that the certificates of DNS over TLS servers are verified against.
+func parseDoTName(s string) (string, error) {
+	name, err := parseDNSMatchDomain(s)
+	if err != nil || strings.HasPrefix(name, "*.") {
+		return "", &ParseError{l18n.Sprintf("Invalid DNS over TLS server name"), s}
+	}
+	return name, nil
+}
+
 func parsePort(s string) (uint16, error) {
 	m, err := strconv.Atoi(s)
 	if err != nil {
@@ -201,16 +318,51 @@ func FromWgQuick(s string, name string) (*Config, error) {
 	if !TunnelNameIsValid(name) {
 		return nil, &ParseError{l18n.Sprintf("Tunnel name is not valid"), name}
 	}
-	lines := strings.Split(s, "\n")
+	conf, diagnostics := fromWgQuick(s, name)
+	if err := firstError(diagnostics); err != nil {
+		return nil, err
+	}
+	conf.Document = ParseDocument(s)
+	return conf, nil
+}
+
+// Validate parses s like FromWgQuick, but rather than stopping at the first problem, it collects every
+// error and warning along with its position. The returned configuration is nil if there are any errors.
+func Validate(s string, name string) (*Config, []Diagnostic) {
+	if !TunnelNameIsValid(name) {
+		return nil, []Diagnostic{newDiagnostic(s, DiagnosticError, &ParseError{l18n.Sprintf("Tunnel name is not valid"), name}, 0, 0, 0)}
+	}
+	conf, diagnostics := fromWgQuick(s, name)
+	if firstError(diagnostics) != nil {
+		return nil, diagnostics
+	}
+	conf.Document = ParseDocument(s)
+	return conf, diagnostics
+}
+
+func fromWgQuick(s string, name string) (*Config, []Diagnostic) {
+	var diagnostics []Diagnostic
+	lines := strings.SplitAfter(s, "\n")
 	parserState := notInASection
 	conf := Config{Name: name}
 	sawPrivateKey := false
 	var peer *Peer
-	for _, line := range lines {
+	var peerHeaders []struct{ line, start, end int }
+	var seenKeys map[string]bool
+	lineStart := 0
+	for lineIndex, raw := range lines {
+		rawStart := lineStart
+		lineStart += len(raw)
+		report := func(severity DiagnosticSeverity, err error, start, end int) {
+			diagnostics = append(diagnostics, newDiagnostic(s, severity, err, lineIndex+1, rawStart+start, rawStart+end))
+		}
+
+		line := strings.TrimSuffix(raw, "\n")
 		pound := strings.IndexByte(line, '#')
 		if pound >= 0 {
 			line = line[:pound]
 		}
+		lineOffset := strings.Index(line, strings.TrimSpace(line))
 		line = strings.TrimSpace(line)
 		lineLower := strings.ToLower(line)
 		if len(line) == 0 {
@@ -218,64 +370,130 @@ func FromWgQuick(s string, name string) (*Config, error) {
 		}
 		if lineLower == "[interface]" {
 			conf.maybeAddPeer(peer)
+			peer = nil
 			parserState = inInterfaceSection
+			seenKeys = make(map[string]bool)
 			continue
 		}
 		if lineLower == "[peer]" {
 			conf.maybeAddPeer(peer)
 			peer = &Peer{}
+			peerHeaders = append(peerHeaders, struct{ line, start, end int }{lineIndex + 1, rawStart + lineOffset, rawStart + lineOffset + len(line)})
 			parserState = inPeerSection
+			seenKeys = make(map[string]bool)
 			continue
 		}
 		if parserState == notInASection {
-			return nil, &ParseError{l18n.Sprintf("Line must occur in a section"), line}
+			report(DiagnosticError, &ParseError{l18n.Sprintf("Line must occur in a section"), line}, lineOffset, lineOffset+len(line))
+			continue
 		}
 		equals := strings.IndexByte(line, '=')
 		if equals < 0 {
-			return nil, &ParseError{l18n.Sprintf("Config key is missing an equals separator"), line}
+			report(DiagnosticError, &ParseError{l18n.Sprintf("Config key is missing an equals separator"), line}, lineOffset, lineOffset+len(line))
+			continue
 		}
 		key, val := strings.TrimSpace(lineLower[:equals]), strings.TrimSpace(line[equals+1:])
+		keyStart := lineOffset + strings.Index(line[:equals], strings.TrimSpace(line[:equals]))
+		keyEnd := keyStart + len(strings.TrimSpace(line[:equals]))
+		valStart := lineOffset + equals + 1 + strings.Index(line[equals+1:], val)
+		valEnd := valStart + len(val)
 		if len(val) == 0 {
-			return nil, &ParseError{l18n.Sprintf("Key must have a value"), line}
+			report(DiagnosticError, &ParseError{l18n.Sprintf("Key must have a value"), line}, lineOffset, lineOffset+len(line))
+			continue
+		}
+		valueError := func(err error) {
+			report(DiagnosticError, err, valStart, valEnd)
+		}
+		elements := func() (elements []string, starts []int) {
+			var err error
+			elements, err = splitList(val)
+			if err != nil {
+				valueError(err)
+				return nil, nil
+			}
+			cursor := valStart
+			for _, element := range elements {
+				i := strings.Index(raw[cursor:], element)
+				starts = append(starts, cursor+i)
+				cursor += i + len(element)
+			}
+			return
+		}
+		elementError := func(err error, start int, element string) {
+			report(DiagnosticError, err, start, start+len(element))
+		}
+		switch key {
+		case "dnsoverhttps", "dnsovertls", "privatekey", "listenport", "mtu", "ipv4mtu", "ipv6mtu", "table", "saveconfig", "preup", "postup", "predown", "postdown", "publickey", "presharedkey", "persistentkeepalive", "endpoint":
+			if seenKeys[key] {
+				report(DiagnosticWarning, &ParseError{l18n.Sprintf("Key is specified more than once in this section, so only the last value is used"), strings.TrimSpace(line[:equals])}, keyStart, keyEnd)
+			}
+			seenKeys[key] = true
 		}
 		if parserState == inInterfaceSection {
 			switch key {
 			case "privatekey":
 				k, err := parseKeyBase64(val)
 				if err != nil {
-					return nil, err
+					valueError(err)
+					continue
 				}
 				conf.Interface.PrivateKey = *k
 				sawPrivateKey = true
 			case "listenport":
 				p, err := parsePort(val)
 				if err != nil {
-					return nil, err
+					valueError(err)
+					continue
 				}
 				conf.Interface.ListenPort = p
 			case "mtu":
 				m, err := parseMTU(val)
 				if err != nil {
-					return nil, err
+					valueError(err)
+					continue
 				}
 				conf.Interface.MTU = m
-			case "address":
-				addresses, err := splitList(val)
+			case "ipv4mtu":
+				m, err := parseMTU(val)
 				if err != nil {
-					return nil, err
+					valueError(err)
+					continue
 				}
-				for _, address := range addresses {
+				conf.Interface.IPv4MTU = m
+			case "ipv6mtu":
+				m, err := parseMTU(val)
+				if err != nil {
+					valueError(err)
+					continue
+				}
+				conf.Interface.IPv6MTU = m
+			case "table":
+				off, metric, err := parseTable(val)
+				if err != nil {
+					valueError(err)
+					continue
+				}
+				conf.Interface.TableOff = off
+				conf.Interface.TableMetric = metric
+			case "saveconfig":
+				save, err := parseSaveConfig(val)
+				if err != nil {
+					valueError(err)
+					continue
+				}
+				conf.Interface.SaveConfig = save
+			case "address":
+				addresses, starts := elements()
+				for i, address := range addresses {
 					a, err := parseIPCidr(address)
 					if err != nil {
-						return nil, err
+						elementError(err, starts[i], address)
+						continue
 					}
 					conf.Interface.Addresses = append(conf.Interface.Addresses, *a)
 				}
 			case "dns":
-				addresses, err := splitList(val)
-				if err != nil {
-					return nil, err
-				}
+				addresses, _ := elements()
 				for _, address := range addresses {
 					a := net.ParseIP(address)
 					if a == nil {
@@ -284,6 +502,30 @@ func FromWgQuick(s string, name string) (*Config, error) {
 						conf.Interface.DNS = append(conf.Interface.DNS, a)
 					}
 				}
+			case "dnsmatch":
+				domains, starts := elements()
+				for i, domain := range domains {
+					d, err := parseDNSMatchDomain(domain)
+					if err != nil {
+						elementError(err, starts[i], domain)
+						continue
+					}
+					conf.Interface.DNSMatch = append(conf.Interface.DNSMatch, d)
+				}
+			case "dnsoverhttps":
+				template, err := parseDoHTemplate(val)
+				if err != nil {
+					valueError(err)
+					continue
+				}
+				conf.Interface.DoHTemplate = template
+			case "dnsovertls":
+				name, err := parseDoTName(val)
+				if err != nil {
+					valueError(err)
+					continue
+				}
+				conf.Interface.DoTName = name
 			case "preup":
 				conf.Interface.PreUp = val
 			case "postup":
@@ -293,63 +535,92 @@ func FromWgQuick(s string, name string) (*Config, error) {
 			case "postdown":
 				conf.Interface.PostDown = val
 			default:
-				return nil, &ParseError{l18n.Sprintf("Invalid key for [Interface] section"), key}
+				report(DiagnosticError, &ParseError{l18n.Sprintf("Invalid key for [Interface] section"), key}, keyStart, keyEnd)
 			}
 		} else if parserState == inPeerSection {
 			switch key {
 			case "publickey":
 				k, err := parseKeyBase64(val)
 				if err != nil {
-					return nil, err
+					valueError(err)
+					continue
 				}
 				peer.PublicKey = *k
 			case "presharedkey":
 				k, err := parseKeyBase64(val)
 				if err != nil {
-					return nil, err
+					valueError(err)
+					continue
 				}
 				peer.PresharedKey = *k
 			case "allowedips":
-				addresses, err := splitList(val)
-				if err != nil {
-					return nil, err
-				}
-				for _, address := range addresses {
+				addresses, starts := elements()
+				for i, address := range addresses {
 					a, err := parseIPCidr(address)
 					if err != nil {
-						return nil, err
+						elementError(err, starts[i], address)
+						continue
 					}
 					peer.AllowedIPs = append(peer.AllowedIPs, *a)
 				}
+			case "disallowedips":
+				addresses, starts := elements()
+				for i, address := range addresses {
+					a, err := parseIPCidr(address)
+					if err != nil {
+						elementError(err, starts[i], address)
+						continue
+					}
+					peer.DisallowedIPs = append(peer.DisallowedIPs, *a)
+				}
 			case "persistentkeepalive":
 				p, err := parsePersistentKeepalive(val)
 				if err != nil {
-					return nil, err
+					valueError(err)
+					continue
 				}
 				peer.PersistentKeepalive = p
 			case "endpoint":
-				e, err := parseEndpoint(val)
-				if err != nil {
-					return nil, err
+				peer.Endpoint = Endpoint{}
+				peer.BackupEndpoints = nil
+				endpoints, starts := elements()
+				for i, endpoint := range endpoints {
+					e, err := parseEndpoint(endpoint)
+					if err != nil {
+						elementError(err, starts[i], endpoint)
+						continue
+					}
+					if peer.HasEndpoint(*e) {
+						report(DiagnosticWarning, &ParseError{l18n.Sprintf("Endpoint is listed more than once"), endpoint}, starts[i], starts[i]+len(endpoint))
+						continue
+					}
+					if peer.Endpoint.IsEmpty() {
+						peer.Endpoint = *e
+					} else {
+						peer.BackupEndpoints = append(peer.BackupEndpoints, *e)
+					}
 				}
-				peer.Endpoint = *e
 			default:
-				return nil, &ParseError{l18n.Sprintf("Invalid key for [Peer] section"), key}
+				report(DiagnosticError, &ParseError{l18n.Sprintf("Invalid key for [Peer] section"), key}, keyStart, keyEnd)
 			}
 		}
 	}
 	conf.maybeAddPeer(peer)
 
 	if !sawPrivateKey {
-		return nil, &ParseError{l18n.Sprintf("An interface must have a private key"), l18n.Sprintf("[none specified]")}
+		diagnostics = append(diagnostics, newDiagnostic(s, DiagnosticError, &ParseError{l18n.Sprintf("An interface must have a private key"), l18n.Sprintf("[none specified]")}, 0, 0, 0))
+	}
+	if len(conf.Interface.DoHTemplate) > 0 && len(conf.Interface.DoTName) > 0 {
+		diagnostics = append(diagnostics, newDiagnostic(s, DiagnosticError, &ParseError{l18n.Sprintf("DNS servers cannot be queried over both HTTPS and TLS"), conf.Interface.DoTName}, 0, 0, 0))
 	}
-	for _, p := range conf.Peers {
+	for i, p := range conf.Peers {
 		if p.PublicKey.IsZero() {
-			return nil, &ParseError{l18n.Sprintf("All peers must have public keys"), l18n.Sprintf("[none specified]")}
+			header := peerHeaders[i]
+			diagnostics = append(diagnostics, newDiagnostic(s, DiagnosticError, &ParseError{l18n.Sprintf("All peers must have public keys"), l18n.Sprintf("[none specified]")}, header.line, header.start, header.end))
 		}
 	}
 
-	return &conf, nil
+	return &conf, diagnostics
 }
 
 func FromWgQuickWithUnknownEncoding(s string, name string) (*Config, error) {
@@ -372,16 +643,25 @@ func FromWgQuickWithUnknownEncoding(s string, name string) (*Config, error) {
 func FromUAPI(reader io.Reader, existingConfig *Config) (*Config, error) {
 	parserState := inInterfaceSection
 	conf := Config{
-		Name: existingConfig.Name,
+		Name:     existingConfig.Name,
+		Metadata: existingConfig.Metadata,
 		Interface: Interface{
-			Addresses: existingConfig.Interface.Addresses,
-			DNS:       existingConfig.Interface.DNS,
-			DNSSearch: existingConfig.Interface.DNSSearch,
-			MTU:       existingConfig.Interface.MTU,
-			PreUp:     existingConfig.Interface.PreUp,
-			PostUp:    existingConfig.Interface.PostUp,
-			PreDown:   existingConfig.Interface.PreDown,
-			PostDown:  existingConfig.Interface.PostDown,
+			Addresses:   existingConfig.Interface.Addresses,
+			DNS:         existingConfig.Interface.DNS,
+			DNSSearch:   existingConfig.Interface.DNSSearch,
+			DNSMatch:    existingConfig.Interface.DNSMatch,
+			DoHTemplate: existingConfig.Interface.DoHTemplate,
+			DoTName:     existingConfig.Interface.DoTName,
+			MTU:         existingConfig.Interface.MTU,
+			IPv4MTU:     existingConfig.Interface.IPv4MTU,
+			IPv6MTU:     existingConfig.Interface.IPv6MTU,
+			PreUp:       existingConfig.Interface.PreUp,
+			PostUp:      existingConfig.Interface.PostUp,
+			PreDown:     existingConfig.Interface.PreDown,
+			PostDown:    existingConfig.Interface.PostDown,
+			TableOff:    existingConfig.Interface.TableOff,
+			TableMetric: existingConfig.Interface.TableMetric,
+			SaveConfig:  existingConfig.Interface.SaveConfig,
 		},
 	}
 	var peer *Peer
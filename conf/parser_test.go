@@ -9,6 +9,7 @@ import (
 	"net"
 	"reflect"
 	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -79,8 +80,8 @@ func TestFromWgQuick(t *testing.T) {
 	if noError(t, err) {
 
 		lenTest(t, conf.Interface.Addresses, 2)
-		contains(t, conf.Interface.Addresses, IPCidr{net.IPv4(10, 10, 0, 1), uint8(16)})
-		contains(t, conf.Interface.Addresses, IPCidr{net.IPv4(10, 192, 122, 1), uint8(24)})
+		contains(t, conf.Interface.Addresses, IPCidr{net.IPv4(10, 10, 0, 1).To4(), uint8(16)})
+		contains(t, conf.Interface.Addresses, IPCidr{net.IPv4(10, 192, 122, 1).To4(), uint8(24)})
 		equal(t, "yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=", conf.Interface.PrivateKey.String())
 		equal(t, uint16(51820), conf.Interface.ListenPort)
 
@@ -126,3 +127,267 @@ func TestParseEndpoint(t *testing.T) {
 		t.Error("Error was expected")
 	}
 }
+
+func TestTable(t *testing.T) {
+	for _, tt := range []struct {
+		value    string
+		off      bool
+		metric   uint32
+		rendered string
+	}{
+		{"off", true, 0, "Table = off\n"},
+		{"auto", false, 0, ""},
+		{"0", false, 0, ""},
+		{"42", false, 42, "Table = 42\n"},
+	} {
+		input := "[Interface]\nPrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=\nTable = " + tt.value + "\n"
+		conf, err := FromWgQuick(input, "test")
+		if !noError(t, err) {
+			continue
+		}
+		equal(t, tt.off, conf.Interface.TableOff)
+		equal(t, tt.metric, conf.Interface.TableMetric)
+		conf.Document = nil
+		equal(t, "[Interface]\nPrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=\n"+tt.rendered, conf.ToWgQuick())
+		reparsed, err := FromWgQuick(conf.ToWgQuick(), "test")
+		if noError(t, err) {
+			equal(t, conf.Interface, reparsed.Interface)
+		}
+	}
+	for _, value := range []string{"main", "-1", "4294967296", "of"} {
+		_, err := FromWgQuick("[Interface]\nPrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=\nTable = "+value+"\n", "test")
+		if err == nil {
+			t.Errorf("Error was expected for Table = %s", value)
+		}
+	}
+}
+
+func TestFamilyMTU(t *testing.T) {
+	input := "[Interface]\nPrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=\nMTU = 1420\nIPv6MTU = 1400\n"
+	conf, err := FromWgQuick(input, "test")
+	if !noError(t, err) {
+		return
+	}
+	equal(t, uint16(1420), conf.Interface.EffectiveMTU(false))
+	equal(t, uint16(1400), conf.Interface.EffectiveMTU(true))
+	conf.Document = nil
+	equal(t, input, conf.ToWgQuick())
+	fromJSON, err := FromJSON(conf.ToJSON(), "test")
+	if noError(t, err) {
+		equal(t, conf.Interface, fromJSON.Interface)
+	}
+
+	conf, err = FromWgQuick("[Interface]\nPrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=\nIPv4MTU = 1380\n", "test")
+	if noError(t, err) {
+		equal(t, uint16(1380), conf.Interface.EffectiveMTU(false))
+		equal(t, uint16(0), conf.Interface.EffectiveMTU(true))
+	}
+	_, err = FromWgQuick("[Interface]\nPrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=\nIPv6MTU = 100\n", "test")
+	if err == nil {
+		t.Error("Error was expected for IPv6MTU = 100")
+	}
+}
+
+func TestBackupEndpoints(t *testing.T) {
+	input := "[Interface]\nPrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=\n\n[Peer]\nPublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=\nEndpoint = primary.example.com:51820, 192.0.2.1:51820, [2001:db8::1]:51820\n"
+	conf, err := FromWgQuick(input, "test")
+	if !noError(t, err) {
+		return
+	}
+	equal(t, Endpoint{"primary.example.com", 51820}, conf.Peers[0].Endpoint)
+	equal(t, []Endpoint{{"192.0.2.1", 51820}, {"2001:db8::1", 51820}}, conf.Peers[0].BackupEndpoints)
+	equal(t, 3, len(conf.Peers[0].Endpoints()))
+	conf.Document = nil
+	equal(t, input, conf.ToWgQuick())
+	fromJSON, err := FromJSON(conf.ToJSON(), "test")
+	if noError(t, err) {
+		equal(t, conf.Peers[0].Endpoints(), fromJSON.Peers[0].Endpoints())
+	}
+
+	_, diagnostics := Validate("[Interface]\nPrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=\n\n[Peer]\nPublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=\nEndpoint = 192.0.2.1:51820, 192.0.2.1:51820\n", "test")
+	if len(diagnostics) != 1 || diagnostics[0].Severity != DiagnosticWarning {
+		t.Errorf("A warning was expected for a repeated endpoint, but got %v", diagnostics)
+	}
+	_, err = FromWgQuick("[Interface]\nPrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=\n\n[Peer]\nPublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=\nEndpoint = 192.0.2.1:51820, 192.0.2.2\n", "test")
+	if err == nil {
+		t.Error("Error was expected for a backup endpoint without a port")
+	}
+}
+
+func TestDisplayName(t *testing.T) {
+	input := "[Interface]\nPrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=\n"
+	conf, err := FromWgQuick(input, "Buro-Berlin-Failover")
+	if !noError(t, err) {
+		return
+	}
+	equal(t, "Buro-Berlin-Failover", conf.Title())
+	conf.Metadata.DisplayName = "Büro Berlin (Failover)"
+	equal(t, "Büro Berlin (Failover)", conf.Title())
+	conf.Document = nil
+	equal(t, input, conf.ToWgQuick())
+	fromJSON, err := FromJSON(conf.ToJSON(), "Buro-Berlin-Failover")
+	if noError(t, err) {
+		equal(t, conf.Metadata, fromJSON.Metadata)
+	}
+
+	_, err = FromWgQuick("[Interface]\nDisplayName = Büro\nPrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=\n", "test")
+	if err == nil {
+		t.Error("Error was expected for a DisplayName key, which wg-quick does not know")
+	}
+	for _, value := range []string{"Tab\tSeparated", strings.Repeat("x", maxDisplayNameLength+1)} {
+		if DisplayNameIsValid(value) {
+			t.Errorf("Display name %q should be invalid", value)
+		}
+	}
+}
+
+func TestTagsAndFolder(t *testing.T) {
+	tags, err := ParseTags("Acme, production, acme, Spaß")
+	if !noError(t, err) {
+		return
+	}
+	folder, err := ParseFolder(" Customers / Acme ")
+	if !noError(t, err) {
+		return
+	}
+	metadata := Metadata{Tags: tags, Folder: folder}
+	equal(t, []string{"Acme", "production", "Spaß"}, metadata.Tags)
+	equal(t, "Customers/Acme", metadata.Folder)
+	equal(t, true, metadata.HasTag("ACME"))
+	equal(t, false, metadata.HasTag("staging"))
+	conf, err := FromWgQuick(testInput, "test")
+	if !noError(t, err) {
+		return
+	}
+	conf.Metadata = metadata
+	fromJSON, err := FromJSON(conf.ToJSON(), "test")
+	if noError(t, err) {
+		equal(t, conf.Metadata, fromJSON.Metadata)
+	}
+
+	tags, err = ParseTags(" ")
+	if noError(t, err) {
+		equal(t, 0, len(tags))
+	}
+	for _, value := range []string{"a,,b", strings.Repeat("x", maxTagLength+1)} {
+		if _, err := ParseTags(value); err == nil {
+			t.Errorf("Error was expected for tags %q", value)
+		}
+	}
+	for _, value := range []string{"a//b", "/a"} {
+		if _, err := ParseFolder(value); err == nil {
+			t.Errorf("Error was expected for folder %q", value)
+		}
+	}
+	for _, line := range []string{"Tags = a", "Folder = a"} {
+		_, err := FromWgQuick("[Interface]\n"+line+"\nPrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=\n", "test")
+		if err == nil {
+			t.Errorf("Error was expected for %s, which wg-quick does not know", line)
+		}
+	}
+}
+
+func TestDNSMatch(t *testing.T) {
+	input := "[Interface]\nPrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=\nDNS = 10.0.0.1\nDNSMatch = Corp.Example., *.lab.corp.example\n"
+	conf, err := FromWgQuick(input, "test")
+	if !noError(t, err) {
+		return
+	}
+	equal(t, []string{"corp.example", "*.lab.corp.example"}, conf.Interface.DNSMatch)
+	conf.Document = nil
+	equal(t, "[Interface]\nPrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=\nDNS = 10.0.0.1\nDNSMatch = corp.example, *.lab.corp.example\n", conf.ToWgQuick())
+	fromJSON, err := FromJSON(conf.ToJSON(), "test")
+	if noError(t, err) {
+		equal(t, conf.Interface.DNSMatch, fromJSON.Interface.DNSMatch)
+	}
+
+	for _, domain := range []string{"*", "a..b", "-a.b", "a b", "*.*.a", strings.Repeat("x", 64) + ".com"} {
+		_, err := FromWgQuick("[Interface]\nDNSMatch = "+domain+"\nPrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=\n", "test")
+		if err == nil {
+			t.Errorf("Error was expected for %s", domain)
+		}
+	}
+}
+
+func TestEncryptedDNS(t *testing.T) {
+	const prefix = "[Interface]\nPrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=\nDNS = 10.0.0.1\n"
+	conf, err := FromWgQuick(prefix+"DNSOverHTTPS = https://dns.corp.example/dns-query{?dns}\n", "test")
+	if noError(t, err) {
+		equal(t, "https://dns.corp.example/dns-query{?dns}", conf.Interface.DoHTemplate)
+		conf.Document = nil
+		equal(t, prefix+"DNSOverHTTPS = https://dns.corp.example/dns-query{?dns}\n", conf.ToWgQuick())
+		fromJSON, err := FromJSON(conf.ToJSON(), "test")
+		if noError(t, err) {
+			equal(t, conf.Interface.DoHTemplate, fromJSON.Interface.DoHTemplate)
+		}
+	}
+	conf, err = FromWgQuick(prefix+"DNSOverTLS = DNS.corp.example\n", "test")
+	if noError(t, err) {
+		equal(t, "dns.corp.example", conf.Interface.DoTName)
+	}
+
+	for _, line := range []string{
+		"DNSOverHTTPS = http://dns.corp.example/dns-query",
+		"DNSOverHTTPS = https:///dns-query",
+		"DNSOverHTTPS = https://user@dns.corp.example/dns-query",
+		"DNSOverHTTPS = https://dns.corp.example/dns-query?dns=x",
+		"DNSOverTLS = *.corp.example",
+		"DNSOverTLS = dns corp",
+		"DNSOverHTTPS = https://dns.corp.example/dns-query\nDNSOverTLS = dns.corp.example",
+	} {
+		_, err := FromWgQuick(prefix+line+"\n", "test")
+		if err == nil {
+			t.Errorf("Error was expected for %s", line)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	const input = "[Interface]\n" +
+		"PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=\n" +
+		"Address = 10.0.0.1/24, 10.0.0.300/24\n" +
+		"MTU = 100000\n" +
+		"\n" +
+		"[Peer]\n" +
+		"PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=\n" +
+		"Endpoint = 192.95.5.67:1234\n" +
+		"Endpoint = 192.95.5.68:1234\n" +
+		"Bogus = 1\n" +
+		"\n" +
+		"[Peer]\n" +
+		"AllowedIPs = 0.0.0.0/0\n"
+	conf, diagnostics := Validate(input, "test")
+	if conf != nil {
+		t.Error("Configuration with errors was returned")
+	}
+	if !lenTest(t, diagnostics, 5) {
+		return
+	}
+	for i, expected := range []struct {
+		severity     DiagnosticSeverity
+		line, column int
+		span         string
+	}{
+		{DiagnosticError, 3, 24, "10.0.0.300/24"},
+		{DiagnosticError, 4, 7, "100000"},
+		{DiagnosticWarning, 9, 1, "Endpoint"},
+		{DiagnosticError, 10, 1, "Bogus"},
+		{DiagnosticError, 12, 1, "[Peer]"},
+	} {
+		d := diagnostics[i]
+		equal(t, expected.severity, d.Severity)
+		equal(t, expected.line, d.Line)
+		equal(t, expected.column, d.Column)
+		equal(t, expected.span, input[d.Offset:d.Offset+d.Length])
+	}
+	if !HasErrors(diagnostics) {
+		t.Error("Errors were expected")
+	}
+	_, err := FromWgQuick(input, "test")
+	equal(t, diagnostics[0].Unwrap(), err)
+
+	conf, diagnostics = Validate(testInput, "test")
+	if conf == nil || len(diagnostics) != 0 {
+		t.Errorf("Unexpected diagnostics: %v", diagnostics)
+	}
+}
@@ -0,0 +1,102 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Data encrypted by a passphrase encrypter starts with passphraseMagic, followed by the salt of the key
+// derivation, the nonce, and the ciphertext with its tag.
+const (
+	passphraseMagic    = "WGPP\x01"
+	passphraseSaltSize = 16
+)
+
+// The Argon2id parameters are those recommended by RFC 9106 for memory-constrained environments.
+const (
+	passphraseArgonTime    = 3
+	passphraseArgonMemory  = 64 * 1024
+	passphraseArgonThreads = 4
+)
+
+var ErrWrongPassphrase = errors.New("The passphrase is wrong or the data is corrupt")
+
+type passphraseEncrypter struct {
+	passphrase []byte
+	salt       [passphraseSaltSize]byte
+
+	mutex sync.Mutex
+	keys  map[[passphraseSaltSize]byte][]byte
+}
+
+// NewPassphraseEncrypter returns an Encrypter that encrypts with XChaCha20-Poly1305, under a key derived
+// from passphrase with Argon2id, and with the name of the tunnel as additional data. The key is derived
+// once for each salt, and the encrypter uses the same random salt for everything it encrypts.
+func NewPassphraseEncrypter(passphrase string) (Encrypter, error) {
+	e := &passphraseEncrypter{
+		passphrase: []byte(passphrase),
+		keys:       make(map[[passphraseSaltSize]byte][]byte),
+	}
+	_, err := rand.Read(e.salt[:])
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *passphraseEncrypter) key(salt [passphraseSaltSize]byte) []byte {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	key, ok := e.keys[salt]
+	if !ok {
+		key = argon2.IDKey(e.passphrase, salt[:], passphraseArgonTime, passphraseArgonMemory, passphraseArgonThreads, chacha20poly1305.KeySize)
+		e.keys[salt] = key
+	}
+	return key
+}
+
+func (e *passphraseEncrypter) Encrypt(data []byte, name string) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(e.key(e.salt))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(passphraseMagic)+passphraseSaltSize+aead.NonceSize()+len(data)+aead.Overhead())
+	out = append(out, passphraseMagic...)
+	out = append(out, e.salt[:]...)
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, data, []byte(name)), nil
+}
+
+func (e *passphraseEncrypter) Decrypt(data []byte, name string) ([]byte, error) {
+	if len(data) < len(passphraseMagic)+passphraseSaltSize+chacha20poly1305.NonceSizeX || !bytes.HasPrefix(data, []byte(passphraseMagic)) {
+		return nil, ErrWrongPassphrase
+	}
+	data = data[len(passphraseMagic):]
+	var salt [passphraseSaltSize]byte
+	copy(salt[:], data)
+	data = data[passphraseSaltSize:]
+	aead, err := chacha20poly1305.NewX(e.key(salt))
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(name))
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,53 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"testing"
+)
+
+func TestPassphraseEncrypter(t *testing.T) {
+	e, err := NewPassphraseEncrypter("correct horse battery staple")
+	if !noError(t, err) {
+		return
+	}
+	plaintext := []byte(testInput)
+	ciphertext, err := e.Encrypt(plaintext, "golangTest")
+	if !noError(t, err) {
+		return
+	}
+	decrypted, err := e.Decrypt(ciphertext, "golangTest")
+	if noError(t, err) {
+		equal(t, plaintext, decrypted)
+	}
+
+	other, err := NewPassphraseEncrypter("correct horse battery staple")
+	if !noError(t, err) {
+		return
+	}
+	decrypted, err = other.Decrypt(ciphertext, "golangTest")
+	if noError(t, err) {
+		equal(t, plaintext, decrypted)
+	}
+
+	wrong, err := NewPassphraseEncrypter("incorrect horse battery staple")
+	if !noError(t, err) {
+		return
+	}
+	if _, err := wrong.Decrypt(ciphertext, "golangTest"); err != ErrWrongPassphrase {
+		t.Errorf("Decrypting with the wrong passphrase should fail with ErrWrongPassphrase, but got %v", err)
+	}
+	if _, err := e.Decrypt(ciphertext, "otherName"); err != ErrWrongPassphrase {
+		t.Errorf("Decrypting under another name should fail with ErrWrongPassphrase, but got %v", err)
+	}
+	ciphertext[len(ciphertext)-1] ^= 1
+	if _, err := e.Decrypt(ciphertext, "golangTest"); err != ErrWrongPassphrase {
+		t.Errorf("Decrypting corrupt data should fail with ErrWrongPassphrase, but got %v", err)
+	}
+	if _, err := e.Decrypt(ciphertext[:10], "golangTest"); err != ErrWrongPassphrase {
+		t.Errorf("Decrypting truncated data should fail with ErrWrongPassphrase, but got %v", err)
+	}
+}
@@ -35,6 +35,19 @@ func tunnelConfigurationsDirectory() (string, error) {
 	return cachedConfigFileDir, nil
 }
 
+func tunnelHistoryDirectory(name string) (string, error) {
+	root, err := RootDirectory(true)
+	if err != nil {
+		return "", err
+	}
+	c := filepath.Join(root, "History", name)
+	err = os.MkdirAll(c, os.ModeDir|0700)
+	if err != nil {
+		return "", err
+	}
+	return c, nil
+}
+
 // PresetRootDirectory causes RootDirectory() to not try any automatic deduction, and instead
 // uses what's passed to it. This isn't used by wireguard-windows, but is useful for external
 // consumers of our libraries who might want to do strange things.
@@ -0,0 +1,45 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+// PeerHealthState is how a peer of a running tunnel is doing, according to the health monitor of its
+// tunnel service: healthy peers have completed a recent handshake, idle ones are not sent to, and
+// recovering and unreachable ones are sent data but do not answer.
+type PeerHealthState int
+
+const (
+	PeerHealthUnknown PeerHealthState = iota
+	PeerHealthy
+	PeerIdle
+	PeerRecovering
+	PeerUnreachable
+)
+
+// These are the names of the states in the health operation on the UAPI pipe of a tunnel service.
+var peerHealthStateNames = [...]string{
+	PeerHealthUnknown: "unknown",
+	PeerHealthy:       "healthy",
+	PeerIdle:          "idle",
+	PeerRecovering:    "recovering",
+	PeerUnreachable:   "unreachable",
+}
+
+func (state PeerHealthState) String() string {
+	if state >= 0 && int(state) < len(peerHealthStateNames) {
+		return peerHealthStateNames[state]
+	}
+	return peerHealthStateNames[PeerHealthUnknown]
+}
+
+// ParsePeerHealthState returns the state with the given name, or PeerHealthUnknown if there is none.
+func ParsePeerHealthState(name string) PeerHealthState {
+	for state := range peerHealthStateNames {
+		if peerHealthStateNames[state] == name {
+			return PeerHealthState(state)
+		}
+	}
+	return PeerHealthUnknown
+}
@@ -0,0 +1,94 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"net"
+	"sort"
+
+	"golang.zx2c4.com/wireguard/windows/l18n"
+)
+
+// FirewallMode is how the firewall treats traffic outside of the tunnel.
+type FirewallMode int
+
+const (
+	FirewallUnrestricted         FirewallMode = iota // Untunneled traffic is not restricted
+	FirewallBlock                                    // Untunneled traffic is blocked
+	FirewallBlockExceptTunnelDNS                     // Untunneled traffic is blocked, and DNS only reaches the servers of the tunnel
+	FirewallBlockExceptDNS                           // Untunneled traffic is blocked, except DNS, as split DNS uses the servers of other interfaces
+)
+
+// PreflightProblem is something that would keep a configuration from working once activated, or that
+// would disturb other traffic.
+type PreflightProblem struct {
+	Severity DiagnosticSeverity
+	Message  string
+}
+
+// PreflightEndpoint is an endpoint of a peer, along with the address that it resolves to, which is
+// empty if it cannot be resolved.
+type PreflightEndpoint struct {
+	PublicKey Key
+	Endpoint  Endpoint
+	Resolved  string
+}
+
+// PreflightReport is the outcome of checking a configuration without activating it, along with what
+// activating it would apply. If Diagnostics holds an error, nothing else is filled in.
+type PreflightReport struct {
+	Diagnostics []Diagnostic
+	Findings    []LintFinding
+	Problems    []PreflightProblem
+	Endpoints   []PreflightEndpoint
+
+	Routes      []net.IPNet
+	RouteMetric uint32
+
+	DNSServers      []net.IP // The servers that are set on the interface
+	DNSSearch       []string
+	DNSNamespaces   []string // The names whose queries go to DNSMatchServers, rather than the usual servers
+	DNSMatchServers []net.IP
+	DNSForwardedTo  []net.IP // The servers that the DNS forwarder queries over HTTPS or TLS, if it is used
+
+	Firewall FirewallMode
+}
+
+// HasErrors reports whether any problem would keep the configuration from being activated.
+func (r *PreflightReport) HasErrors() bool {
+	if HasErrors(r.Diagnostics) {
+		return true
+	}
+	for i := range r.Findings {
+		if r.Findings[i].Severity == DiagnosticError {
+			return true
+		}
+	}
+	for i := range r.Problems {
+		if r.Problems[i].Severity == DiagnosticError {
+			return true
+		}
+	}
+	return false
+}
+
+// AddUncheckedTunnels reports the active tunnels whose configurations could not be loaded, by name,
+// as the configuration was not checked against them.
+func (r *PreflightReport) AddUncheckedTunnels(unloadable map[string]error) {
+	if HasErrors(r.Diagnostics) {
+		return
+	}
+	names := make([]string, 0, len(unloadable))
+	for name := range unloadable {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return TunnelNameIsLess(names[i], names[j])
+	})
+	for _, name := range names {
+		r.Problems = append(r.Problems, PreflightProblem{DiagnosticWarning, l18n.Sprintf("Unable to check against the active tunnel ‘%s’: %v", name, unloadable[name])})
+	}
+}
@@ -0,0 +1,71 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"net"
+)
+
+// WithRuntimeState returns a copy of the configuration with the peers, endpoints, and allowed IPs that
+// runtime, as read back from the running interface with FromUAPI, reports, for saving when SaveConfig
+// is set. Everything that the running interface does not know about is kept: the addresses, DNS
+// servers, scripts, and the document with its comments. Hostname endpoints are kept rather than being
+// replaced by the address they happen to resolve to, as are the endpoints of peers with backup
+// endpoints, which the running interface may have failed over from, and so are AllowedIPs and
+// DisallowedIPs that still amount to the allowed IPs of the running peer.
+func (config *Config) WithRuntimeState(runtime *Config) *Config {
+	merged := *config
+	if config.Document != nil {
+		merged.Document = config.Document.Clone()
+	}
+	merged.Interface.PrivateKey = runtime.Interface.PrivateKey
+	if runtime.Interface.ListenPort != 0 {
+		merged.Interface.ListenPort = runtime.Interface.ListenPort
+	}
+	merged.Peers = make([]Peer, 0, len(runtime.Peers))
+	for i := range runtime.Peers {
+		peer := Peer{
+			PublicKey:           runtime.Peers[i].PublicKey,
+			PresharedKey:        runtime.Peers[i].PresharedKey,
+			AllowedIPs:          runtime.Peers[i].AllowedIPs,
+			Endpoint:            runtime.Peers[i].Endpoint,
+			PersistentKeepalive: runtime.Peers[i].PersistentKeepalive,
+		}
+		for j := range config.Peers {
+			stored := &config.Peers[j]
+			if stored.PublicKey != peer.PublicKey {
+				continue
+			}
+			if len(stored.BackupEndpoints) > 0 {
+				peer.Endpoint = stored.Endpoint
+				peer.BackupEndpoints = stored.BackupEndpoints
+			} else if peer.Endpoint.IsEmpty() || (!stored.Endpoint.IsEmpty() && net.ParseIP(stored.Endpoint.Host) == nil) {
+				peer.Endpoint = stored.Endpoint
+			}
+			if sameIPCidrs(stored.EffectiveAllowedIPs(), peer.AllowedIPs) {
+				peer.AllowedIPs = stored.AllowedIPs
+				peer.DisallowedIPs = stored.DisallowedIPs
+			}
+			break
+		}
+		merged.Peers = append(merged.Peers, peer)
+	}
+	return &merged
+}
+
+// sameIPCidrs reports whether a and b cover the same addresses.
+func sameIPCidrs(a, b []IPCidr) bool {
+	a, b = NormalizeIPCidrs(a), NormalizeIPCidrs(b)
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if compareIPCidrs(&a[i], &b[i]) != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const testSaveConfigInput = `[Interface]
+# Office laptop
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+Address = 10.192.122.1/24
+SaveConfig = true
+PostUp = echo up
+
+# Gateway, reached by name
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 0.0.0.0/0
+DisallowedIPs = 192.168.0.0/16
+Endpoint = test.wireguard.com:18981
+
+# Roaming phone
+[Peer]
+PublicKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+AllowedIPs = 10.10.10.2/32
+Endpoint = 192.0.2.1:51820
+
+# Removed at runtime
+[Peer]
+PublicKey = gN65BkIKy1eCE9pP1wdc8ROUtkHLF2PfAqYdyYBz6EA=
+AllowedIPs = 10.10.10.3/32
+`
+
+const testSaveConfigOutput = `[Interface]
+# Office laptop
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+Address = 10.192.122.1/24
+SaveConfig = true
+PostUp = echo up
+ListenPort = 41414
+
+# Gateway, reached by name
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 0.0.0.0/0
+DisallowedIPs = 192.168.0.0/16
+Endpoint = test.wireguard.com:18981
+
+# Roaming phone
+[Peer]
+PublicKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+AllowedIPs = 10.10.10.2/32, 10.10.20.0/24
+Endpoint = 198.51.100.7:40000
+
+[Peer]
+PublicKey = HIgo9xNzJMWLKASShiTqIybxZ0U3wGLiUeJ1PKf8ykw=
+AllowedIPs = 10.10.10.4/32
+`
+
+func TestWithRuntimeState(t *testing.T) {
+	config, err := FromWgQuick(testSaveConfigInput, "test")
+	if !noError(t, err) {
+		return
+	}
+	if !config.Interface.SaveConfig {
+		t.Error("SaveConfig was not parsed")
+	}
+	added, err := parseKeyBase64("HIgo9xNzJMWLKASShiTqIybxZ0U3wGLiUeJ1PKf8ykw=")
+	if !noError(t, err) {
+		return
+	}
+	gateway, phone := config.Peers[0].PublicKey, config.Peers[1].PublicKey
+	uapi := fmt.Sprintf("private_key=%s\nlisten_port=41414\n", config.Interface.PrivateKey.HexString())
+	uapi += fmt.Sprintf("public_key=%s\nendpoint=203.0.113.9:18981\n", gateway.HexString())
+	for _, cidr := range config.Peers[0].EffectiveAllowedIPs() {
+		uapi += fmt.Sprintf("allowed_ip=%s\n", cidr.String())
+	}
+	uapi += fmt.Sprintf("public_key=%s\nendpoint=198.51.100.7:40000\nallowed_ip=10.10.10.2/32\nallowed_ip=10.10.20.0/24\n", phone.HexString())
+	uapi += fmt.Sprintf("public_key=%s\nallowed_ip=10.10.10.4/32\n", added.HexString())
+	runtime, err := FromUAPI(strings.NewReader(uapi+"\n"), config)
+	if !noError(t, err) {
+		return
+	}
+
+	merged := config.WithRuntimeState(runtime)
+	if !noError(t, merged.Document.Apply(merged)) {
+		return
+	}
+	equal(t, testSaveConfigOutput, merged.Document.String())
+	equal(t, testSaveConfigInput, config.Document.String())
+	equal(t, 3, len(config.Peers))
+}
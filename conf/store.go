@@ -7,76 +7,52 @@ package conf
 
 import (
 	"errors"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
-
-	"golang.zx2c4.com/wireguard/windows/conf/dpapi"
 )
 
 const configFileSuffix = ".conf.dpapi"
 const configFileUnencryptedSuffix = ".conf"
+const metadataFileSuffix = ".meta.dpapi"
 
 func ListConfigNames() ([]string, error) {
-	configFileDir, err := tunnelConfigurationsDirectory()
-	if err != nil {
-		return nil, err
+	s, _ := currentStore()
+	return s.Names()
+}
+
+func readStoredConfig(name string) (string, error) {
+	if !TunnelNameIsValid(name) {
+		return "", errors.New("Tunnel name is not valid")
 	}
-	files, err := os.ReadDir(configFileDir)
+	s, e := currentStore()
+	bytes, _, err := s.Read(name)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	configs := make([]string, len(files))
-	i := 0
-	for _, file := range files {
-		name := filepath.Base(file.Name())
-		if len(name) <= len(configFileSuffix) || !strings.HasSuffix(name, configFileSuffix) {
-			continue
-		}
-		if !file.Type().IsRegular() {
-			continue
-		}
-		info, err := file.Info()
-		if err != nil {
-			continue
-		}
-		if info.Mode().Perm()&0444 == 0 {
-			continue
-		}
-		name = strings.TrimSuffix(name, configFileSuffix)
-		if !TunnelNameIsValid(name) {
-			continue
-		}
-		configs[i] = name
-		i++
+	bytes, err = e.Decrypt(bytes, name)
+	if err != nil {
+		return "", err
 	}
-	return configs[:i], nil
+	return string(bytes), nil
 }
 
 func LoadFromName(name string) (*Config, error) {
-	configFileDir, err := tunnelConfigurationsDirectory()
+	contents, err := readStoredConfig(name)
 	if err != nil {
 		return nil, err
 	}
-	return LoadFromPath(filepath.Join(configFileDir, name+configFileSuffix))
-}
-
-func LoadFromPath(path string) (*Config, error) {
-	name, err := NameFromPath(path)
+	config, err := FromWgQuickWithUnknownEncoding(contents, name)
 	if err != nil {
 		return nil, err
 	}
-	bytes, err := os.ReadFile(path)
+	// Metadata that cannot be read must not keep the tunnel from being used.
+	config.Metadata, err = readMetadata(name)
 	if err != nil {
-		return nil, err
+		log.Printf("Unable to read metadata of %s: %v", name, err)
 	}
-	if strings.HasSuffix(path, configFileSuffix) {
-		bytes, err = dpapi.Decrypt(bytes, name)
-		if err != nil {
-			return nil, err
-		}
-	}
-	return FromWgQuickWithUnknownEncoding(string(bytes), name)
+	return config, nil
 }
 
 func PathIsEncrypted(path string) bool {
@@ -101,42 +77,110 @@ func NameFromPath(path string) (string, error) {
 }
 
 func (config *Config) Save(overwrite bool) error {
+	return config.SaveEditedBy(overwrite, currentUserName())
+}
+
+// SaveEditedBy saves the configuration like Save, but records user rather than the user of the current
+// process as the author of the new revision.
+func (config *Config) SaveEditedBy(overwrite bool, user string) error {
 	if !TunnelNameIsValid(config.Name) {
 		return errors.New("Tunnel name is not valid")
 	}
-	configFileDir, err := tunnelConfigurationsDirectory()
+	s, _ := currentStore()
+	unlock, err := s.Lock(config.Name)
 	if err != nil {
 		return err
 	}
-	filename := filepath.Join(configFileDir, config.Name+configFileSuffix)
-	bytes := []byte(config.ToWgQuick())
-	bytes, err = dpapi.Encrypt(bytes, config.Name)
+	defer unlock()
+	return config.save(overwrite, user)
+}
+
+func (config *Config) save(overwrite bool, user string) error {
+	s, e := currentStore()
+	var contents string
+	if config.Document != nil {
+		// Copies of the configuration share its document, so the fields are applied to a clone of it.
+		doc := config.Document.Clone()
+		err := doc.Apply(config)
+		if err != nil {
+			return err
+		}
+		config.Document = doc
+		contents = doc.String()
+	} else {
+		contents = config.ToWgQuick()
+	}
+	previous, previousModified, err := s.Read(config.Name)
+	if err != nil {
+		previous = nil
+	} else if !overwrite {
+		return os.ErrExist
+	}
+	bytes, err := e.Encrypt([]byte(contents), config.Name)
+	if err != nil {
+		return err
+	}
+	err = s.Write(config.Name, bytes, overwrite)
+	if err != nil {
+		return err
+	}
+	err = writeMetadata(config.Name, config.Metadata)
 	if err != nil {
 		return err
 	}
-	return writeLockedDownFile(filename, overwrite, bytes)
+	// The configuration is saved even if its history cannot be updated.
+	err = recordRevision(config.Name, contents, user, previous, previousModified)
+	if err != nil {
+		log.Printf("Unable to record revision of %s: %v", config.Name, err)
+	}
+	return nil
 }
 
-func (config *Config) Path() (string, error) {
+var ErrConfigModified = errors.New("Tunnel configuration was modified or removed in the meantime")
+
+// SaveIfUnmodified saves the configuration like Save, but only if the document of the stored
+// configuration of the tunnel still reads exactly original, which is checked and written while holding
+// the same lock as Save, so that an edit made in the meantime is never overwritten. If the stored
+// configuration has changed or is gone, ErrConfigModified is returned. The stored metadata is kept, as
+// it is not part of the document.
+func (config *Config) SaveIfUnmodified(original string) error {
 	if !TunnelNameIsValid(config.Name) {
-		return "", errors.New("Tunnel name is not valid")
+		return errors.New("Tunnel name is not valid")
 	}
-	configFileDir, err := tunnelConfigurationsDirectory()
+	s, _ := currentStore()
+	unlock, err := s.Lock(config.Name)
 	if err != nil {
-		return "", err
+		return err
 	}
-	return filepath.Join(configFileDir, config.Name+configFileSuffix), nil
+	defer unlock()
+	stored, err := LoadFromName(config.Name)
+	if os.IsNotExist(err) {
+		return ErrConfigModified
+	} else if err != nil {
+		return err
+	}
+	if stored.Document.String() != original {
+		return ErrConfigModified
+	}
+	config.Metadata = stored.Metadata
+	return config.save(true, currentUserName())
 }
 
 func DeleteName(name string) error {
 	if !TunnelNameIsValid(name) {
 		return errors.New("Tunnel name is not valid")
 	}
-	configFileDir, err := tunnelConfigurationsDirectory()
+	s, _ := currentStore()
+	unlock, err := s.Lock(name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	err = s.Delete(name)
 	if err != nil {
 		return err
 	}
-	return os.Remove(filepath.Join(configFileDir, name+configFileSuffix))
+	return s.WriteMetadata(name, nil)
 }
 
 func (config *Config) Delete() error {
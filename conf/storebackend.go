@@ -0,0 +1,82 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"sync"
+	"time"
+)
+
+// Store keeps the encrypted configurations of tunnels, along with their revisions, by the name of the
+// tunnel. The default store, which is the one that the manager and the tunnel services use, keeps them
+// in files in the configuration directory. Other stores may be used with UseStore.
+type Store interface {
+	// Names returns the names of the stored tunnels.
+	Names() ([]string, error)
+	// Read returns the stored configuration of a tunnel and when it was written. If there is none,
+	// the error satisfies os.IsNotExist.
+	Read(name string) (data []byte, modified time.Time, err error)
+	// Write atomically replaces the stored configuration of a tunnel. Unless overwrite is set, it
+	// fails with an error satisfying os.IsExist if there already is one.
+	Write(name string, data []byte, overwrite bool) error
+	// Delete removes the stored configuration of a tunnel, but not its revisions.
+	Delete(name string) error
+	// Lock keeps everyone else using the store, including other processes, from changing the
+	// configuration of a tunnel, until the returned function is called.
+	Lock(name string) (unlock func(), err error)
+
+	// ReadMetadata returns the stored metadata of a tunnel. If there is none, the error satisfies
+	// os.IsNotExist.
+	ReadMetadata(name string) ([]byte, error)
+	// WriteMetadata atomically replaces the stored metadata of a tunnel, or removes it if data is nil.
+	WriteMetadata(name string, data []byte) error
+
+	// Revisions returns the IDs of the revisions of a tunnel, in no particular order.
+	Revisions(name string) ([]string, error)
+	ReadRevision(name, id string) ([]byte, error)
+	WriteRevision(name, id string, data []byte) error
+	DeleteRevision(name, id string) error
+}
+
+// Encrypter encrypts configurations for a Store. The data is bound to the name of the tunnel, so that
+// decrypting it under any other name fails.
+type Encrypter interface {
+	Encrypt(data []byte, name string) ([]byte, error)
+	Decrypt(data []byte, name string) ([]byte, error)
+}
+
+// watchableStore is implemented by stores that need to be watched for changes made behind their back,
+// rather than reporting changes themselves.
+type watchableStore interface {
+	startWatching()
+}
+
+var (
+	storeMutex sync.Mutex
+	store      Store
+	encrypter  Encrypter
+)
+
+// UseStore makes this package keep configurations in s, encrypted with e, rather than in the
+// configuration directory, encrypted with DPAPI. This isn't used by wireguard-windows, whose tunnel
+// services load their configurations from the configuration directory, but is useful for tests and
+// for external consumers of our libraries. It must be called before any configuration is loaded or
+// saved.
+func UseStore(s Store, e Encrypter) {
+	storeMutex.Lock()
+	store, encrypter = s, e
+	storeMutex.Unlock()
+	resetStoreSnapshot()
+}
+
+func currentStore() (Store, Encrypter) {
+	storeMutex.Lock()
+	defer storeMutex.Unlock()
+	if store == nil {
+		store, encrypter = defaultStore()
+	}
+	return store, encrypter
+}
@@ -0,0 +1,45 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockStoreName serializes writes to the stored configuration of a tunnel across processes, so that
+// the tunnel service saving its runtime state does not interleave with an edit from the manager. The
+// returned function releases the lock.
+func lockStoreName(name string) (func(), error) {
+	sd, err := windows.SecurityDescriptorFromString("O:SYD:(A;;GA;;;SY)(A;;GA;;;BA)")
+	if err != nil {
+		return nil, err
+	}
+	sa := &windows.SecurityAttributes{Length: uint32(unsafe.Sizeof(windows.SecurityAttributes{})), SecurityDescriptor: sd}
+	mutexName, err := windows.UTF16PtrFromString(`Global\WireGuard-Config-` + strings.ToLower(name))
+	if err != nil {
+		return nil, err
+	}
+	mutex, err := windows.CreateMutex(sa, false, mutexName)
+	if err != nil && err != windows.ERROR_ALREADY_EXISTS {
+		return nil, err
+	}
+	event, err := windows.WaitForSingleObject(mutex, windows.INFINITE)
+	if err != nil {
+		windows.CloseHandle(mutex)
+		return nil, err
+	}
+	if event != windows.WAIT_OBJECT_0 && event != windows.WAIT_ABANDONED {
+		windows.CloseHandle(mutex)
+		return nil, windows.ERROR_LOCK_FAILED
+	}
+	return func() {
+		windows.ReleaseMutex(mutex)
+		windows.CloseHandle(mutex)
+	}, nil
+}
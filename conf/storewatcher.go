@@ -5,20 +5,228 @@
 
 package conf
 
+import (
+	"crypto/sha256"
+	"sort"
+	"sync"
+	"time"
+)
+
+type StoreChangeType int
+
+const (
+	StoreChangeAdded StoreChangeType = iota
+	StoreChangeRemoved
+	StoreChangeModified
+	StoreChangeRenamed
+)
+
+// StoreChange describes a change to a single stored configuration. OldName is only set for renames.
+type StoreChange struct {
+	Type    StoreChangeType
+	Name    string
+	OldName string
+}
+
 type StoreCallback struct {
-	cb func()
+	cb     func()
+	events func(changes []StoreChange)
+}
+
+// storeChangeDebounce is how long the store must be quiet after a change before callbacks are told about
+// it, so that a burst of notifications from the directory watcher results in a single batch of changes.
+var storeChangeDebounce = 100 * time.Millisecond
+
+// storeSnapshotEntry is what a snapshot keeps of a stored configuration and its metadata. The hash of
+// the encrypted data tells whether the decrypted data needs to be hashed again, which is what changes
+// are found with, as the same configuration encrypted again need not encrypt to the same data.
+type storeSnapshotEntry struct {
+	encrypted [sha256.Size]byte
+	decrypted [sha256.Size]byte
 }
 
-var storeCallbacks = make(map[*StoreCallback]bool)
+var (
+	storeCallbacksMutex sync.Mutex
+	storeCallbacks      = make(map[*StoreCallback]bool)
+	storeChangeTimer    *time.Timer
+
+	// storeSnapshotMutex is held while the store is read to find what changed, which may take a while,
+	// so it is separate from storeCallbacksMutex, which only guards the callbacks and the timer. When
+	// both are held, storeSnapshotMutex is taken first.
+	storeSnapshotMutex sync.Mutex
+	storeSnapshot      map[string]storeSnapshotEntry
+)
 
+// RegisterStoreChangeCallback calls cb now and after every batch of changes to the store.
 func RegisterStoreChangeCallback(cb func()) *StoreCallback {
-	startWatchingConfigDir()
+	s := registerStoreCallback(&StoreCallback{cb: cb})
 	cb()
-	s := &StoreCallback{cb}
-	storeCallbacks[s] = true
 	return s
 }
 
+// RegisterStoreChangeEventCallback calls cb with every batch of changes to the store.
+func RegisterStoreChangeEventCallback(cb func(changes []StoreChange)) *StoreCallback {
+	return registerStoreCallback(&StoreCallback{events: cb})
+}
+
+func registerStoreCallback(cb *StoreCallback) *StoreCallback {
+	s, _ := currentStore()
+	storeSnapshotMutex.Lock()
+	if storeSnapshot == nil {
+		storeSnapshot = takeStoreSnapshot(nil)
+	}
+	storeCallbacksMutex.Lock()
+	storeCallbacks[cb] = true
+	storeCallbacksMutex.Unlock()
+	storeSnapshotMutex.Unlock()
+	if watchable, ok := s.(watchableStore); ok {
+		watchable.startWatching()
+	}
+	return cb
+}
+
 func (cb *StoreCallback) Unregister() {
+	storeCallbacksMutex.Lock()
 	delete(storeCallbacks, cb)
+	storeCallbacksMutex.Unlock()
+}
+
+// notifyStoreChange is called by stores whenever something might have changed. The callbacks run once
+// the store has been quiet for storeChangeDebounce.
+func notifyStoreChange() {
+	storeCallbacksMutex.Lock()
+	defer storeCallbacksMutex.Unlock()
+	if storeChangeTimer == nil {
+		storeChangeTimer = time.AfterFunc(storeChangeDebounce, deliverStoreChanges)
+	} else {
+		storeChangeTimer.Reset(storeChangeDebounce)
+	}
+}
+
+// resetStoreSnapshot forgets the contents of the previous store, after it has been replaced.
+func resetStoreSnapshot() {
+	storeSnapshotMutex.Lock()
+	defer storeSnapshotMutex.Unlock()
+	storeCallbacksMutex.Lock()
+	watched := len(storeCallbacks) > 0
+	storeCallbacksMutex.Unlock()
+	storeSnapshot = nil
+	if watched {
+		storeSnapshot = takeStoreSnapshot(nil)
+	}
+}
+
+func deliverStoreChanges() {
+	storeSnapshotMutex.Lock()
+	storeCallbacksMutex.Lock()
+	callbacks := make([]*StoreCallback, 0, len(storeCallbacks))
+	for cb := range storeCallbacks {
+		callbacks = append(callbacks, cb)
+	}
+	storeCallbacksMutex.Unlock()
+	if len(callbacks) == 0 {
+		// Nobody is told about these changes, so the next callback starts from a fresh snapshot.
+		storeSnapshot = nil
+		storeSnapshotMutex.Unlock()
+		return
+	}
+	snapshot := takeStoreSnapshot(storeSnapshot)
+	changes := diffStoreSnapshots(storeSnapshot, snapshot)
+	storeSnapshot = snapshot
+	storeSnapshotMutex.Unlock()
+
+	for _, cb := range callbacks {
+		if cb.cb != nil {
+			cb.cb()
+		} else if len(changes) > 0 {
+			cb.events(changes)
+		}
+	}
+}
+
+// takeStoreSnapshot hashes the decrypted contents of every stored configuration along with its metadata,
+// so that a configuration that disappears under one name and appears under another with the same
+// contents counts as a rename, and a change to the metadata alone counts as a modification. Only the
+// configurations whose encrypted data differs from that in previous are decrypted.
+func takeStoreSnapshot(previous map[string]storeSnapshotEntry) map[string]storeSnapshotEntry {
+	s, e := currentStore()
+	names, err := s.Names()
+	if err != nil {
+		return nil
+	}
+	decrypt := func(data []byte, name string) []byte {
+		if plaintext, err := e.Decrypt(data, name); err == nil {
+			return plaintext
+		}
+		return data
+	}
+	snapshot := make(map[string]storeSnapshotEntry, len(names))
+	for _, name := range names {
+		data, _, err := s.Read(name)
+		if err != nil {
+			continue
+		}
+		metadata, err := s.ReadMetadata(name)
+		if err != nil {
+			metadata = nil
+		}
+		var entry storeSnapshotEntry
+		hash := sha256.New()
+		hash.Write(data)
+		hash.Write(metadata)
+		copy(entry.encrypted[:], hash.Sum(nil))
+		if old, ok := previous[name]; ok && old.encrypted == entry.encrypted {
+			snapshot[name] = old
+			continue
+		}
+		hash.Reset()
+		hash.Write(decrypt(data, name))
+		if metadata != nil {
+			hash.Write(decrypt(metadata, name))
+		}
+		copy(entry.decrypted[:], hash.Sum(nil))
+		snapshot[name] = entry
+	}
+	return snapshot
+}
+
+func diffStoreSnapshots(old, new map[string]storeSnapshotEntry) []StoreChange {
+	var added, removed []string
+	var changes []StoreChange
+	for name, hash := range new {
+		oldHash, ok := old[name]
+		if !ok {
+			added = append(added, name)
+		} else if oldHash.decrypted != hash.decrypted {
+			changes = append(changes, StoreChange{Type: StoreChangeModified, Name: name})
+		}
+	}
+	for name := range old {
+		if _, ok := new[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	for _, name := range added {
+		renamed := false
+		for i, oldName := range removed {
+			if old[oldName].decrypted == new[name].decrypted {
+				changes = append(changes, StoreChange{Type: StoreChangeRenamed, Name: name, OldName: oldName})
+				removed = append(removed[:i], removed[i+1:]...)
+				renamed = true
+				break
+			}
+		}
+		if !renamed {
+			changes = append(changes, StoreChange{Type: StoreChangeAdded, Name: name})
+		}
+	}
+	for _, name := range removed {
+		changes = append(changes, StoreChange{Type: StoreChangeRemoved, Name: name})
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return TunnelNameIsLess(changes[i].Name, changes[j].Name)
+	})
+	return changes
 }
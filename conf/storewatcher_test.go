@@ -0,0 +1,111 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStoreChangeEvents(t *testing.T) {
+	useMemoryStore(t)
+	defer UseStore(nil, nil)
+	defer func(debounce time.Duration) { storeChangeDebounce = debounce }(storeChangeDebounce)
+	storeChangeDebounce = time.Millisecond * 20
+
+	events := make(chan []StoreChange, 10)
+	cb := RegisterStoreChangeEventCallback(func(changes []StoreChange) {
+		events <- changes
+	})
+	defer cb.Unregister()
+	next := func() []StoreChange {
+		select {
+		case changes := <-events:
+			return changes
+		case <-time.After(time.Second * 5):
+			t.Fatal("Timed out waiting for store changes")
+			return nil
+		}
+	}
+
+	first, err := FromWgQuick(testInput, "first")
+	if !noError(t, err) {
+		return
+	}
+	second, err := FromWgQuick(testInput, "second")
+	if !noError(t, err) {
+		return
+	}
+	second.Interface.ListenPort = 1234
+	noError(t, first.Save(false))
+	noError(t, second.Save(false))
+	equal(t, []StoreChange{{Type: StoreChangeAdded, Name: "first"}, {Type: StoreChangeAdded, Name: "second"}}, next())
+
+	first.Interface.ListenPort = 4321
+	noError(t, first.Save(true))
+	equal(t, []StoreChange{{Type: StoreChangeModified, Name: "first"}}, next())
+
+	third := *second
+	third.Name = "third"
+	noError(t, third.Save(false))
+	noError(t, DeleteName("second"))
+	equal(t, []StoreChange{{Type: StoreChangeRenamed, Name: "third", OldName: "second"}}, next())
+
+	noError(t, DeleteName("first"))
+	equal(t, []StoreChange{{Type: StoreChangeRemoved, Name: "first"}}, next())
+
+	select {
+	case changes := <-events:
+		t.Errorf("Unexpected store changes: %v", changes)
+	case <-time.After(storeChangeDebounce * 5):
+	}
+}
+
+type countingEncrypter struct {
+	Encrypter
+	decrypted int
+}
+
+func (e *countingEncrypter) Decrypt(data []byte, name string) ([]byte, error) {
+	e.decrypted++
+	return e.Encrypter.Decrypt(data, name)
+}
+
+func TestStoreSnapshotDecryptsOnlyChanges(t *testing.T) {
+	passphrase, err := NewPassphraseEncrypter("correct horse battery staple")
+	if !noError(t, err) {
+		return
+	}
+	e := &countingEncrypter{Encrypter: passphrase}
+	UseStore(NewMemoryStore(), e)
+	defer UseStore(nil, nil)
+
+	for _, name := range []string{"first", "second"} {
+		c, err := FromWgQuick(testInput, name)
+		if !noError(t, err) || !noError(t, c.Save(false)) {
+			return
+		}
+	}
+	e.decrypted = 0
+	snapshot := takeStoreSnapshot(nil)
+	equal(t, 2, e.decrypted)
+
+	e.decrypted = 0
+	equal(t, snapshot, takeStoreSnapshot(snapshot))
+	equal(t, 0, e.decrypted)
+
+	c, err := LoadFromName("first")
+	if !noError(t, err) {
+		return
+	}
+	c.Interface.ListenPort = 1234
+	if !noError(t, c.Save(true)) {
+		return
+	}
+	e.decrypted = 0
+	equal(t, []StoreChange{{Type: StoreChangeModified, Name: "first"}}, diffStoreSnapshots(snapshot, takeStoreSnapshot(snapshot)))
+	equal(t, 1, e.decrypted)
+}
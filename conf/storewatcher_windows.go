@@ -45,9 +45,7 @@ func startWatchingConfigDir() {
 				goto startover
 			}
 
-			for cb := range storeCallbacks {
-				cb.cb()
-			}
+			notifyStoreChange()
 
 			err = windows.FindNextChangeNotification(h)
 			if err != nil {
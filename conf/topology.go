@@ -0,0 +1,272 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"strconv"
+
+	"golang.zx2c4.com/wireguard/windows/l18n"
+)
+
+type TopologyLayout int
+
+const (
+	TopologyMesh TopologyLayout = iota // Every node is a peer of every other node
+	TopologyHub                        // Every node is a peer of the hub only, which forwards between them
+)
+
+// Topology describes a network of nodes, from which GenerateTopology makes the configuration of each.
+type Topology struct {
+	Layout              TopologyLayout
+	Hub                 string // The name of the hub node, if Layout is TopologyHub
+	PersistentKeepalive uint16 // Used by nodes without endpoints for the peers that have one
+	PresharedKeys       bool   // Whether each pair of nodes shares a preshared key
+	Nodes               []TopologyNode
+}
+
+// TopologyNode is a node of a Topology, which becomes a tunnel called Name.
+type TopologyNode struct {
+	Name       string
+	Addresses  []IPCidr
+	Endpoint   Endpoint // Where the other nodes reach the node, if they can, whose port it listens on
+	AllowedIPs []IPCidr // The networks that are reached through the node, besides its addresses
+	DNS        []net.IP
+	DNSSearch  []string
+}
+
+// jsonTopology is the JSON representation of a Topology. Like that of a configuration, its names are
+// those of the wg-quick keys, where there are any. For example:
+//
+//	{
+//	  "Layout": "hub",
+//	  "Hub": "office",
+//	  "PersistentKeepalive": 25,
+//	  "PresharedKeys": true,
+//	  "Nodes": [
+//	    {
+//	      "Name": "office",
+//	      "Address": ["10.10.0.1/24"],
+//	      "Endpoint": "vpn.example.com:51820",
+//	      "AllowedIPs": ["192.168.1.0/24"]
+//	    },
+//	    {
+//	      "Name": "laptop",
+//	      "Address": ["10.10.0.2/32"],
+//	      "DNS": ["192.168.1.1", "corp.example.com"]
+//	    }
+//	  ]
+//	}
+//
+// The layout is either "mesh", which is the default, or "hub".
+type jsonTopology struct {
+	Layout              string             `json:"Layout,omitempty"`
+	Hub                 string             `json:"Hub,omitempty"`
+	PersistentKeepalive int                `json:"PersistentKeepalive,omitempty"`
+	PresharedKeys       bool               `json:"PresharedKeys,omitempty"`
+	Nodes               []jsonTopologyNode `json:"Nodes"`
+}
+
+type jsonTopologyNode struct {
+	Name       string   `json:"Name"`
+	Address    []string `json:"Address"`
+	Endpoint   string   `json:"Endpoint,omitempty"`
+	AllowedIPs []string `json:"AllowedIPs,omitempty"`
+	DNS        []string `json:"DNS,omitempty"`
+}
+
+// ParseTopology parses a topology in the JSON representation described by jsonTopology. Unknown keys
+// are rejected.
+func ParseTopology(s string) (*Topology, error) {
+	var j jsonTopology
+	decoder := json.NewDecoder(bytes.NewReader([]byte(s)))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&j)
+	if err == nil && decoder.More() {
+		err = errors.New(l18n.Sprintf("unexpected data after the topology"))
+	}
+	if err != nil {
+		return nil, &JSONError{err}
+	}
+
+	var t Topology
+	switch j.Layout {
+	case "", "mesh":
+		t.Layout = TopologyMesh
+	case "hub":
+		t.Layout = TopologyHub
+	default:
+		return nil, &ParseError{l18n.Sprintf("Layout must be either mesh or hub"), j.Layout}
+	}
+	if j.PersistentKeepalive != 0 {
+		t.PersistentKeepalive, err = parsePersistentKeepalive(strconv.Itoa(j.PersistentKeepalive))
+		if err != nil {
+			return nil, err
+		}
+	}
+	t.PresharedKeys = j.PresharedKeys
+	names := make(map[string]bool, len(j.Nodes))
+	for _, n := range j.Nodes {
+		if !TunnelNameIsValid(n.Name) {
+			return nil, &ParseError{l18n.Sprintf("Tunnel name is not valid"), n.Name}
+		}
+		if names[n.Name] {
+			return nil, &ParseError{l18n.Sprintf("Node is listed more than once"), n.Name}
+		}
+		names[n.Name] = true
+		node := TopologyNode{Name: n.Name}
+		if len(n.Address) == 0 {
+			return nil, &ParseError{l18n.Sprintf("A node must have an address"), n.Name}
+		}
+		node.Addresses, err = parseIPCidrList(n.Address)
+		if err != nil {
+			return nil, err
+		}
+		if len(n.Endpoint) > 0 {
+			e, err := parseEndpoint(n.Endpoint)
+			if err != nil {
+				return nil, err
+			}
+			node.Endpoint = *e
+		}
+		node.AllowedIPs, err = parseIPCidrList(n.AllowedIPs)
+		if err != nil {
+			return nil, err
+		}
+		for _, address := range n.DNS {
+			a := net.ParseIP(address)
+			if a == nil {
+				node.DNSSearch = append(node.DNSSearch, address)
+			} else {
+				node.DNS = append(node.DNS, a)
+			}
+		}
+		t.Nodes = append(t.Nodes, node)
+	}
+	if len(t.Nodes) < 2 {
+		return nil, &ParseError{l18n.Sprintf("A topology must have at least two nodes"), strconv.Itoa(len(t.Nodes))}
+	}
+	if t.Layout == TopologyHub {
+		t.Hub = j.Hub
+		if !names[t.Hub] {
+			return nil, &ParseError{l18n.Sprintf("The hub must be one of the nodes"), t.Hub}
+		}
+	} else if len(j.Hub) > 0 {
+		return nil, &ParseError{l18n.Sprintf("Only the hub layout has a hub"), j.Hub}
+	}
+	return &t, nil
+}
+
+// hostAddresses returns the single addresses of a node, which are what its peers route to it.
+func (node *TopologyNode) hostAddresses() []IPCidr {
+	hosts := make([]IPCidr, len(node.Addresses))
+	for i, address := range node.Addresses {
+		hosts[i] = IPCidr{address.IP, address.Bits()}
+	}
+	return hosts
+}
+
+// GenerateTopology makes the configuration of each node of a topology, in the order of the nodes. The
+// keys of previous configurations with the same names are kept, as are the preshared keys of the pairs
+// of nodes that both keep their keys, so that regenerating a topology only changes what it changed.
+func GenerateTopology(t *Topology, previous []*Config) ([]*Config, error) {
+	previousByName := make(map[string]*Config, len(previous))
+	for _, config := range previous {
+		previousByName[config.Name] = config
+	}
+	configs := make([]*Config, len(t.Nodes))
+	kept := make([]bool, len(t.Nodes))
+	for i := range t.Nodes {
+		node := &t.Nodes[i]
+		config := &Config{Name: node.Name}
+		config.Interface.Addresses = node.Addresses
+		config.Interface.ListenPort = node.Endpoint.Port
+		config.Interface.DNS = node.DNS
+		config.Interface.DNSSearch = node.DNSSearch
+		if p := previousByName[node.Name]; p != nil && !p.Interface.PrivateKey.IsZero() {
+			config.Interface.PrivateKey = p.Interface.PrivateKey
+			kept[i] = true
+		} else {
+			k, err := NewPrivateKey()
+			if err != nil {
+				return nil, err
+			}
+			config.Interface.PrivateKey = *k
+		}
+		configs[i] = config
+	}
+
+	hub := -1
+	for i := range t.Nodes {
+		if t.Layout == TopologyHub && t.Nodes[i].Name == t.Hub {
+			hub = i
+		}
+	}
+	presharedKeys := make(map[[2]int]Key)
+	presharedKey := func(a, b int) (Key, error) {
+		if a > b {
+			a, b = b, a
+		}
+		if k, ok := presharedKeys[[2]int{a, b}]; ok {
+			return k, nil
+		}
+		var k Key
+		if kept[a] && kept[b] {
+			for _, peer := range previousByName[t.Nodes[a].Name].Peers {
+				if peer.PublicKey == *configs[b].Interface.PrivateKey.Public() {
+					k = peer.PresharedKey
+				}
+			}
+		}
+		if k.IsZero() {
+			psk, err := NewPresharedKey()
+			if err != nil {
+				return Key{}, err
+			}
+			k = *psk
+		}
+		presharedKeys[[2]int{a, b}] = k
+		return k, nil
+	}
+
+	for i := range t.Nodes {
+		for j := range t.Nodes {
+			if i == j || (hub >= 0 && i != hub && j != hub) {
+				continue
+			}
+			remote := &t.Nodes[j]
+			peer := Peer{
+				PublicKey: *configs[j].Interface.PrivateKey.Public(),
+				Endpoint:  remote.Endpoint,
+			}
+			peer.AllowedIPs = append(remote.hostAddresses(), remote.AllowedIPs...)
+			if j == hub {
+				// The hub forwards to the other spokes, so it routes to them as well.
+				for k := range t.Nodes {
+					if k != i && k != hub {
+						peer.AllowedIPs = append(peer.AllowedIPs, t.Nodes[k].hostAddresses()...)
+						peer.AllowedIPs = append(peer.AllowedIPs, t.Nodes[k].AllowedIPs...)
+					}
+				}
+			}
+			if t.Nodes[i].Endpoint.IsEmpty() && !remote.Endpoint.IsEmpty() {
+				peer.PersistentKeepalive = t.PersistentKeepalive
+			}
+			if t.PresharedKeys {
+				var err error
+				peer.PresharedKey, err = presharedKey(i, j)
+				if err != nil {
+					return nil, err
+				}
+			}
+			configs[i].Peers = append(configs[i].Peers, peer)
+		}
+	}
+	return configs, nil
+}
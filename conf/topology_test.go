@@ -0,0 +1,103 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"strings"
+	"testing"
+)
+
+const topologyInput = `{
+  "Layout": "hub",
+  "Hub": "office",
+  "PersistentKeepalive": 25,
+  "PresharedKeys": true,
+  "Nodes": [
+    {"Name": "office", "Address": ["10.10.0.1/24"], "Endpoint": "vpn.example.com:51820", "AllowedIPs": ["192.168.1.0/24"]},
+    {"Name": "laptop", "Address": ["10.10.0.2/32"], "DNS": ["192.168.1.1", "corp.example.com"]},
+    {"Name": "home", "Address": ["10.10.0.3/32"], "Endpoint": "198.51.100.7:51821"}
+  ]
+}`
+
+func TestGenerateTopology(t *testing.T) {
+	topology, err := ParseTopology(topologyInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configs, err := GenerateTopology(topology, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 3 {
+		t.Fatalf("Expected 3 configurations, but got %d", len(configs))
+	}
+	office, laptop, home := configs[0], configs[1], configs[2]
+	if office.Name != "office" || office.Interface.ListenPort != 51820 || len(office.Peers) != 2 {
+		t.Errorf("Wrong hub configuration:\n%s", office.ToWgQuick())
+	}
+	if laptop.Interface.ListenPort != 0 || len(laptop.Interface.DNS) != 1 || len(laptop.Interface.DNSSearch) != 1 || len(laptop.Peers) != 1 {
+		t.Errorf("Wrong spoke configuration:\n%s", laptop.ToWgQuick())
+	}
+	toHub := &laptop.Peers[0]
+	if toHub.PublicKey != *office.Interface.PrivateKey.Public() || toHub.Endpoint.String() != "vpn.example.com:51820" || toHub.PersistentKeepalive != 25 {
+		t.Errorf("Wrong peer for the hub: %+v", toHub)
+	}
+	if allowedIPs := strings.Join(ipCidrStrings(toHub.AllowedIPs), ", "); allowedIPs != "10.10.0.1/32, 192.168.1.0/24, 10.10.0.3/32" {
+		t.Errorf("Wrong AllowedIPs for the hub: %s", allowedIPs)
+	}
+	fromHub := &office.Peers[0]
+	if fromHub.PublicKey != *laptop.Interface.PrivateKey.Public() || !fromHub.Endpoint.IsEmpty() || fromHub.PersistentKeepalive != 0 || fromHub.PresharedKey != toHub.PresharedKey || fromHub.PresharedKey.IsZero() {
+		t.Errorf("Wrong peer for a spoke: %+v", fromHub)
+	}
+	if home.Peers[0].PersistentKeepalive != 0 || home.Peers[0].PresharedKey == toHub.PresharedKey {
+		t.Errorf("Wrong peer for the hub of a spoke with an endpoint: %+v", home.Peers[0])
+	}
+	for _, config := range configs {
+		_, err = FromWgQuick(config.ToWgQuick(), config.Name)
+		if err != nil {
+			t.Errorf("Generated configuration of %s does not parse: %v", config.Name, err)
+		}
+	}
+
+	topology.Layout, topology.Hub = TopologyMesh, ""
+	topology.Nodes = append(topology.Nodes[:1], topology.Nodes[2:]...)
+	topology.Nodes = append(topology.Nodes, TopologyNode{Name: "server", Addresses: []IPCidr{{[]byte{10, 10, 0, 4}, 32}}})
+	regenerated, err := GenerateTopology(topology, configs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(regenerated) != 3 || regenerated[0].Interface.PrivateKey != office.Interface.PrivateKey || regenerated[1].Interface.PrivateKey != home.Interface.PrivateKey {
+		t.Fatal("The keys of the nodes that remain were not kept")
+	}
+	if regenerated[0].Peers[0].PresharedKey != office.Peers[1].PresharedKey || regenerated[1].Peers[0].PresharedKey != office.Peers[1].PresharedKey {
+		t.Error("The preshared key of a pair of nodes that remain was not kept")
+	}
+	server := regenerated[2]
+	if server.Interface.PrivateKey == laptop.Interface.PrivateKey || len(server.Peers) != 2 || len(regenerated[1].Peers) != 2 {
+		t.Errorf("Wrong mesh configuration:\n%s", server.ToWgQuick())
+	}
+	if regenerated[0].Peers[1].PresharedKey == regenerated[1].Peers[1].PresharedKey {
+		t.Error("Two pairs of nodes share a preshared key")
+	}
+}
+
+func TestParseTopologyErrors(t *testing.T) {
+	for _, input := range []string{
+		`{"Layout": "ring", "Nodes": [{"Name": "a", "Address": ["10.0.0.1/32"]}, {"Name": "b", "Address": ["10.0.0.2/32"]}]}`,
+		`{"Layout": "hub", "Hub": "c", "Nodes": [{"Name": "a", "Address": ["10.0.0.1/32"]}, {"Name": "b", "Address": ["10.0.0.2/32"]}]}`,
+		`{"Hub": "a", "Nodes": [{"Name": "a", "Address": ["10.0.0.1/32"]}, {"Name": "b", "Address": ["10.0.0.2/32"]}]}`,
+		`{"Nodes": [{"Name": "a", "Address": ["10.0.0.1/32"]}, {"Name": "a", "Address": ["10.0.0.2/32"]}]}`,
+		`{"Nodes": [{"Name": "a", "Address": ["10.0.0.1/32"]}, {"Name": "b"}]}`,
+		`{"Nodes": [{"Name": "a", "Address": ["10.0.0.1/32"]}, {"Name": "b", "Address": ["10.0.0.2/32"], "Endpoint": "nope"}]}`,
+		`{"Nodes": [{"Name": "a", "Address": ["10.0.0.1/32"]}]}`,
+		`{"Nodes": [{"Name": "a", "Address": ["10.0.0.1/32"], "Port": 1}, {"Name": "b", "Address": ["10.0.0.2/32"]}]}`,
+	} {
+		_, err := ParseTopology(input)
+		if err == nil {
+			t.Errorf("Topology was accepted: %s", input)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"sync"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	userNames     = make(map[string]string)
+	userNamesLock sync.Mutex
+)
+
+// TokenUserName returns the account name, as DOMAIN\user, of the user of token, or its SID if that
+// cannot be looked up. Names are looked up once per SID, as the lookup may have to ask a domain
+// controller.
+func TokenUserName(token windows.Token) string {
+	user, err := token.GetTokenUser()
+	if err != nil {
+		return ""
+	}
+	sid := user.User.Sid.String()
+	userNamesLock.Lock()
+	defer userNamesLock.Unlock()
+	if name, ok := userNames[sid]; ok {
+		return name
+	}
+	name := sid
+	account, domain, _, err := user.User.Sid.LookupAccount("")
+	if err == nil {
+		name = domain + `\` + account
+	}
+	userNames[sid] = name
+	return name
+}
+
+func currentUserName() string {
+	return TokenUserName(windows.GetCurrentProcessToken())
+}
@@ -10,73 +10,143 @@ import (
 	"strings"
 )
 
-func (conf *Config) ToWgQuick() string {
-	var output strings.Builder
-	output.WriteString("[Interface]\n")
+type wgQuickField struct {
+	key   string
+	value string
+}
 
-	output.WriteString(fmt.Sprintf("PrivateKey = %s\n", conf.Interface.PrivateKey.String()))
+func (iface *Interface) wgQuickFields() []wgQuickField {
+	var fields []wgQuickField
+	fields = append(fields, wgQuickField{"PrivateKey", iface.PrivateKey.String()})
 
-	if conf.Interface.ListenPort > 0 {
-		output.WriteString(fmt.Sprintf("ListenPort = %d\n", conf.Interface.ListenPort))
+	if iface.ListenPort > 0 {
+		fields = append(fields, wgQuickField{"ListenPort", fmt.Sprintf("%d", iface.ListenPort)})
 	}
 
-	if len(conf.Interface.Addresses) > 0 {
-		addrStrings := make([]string, len(conf.Interface.Addresses))
-		for i, address := range conf.Interface.Addresses {
+	if len(iface.Addresses) > 0 {
+		addrStrings := make([]string, len(iface.Addresses))
+		for i, address := range iface.Addresses {
 			addrStrings[i] = address.String()
 		}
-		output.WriteString(fmt.Sprintf("Address = %s\n", strings.Join(addrStrings[:], ", ")))
+		fields = append(fields, wgQuickField{"Address", strings.Join(addrStrings[:], ", ")})
 	}
 
-	if len(conf.Interface.DNS)+len(conf.Interface.DNSSearch) > 0 {
-		addrStrings := make([]string, 0, len(conf.Interface.DNS)+len(conf.Interface.DNSSearch))
-		for _, address := range conf.Interface.DNS {
+	if len(iface.DNS)+len(iface.DNSSearch) > 0 {
+		addrStrings := make([]string, 0, len(iface.DNS)+len(iface.DNSSearch))
+		for _, address := range iface.DNS {
 			addrStrings = append(addrStrings, address.String())
 		}
-		addrStrings = append(addrStrings, conf.Interface.DNSSearch...)
-		output.WriteString(fmt.Sprintf("DNS = %s\n", strings.Join(addrStrings[:], ", ")))
+		addrStrings = append(addrStrings, iface.DNSSearch...)
+		fields = append(fields, wgQuickField{"DNS", strings.Join(addrStrings[:], ", ")})
 	}
 
-	if conf.Interface.MTU > 0 {
-		output.WriteString(fmt.Sprintf("MTU = %d\n", conf.Interface.MTU))
+	if len(iface.DNSMatch) > 0 {
+		fields = append(fields, wgQuickField{"DNSMatch", strings.Join(iface.DNSMatch, ", ")})
 	}
 
-	if len(conf.Interface.PreUp) > 0 {
-		output.WriteString(fmt.Sprintf("PreUp = %s\n", conf.Interface.PreUp))
+	if len(iface.DoHTemplate) > 0 {
+		fields = append(fields, wgQuickField{"DNSOverHTTPS", iface.DoHTemplate})
 	}
-	if len(conf.Interface.PostUp) > 0 {
-		output.WriteString(fmt.Sprintf("PostUp = %s\n", conf.Interface.PostUp))
+
+	if len(iface.DoTName) > 0 {
+		fields = append(fields, wgQuickField{"DNSOverTLS", iface.DoTName})
 	}
-	if len(conf.Interface.PreDown) > 0 {
-		output.WriteString(fmt.Sprintf("PreDown = %s\n", conf.Interface.PreDown))
+
+	if iface.MTU > 0 {
+		fields = append(fields, wgQuickField{"MTU", fmt.Sprintf("%d", iface.MTU)})
 	}
-	if len(conf.Interface.PostDown) > 0 {
-		output.WriteString(fmt.Sprintf("PostDown = %s\n", conf.Interface.PostDown))
+
+	if iface.IPv4MTU > 0 {
+		fields = append(fields, wgQuickField{"IPv4MTU", fmt.Sprintf("%d", iface.IPv4MTU)})
 	}
 
-	for _, peer := range conf.Peers {
-		output.WriteString("\n[Peer]\n")
+	if iface.IPv6MTU > 0 {
+		fields = append(fields, wgQuickField{"IPv6MTU", fmt.Sprintf("%d", iface.IPv6MTU)})
+	}
 
-		output.WriteString(fmt.Sprintf("PublicKey = %s\n", peer.PublicKey.String()))
+	if iface.TableOff {
+		fields = append(fields, wgQuickField{"Table", "off"})
+	} else if iface.TableMetric > 0 {
+		fields = append(fields, wgQuickField{"Table", fmt.Sprintf("%d", iface.TableMetric)})
+	}
 
-		if !peer.PresharedKey.IsZero() {
-			output.WriteString(fmt.Sprintf("PresharedKey = %s\n", peer.PresharedKey.String()))
+	if iface.SaveConfig {
+		fields = append(fields, wgQuickField{"SaveConfig", "true"})
+	}
+
+	if len(iface.PreUp) > 0 {
+		fields = append(fields, wgQuickField{"PreUp", iface.PreUp})
+	}
+	if len(iface.PostUp) > 0 {
+		fields = append(fields, wgQuickField{"PostUp", iface.PostUp})
+	}
+	if len(iface.PreDown) > 0 {
+		fields = append(fields, wgQuickField{"PreDown", iface.PreDown})
+	}
+	if len(iface.PostDown) > 0 {
+		fields = append(fields, wgQuickField{"PostDown", iface.PostDown})
+	}
+	return fields
+}
+
+func (peer *Peer) wgQuickFields() []wgQuickField {
+	fields := []wgQuickField{{"PublicKey", peer.PublicKey.String()}}
+
+	if !peer.PresharedKey.IsZero() {
+		fields = append(fields, wgQuickField{"PresharedKey", peer.PresharedKey.String()})
+	}
+
+	if len(peer.AllowedIPs) > 0 {
+		addrStrings := make([]string, len(peer.AllowedIPs))
+		for i, address := range peer.AllowedIPs {
+			addrStrings[i] = address.String()
 		}
+		fields = append(fields, wgQuickField{"AllowedIPs", strings.Join(addrStrings[:], ", ")})
+	}
 
-		if len(peer.AllowedIPs) > 0 {
-			addrStrings := make([]string, len(peer.AllowedIPs))
-			for i, address := range peer.AllowedIPs {
-				addrStrings[i] = address.String()
-			}
-			output.WriteString(fmt.Sprintf("AllowedIPs = %s\n", strings.Join(addrStrings[:], ", ")))
+	if len(peer.DisallowedIPs) > 0 {
+		addrStrings := make([]string, len(peer.DisallowedIPs))
+		for i, address := range peer.DisallowedIPs {
+			addrStrings[i] = address.String()
 		}
+		fields = append(fields, wgQuickField{"DisallowedIPs", strings.Join(addrStrings[:], ", ")})
+	}
 
-		if !peer.Endpoint.IsEmpty() {
-			output.WriteString(fmt.Sprintf("Endpoint = %s\n", peer.Endpoint.String()))
+	if endpoints := peer.Endpoints(); len(endpoints) > 0 {
+		endpointStrings := make([]string, len(endpoints))
+		for i, endpoint := range endpoints {
+			endpointStrings[i] = endpoint.String()
+		}
+		fields = append(fields, wgQuickField{"Endpoint", strings.Join(endpointStrings, ", ")})
+	}
+
+	if peer.PersistentKeepalive > 0 {
+		fields = append(fields, wgQuickField{"PersistentKeepalive", fmt.Sprintf("%d", peer.PersistentKeepalive)})
+	}
+	return fields
+}
+
+// ToWgQuick renders the configuration in wg-quick format. If the configuration carries a Document,
+// the changed fields are written into it, so that comments and layout survive; otherwise a canonical
+// form is produced.
+func (conf *Config) ToWgQuick() string {
+	if conf.Document != nil {
+		doc := conf.Document.Clone()
+		if doc.Apply(conf) == nil {
+			return doc.String()
 		}
+	}
+
+	var output strings.Builder
+	output.WriteString("[Interface]\n")
+	for _, field := range conf.Interface.wgQuickFields() {
+		output.WriteString(fmt.Sprintf("%s = %s\n", field.key, field.value))
+	}
 
-		if peer.PersistentKeepalive > 0 {
-			output.WriteString(fmt.Sprintf("PersistentKeepalive = %d\n", peer.PersistentKeepalive))
+	for _, peer := range conf.Peers {
+		output.WriteString("\n[Peer]\n")
+		for _, field := range peer.wgQuickFields() {
+			output.WriteString(fmt.Sprintf("%s = %s\n", field.key, field.value))
 		}
 	}
 	return output.String()
@@ -113,9 +183,93 @@ func (conf *Config) ToUAPI() (uapi string, dnsErr error) {
 
 		output.WriteString(fmt.Sprintf("persistent_keepalive_interval=%d\n", peer.PersistentKeepalive))
 
-		if len(peer.AllowedIPs) > 0 {
+		if allowedIPs := peer.EffectiveAllowedIPs(); len(allowedIPs) > 0 {
+			output.WriteString("replace_allowed_ips=true\n")
+			for _, address := range allowedIPs {
+				output.WriteString(fmt.Sprintf("allowed_ip=%s\n", address.String()))
+			}
+		}
+	}
+	return output.String(), nil
+}
+
+// ToUAPIDiff returns the UAPI that changes a device configured with running to the configuration,
+// touching only what differs. Peers that are gone are removed, new peers are added, and the changed
+// properties of the remaining peers are updated, so that peers which have not changed keep their
+// sessions. Endpoints are compared with previous, the configuration that the device was last set up
+// with, rather than with running, whose endpoints are resolved and may have roamed or failed over, so
+// they are only set if they were edited. Endpoints that were removed are left to the device, which
+// cannot unset them.
+func (conf *Config) ToUAPIDiff(previous, running *Config) (uapi string, dnsErr error) {
+	var output strings.Builder
+	if conf.Interface.PrivateKey != running.Interface.PrivateKey {
+		output.WriteString(fmt.Sprintf("private_key=%s\n", conf.Interface.PrivateKey.HexString()))
+	}
+	if conf.Interface.ListenPort != running.Interface.ListenPort {
+		output.WriteString(fmt.Sprintf("listen_port=%d\n", conf.Interface.ListenPort))
+	}
+
+	for i := range running.Peers {
+		found := false
+		for j := range conf.Peers {
+			if conf.Peers[j].PublicKey == running.Peers[i].PublicKey {
+				found = true
+				break
+			}
+		}
+		if !found {
+			output.WriteString(fmt.Sprintf("public_key=%s\nremove=true\n", running.Peers[i].PublicKey.HexString()))
+		}
+	}
+
+	for i := range conf.Peers {
+		peer := &conf.Peers[i]
+		var old *Peer
+		for j := range running.Peers {
+			if running.Peers[j].PublicKey == peer.PublicKey {
+				old = &running.Peers[j]
+				break
+			}
+		}
+		endpointChanged := !peer.Endpoint.IsEmpty()
+		for j := range previous.Peers {
+			if old != nil && previous.Peers[j].PublicKey == peer.PublicKey {
+				endpointChanged = endpointChanged && previous.Peers[j].Endpoint != peer.Endpoint
+				break
+			}
+		}
+		if old == nil {
+			old = &Peer{}
+			output.WriteString(fmt.Sprintf("public_key=%s\n", peer.PublicKey.HexString()))
+		} else if old.PresharedKey == peer.PresharedKey && !endpointChanged &&
+			old.PersistentKeepalive == peer.PersistentKeepalive &&
+			sameIPCidrs(old.EffectiveAllowedIPs(), peer.EffectiveAllowedIPs()) {
+			continue
+		} else {
+			output.WriteString(fmt.Sprintf("public_key=%s\nupdate_only=true\n", peer.PublicKey.HexString()))
+		}
+
+		if old.PresharedKey != peer.PresharedKey {
+			output.WriteString(fmt.Sprintf("preshared_key=%s\n", peer.PresharedKey.HexString()))
+		}
+
+		if endpointChanged {
+			var resolvedIP string
+			resolvedIP, dnsErr = resolveHostname(peer.Endpoint.Host)
+			if dnsErr != nil {
+				return
+			}
+			resolvedEndpoint := Endpoint{resolvedIP, peer.Endpoint.Port}
+			output.WriteString(fmt.Sprintf("endpoint=%s\n", resolvedEndpoint.String()))
+		}
+
+		if old.PersistentKeepalive != peer.PersistentKeepalive {
+			output.WriteString(fmt.Sprintf("persistent_keepalive_interval=%d\n", peer.PersistentKeepalive))
+		}
+
+		if allowedIPs := peer.EffectiveAllowedIPs(); !sameIPCidrs(old.EffectiveAllowedIPs(), allowedIPs) {
 			output.WriteString("replace_allowed_ips=true\n")
-			for _, address := range peer.AllowedIPs {
+			for _, address := range allowedIPs {
 				output.WriteString(fmt.Sprintf("allowed_ip=%s\n", address.String()))
 			}
 		}
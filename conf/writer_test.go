@@ -0,0 +1,111 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package conf
+
+import (
+	"fmt"
+	"testing"
+)
+
+const testRunningInput = `[Interface]
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+ListenPort = 51820
+Address = 10.192.122.1/24
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 10.10.10.1/32
+Endpoint = 192.0.2.1:51820
+
+[Peer]
+PublicKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+AllowedIPs = 10.10.10.2/32, 10.10.20.0/24
+
+[Peer]
+PublicKey = gN65BkIKy1eCE9pP1wdc8ROUtkHLF2PfAqYdyYBz6EA=
+AllowedIPs = 10.10.10.3/32
+`
+
+const testEditedInput = `[Interface]
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+ListenPort = 51820
+Address = 10.192.122.1/24, 10.192.123.1/24
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 10.10.10.1/32
+Endpoint = 192.0.2.1:51820
+
+[Peer]
+PublicKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+AllowedIPs = 10.10.20.0/24, 10.10.10.2/32
+PersistentKeepalive = 25
+
+[Peer]
+PublicKey = HIgo9xNzJMWLKASShiTqIybxZ0U3wGLiUeJ1PKf8ykw=
+AllowedIPs = 10.10.10.4/32
+Endpoint = 192.0.2.4:51820
+`
+
+func TestToUAPIDiff(t *testing.T) {
+	running, err := FromWgQuick(testRunningInput, "test")
+	if !noError(t, err) {
+		return
+	}
+	edited, err := FromWgQuick(testEditedInput, "test")
+	if !noError(t, err) {
+		return
+	}
+	uapi, err := edited.ToUAPIDiff(running, running)
+	if !noError(t, err) {
+		return
+	}
+	expected := fmt.Sprintf("public_key=%s\nremove=true\n", running.Peers[2].PublicKey.HexString()) +
+		fmt.Sprintf("public_key=%s\nupdate_only=true\npersistent_keepalive_interval=25\n", edited.Peers[1].PublicKey.HexString()) +
+		fmt.Sprintf("public_key=%s\nendpoint=192.0.2.4:51820\nreplace_allowed_ips=true\nallowed_ip=10.10.10.4/32\n", edited.Peers[2].PublicKey.HexString())
+	equal(t, expected, uapi)
+
+	uapi, err = running.ToUAPIDiff(running, running)
+	if noError(t, err) {
+		equal(t, "", uapi)
+	}
+}
+
+const testHostnameInput = `[Interface]
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+Address = 10.192.122.1/24
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 10.10.10.1/32
+Endpoint = vpn.example.com:51820
+`
+
+func TestToUAPIDiffResolvedEndpoint(t *testing.T) {
+	previous, err := FromWgQuick(testHostnameInput, "test")
+	if !noError(t, err) {
+		return
+	}
+	running, err := FromWgQuick(testHostnameInput, "test")
+	if !noError(t, err) {
+		return
+	}
+	running.Peers[0].Endpoint = Endpoint{"192.0.2.7", 51820}
+
+	uapi, err := previous.ToUAPIDiff(previous, running)
+	if noError(t, err) {
+		equal(t, "", uapi)
+	}
+
+	edited, err := FromWgQuick(testHostnameInput+"PersistentKeepalive = 25\n", "test")
+	if !noError(t, err) {
+		return
+	}
+	uapi, err = edited.ToUAPIDiff(previous, running)
+	if noError(t, err) {
+		equal(t, fmt.Sprintf("public_key=%s\nupdate_only=true\npersistent_keepalive_interval=25\n", edited.Peers[0].PublicKey.HexString()), uapi)
+	}
+}
@@ -8,8 +8,6 @@ package l18n
 import (
 	"sync"
 
-	"golang.org/x/sys/windows"
-	"golang.org/x/text/language"
 	"golang.org/x/text/message"
 )
 
@@ -31,24 +29,6 @@ func prn() *message.Printer {
 	return printer
 }
 
-// lang returns the user preferred UI language we have most confident translation in the default catalog available.
-func lang() (tag language.Tag) {
-	tag = language.English
-	confidence := language.No
-	languages, err := windows.GetUserPreferredUILanguages(windows.MUI_LANGUAGE_NAME)
-	if err != nil {
-		return
-	}
-	for i := range languages {
-		t, _, c := message.DefaultCatalog.Matcher().Match(message.MatchLanguage(languages[i]))
-		if c > confidence {
-			tag = t
-			confidence = c
-		}
-	}
-	return
-}
-
 // Sprintf is like fmt.Sprintf, but using language-specific formatting.
 func Sprintf(key message.Reference, a ...interface{}) string {
 	return prn().Sprintf(key, a...)
@@ -0,0 +1,18 @@
+// +build !windows
+
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package l18n
+
+import (
+	"golang.org/x/text/language"
+)
+
+// lang returns English, as the preferred UI language is only known on Windows, where the other parts
+// of the program run. Elsewhere, this package is only built for testing portable packages.
+func lang() language.Tag {
+	return language.English
+}
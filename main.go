@@ -6,10 +6,14 @@
 package main
 
 import (
+	"bufio"
 	"debug/pe"
 	"errors"
 	"fmt"
+	"image/png"
+	"io"
 	"log"
+	"net"
 	"os"
 	"strconv"
 	"strings"
@@ -18,9 +22,11 @@ import (
 	"golang.org/x/sys/windows"
 	"golang.zx2c4.com/wireguard/tun"
 
+	"golang.zx2c4.com/wireguard/windows/conf"
 	"golang.zx2c4.com/wireguard/windows/elevate"
 	"golang.zx2c4.com/wireguard/windows/l18n"
 	"golang.zx2c4.com/wireguard/windows/manager"
+	"golang.zx2c4.com/wireguard/windows/qrcode"
 	"golang.zx2c4.com/wireguard/windows/ringlogger"
 	"golang.zx2c4.com/wireguard/windows/tunnel"
 	"golang.zx2c4.com/wireguard/windows/ui"
@@ -53,6 +59,21 @@ func usage() {
 		"/dumplog OUTPUT_PATH",
 		"/update [LOG_FILE]",
 		"/removealladapters [LOG_FILE]",
+		"/validateconfig CONFIG_PATH [LOG_FILE]",
+		"/preflight CONFIG_PATH [LOG_FILE]",
+		"/exportqr CONFIG_PATH [PNG_PATH]",
+		"/exportpeer CONFIG_PATH [ENDPOINT]",
+		"/exportclient CONFIG_PATH PEER_PUBLIC_KEY [ENDPOINT]",
+		"/importqr IMAGE_PATH TUNNEL_NAME",
+		"/exportbundle BUNDLE_PATH [json] < PASSPHRASE",
+		"/importbundle BUNDLE_PATH < PASSPHRASE",
+		"/generatetopology TOPOLOGY_PATH BUNDLE_PATH [json] < PASSPHRASE",
+		"show [TUNNEL_NAME | all | interfaces] [FIELD] [--json]",
+		"showconf TUNNEL_NAME [--json]",
+		"set TUNNEL_NAME [listen-port PORT] [private-key FILE] [peer PUBLIC_KEY [remove] [preshared-key FILE] [endpoint HOST:PORT] [persistent-keepalive SECONDS] [allowed-ips IP/CIDR,...]]...",
+		"genkey",
+		"genpsk",
+		"pubkey < PRIVATE_KEY",
 	}
 	builder := strings.Builder{}
 	for _, flag := range flags {
@@ -62,6 +83,60 @@ func usage() {
 	os.Exit(1)
 }
 
+// These commands write to standard output or standard error rather than showing a message box.
+var consoleCommands = map[string]bool{
+	"/update":            true,
+	"/removealladapters": true,
+	"/validateconfig":    true,
+	"/preflight":         true,
+	"/exportqr":          true,
+	"/exportpeer":        true,
+	"/exportclient":      true,
+	"show":               true,
+	"showconf":           true,
+	"set":                true,
+	"genkey":             true,
+	"genpsk":             true,
+	"pubkey":             true,
+}
+
+var procAttachConsole = windows.NewLazySystemDLL("kernel32.dll").NewProc("AttachConsole")
+
+const attachParentProcess = ^uint32(0)
+
+// attachParentConsole makes standard output and standard error write to the console of the parent
+// process, unless they are redirected. We are linked as a GUI program, so we start without a console,
+// and what we write would otherwise be lost when run from one.
+func attachParentConsole() {
+	redirected := func(std uint32) bool {
+		handle, err := windows.GetStdHandle(std)
+		if err != nil || handle == 0 || handle == windows.InvalidHandle {
+			return false
+		}
+		fileType, err := windows.GetFileType(handle)
+		return err == nil && fileType != windows.FILE_TYPE_UNKNOWN
+	}
+	stdout, stderr := redirected(windows.STD_OUTPUT_HANDLE), redirected(windows.STD_ERROR_HANDLE)
+	if stdout && stderr {
+		return
+	}
+	if ret, _, _ := procAttachConsole.Call(uintptr(attachParentProcess)); ret == 0 {
+		return
+	}
+	console, err := windows.CreateFile(windows.StringToUTF16Ptr("CONOUT$"), windows.GENERIC_READ|windows.GENERIC_WRITE, windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE, nil, windows.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		return
+	}
+	if !stdout {
+		windows.SetStdHandle(windows.STD_OUTPUT_HANDLE, console)
+		os.Stdout = os.NewFile(uintptr(console), "/dev/stdout")
+	}
+	if !stderr {
+		windows.SetStdHandle(windows.STD_ERROR_HANDLE, console)
+		os.Stderr = os.NewFile(uintptr(console), "/dev/stderr")
+	}
+}
+
 func checkForWow64() {
 	b, err := func() (bool, error) {
 		var processMachine, nativeMachine uint16
@@ -120,6 +195,115 @@ func execElevatedManagerServiceInstaller() error {
 	return windows.ERROR_UNHANDLED_EXCEPTION // Not reached
 }
 
+// readPassphrase reads a passphrase from the first line of standard input, so that it does not show up
+// in the command line of the process.
+func readPassphrase() string {
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && len(line) > 0) {
+		fatal(l18n.Sprintf("Unable to read passphrase from standard input: %v", err))
+	}
+	passphrase := strings.TrimRight(line, "\r\n")
+	if passphrase == "" {
+		fatal(l18n.Sprintf("The passphrase must not be empty"))
+	}
+	return passphrase
+}
+
+// storedConfigNameIsTaken returns a function that reports whether a tunnel name is in use by a stored
+// configuration, for choosing the names of imported configurations. A name that is reported as free
+// is reserved, so that later calls report it as taken.
+func storedConfigNameIsTaken() func(name string) bool {
+	names, _ := conf.ListConfigNames()
+	taken := make(map[string]bool, len(names))
+	for _, name := range names {
+		taken[strings.ToLower(name)] = true
+	}
+	return func(name string) bool {
+		if taken[strings.ToLower(name)] {
+			return true
+		}
+		taken[strings.ToLower(name)] = true
+		return false
+	}
+}
+
+// saveImportedConfig saves a configuration that is imported from a file, a bundle, or a QR code,
+// which is named by NameForImport, under the display name that it chose, unless the configuration
+// brings its own.
+func saveImportedConfig(config *conf.Config, displayName string) error {
+	if len(config.Metadata.DisplayName) == 0 {
+		config.Metadata.DisplayName = displayName
+	}
+	return config.Save(false)
+}
+
+// writePreflightReport writes the problems that a preflight check found, followed by what activating
+// the configuration would apply, unless it could not be parsed.
+func writePreflightReport(w io.Writer, report *conf.PreflightReport) {
+	for i := range report.Diagnostics {
+		fmt.Fprintln(w, report.Diagnostics[i].Error())
+	}
+	if conf.HasErrors(report.Diagnostics) {
+		return
+	}
+	for i := range report.Findings {
+		fmt.Fprintln(w, report.Findings[i].String())
+	}
+	for i := range report.Problems {
+		if report.Problems[i].Severity == conf.DiagnosticWarning {
+			fmt.Fprintln(w, l18n.Sprintf("warning: %s", report.Problems[i].Message))
+		} else {
+			fmt.Fprintln(w, report.Problems[i].Message)
+		}
+	}
+	joinIPs := func(ips []net.IP) string {
+		s := make([]string, len(ips))
+		for i := range ips {
+			s[i] = ips[i].String()
+		}
+		return strings.Join(s, l18n.EnumerationSeparator())
+	}
+
+	fmt.Fprintln(w, l18n.Sprintf("Endpoints:"))
+	for _, endpoint := range report.Endpoints {
+		resolved := endpoint.Resolved
+		if len(resolved) == 0 {
+			resolved = l18n.Sprintf("unresolved")
+		}
+		fmt.Fprintf(w, "    %s: %s (%s)\n", endpoint.PublicKey.String(), endpoint.Endpoint.String(), resolved)
+	}
+	fmt.Fprintln(w, l18n.Sprintf("Routes:"))
+	for _, route := range report.Routes {
+		if report.RouteMetric != 0 {
+			fmt.Fprintf(w, "    %s\n", l18n.Sprintf("%s, metric %d", route.String(), report.RouteMetric))
+		} else {
+			fmt.Fprintf(w, "    %s\n", route.String())
+		}
+	}
+	if len(report.DNSServers) > 0 {
+		fmt.Fprintln(w, l18n.Sprintf("DNS servers: %s", joinIPs(report.DNSServers)))
+	}
+	if len(report.DNSSearch) > 0 {
+		fmt.Fprintln(w, l18n.Sprintf("DNS search domains: %s", strings.Join(report.DNSSearch, l18n.EnumerationSeparator())))
+	}
+	if len(report.DNSNamespaces) > 0 {
+		fmt.Fprintln(w, l18n.Sprintf("DNS servers for %s: %s", strings.Join(report.DNSNamespaces, l18n.EnumerationSeparator()), joinIPs(report.DNSMatchServers)))
+	}
+	if len(report.DNSForwardedTo) > 0 {
+		fmt.Fprintln(w, l18n.Sprintf("DNS forwarded over HTTPS or TLS to: %s", joinIPs(report.DNSForwardedTo)))
+	}
+	switch report.Firewall {
+	case conf.FirewallUnrestricted:
+		fmt.Fprintln(w, l18n.Sprintf("Firewall: untunneled traffic is allowed"))
+	case conf.FirewallBlock:
+		fmt.Fprintln(w, l18n.Sprintf("Firewall: untunneled traffic is blocked"))
+	case conf.FirewallBlockExceptTunnelDNS:
+		fmt.Fprintln(w, l18n.Sprintf("Firewall: untunneled traffic is blocked, and DNS only reaches the servers of the tunnel"))
+	case conf.FirewallBlockExceptDNS:
+		fmt.Fprintln(w, l18n.Sprintf("Firewall: untunneled traffic other than DNS is blocked"))
+	}
+}
+
 func pipeFromHandleArgument(handleStr string) (*os.File, error) {
 	handleInt, err := strconv.ParseUint(handleStr, 10, 64)
 	if err != nil {
@@ -146,6 +330,9 @@ func main() {
 		}
 		return
 	}
+	if consoleCommands[os.Args[1]] {
+		attachParentConsole()
+	}
 	switch os.Args[1] {
 	case "/installmanagerservice":
 		if len(os.Args) != 2 {
@@ -176,7 +363,7 @@ func main() {
 		if len(os.Args) != 2 {
 			usage()
 		}
-		err := manager.Run()
+		err := manager.Run(tunnel.Preflight)
 		if err != nil {
 			fatal(err)
 		}
@@ -318,6 +505,302 @@ func main() {
 			log.Println("A reboot may be required")
 		}
 		return
+	case "/validateconfig":
+		if len(os.Args) != 3 && len(os.Args) != 4 {
+			usage()
+		}
+		var f *os.File
+		var err error
+		if len(os.Args) == 3 {
+			f = os.Stdout
+		} else {
+			f, err = os.Create(os.Args[3])
+			if err != nil {
+				fatal(err)
+			}
+			defer f.Close()
+		}
+		config, diagnostics, err := conf.ValidatePath(os.Args[2])
+		if err != nil {
+			fmt.Fprintf(f, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		for i := range diagnostics {
+			fmt.Fprintln(f, diagnostics[i].Error())
+		}
+		if conf.HasErrors(diagnostics) {
+			os.Exit(1)
+		}
+		failed := false
+		for _, finding := range conf.Lint(config) {
+			fmt.Fprintln(f, finding.String())
+			failed = failed || finding.Severity == conf.DiagnosticError
+		}
+		if failed {
+			os.Exit(1)
+		}
+		return
+	case "/preflight":
+		if len(os.Args) != 3 && len(os.Args) != 4 {
+			usage()
+		}
+		var f *os.File
+		var err error
+		if len(os.Args) == 3 {
+			f = os.Stdout
+		} else {
+			f, err = os.Create(os.Args[3])
+			if err != nil {
+				fatal(err)
+			}
+			defer f.Close()
+		}
+		name, contents, err := conf.ReadConfigFile(os.Args[2])
+		if err != nil {
+			fmt.Fprintf(f, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		active, unloadable, err := manager.ActiveTunnelConfigs()
+		if err != nil {
+			fmt.Fprintln(f, l18n.Sprintf("warning: Unable to check against the active tunnels: %v", err))
+		}
+		report := tunnel.Preflight(contents, name, active)
+		report.AddUncheckedTunnels(unloadable)
+		writePreflightReport(f, report)
+		if report.HasErrors() {
+			os.Exit(1)
+		}
+		return
+	case "/exportqr":
+		if len(os.Args) != 3 && len(os.Args) != 4 {
+			usage()
+		}
+		config, err := conf.LoadFromPath(os.Args[2])
+		if err != nil {
+			fatal(err)
+		}
+		code, err := qrcode.Encode([]byte(config.ToWgQuick()), qrcode.Low)
+		if err != nil {
+			fatal(err)
+		}
+		if len(os.Args) == 3 {
+			os.Stdout.WriteString(code.Text())
+			return
+		}
+		f, err := os.Create(os.Args[3])
+		if err != nil {
+			fatal(err)
+		}
+		defer f.Close()
+		err = png.Encode(f, code.Image(8))
+		if err != nil {
+			fatal(err)
+		}
+		return
+	case "/exportpeer":
+		if len(os.Args) != 3 && len(os.Args) != 4 {
+			usage()
+		}
+		config, err := conf.LoadFromPath(os.Args[2])
+		if err != nil {
+			fatal(err)
+		}
+		var endpoint conf.Endpoint
+		if len(os.Args) == 4 {
+			e, err := conf.ParseEndpoint(os.Args[3])
+			if err != nil {
+				fatal(err)
+			}
+			endpoint = *e
+		}
+		os.Stdout.WriteString(config.CounterpartPeers(endpoint))
+		return
+	case "/exportclient":
+		if len(os.Args) != 4 && len(os.Args) != 5 {
+			usage()
+		}
+		config, err := conf.LoadFromPath(os.Args[2])
+		if err != nil {
+			fatal(err)
+		}
+		var endpoint conf.Endpoint
+		if len(os.Args) == 5 {
+			e, err := conf.ParseEndpoint(os.Args[4])
+			if err != nil {
+				fatal(err)
+			}
+			endpoint = *e
+		}
+		for i := range config.Peers {
+			if config.Peers[i].PublicKey.String() == os.Args[3] {
+				os.Stdout.WriteString(config.CounterpartConfig(i, endpoint))
+				return
+			}
+		}
+		fatalf("The tunnel has no peer with the public key %s", os.Args[3])
+	case "/importqr":
+		if len(os.Args) != 4 {
+			usage()
+		}
+		data, err := qrcode.DecodeFile(os.Args[2])
+		if err != nil {
+			fatal(err)
+		}
+		name, displayName := conf.NameForImport(os.Args[3], storedConfigNameIsTaken())
+		config, err := conf.FromWgQuickWithUnknownEncoding(string(data), name)
+		if err != nil {
+			fatal(err)
+		}
+		err = saveImportedConfig(config, displayName)
+		if err != nil {
+			fatal(err)
+		}
+		return
+	case "/exportbundle":
+		if len(os.Args) != 3 && (len(os.Args) != 4 || os.Args[3] != "json") {
+			usage()
+		}
+		names, err := conf.ListConfigNames()
+		if err != nil {
+			fatal(err)
+		}
+		configs := make([]*conf.Config, 0, len(names))
+		for _, name := range names {
+			config, err := conf.LoadFromName(name)
+			if err != nil {
+				fatalf("%s: %v", name, err)
+			}
+			configs = append(configs, config)
+		}
+		passphrase := readPassphrase()
+		f, err := os.OpenFile(os.Args[2], os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+		if err != nil {
+			fatal(err)
+		}
+		err = conf.WriteBundle(f, configs, len(os.Args) == 4, passphrase)
+		if err == nil {
+			err = f.Close()
+		} else {
+			f.Close()
+		}
+		if err != nil {
+			os.Remove(os.Args[2])
+			fatal(err)
+		}
+		return
+	case "/importbundle":
+		if len(os.Args) != 3 {
+			usage()
+		}
+		data, err := os.ReadFile(os.Args[2])
+		if err != nil {
+			fatal(err)
+		}
+		var passphrase string
+		if conf.IsEncryptedBundle(data) {
+			passphrase = readPassphrase()
+		}
+		files, err := conf.ReadBundle(data, passphrase)
+		if err != nil {
+			fatal(err)
+		}
+		var failures []string
+		taken := storedConfigNameIsTaken()
+		for i := range files {
+			if conf.TunnelNameIsValid(files[i].Name) {
+				taken(files[i].Name)
+			}
+		}
+		for i := range files {
+			fileName := files[i].Name
+			var displayName string
+			files[i].Name, displayName = conf.NameForImport(fileName, taken)
+			config, err := files[i].Parse()
+			if err == nil {
+				err = saveImportedConfig(config, displayName)
+			}
+			files[i].Name = fileName
+			if err != nil {
+				failures = append(failures, fmt.Sprintf("%s: %v", files[i].Name, err))
+			}
+		}
+		if len(failures) > 0 {
+			fatalf("Imported %d of %d tunnels:\n\n%s", len(files)-len(failures), len(files), strings.Join(failures, "\n"))
+		}
+		return
+	case "/generatetopology":
+		if len(os.Args) != 4 && (len(os.Args) != 5 || os.Args[4] != "json") {
+			usage()
+		}
+		data, err := os.ReadFile(os.Args[2])
+		if err != nil {
+			fatal(err)
+		}
+		topology, err := conf.ParseTopology(string(data))
+		if err != nil {
+			fatal(err)
+		}
+		passphrase := readPassphrase()
+		// The keys of a bundle that was generated before are kept, so that regenerating it only
+		// changes the nodes that need to be.
+		var previous []*conf.Config
+		data, err = os.ReadFile(os.Args[3])
+		if err == nil {
+			files, err := conf.ReadBundle(data, passphrase)
+			if err != nil {
+				fatal(err)
+			}
+			for i := range files {
+				config, err := files[i].Parse()
+				if err != nil {
+					fatalf("%s: %v", files[i].Name, err)
+				}
+				previous = append(previous, config)
+			}
+		} else if !os.IsNotExist(err) {
+			fatal(err)
+		}
+		configs, err := conf.GenerateTopology(topology, previous)
+		if err != nil {
+			fatal(err)
+		}
+		tempPath := os.Args[3] + ".tmp"
+		f, err := os.OpenFile(tempPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			fatal(err)
+		}
+		err = conf.WriteBundle(f, configs, len(os.Args) == 5, passphrase)
+		if err == nil {
+			err = f.Close()
+		} else {
+			f.Close()
+		}
+		if err == nil {
+			err = os.Rename(tempPath, os.Args[3])
+		}
+		if err != nil {
+			os.Remove(tempPath)
+			fatal(err)
+		}
+		return
+	case "show":
+		wgShow(os.Args[2:])
+		return
+	case "showconf":
+		wgShowConf(os.Args[2:])
+		return
+	case "set":
+		wgSet(os.Args[2:])
+		return
+	case "genkey":
+		wgGenKey(os.Args[2:], false)
+		return
+	case "genpsk":
+		wgGenKey(os.Args[2:], true)
+		return
+	case "pubkey":
+		wgPubKey(os.Args[2:])
+		return
 	}
 	usage()
 }
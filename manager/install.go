@@ -7,6 +7,7 @@ package manager
 
 import (
 	"errors"
+	"log"
 	"os"
 	"time"
 
@@ -16,6 +17,7 @@ import (
 
 	"golang.zx2c4.com/wireguard/windows/conf"
 	"golang.zx2c4.com/wireguard/windows/services"
+	"golang.zx2c4.com/wireguard/windows/tunnel/nrpt"
 )
 
 var cachedServiceManager *mgr.Mgr
@@ -195,5 +197,9 @@ func UninstallTunnel(name string) error {
 	if err != nil && err != windows.ERROR_SERVICE_MARKED_FOR_DELETE {
 		return err
 	}
+	// The tunnel service removes its name resolution policy rules as it stops, but not if it crashed.
+	if err := nrpt.SetRules(name, nil); err != nil {
+		log.Printf("[%s] Unable to remove name resolution policy rules: %v", name, err)
+	}
 	return err2
 }
@@ -15,6 +15,7 @@ import (
 
 	"golang.zx2c4.com/wireguard/tun"
 	"golang.zx2c4.com/wireguard/windows/services"
+	"golang.zx2c4.com/wireguard/windows/tunnel/nrpt"
 )
 
 func cleanupStaleWintunInterfaces() {
@@ -54,3 +55,43 @@ func cleanupStaleWintunInterfaces() {
 		return false
 	}, false)
 }
+
+// cleanupStaleDNSPolicyRules removes the name resolution policy rules of tunnels that are not running,
+// which are left behind in the registry when a tunnel service does not get to remove them itself.
+func cleanupStaleDNSPolicyRules() {
+	owners, err := nrpt.Owners()
+	if err != nil {
+		log.Printf("Unable to enumerate name resolution policy rules: %v", err)
+		return
+	}
+	if len(owners) == 0 {
+		return
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return
+	}
+	defer m.Disconnect()
+
+	for _, owner := range owners {
+		serviceName, err := services.ServiceNameOfTunnel(owner)
+		if err != nil {
+			continue
+		}
+		service, err := m.OpenService(serviceName)
+		if err == nil {
+			status, err := service.Query()
+			service.Close()
+			if err != nil || status.State != svc.Stopped {
+				continue
+			}
+		} else if err != windows.ERROR_SERVICE_DOES_NOT_EXIST {
+			continue
+		}
+		log.Printf("Removing name resolution policy rules of tunnel ‘%s’ because it is not running", owner)
+		err = nrpt.SetRules(owner, nil)
+		if err != nil {
+			log.Printf("Unable to remove name resolution policy rules of tunnel ‘%s’: %v", owner, err)
+		}
+	}
+}
@@ -19,6 +19,9 @@ type Tunnel struct {
 	Name string
 }
 
+// TunnelMetadata is what the user keeps about a tunnel to present it, next to its configuration.
+type TunnelMetadata = conf.Metadata
+
 type TunnelState int
 
 const (
@@ -29,6 +32,14 @@ const (
 	TunnelStopping
 )
 
+// PeerHealth is how a peer of a running tunnel is doing, according to the health monitor of its tunnel
+// service.
+type PeerHealth struct {
+	PublicKey         conf.Key
+	State             conf.PeerHealthState
+	LastHandshakeTime conf.HandshakeTime
+}
+
 type NotificationType int
 
 const (
@@ -37,6 +48,7 @@ const (
 	ManagerStoppingNotificationType
 	UpdateFoundNotificationType
 	UpdateProgressNotificationType
+	PeerHealthChangeNotificationType
 )
 
 type MethodType int
@@ -55,6 +67,16 @@ const (
 	QuitMethodType
 	UpdateStateMethodType
 	UpdateMethodType
+	ReloadMethodType
+	RevisionsMethodType
+	DiffRevisionsMethodType
+	RollbackMethodType
+	TunnelMetadataMethodType
+	TunnelsWithTagMethodType
+	StartTaggedMethodType
+	StopTaggedMethodType
+	PeerHealthMethodType
+	PreflightMethodType
 )
 
 var (
@@ -70,7 +92,7 @@ type TunnelChangeCallback struct {
 var tunnelChangeCallbacks = make(map[*TunnelChangeCallback]bool)
 
 type TunnelsChangeCallback struct {
-	cb func()
+	cb func(changes []conf.StoreChange)
 }
 
 var tunnelsChangeCallbacks = make(map[*TunnelsChangeCallback]bool)
@@ -93,6 +115,12 @@ type UpdateProgressCallback struct {
 
 var updateProgressCallbacks = make(map[*UpdateProgressCallback]bool)
 
+type PeerHealthChangeCallback struct {
+	cb func(tunnel *Tunnel, health []PeerHealth)
+}
+
+var peerHealthChangeCallbacks = make(map[*PeerHealthChangeCallback]bool)
+
 func InitializeIPCClient(reader *os.File, writer *os.File, events *os.File) {
 	rpcDecoder = gob.NewDecoder(reader)
 	rpcEncoder = gob.NewEncoder(writer)
@@ -138,8 +166,13 @@ func InitializeIPCClient(reader *os.File, writer *os.File, events *os.File) {
 					cb.cb(t, state, globalState, retErr)
 				}
 			case TunnelsChangeNotificationType:
+				var changes []conf.StoreChange
+				err = decoder.Decode(&changes)
+				if err != nil {
+					continue
+				}
 				for cb := range tunnelsChangeCallbacks {
-					cb.cb()
+					cb.cb(changes)
 				}
 			case ManagerStoppingNotificationType:
 				for cb := range managerStoppingCallbacks {
@@ -183,6 +216,21 @@ func InitializeIPCClient(reader *os.File, writer *os.File, events *os.File) {
 				for cb := range updateProgressCallbacks {
 					cb.cb(dp)
 				}
+			case PeerHealthChangeNotificationType:
+				var tunnel string
+				err := decoder.Decode(&tunnel)
+				if err != nil || len(tunnel) == 0 {
+					continue
+				}
+				var health []PeerHealth
+				err = decoder.Decode(&health)
+				if err != nil {
+					continue
+				}
+				t := &Tunnel{tunnel}
+				for cb := range peerHealthChangeCallbacks {
+					cb.cb(t, health)
+				}
 			}
 		}
 	}()
@@ -240,6 +288,27 @@ func (t *Tunnel) RuntimeConfig() (c conf.Config, err error) {
 	return
 }
 
+// PeerHealth returns the health of the peers of the tunnel, which is empty if it is not running.
+func (t *Tunnel) PeerHealth() (health []PeerHealth, err error) {
+	rpcMutex.Lock()
+	defer rpcMutex.Unlock()
+
+	err = rpcEncoder.Encode(PeerHealthMethodType)
+	if err != nil {
+		return
+	}
+	err = rpcEncoder.Encode(t.Name)
+	if err != nil {
+		return
+	}
+	err = rpcDecoder.Decode(&health)
+	if err != nil {
+		return
+	}
+	err = rpcDecodeError()
+	return
+}
+
 func (t *Tunnel) Start() (err error) {
 	rpcMutex.Lock()
 	defer rpcMutex.Unlock()
@@ -318,6 +387,94 @@ func (t *Tunnel) Delete() (err error) {
 	return
 }
 
+func (t *Tunnel) Reload() (restart bool, err error) {
+	rpcMutex.Lock()
+	defer rpcMutex.Unlock()
+
+	err = rpcEncoder.Encode(ReloadMethodType)
+	if err != nil {
+		return
+	}
+	err = rpcEncoder.Encode(t.Name)
+	if err != nil {
+		return
+	}
+	err = rpcDecoder.Decode(&restart)
+	if err != nil {
+		return
+	}
+	err = rpcDecodeError()
+	return
+}
+
+func (t *Tunnel) Revisions() (revisions []conf.Revision, err error) {
+	rpcMutex.Lock()
+	defer rpcMutex.Unlock()
+
+	err = rpcEncoder.Encode(RevisionsMethodType)
+	if err != nil {
+		return
+	}
+	err = rpcEncoder.Encode(t.Name)
+	if err != nil {
+		return
+	}
+	err = rpcDecoder.Decode(&revisions)
+	if err != nil {
+		return
+	}
+	err = rpcDecodeError()
+	return
+}
+
+func (t *Tunnel) DiffRevisions(fromID, toID string) (diff string, err error) {
+	rpcMutex.Lock()
+	defer rpcMutex.Unlock()
+
+	err = rpcEncoder.Encode(DiffRevisionsMethodType)
+	if err != nil {
+		return
+	}
+	err = rpcEncoder.Encode(t.Name)
+	if err != nil {
+		return
+	}
+	err = rpcEncoder.Encode(fromID)
+	if err != nil {
+		return
+	}
+	err = rpcEncoder.Encode(toID)
+	if err != nil {
+		return
+	}
+	err = rpcDecoder.Decode(&diff)
+	if err != nil {
+		return
+	}
+	err = rpcDecodeError()
+	return
+}
+
+func (t *Tunnel) Rollback(revisionID string) (err error) {
+	rpcMutex.Lock()
+	defer rpcMutex.Unlock()
+
+	err = rpcEncoder.Encode(RollbackMethodType)
+	if err != nil {
+		return
+	}
+	err = rpcEncoder.Encode(t.Name)
+	if err != nil {
+		return
+	}
+	err = rpcEncoder.Encode(revisionID)
+	if err != nil {
+		return
+	}
+	err = rpcDecodeError()
+	return
+}
+
 func (t *Tunnel) State() (tunnelState TunnelState, err error) {
 	rpcMutex.Lock()
 	defer rpcMutex.Unlock()
@@ -373,6 +530,32 @@ func IPCClientNewTunnel(conf *conf.Config) (tunnel Tunnel, err error) {
 	return
 }
 
+// IPCClientPreflight checks the configuration in text, as the tunnel called name, for what would go
+// wrong when activating it, without activating it.
+func IPCClientPreflight(name, text string) (report conf.PreflightReport, err error) {
+	rpcMutex.Lock()
+	defer rpcMutex.Unlock()
+
+	err = rpcEncoder.Encode(PreflightMethodType)
+	if err != nil {
+		return
+	}
+	err = rpcEncoder.Encode(name)
+	if err != nil {
+		return
+	}
+	err = rpcEncoder.Encode(text)
+	if err != nil {
+		return
+	}
+	err = rpcDecoder.Decode(&report)
+	if err != nil {
+		return
+	}
+	err = rpcDecodeError()
+	return
+}
+
 func IPCClientTunnels() (tunnels []Tunnel, err error) {
 	rpcMutex.Lock()
 	defer rpcMutex.Unlock()
@@ -389,6 +572,73 @@ func IPCClientTunnels() (tunnels []Tunnel, err error) {
 	return
 }
 
+// IPCClientTunnelMetadata returns the metadata of the tunnels that have any, by tunnel name.
+func IPCClientTunnelMetadata() (metadata map[string]TunnelMetadata, err error) {
+	rpcMutex.Lock()
+	defer rpcMutex.Unlock()
+
+	err = rpcEncoder.Encode(TunnelMetadataMethodType)
+	if err != nil {
+		return
+	}
+	err = rpcDecoder.Decode(&metadata)
+	if err != nil {
+		return
+	}
+	err = rpcDecodeError()
+	return
+}
+
+func IPCClientTunnelsWithTag(tag string) (tunnels []Tunnel, err error) {
+	rpcMutex.Lock()
+	defer rpcMutex.Unlock()
+
+	err = rpcEncoder.Encode(TunnelsWithTagMethodType)
+	if err != nil {
+		return
+	}
+	err = rpcEncoder.Encode(tag)
+	if err != nil {
+		return
+	}
+	err = rpcDecoder.Decode(&tunnels)
+	if err != nil {
+		return
+	}
+	err = rpcDecodeError()
+	return
+}
+
+func IPCClientStartTagged(tag string) error {
+	rpcMutex.Lock()
+	defer rpcMutex.Unlock()
+
+	err := rpcEncoder.Encode(StartTaggedMethodType)
+	if err != nil {
+		return err
+	}
+	err = rpcEncoder.Encode(tag)
+	if err != nil {
+		return err
+	}
+	return rpcDecodeError()
+}
+
+func IPCClientStopTagged(tag string) error {
+	rpcMutex.Lock()
+	defer rpcMutex.Unlock()
+
+	err := rpcEncoder.Encode(StopTaggedMethodType)
+	if err != nil {
+		return err
+	}
+	err = rpcEncoder.Encode(tag)
+	if err != nil {
+		return err
+	}
+	return rpcDecodeError()
+}
+
 func IPCClientQuit(stopTunnelsOnQuit bool) (alreadyQuit bool, err error) {
 	rpcMutex.Lock()
 	defer rpcMutex.Unlock()
@@ -439,7 +689,7 @@ func IPCClientRegisterTunnelChange(cb func(tunnel *Tunnel, state TunnelState, gl
 func (cb *TunnelChangeCallback) Unregister() {
 	delete(tunnelChangeCallbacks, cb)
 }
-func IPCClientRegisterTunnelsChange(cb func()) *TunnelsChangeCallback {
+func IPCClientRegisterTunnelsChange(cb func(changes []conf.StoreChange)) *TunnelsChangeCallback {
 	s := &TunnelsChangeCallback{cb}
 	tunnelsChangeCallbacks[s] = true
 	return s
@@ -471,3 +721,11 @@ func IPCClientRegisterUpdateProgress(cb func(dp updater.DownloadProgress)) *Upda
 func (cb *UpdateProgressCallback) Unregister() {
 	delete(updateProgressCallbacks, cb)
 }
+func IPCClientRegisterPeerHealthChange(cb func(tunnel *Tunnel, health []PeerHealth)) *PeerHealthChangeCallback {
+	s := &PeerHealthChangeCallback{cb}
+	peerHealthChangeCallbacks[s] = true
+	return s
+}
+func (cb *PeerHealthChangeCallback) Unregister() {
+	delete(peerHealthChangeCallbacks, cb)
+}
@@ -8,10 +8,12 @@ package manager
 import (
 	"bytes"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -20,6 +22,7 @@ import (
 	"golang.org/x/sys/windows/svc"
 
 	"golang.zx2c4.com/wireguard/windows/conf"
+	"golang.zx2c4.com/wireguard/windows/l18n"
 	"golang.zx2c4.com/wireguard/windows/services"
 	"golang.zx2c4.com/wireguard/windows/updater"
 )
@@ -84,6 +87,23 @@ func (s *ManagerService) RuntimeConfig(tunnelName string) (*conf.Config, error)
 	return conf, nil
 }
 
+// PeerHealth returns the health of the peers of a tunnel, as its tunnel service last reported it.
+func (s *ManagerService) PeerHealth(tunnelName string) ([]PeerHealth, error) {
+	return trackedPeerHealth(tunnelName), nil
+}
+
+// Preflight checks a configuration for what would go wrong when activating it as the tunnel called
+// tunnelName, including collisions with the other active tunnels.
+func (s *ManagerService) Preflight(tunnelName, text string) (*conf.PreflightReport, error) {
+	active, unloadable, err := ActiveTunnelConfigs()
+	if err != nil {
+		return nil, err
+	}
+	report := preflight(text, tunnelName, active)
+	report.AddUncheckedTunnels(unloadable)
+	return report, nil
+}
+
 func (s *ManagerService) Start(tunnelName string) error {
 	// TODO: Rather than being lazy and gating this behind a knob (yuck!), we should instead keep track of the routes
 	// of each tunnel, and only deactivate in the case of a tunnel with identical routes being added.
@@ -214,7 +234,7 @@ func (s *ManagerService) Create(tunnelConfig *conf.Config) (*Tunnel, error) {
 	if s.elevatedToken == 0 {
 		return nil, windows.ERROR_ACCESS_DENIED
 	}
-	err := tunnelConfig.Save(true)
+	err := tunnelConfig.SaveEditedBy(true, conf.TokenUserName(s.elevatedToken))
 	if err != nil {
 		return nil, err
 	}
@@ -223,6 +243,67 @@ func (s *ManagerService) Create(tunnelConfig *conf.Config) (*Tunnel, error) {
 	// TODO: handle already running and existing situation
 }
 
+// Reload applies the stored configuration of a tunnel to it while it is running, changing whatever
+// the tunnel service can in place. It returns whether the tunnel needs to be restarted instead, which
+// is left to the caller. Tunnels that are not running are left alone.
+func (s *ManagerService) Reload(tunnelName string) (restart bool, err error) {
+	if s.elevatedToken == 0 {
+		return false, windows.ERROR_ACCESS_DENIED
+	}
+	state, err := s.State(tunnelName)
+	if err != nil || state == TunnelStopped || state == TunnelStopping {
+		return false, err
+	}
+	if state != TunnelStarted {
+		return true, nil
+	}
+	restart, err = reloadTunnelService(tunnelName)
+	if restart {
+		log.Printf("[%s] Restart required to apply configuration", tunnelName)
+	}
+	return restart, err
+}
+
+func (s *ManagerService) Revisions(tunnelName string) ([]conf.Revision, error) {
+	if s.elevatedToken == 0 {
+		return nil, windows.ERROR_ACCESS_DENIED
+	}
+	return conf.ListRevisions(tunnelName)
+}
+
+func (s *ManagerService) DiffRevisions(tunnelName, fromID, toID string) (string, error) {
+	if s.elevatedToken == 0 {
+		return "", windows.ERROR_ACCESS_DENIED
+	}
+	return conf.DiffRevisions(tunnelName, fromID, toID)
+}
+
+// Rollback restores a revision of the configuration of a tunnel, and applies it if the tunnel is running.
+func (s *ManagerService) Rollback(tunnelName, revisionID string) error {
+	if s.elevatedToken == 0 {
+		return windows.ERROR_ACCESS_DENIED
+	}
+	_, err := conf.RollbackToRevision(tunnelName, revisionID, conf.TokenUserName(s.elevatedToken))
+	if err != nil {
+		return err
+	}
+	restart, err := s.Reload(tunnelName)
+	if err != nil {
+		log.Printf("[%s] Unable to reload configuration, so restarting: %v", tunnelName, err)
+	} else if !restart {
+		return nil
+	}
+	err = s.Stop(tunnelName)
+	if err != nil {
+		return err
+	}
+	err = s.WaitForStop(tunnelName)
+	if err != nil {
+		return err
+	}
+	return s.Start(tunnelName)
+}
+
 func (s *ManagerService) Tunnels() ([]Tunnel, error) {
 	names, err := conf.ListConfigNames()
 	if err != nil {
@@ -236,6 +317,62 @@ func (s *ManagerService) Tunnels() ([]Tunnel, error) {
 	// TODO: account for running ones that aren't in the configuration store somehow
 }
 
+func (s *ManagerService) TunnelMetadata() (map[string]TunnelMetadata, error) {
+	return cachedTunnelMetadata()
+}
+
+func (s *ManagerService) TunnelsWithTag(tag string) ([]Tunnel, error) {
+	metadata, err := cachedTunnelMetadata()
+	if err != nil {
+		return nil, err
+	}
+	var tunnels []Tunnel
+	for name, m := range metadata {
+		if m.HasTag(tag) {
+			tunnels = append(tunnels, Tunnel{name})
+		}
+	}
+	sort.Slice(tunnels, func(i, j int) bool {
+		return conf.TunnelNameIsLess(tunnels[i].Name, tunnels[j].Name)
+	})
+	return tunnels, nil
+}
+
+// StartTagged starts every tunnel with the tag. Since starting one tunnel otherwise stops the others,
+// starting several requires the MultipleSimultaneousTunnels knob.
+func (s *ManagerService) StartTagged(tag string) error {
+	tunnels, err := s.TunnelsWithTag(tag)
+	if err != nil {
+		return err
+	}
+	if len(tunnels) > 1 && !conf.AdminBool("MultipleSimultaneousTunnels") {
+		return errors.New(l18n.Sprintf("Activating several tunnels at once requires the MultipleSimultaneousTunnels setting"))
+	}
+	var firstErr error
+	for _, tunnel := range tunnels {
+		err = s.Start(tunnel.Name)
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("%s: %w", tunnel.Name, err)
+		}
+	}
+	return firstErr
+}
+
+func (s *ManagerService) StopTagged(tag string) error {
+	tunnels, err := s.TunnelsWithTag(tag)
+	if err != nil {
+		return err
+	}
+	var firstErr error
+	for _, tunnel := range tunnels {
+		err = s.Stop(tunnel.Name)
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("%s: %w", tunnel.Name, err)
+		}
+	}
+	return firstErr
+}
+
 func (s *ManagerService) Quit(stopTunnelsOnQuit bool) (alreadyQuit bool, err error) {
 	if s.elevatedToken == 0 {
 		return false, windows.ERROR_ACCESS_DENIED
@@ -335,6 +472,43 @@ func (s *ManagerService) ServeConn(reader io.Reader, writer io.Writer) {
 			if err != nil {
 				return
 			}
+		case PeerHealthMethodType:
+			var tunnelName string
+			err := decoder.Decode(&tunnelName)
+			if err != nil {
+				return
+			}
+			health, retErr := s.PeerHealth(tunnelName)
+			err = encoder.Encode(health)
+			if err != nil {
+				return
+			}
+			err = encoder.Encode(errToString(retErr))
+			if err != nil {
+				return
+			}
+		case PreflightMethodType:
+			var tunnelName, text string
+			err := decoder.Decode(&tunnelName)
+			if err != nil {
+				return
+			}
+			err = decoder.Decode(&text)
+			if err != nil {
+				return
+			}
+			report, retErr := s.Preflight(tunnelName, text)
+			if report == nil {
+				report = &conf.PreflightReport{}
+			}
+			err = encoder.Encode(*report)
+			if err != nil {
+				return
+			}
+			err = encoder.Encode(errToString(retErr))
+			if err != nil {
+				return
+			}
 		case StartMethodType:
 			var tunnelName string
 			err := decoder.Decode(&tunnelName)
@@ -418,6 +592,74 @@ func (s *ManagerService) ServeConn(reader io.Reader, writer io.Writer) {
 			if err != nil {
 				return
 			}
+		case ReloadMethodType:
+			var tunnelName string
+			err := decoder.Decode(&tunnelName)
+			if err != nil {
+				return
+			}
+			restart, retErr := s.Reload(tunnelName)
+			err = encoder.Encode(restart)
+			if err != nil {
+				return
+			}
+			err = encoder.Encode(errToString(retErr))
+			if err != nil {
+				return
+			}
+		case RevisionsMethodType:
+			var tunnelName string
+			err := decoder.Decode(&tunnelName)
+			if err != nil {
+				return
+			}
+			revisions, retErr := s.Revisions(tunnelName)
+			err = encoder.Encode(revisions)
+			if err != nil {
+				return
+			}
+			err = encoder.Encode(errToString(retErr))
+			if err != nil {
+				return
+			}
+		case DiffRevisionsMethodType:
+			var tunnelName, fromID, toID string
+			err := decoder.Decode(&tunnelName)
+			if err != nil {
+				return
+			}
+			err = decoder.Decode(&fromID)
+			if err != nil {
+				return
+			}
+			err = decoder.Decode(&toID)
+			if err != nil {
+				return
+			}
+			diff, retErr := s.DiffRevisions(tunnelName, fromID, toID)
+			err = encoder.Encode(diff)
+			if err != nil {
+				return
+			}
+			err = encoder.Encode(errToString(retErr))
+			if err != nil {
+				return
+			}
+		case RollbackMethodType:
+			var tunnelName, revisionID string
+			err := decoder.Decode(&tunnelName)
+			if err != nil {
+				return
+			}
+			err = decoder.Decode(&revisionID)
+			if err != nil {
+				return
+			}
+			retErr := s.Rollback(tunnelName, revisionID)
+			err = encoder.Encode(errToString(retErr))
+			if err != nil {
+				return
+			}
 		case TunnelsMethodType:
 			tunnels, retErr := s.Tunnels()
 			err = encoder.Encode(tunnels)
@@ -428,6 +670,53 @@ func (s *ManagerService) ServeConn(reader io.Reader, writer io.Writer) {
 			if err != nil {
 				return
 			}
+		case TunnelMetadataMethodType:
+			metadata, retErr := s.TunnelMetadata()
+			err = encoder.Encode(metadata)
+			if err != nil {
+				return
+			}
+			err = encoder.Encode(errToString(retErr))
+			if err != nil {
+				return
+			}
+		case TunnelsWithTagMethodType:
+			var tag string
+			err := decoder.Decode(&tag)
+			if err != nil {
+				return
+			}
+			tunnels, retErr := s.TunnelsWithTag(tag)
+			err = encoder.Encode(tunnels)
+			if err != nil {
+				return
+			}
+			err = encoder.Encode(errToString(retErr))
+			if err != nil {
+				return
+			}
+		case StartTaggedMethodType:
+			var tag string
+			err := decoder.Decode(&tag)
+			if err != nil {
+				return
+			}
+			retErr := s.StartTagged(tag)
+			err = encoder.Encode(errToString(retErr))
+			if err != nil {
+				return
+			}
+		case StopTaggedMethodType:
+			var tag string
+			err := decoder.Decode(&tag)
+			if err != nil {
+				return
+			}
+			retErr := s.StopTagged(tag)
+			err = encoder.Encode(errToString(retErr))
+			if err != nil {
+				return
+			}
 		case QuitMethodType:
 			var stopTunnelsOnQuit bool
 			err := decoder.Decode(&stopTunnelsOnQuit)
@@ -523,8 +812,8 @@ func IPCServerNotifyTunnelChange(name string, state TunnelState, err error) {
 	notifyAll(TunnelChangeNotificationType, false, name, state, trackedTunnelsGlobalState(), errToString(err))
 }
 
-func IPCServerNotifyTunnelsChange() {
-	notifyAll(TunnelsChangeNotificationType, false)
+func IPCServerNotifyTunnelsChange(changes []conf.StoreChange) {
+	notifyAll(TunnelsChangeNotificationType, false, changes)
 }
 
 func IPCServerNotifyUpdateFound(state UpdateState) {
@@ -539,3 +828,7 @@ func IPCServerNotifyManagerStopping() {
 	notifyAll(ManagerStoppingNotificationType, false)
 	time.Sleep(time.Millisecond * 200)
 }
+
+func IPCServerNotifyPeerHealthChange(name string, health []PeerHealth) {
+	notifyAll(PeerHealthChangeNotificationType, false, name, health)
+}
@@ -6,12 +6,18 @@
 package manager
 
 import (
+	"bufio"
+	"errors"
+	"fmt"
 	"net"
+	"strings"
 	"sync"
+	"time"
 
 	"golang.org/x/sys/windows"
 	"golang.zx2c4.com/wireguard/ipc/winpipe"
 
+	"golang.zx2c4.com/wireguard/windows/conf"
 	"golang.zx2c4.com/wireguard/windows/services"
 )
 
@@ -23,6 +29,18 @@ type connectedTunnel struct {
 var connectedTunnelServicePipes = make(map[string]*connectedTunnel)
 var connectedTunnelServicePipesLock sync.RWMutex
 
+func dialTunnelServicePipe(tunnelName string) (net.Conn, error) {
+	pipePath, err := services.PipePathOfTunnel(tunnelName)
+	if err != nil {
+		return nil, err
+	}
+	localSystem, err := windows.CreateWellKnownSid(windows.WinLocalSystemSid)
+	if err != nil {
+		return nil, err
+	}
+	return winpipe.Dial(pipePath, nil, &winpipe.DialConfig{ExpectedOwner: localSystem})
+}
+
 func connectTunnelServicePipe(tunnelName string) (*connectedTunnel, error) {
 	connectedTunnelServicePipesLock.RLock()
 	pipe, ok := connectedTunnelServicePipes[tunnelName]
@@ -34,21 +52,14 @@ func connectTunnelServicePipe(tunnelName string) (*connectedTunnel, error) {
 	connectedTunnelServicePipesLock.RUnlock()
 	connectedTunnelServicePipesLock.Lock()
 	defer connectedTunnelServicePipesLock.Unlock()
+	var err error
 	pipe, ok = connectedTunnelServicePipes[tunnelName]
 	if ok {
 		pipe.Lock()
 		return pipe, nil
 	}
-	pipePath, err := services.PipePathOfTunnel(tunnelName)
-	if err != nil {
-		return nil, err
-	}
-	localSystem, err := windows.CreateWellKnownSid(windows.WinLocalSystemSid)
-	if err != nil {
-		return nil, err
-	}
 	pipe = &connectedTunnel{}
-	pipe.Conn, err = winpipe.Dial(pipePath, nil, &winpipe.DialConfig{ExpectedOwner: localSystem})
+	pipe.Conn, err = dialTunnelServicePipe(tunnelName)
 	if err != nil {
 		return nil, err
 	}
@@ -69,3 +80,101 @@ func disconnectTunnelServicePipe(tunnelName string) {
 	delete(connectedTunnelServicePipes, tunnelName)
 	pipe.Unlock()
 }
+
+// reloadTunnelService asks the tunnel service to apply its stored configuration in place, on a
+// connection of its own, since the shared one is handed to the device after its first request. It
+// returns whether the tunnel service needs to be restarted instead.
+func reloadTunnelService(tunnelName string) (restart bool, err error) {
+	pipe, err := dialTunnelServicePipe(tunnelName)
+	if err != nil {
+		return false, err
+	}
+	defer pipe.Close()
+	pipe.SetDeadline(time.Now().Add(time.Second * 30))
+	_, err = pipe.Write([]byte("reload=1\n\n"))
+	if err != nil {
+		return false, err
+	}
+	var errno, message string
+	reader := bufio.NewReader(pipe)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return false, err
+		}
+		line = line[:len(line)-1]
+		if len(line) == 0 {
+			break
+		}
+		equals := strings.IndexByte(line, '=')
+		if equals < 0 {
+			continue
+		}
+		switch line[:equals] {
+		case "restart":
+			restart = line[equals+1:] == "true"
+		case "error":
+			message = line[equals+1:]
+		case "errno":
+			errno = line[equals+1:]
+		}
+	}
+	if errno != "0" {
+		if len(message) == 0 {
+			message = fmt.Sprintf("Tunnel service failed to reload its configuration (errno %s)", errno)
+		}
+		return false, errors.New(message)
+	}
+	return restart, nil
+}
+
+// ReadTunnelRuntimeConfig returns the configuration that a running tunnel is using, as its tunnel
+// service reports it on a connection of its own, taking what the UAPI does not convey, such as the
+// addresses, from storedConfig, which may be empty apart from its name.
+func ReadTunnelRuntimeConfig(tunnelName string, storedConfig *conf.Config) (*conf.Config, error) {
+	pipe, err := dialTunnelServicePipe(tunnelName)
+	if err != nil {
+		return nil, err
+	}
+	defer pipe.Close()
+	pipe.SetDeadline(time.Now().Add(time.Second * 2))
+	_, err = pipe.Write([]byte("get=1\n\n"))
+	if err != nil {
+		return nil, err
+	}
+	return conf.FromUAPI(pipe, storedConfig)
+}
+
+// SetTunnelRuntimeConfig applies the lines of a UAPI set operation to a running tunnel, on a connection
+// of its own. The change lasts until the tunnel is restarted or reloaded, as it is not stored.
+func SetTunnelRuntimeConfig(tunnelName, uapi string) error {
+	pipe, err := dialTunnelServicePipe(tunnelName)
+	if err != nil {
+		return err
+	}
+	defer pipe.Close()
+	pipe.SetDeadline(time.Now().Add(time.Second * 30))
+	_, err = pipe.Write([]byte("set=1\n" + uapi + "\n"))
+	if err != nil {
+		return err
+	}
+	var errno string
+	reader := bufio.NewReader(pipe)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = line[:len(line)-1]
+		if len(line) == 0 {
+			break
+		}
+		if strings.HasPrefix(line, "errno=") {
+			errno = line[len("errno="):]
+		}
+	}
+	if errno != "0" {
+		return fmt.Errorf("Tunnel service failed to set the configuration (errno %s)", errno)
+	}
+	return nil
+}
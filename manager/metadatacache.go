@@ -0,0 +1,67 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package manager
+
+import (
+	"sync"
+
+	"golang.zx2c4.com/wireguard/windows/conf"
+)
+
+// The metadata of the tunnels that have any, by tunnel name, which every UI process asks for after
+// every change to the store. It is read in full once, and after that only for the tunnels that changed.
+var (
+	tunnelMetadata     map[string]TunnelMetadata
+	tunnelMetadataLock sync.Mutex
+)
+
+func loadTunnelMetadata(name string) {
+	m, err := conf.LoadMetadata(name)
+	if err != nil || (len(m.DisplayName) == 0 && len(m.Tags) == 0 && len(m.Folder) == 0) {
+		delete(tunnelMetadata, name)
+		return
+	}
+	tunnelMetadata[name] = m
+}
+
+func cachedTunnelMetadata() (map[string]TunnelMetadata, error) {
+	tunnelMetadataLock.Lock()
+	defer tunnelMetadataLock.Unlock()
+	if tunnelMetadata == nil {
+		names, err := conf.ListConfigNames()
+		if err != nil {
+			return nil, err
+		}
+		tunnelMetadata = make(map[string]TunnelMetadata, len(names))
+		for _, name := range names {
+			loadTunnelMetadata(name)
+		}
+	}
+	metadata := make(map[string]TunnelMetadata, len(tunnelMetadata))
+	for name, m := range tunnelMetadata {
+		metadata[name] = m
+	}
+	return metadata, nil
+}
+
+func updateTunnelMetadata(changes []conf.StoreChange) {
+	tunnelMetadataLock.Lock()
+	defer tunnelMetadataLock.Unlock()
+	if tunnelMetadata == nil {
+		return
+	}
+	for _, change := range changes {
+		switch change.Type {
+		case conf.StoreChangeRemoved:
+			delete(tunnelMetadata, change.Name)
+		case conf.StoreChangeRenamed:
+			delete(tunnelMetadata, change.OldName)
+			loadTunnelMetadata(change.Name)
+		default:
+			loadTunnelMetadata(change.Name)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package manager
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.zx2c4.com/wireguard/windows/conf"
+)
+
+var trackedPeerHealths = make(map[string][]PeerHealth)
+var trackedPeerHealthsLock sync.Mutex
+
+func trackedPeerHealth(tunnelName string) []PeerHealth {
+	trackedPeerHealthsLock.Lock()
+	defer trackedPeerHealthsLock.Unlock()
+	return trackedPeerHealths[tunnelName]
+}
+
+// readPeerHealth reads one answer to the health operation of a tunnel service, which lists the health
+// of each peer.
+func readPeerHealth(reader *bufio.Reader) ([]PeerHealth, error) {
+	var health []PeerHealth
+	var errno string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = line[:len(line)-1]
+		if len(line) == 0 {
+			break
+		}
+		equals := strings.IndexByte(line, '=')
+		if equals < 0 {
+			continue
+		}
+		key, val := line[:equals], line[equals+1:]
+		if key == "errno" {
+			errno = val
+			continue
+		}
+		if key == "public_key" {
+			var peer PeerHealth
+			if hex.DecodedLen(len(val)) != len(peer.PublicKey) {
+				return nil, errors.New("Invalid public key in peer health")
+			}
+			_, err = hex.Decode(peer.PublicKey[:], []byte(val))
+			if err != nil {
+				return nil, err
+			}
+			health = append(health, peer)
+			continue
+		}
+		if len(health) == 0 {
+			continue
+		}
+		peer := &health[len(health)-1]
+		switch key {
+		case "health":
+			peer.State = conf.ParsePeerHealthState(val)
+		case "last_handshake_time_sec":
+			t, _ := strconv.ParseInt(val, 10, 64)
+			peer.LastHandshakeTime += conf.HandshakeTime(time.Duration(t) * time.Second)
+		case "last_handshake_time_nsec":
+			t, _ := strconv.ParseInt(val, 10, 64)
+			peer.LastHandshakeTime += conf.HandshakeTime(time.Duration(t) * time.Nanosecond)
+		}
+	}
+	if errno != "0" {
+		return nil, errors.New("Tunnel service failed to report peer health (errno " + errno + ")")
+	}
+	return health, nil
+}
+
+// watchPeerHealth follows the health of the peers of a running tunnel, which its tunnel service
+// reports whenever it changes, and forwards it to clients, until stop is closed or the tunnel service
+// goes away.
+func watchPeerHealth(tunnelName string, stop <-chan struct{}) {
+	defer func() {
+		trackedPeerHealthsLock.Lock()
+		delete(trackedPeerHealths, tunnelName)
+		trackedPeerHealthsLock.Unlock()
+	}()
+	pipe, err := dialTunnelServicePipe(tunnelName)
+	if err != nil {
+		log.Printf("[%s] Unable to follow peer health: %v", tunnelName, err)
+		return
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+		case <-done:
+		}
+		pipe.Close()
+	}()
+	_, err = io.WriteString(pipe, "health=1\n\n")
+	if err != nil {
+		return
+	}
+	reader := bufio.NewReader(pipe)
+	for {
+		health, err := readPeerHealth(reader)
+		if err != nil {
+			return
+		}
+		trackedPeerHealthsLock.Lock()
+		trackedPeerHealths[tunnelName] = health
+		trackedPeerHealthsLock.Unlock()
+		IPCServerNotifyPeerHealthChange(tunnelName, health)
+	}
+}
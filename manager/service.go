@@ -71,8 +71,14 @@ func (service *managerService) Execute(args []string, r <-chan svc.ChangeRequest
 		return
 	}
 
+	cleanupStaleDNSPolicyRules()
+
 	conf.RegisterStoreChangeCallback(conf.MigrateUnencryptedConfigs)
-	conf.RegisterStoreChangeCallback(IPCServerNotifyTunnelsChange)
+	conf.RegisterStoreChangeEventCallback(func(changes []conf.StoreChange) {
+		// The UI asks for the metadata as soon as it is told, so it must be up to date by then.
+		updateTunnelMetadata(changes)
+		IPCServerNotifyTunnelsChange(changes)
+	})
 
 	procs := make(map[uint32]*os.Process)
 	aliveSessions := make(map[uint32]bool)
@@ -367,6 +373,15 @@ loop:
 	return
 }
 
-func Run() error {
+// Preflighter checks a configuration for what would go wrong when activating it as the tunnel called
+// name, given the configurations of the active tunnels.
+type Preflighter func(text, name string, active []*conf.Config) *conf.PreflightReport
+
+// preflight is the Preflighter that Run is given, which is that of the tunnel service. The manager only
+// starts tunnel services, so it does not depend on their package.
+var preflight Preflighter
+
+func Run(preflighter Preflighter) error {
+	preflight = preflighter
 	return svc.Run("WireGuardManager", &managerService{})
 }
@@ -47,6 +47,57 @@ func trackExistingTunnels() error {
 	return nil
 }
 
+// ActiveTunnelNames returns the names of the tunnels whose services are running or starting.
+func ActiveTunnelNames() ([]string, error) {
+	m, err := serviceManager()
+	if err != nil {
+		return nil, err
+	}
+	names, err := conf.ListConfigNames()
+	if err != nil {
+		return nil, err
+	}
+	var active []string
+	for _, name := range names {
+		serviceName, err := services.ServiceNameOfTunnel(name)
+		if err != nil {
+			continue
+		}
+		service, err := m.OpenService(serviceName)
+		if err != nil {
+			continue
+		}
+		status, err := service.Query()
+		service.Close()
+		if err != nil || (status.State != svc.Running && status.State != svc.StartPending) {
+			continue
+		}
+		active = append(active, name)
+	}
+	return active, nil
+}
+
+// ActiveTunnelConfigs returns the stored configurations of the tunnels whose services are running or
+// starting. Those that cannot be loaded are skipped, and returned in unloadable with their errors.
+func ActiveTunnelConfigs() (configs []*conf.Config, unloadable map[string]error, err error) {
+	names, err := ActiveTunnelNames()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, name := range names {
+		config, err := conf.LoadFromName(name)
+		if err != nil {
+			if unloadable == nil {
+				unloadable = make(map[string]error)
+			}
+			unloadable[name] = err
+			continue
+		}
+		configs = append(configs, config)
+	}
+	return configs, unloadable, nil
+}
+
 var trackedTunnels = make(map[string]TunnelState)
 var trackedTunnelsLock = sync.Mutex{}
 
@@ -231,6 +282,12 @@ func trackTunnelService(tunnelName string, service *mgr.Service) {
 		return
 	}
 	lastState := TunnelUnknown
+	var stopPeerHealth chan struct{}
+	defer func() {
+		if stopPeerHealth != nil {
+			close(stopPeerHealth)
+		}
+	}()
 	err := trackService(service, func(status uint32) bool {
 		state := notifyStateToTunState(status)
 		var tunnelError error
@@ -260,6 +317,13 @@ func trackTunnelService(tunnelName string, service *mgr.Service) {
 			trackedTunnelsLock.Unlock()
 			IPCServerNotifyTunnelChange(tunnelName, state, tunnelError)
 			lastState = state
+			if state == TunnelStarted && stopPeerHealth == nil {
+				stopPeerHealth = make(chan struct{})
+				go watchPeerHealth(tunnelName, stopPeerHealth)
+			} else if state != TunnelStarted && stopPeerHealth != nil {
+				close(stopPeerHealth)
+				stopPeerHealth = nil
+			}
 		}
 		if state == TunnelUnknown && checkForDisabled() {
 			return true
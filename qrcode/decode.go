@@ -0,0 +1,406 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package qrcode
+
+import (
+	"errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"math/bits"
+	"os"
+)
+
+var ErrNotFound = errors.New("No QR code was found in the image")
+
+// Decode reads the data of a QR code from an image, such as a screenshot or a photo. The code is
+// located by its three finder patterns, so it may be rotated and surrounded by other things, as long
+// as it is the only code in the image, it is not mirrored, and its modules are a few pixels across.
+// Perspective is corrected with the alignment pattern in the lower right, which the smallest codes
+// lack, so codes seen at a steep angle may not be read, and neither are curved or folded ones. Damage
+// is corrected to the extent the error correction level of the code allows.
+func Decode(img image.Image) ([]byte, error) {
+	luminance, lowest, highest := luminances(img)
+	bounds := img.Bounds()
+	global := binarize(bounds, luminance, lowest, highest)
+	err := ErrNotFound
+	for _, b := range []*bitmap{global, binarizeLocally(bounds, luminance, lowest, highest)} {
+		for _, c := range locate(b) {
+			data, decodeErr := c.decode()
+			if decodeErr == nil {
+				return data, nil
+			}
+			err = decodeErr
+		}
+	}
+	// A code that fills the image without a quiet zone has finder patterns that touch its edges.
+	grid, gridErr := sampleGrid(global)
+	if gridErr != nil {
+		return nil, err
+	}
+	data, gridErr := grid.decode()
+	if gridErr != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// DecodeFile reads the data of a QR code from a PNG, JPEG, or GIF file, like Decode.
+func DecodeFile(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(img)
+}
+
+type bitmap struct {
+	bounds image.Rectangle
+	dark   []bool
+}
+
+func (b *bitmap) at(x, y int) bool {
+	if !(image.Point{x, y}).In(b.bounds) {
+		return false
+	}
+	return b.dark[(y-b.bounds.Min.Y)*b.bounds.Dx()+(x-b.bounds.Min.X)]
+}
+
+// luminances returns the luminance of each pixel of the image, after compositing it onto white, row by
+// row, along with the lowest and highest of them.
+func luminances(img image.Image) (luminance []uint32, lowest, highest uint32) {
+	bounds := img.Bounds()
+	luminance = make([]uint32, bounds.Dx()*bounds.Dy())
+	lowest, highest = uint32(math.MaxUint32), uint32(0)
+	i := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			r, g, b = r+0xffff-a, g+0xffff-a, b+0xffff-a
+			l := (19595*r + 38470*g + 7471*b + 1<<15) >> 16
+			luminance[i] = l
+			if l < lowest {
+				lowest = l
+			}
+			if l > highest {
+				highest = l
+			}
+			i++
+		}
+	}
+	return
+}
+
+// binarize thresholds the image halfway between its darkest and lightest pixels.
+func binarize(bounds image.Rectangle, luminance []uint32, lowest, highest uint32) *bitmap {
+	threshold := lowest + (highest-lowest)/2
+	b := &bitmap{bounds, make([]bool, len(luminance))}
+	for i, l := range luminance {
+		b.dark[i] = l < threshold && highest != lowest
+	}
+	return b
+}
+
+// binarizeLocally thresholds each pixel of the image against the mean of the pixels around it, which
+// copes with the uneven lighting of photos and with codes that sit on dark backgrounds. Pixels that are
+// about as light as their surroundings are light, so that noise on even areas does not turn dark.
+func binarizeLocally(bounds image.Rectangle, luminance []uint32, lowest, highest uint32) *bitmap {
+	width, height := bounds.Dx(), bounds.Dy()
+	b := &bitmap{bounds, make([]bool, len(luminance))}
+	if highest == lowest {
+		return b
+	}
+	// sums[(y+1)*(width+1)+(x+1)] is the sum of the luminances of the pixels above and left of (x, y), inclusive.
+	sums := make([]uint64, (width+1)*(height+1))
+	for y := 0; y < height; y++ {
+		var row uint64
+		for x := 0; x < width; x++ {
+			row += uint64(luminance[y*width+x])
+			sums[(y+1)*(width+1)+x+1] = sums[y*(width+1)+x+1] + row
+		}
+	}
+	radius := width
+	if height < radius {
+		radius = height
+	}
+	radius /= 10
+	if radius < 8 {
+		radius = 8
+	}
+	margin := uint64(highest-lowest) / 16
+	for y := 0; y < height; y++ {
+		top, bottom := max(y-radius, 0), y+radius+1
+		if bottom > height {
+			bottom = height
+		}
+		for x := 0; x < width; x++ {
+			left, right := max(x-radius, 0), x+radius+1
+			if right > width {
+				right = width
+			}
+			area := uint64((bottom - top) * (right - left))
+			sum := sums[bottom*(width+1)+right] - sums[top*(width+1)+right] - sums[bottom*(width+1)+left] + sums[top*(width+1)+left]
+			b.dark[y*width+x] = (uint64(luminance[y*width+x])+margin)*area < sum
+		}
+	}
+	return b
+}
+
+// sampleGrid locates the symbol by the bounding box of its dark modules, determines the size of the
+// modules from the top edge of the upper left finder pattern, and reads the module at each position.
+// It only works for upright symbols that are alone in the image, but unlike locate, it does not need
+// the quiet zone around the symbol.
+func sampleGrid(b *bitmap) (*Code, error) {
+	minX, minY, maxX, maxY := b.bounds.Max.X, b.bounds.Max.Y, b.bounds.Min.X-1, b.bounds.Min.Y-1
+	for y := b.bounds.Min.Y; y < b.bounds.Max.Y; y++ {
+		for x := b.bounds.Min.X; x < b.bounds.Max.X; x++ {
+			if b.at(x, y) {
+				if x < minX {
+					minX = x
+				}
+				if x > maxX {
+					maxX = x
+				}
+				if y < minY {
+					minY = y
+				}
+				if y > maxY {
+					maxY = y
+				}
+			}
+		}
+	}
+	if maxX < minX || maxY < minY {
+		return nil, ErrNotFound
+	}
+
+	runX, runY := 0, 0
+	for b.at(minX+runX, minY) {
+		runX++
+	}
+	for b.at(minX, minY+runY) {
+		runY++
+	}
+	width, height := float64(maxX-minX+1), float64(maxY-minY+1)
+	sizeX, sizeY := math.Round(width*7/float64(runX)), math.Round(height*7/float64(runY))
+	version := int(math.Round(((sizeX+sizeY)/2 - 17) / 4))
+	if version < minVersion || version > maxVersion {
+		return nil, ErrNotFound
+	}
+
+	c := newCode(version)
+	pitchX, pitchY := width/float64(c.Size), height/float64(c.Size)
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			px := minX + int((float64(x)+0.5)*pitchX)
+			py := minY + int((float64(y)+0.5)*pitchY)
+			c.modules[y*c.Size+x] = b.at(px, py)
+		}
+	}
+	return c, nil
+}
+
+// readFormat returns the error correction level and mask from whichever copy of the format
+// information is closest to a valid one, provided that it is within three bits of it.
+func (c *Code) readFormat() (ErrorCorrectionLevel, int, error) {
+	first, second := formatPositions(c.Size)
+	bestDistance, bestLevel, bestMask := 4, Low, 0
+	for _, positions := range [][15][2]int{first, second} {
+		read := 0
+		for i, position := range positions {
+			if c.Dark(position[0], position[1]) {
+				read |= 1 << i
+			}
+		}
+		for level := Low; level <= High; level++ {
+			for mask := 0; mask < 8; mask++ {
+				if distance := bits.OnesCount(uint(read ^ formatBits(level, mask))); distance < bestDistance {
+					bestDistance, bestLevel, bestMask = distance, level, mask
+				}
+			}
+		}
+	}
+	if bestDistance > 3 {
+		return 0, 0, errors.New("Unable to read the format information of the QR code")
+	}
+	return bestLevel, bestMask, nil
+}
+
+func (c *Code) decode() ([]byte, error) {
+	level, mask, err := c.readFormat()
+	if err != nil {
+		return nil, err
+	}
+	template := newCode(c.Version)
+	c.function = template.function
+	c.applyMask(mask)
+
+	codewords := make([]byte, rawDataModules(c.Version)/8)
+	for i, position := range c.dataPositions() {
+		if i/8 < len(codewords) && c.Dark(position[0], position[1]) {
+			codewords[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+
+	ecc := eccCodewordsPerBlock[level][c.Version]
+	lengths := blockLengths(c.Version, level)
+	blocks := make([][]byte, len(lengths))
+	for i, length := range lengths {
+		blocks[i] = make([]byte, 0, length+ecc)
+	}
+	for i := 0; i <= lengths[len(lengths)-1]; i++ {
+		for j := range blocks {
+			if i < lengths[j] {
+				blocks[j] = append(blocks[j], codewords[0])
+				codewords = codewords[1:]
+			}
+		}
+	}
+	for i := 0; i < ecc; i++ {
+		for j := range blocks {
+			blocks[j] = append(blocks[j], codewords[0])
+			codewords = codewords[1:]
+		}
+	}
+	var data []byte
+	for i, block := range blocks {
+		err = rsCorrect(block, ecc)
+		if err != nil {
+			return nil, errors.New("Unable to correct the errors in the QR code")
+		}
+		data = append(data, block[:lengths[i]]...)
+	}
+	return parseSegments(data, c.Version)
+}
+
+type bitReader struct {
+	data []byte
+	bit  int
+}
+
+func (r *bitReader) remaining() int {
+	return len(r.data)*8 - r.bit
+}
+
+func (r *bitReader) read(length int) int {
+	value := 0
+	for i := 0; i < length; i++ {
+		value <<= 1
+		if r.data[r.bit/8]&(0x80>>(r.bit%8)) != 0 {
+			value |= 1
+		}
+		r.bit++
+	}
+	return value
+}
+
+const alphanumericCharset = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+
+var errMalformedData = errors.New("The data of the QR code is malformed")
+
+// parseSegments decodes the numeric, alphanumeric, and byte mode segments of data, ignoring ECI
+// designators.
+func parseSegments(data []byte, version int) ([]byte, error) {
+	countBits := func(small, medium, large int) int {
+		if version <= 9 {
+			return small
+		} else if version <= 26 {
+			return medium
+		}
+		return large
+	}
+	r := &bitReader{data: data}
+	var result []byte
+	for r.remaining() >= 4 {
+		mode := r.read(4)
+		switch mode {
+		case 0x0:
+			return result, nil
+		case 0x1:
+			if r.remaining() < countBits(10, 12, 14) {
+				return nil, errMalformedData
+			}
+			count := r.read(countBits(10, 12, 14))
+			for count > 0 {
+				digits, length := 3, 10
+				if count == 2 {
+					digits, length = 2, 7
+				} else if count == 1 {
+					digits, length = 1, 4
+				}
+				if r.remaining() < length {
+					return nil, errMalformedData
+				}
+				value := r.read(length)
+				for i, divisor := 0, int(math.Pow10(digits-1)); i < digits; i, divisor = i+1, divisor/10 {
+					result = append(result, byte('0'+value/divisor%10))
+				}
+				count -= digits
+			}
+		case 0x2:
+			if r.remaining() < countBits(9, 11, 13) {
+				return nil, errMalformedData
+			}
+			count := r.read(countBits(9, 11, 13))
+			for ; count >= 2; count -= 2 {
+				if r.remaining() < 11 {
+					return nil, errMalformedData
+				}
+				value := r.read(11)
+				if value/45 >= len(alphanumericCharset) {
+					return nil, errMalformedData
+				}
+				result = append(result, alphanumericCharset[value/45], alphanumericCharset[value%45])
+			}
+			if count == 1 {
+				if r.remaining() < 6 {
+					return nil, errMalformedData
+				}
+				value := r.read(6)
+				if value >= len(alphanumericCharset) {
+					return nil, errMalformedData
+				}
+				result = append(result, alphanumericCharset[value])
+			}
+		case 0x4:
+			if r.remaining() < countBits(8, 16, 16) {
+				return nil, errMalformedData
+			}
+			count := r.read(countBits(8, 16, 16))
+			if r.remaining() < count*8 {
+				return nil, errMalformedData
+			}
+			for i := 0; i < count; i++ {
+				result = append(result, byte(r.read(8)))
+			}
+		case 0x7:
+			if r.remaining() < 8 {
+				return nil, errMalformedData
+			}
+			designator := r.read(8)
+			if designator&0x80 != 0 {
+				extra := 8
+				if designator&0xc0 == 0xc0 {
+					extra = 16
+				}
+				if r.remaining() < extra {
+					return nil, errMalformedData
+				}
+				r.read(extra)
+			}
+		default:
+			return nil, errors.New("The QR code uses an unsupported mode")
+		}
+	}
+	return result, nil
+}
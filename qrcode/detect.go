@@ -0,0 +1,413 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package qrcode
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+// finderPattern is a candidate for one of the three finder patterns of a symbol, the concentric
+// squares in its corners, whose runs of dark and light modules are in the ratio 1:1:3:1:1 along any
+// line through the center.
+type finderPattern struct {
+	x, y       float64
+	moduleSize float64
+	count      int // How many scan lines found it
+}
+
+// runs measures the five runs along the line through (x, y) in the direction (dx, dy), of which the
+// middle one is dark and contains (x, y). It returns their lengths and the offset of the center of the
+// middle run from (x, y), or false if any of the runs is cut off by the edge of the bitmap.
+func (b *bitmap) runs(x, y, dx, dy int) (runs [5]int, center float64, ok bool) {
+	if !b.at(x, y) {
+		return
+	}
+	in := func(i int) bool {
+		return (image.Point{x + i*dx, y + i*dy}).In(b.bounds)
+	}
+	dark := func(i int) bool {
+		return b.at(x+i*dx, y+i*dy)
+	}
+	start := 0
+	for in(start-1) && dark(start-1) {
+		start--
+	}
+	i := start
+	for k := 1; k >= 0; k-- {
+		for in(i-1) && dark(i-1) == (k == 0) {
+			i--
+			runs[k]++
+		}
+		if runs[k] == 0 {
+			return
+		}
+	}
+	end := 0
+	for in(end+1) && dark(end+1) {
+		end++
+	}
+	runs[2] = end - start + 1
+	j := end
+	for k := 3; k < 5; k++ {
+		for in(j+1) && dark(j+1) == (k == 4) {
+			j++
+			runs[k]++
+		}
+		if runs[k] == 0 {
+			return
+		}
+	}
+	return runs, float64(start) + float64(runs[2])/2, true
+}
+
+func total(runs [5]int) int {
+	return runs[0] + runs[1] + runs[2] + runs[3] + runs[4]
+}
+
+// finderRatio reports whether runs are in the ratio 1:1:3:1:1, give or take half a module each.
+func finderRatio(runs [5]int) bool {
+	t := total(runs)
+	if t < 7 {
+		return false
+	}
+	moduleSize := float64(t) / 7
+	variance := moduleSize / 2
+	return math.Abs(moduleSize-float64(runs[0])) < variance &&
+		math.Abs(moduleSize-float64(runs[1])) < variance &&
+		math.Abs(3*moduleSize-float64(runs[2])) < 3*variance &&
+		math.Abs(moduleSize-float64(runs[3])) < variance &&
+		math.Abs(moduleSize-float64(runs[4])) < variance
+}
+
+// findFinderPatterns scans the rows of the bitmap for runs in the ratio of a finder pattern, checks
+// each one found along the column through its center, and again along the row through the center
+// found there, and merges those that are at the same place.
+func findFinderPatterns(b *bitmap) []*finderPattern {
+	var patterns []*finderPattern
+	for y := b.bounds.Min.Y; y < b.bounds.Max.Y; y++ {
+		var row [][2]int // The start and length of each run of the row, beginning with a light one
+		for x := b.bounds.Min.X; x < b.bounds.Max.X; {
+			start := x
+			for x < b.bounds.Max.X && b.at(x, y) == (len(row)%2 == 1) {
+				x++
+			}
+			row = append(row, [2]int{start, x - start})
+		}
+		for i := 1; i+4 < len(row); i += 2 {
+			var horizontal [5]int
+			for k := range horizontal {
+				horizontal[k] = row[i+k][1]
+			}
+			if !finderRatio(horizontal) {
+				continue
+			}
+			x := row[i+2][0] + row[i+2][1]/2
+			vertical, centerY, ok := b.runs(x, y, 0, 1)
+			if !ok || !finderRatio(vertical) || 5*abs(total(vertical)-total(horizontal)) >= 2*total(horizontal) {
+				continue
+			}
+			cy := float64(y) + centerY
+			horizontal, centerX, ok := b.runs(x, int(cy), 1, 0)
+			if !ok || !finderRatio(horizontal) {
+				continue
+			}
+			p := &finderPattern{
+				x:          float64(x) + centerX,
+				y:          cy,
+				moduleSize: float64(total(horizontal)+total(vertical)) / 14,
+				count:      1,
+			}
+			merged := false
+			for _, q := range patterns {
+				if math.Hypot(p.x-q.x, p.y-q.y) <= q.moduleSize*2 && math.Abs(p.moduleSize-q.moduleSize) <= q.moduleSize/2 {
+					n := float64(q.count)
+					q.x = (q.x*n + p.x) / (n + 1)
+					q.y = (q.y*n + p.y) / (n + 1)
+					q.moduleSize = (q.moduleSize*n + p.moduleSize) / (n + 1)
+					q.count++
+					merged = true
+					break
+				}
+			}
+			if !merged {
+				patterns = append(patterns, p)
+			}
+		}
+	}
+	return patterns
+}
+
+// finderWidth measures the finder pattern p along the line towards the center of the finder pattern
+// towards, and returns its width, or 0 if its runs along that line are not in the ratio of a finder
+// pattern.
+func (b *bitmap) finderWidth(p, towards *finderPattern) float64 {
+	distance := math.Hypot(towards.x-p.x, towards.y-p.y)
+	dx, dy := (towards.x-p.x)/distance, (towards.y-p.y)/distance
+	at := func(i int) (bool, bool) {
+		x, y := int(math.Floor(p.x+float64(i)*dx)), int(math.Floor(p.y+float64(i)*dy))
+		return b.at(x, y), (image.Point{x, y}).In(b.bounds)
+	}
+	var runs [5]int
+	for direction := -1; direction <= 1; direction += 2 {
+		k, dark := 2, true
+		for i := 0; k >= 0 && k < 5; i += direction {
+			d, in := at(i)
+			if !in {
+				break
+			}
+			if d != dark {
+				k += direction
+				dark = d
+				if k < 0 || k >= 5 {
+					break
+				}
+			}
+			runs[k]++
+		}
+	}
+	// The pixel at the center was counted twice.
+	runs[2]--
+	if !finderRatio(runs) {
+		return 0
+	}
+	return float64(total(runs))
+}
+
+// moduleSizeBetween returns the size of the modules of the finder patterns p and q along the line
+// through them, or 0 if neither can be measured.
+func (b *bitmap) moduleSizeBetween(p, q *finderPattern) float64 {
+	sum, measured := 0.0, 0
+	for _, width := range []float64{b.finderWidth(p, q), b.finderWidth(q, p)} {
+		if width != 0 {
+			sum += width
+			measured++
+		}
+	}
+	if measured == 0 {
+		return 0
+	}
+	return sum / float64(measured) / 7
+}
+
+// orderFinderPatterns chooses the three finder patterns that most look like those of one symbol, and
+// returns them as its upper left, upper right, and lower left ones, as seen with the symbol upright.
+func orderFinderPatterns(patterns []*finderPattern) (topLeft, topRight, bottomLeft *finderPattern, ok bool) {
+	sort.SliceStable(patterns, func(i, j int) bool {
+		return patterns[i].count > patterns[j].count
+	})
+	// Real finder patterns span several rows, so those found by a single scan line are mostly noise.
+	for i, p := range patterns {
+		if p.count < 2 {
+			patterns = patterns[:i]
+			break
+		}
+	}
+	if len(patterns) > 12 {
+		patterns = patterns[:12]
+	}
+	bestScore := math.Inf(1)
+	for i := 0; i < len(patterns); i++ {
+		for j := i + 1; j < len(patterns); j++ {
+			for k := j + 1; k < len(patterns); k++ {
+				a, b, c := patterns[i], patterns[j], patterns[k]
+				sizes := []float64{a.moduleSize, b.moduleSize, c.moduleSize}
+				sort.Float64s(sizes)
+				if sizes[2] > sizes[0]*1.5 {
+					continue
+				}
+				// The corner is the pattern opposite the longest side.
+				ab, bc, ca := math.Hypot(a.x-b.x, a.y-b.y), math.Hypot(b.x-c.x, b.y-c.y), math.Hypot(c.x-a.x, c.y-a.y)
+				corner, p, q, hypotenuse, leg1, leg2 := c, a, b, ab, bc, ca
+				if bc >= ab && bc >= ca {
+					corner, p, q, hypotenuse, leg1, leg2 = a, b, c, bc, ab, ca
+				} else if ca >= ab && ca >= bc {
+					corner, p, q, hypotenuse, leg1, leg2 = b, c, a, ca, ab, bc
+				}
+				// The finder patterns of the smallest symbols are 14 modules apart, and rotation inflates the
+				// module sizes found along the rows and columns of the image by up to a factor of √2.
+				if leg1 < sizes[0]*9 || leg2 < sizes[0]*9 {
+					continue
+				}
+				// Perspective makes the legs differ, but not wildly so.
+				score := math.Abs(leg1-leg2)/math.Max(leg1, leg2) + math.Abs(hypotenuse-math.Hypot(leg1, leg2))/hypotenuse + (sizes[2]-sizes[0])/sizes[0]
+				if score < bestScore {
+					bestScore = score
+					topLeft, topRight, bottomLeft = corner, p, q
+				}
+			}
+		}
+	}
+	if topLeft == nil {
+		return nil, nil, nil, false
+	}
+	// In image coordinates, which point down, the upper right pattern is clockwise from the lower left
+	// one around the upper left one.
+	if (topRight.x-topLeft.x)*(bottomLeft.y-topLeft.y)-(topRight.y-topLeft.y)*(bottomLeft.x-topLeft.x) < 0 {
+		topRight, bottomLeft = bottomLeft, topRight
+	}
+	return topLeft, topRight, bottomLeft, true
+}
+
+// perspective maps points of one plane to another, as projecting a symbol onto an image does. Its
+// fields are named after the entries of the matrix that transforms row vectors (x, y, 1).
+type perspective struct {
+	a11, a12, a13 float64
+	a21, a22, a23 float64
+	a31, a32, a33 float64
+}
+
+func (t *perspective) apply(x, y float64) (float64, float64) {
+	d := t.a13*x + t.a23*y + t.a33
+	return (t.a11*x + t.a21*y + t.a31) / d, (t.a12*x + t.a22*y + t.a32) / d
+}
+
+// squareToQuadrilateral maps the corners (0, 0), (1, 0), (1, 1), and (0, 1) of the unit square to
+// the points given in q, in that order.
+func squareToQuadrilateral(q [4][2]float64) perspective {
+	x0, y0, x1, y1, x2, y2, x3, y3 := q[0][0], q[0][1], q[1][0], q[1][1], q[2][0], q[2][1], q[3][0], q[3][1]
+	dx3, dy3 := x0-x1+x2-x3, y0-y1+y2-y3
+	if dx3 == 0 && dy3 == 0 {
+		return perspective{
+			a11: x1 - x0, a21: x2 - x1, a31: x0,
+			a12: y1 - y0, a22: y2 - y1, a32: y0,
+			a33: 1,
+		}
+	}
+	dx1, dx2, dy1, dy2 := x1-x2, x3-x2, y1-y2, y3-y2
+	denominator := dx1*dy2 - dx2*dy1
+	a13 := (dx3*dy2 - dx2*dy3) / denominator
+	a23 := (dx1*dy3 - dx3*dy1) / denominator
+	return perspective{
+		a11: x1 - x0 + a13*x1, a21: x3 - x0 + a23*x3, a31: x0,
+		a12: y1 - y0 + a13*y1, a22: y3 - y0 + a23*y3, a32: y0,
+		a13: a13, a23: a23, a33: 1,
+	}
+}
+
+// adjoint returns the adjoint of the matrix, which is the inverse transformation, as the scale of
+// the matrix does not matter.
+func (t *perspective) adjoint() perspective {
+	return perspective{
+		a11: t.a22*t.a33 - t.a23*t.a32, a21: t.a23*t.a31 - t.a21*t.a33, a31: t.a21*t.a32 - t.a22*t.a31,
+		a12: t.a13*t.a32 - t.a12*t.a33, a22: t.a11*t.a33 - t.a13*t.a31, a32: t.a12*t.a31 - t.a11*t.a32,
+		a13: t.a12*t.a23 - t.a13*t.a22, a23: t.a13*t.a21 - t.a11*t.a23, a33: t.a11*t.a22 - t.a12*t.a21,
+	}
+}
+
+// then returns the transformation that applies t and then o.
+func (t *perspective) then(o *perspective) perspective {
+	return perspective{
+		a11: t.a11*o.a11 + t.a12*o.a21 + t.a13*o.a31, a12: t.a11*o.a12 + t.a12*o.a22 + t.a13*o.a32, a13: t.a11*o.a13 + t.a12*o.a23 + t.a13*o.a33,
+		a21: t.a21*o.a11 + t.a22*o.a21 + t.a23*o.a31, a22: t.a21*o.a12 + t.a22*o.a22 + t.a23*o.a32, a23: t.a21*o.a13 + t.a22*o.a23 + t.a23*o.a33,
+		a31: t.a31*o.a11 + t.a32*o.a21 + t.a33*o.a31, a32: t.a31*o.a12 + t.a32*o.a22 + t.a33*o.a32, a33: t.a31*o.a13 + t.a32*o.a23 + t.a33*o.a33,
+	}
+}
+
+// quadrilateralToQuadrilateral maps the points of from to those of to, in order.
+func quadrilateralToQuadrilateral(from, to [4][2]float64) perspective {
+	fromSquare := squareToQuadrilateral(from)
+	toSquare := fromSquare.adjoint()
+	toQuadrilateral := squareToQuadrilateral(to)
+	return toSquare.then(&toQuadrilateral)
+}
+
+// findAlignmentPattern looks for the alignment pattern in the lower right of a symbol, a dark module
+// ringed by light and dark ones, within radius pixels of where it is expected, and returns its center
+// if it is found.
+func findAlignmentPattern(b *bitmap, x, y, moduleSize, radius float64) (float64, float64, bool) {
+	fits := func(runs [5]int) bool {
+		variance := moduleSize / 2
+		return math.Abs(float64(runs[1])-moduleSize) < variance &&
+			math.Abs(float64(runs[2])-moduleSize) < variance &&
+			math.Abs(float64(runs[3])-moduleSize) < variance &&
+			float64(runs[0]) >= variance && float64(runs[4]) >= variance
+	}
+	bestX, bestY, bestDistance := 0.0, 0.0, math.Inf(1)
+	for py := int(y - radius); py <= int(y+radius); py++ {
+		for px := int(x - radius); px <= int(x+radius); px++ {
+			if !b.at(px, py) || b.at(px-1, py) {
+				continue
+			}
+			horizontal, centerX, ok := b.runs(px, py, 1, 0)
+			if !ok || !fits(horizontal) {
+				continue
+			}
+			cx := float64(px) + centerX
+			vertical, centerY, ok := b.runs(int(cx), py, 0, 1)
+			if !ok || !fits(vertical) {
+				continue
+			}
+			cy := float64(py) + centerY
+			if distance := math.Hypot(cx-x, cy-y); distance < bestDistance {
+				bestX, bestY, bestDistance = cx, cy, distance
+			}
+		}
+	}
+	return bestX, bestY, !math.IsInf(bestDistance, 1)
+}
+
+// locate finds the finder patterns of a symbol in the bitmap, which may be rotated, skewed, and
+// surrounded by other things, and samples its modules for each version that the distances between
+// the patterns suggest, the likeliest first. The perspective is taken from the alignment pattern in
+// the lower right where there is one, and the symbol is otherwise treated as a parallelogram.
+func locate(b *bitmap) []*Code {
+	topLeft, topRight, bottomLeft, ok := orderFinderPatterns(findFinderPatterns(b))
+	if !ok {
+		return nil
+	}
+	// Scanning along the rows and columns of the image overestimates the size of the modules of
+	// rotated symbols, so the finder patterns are measured again along the edges of the symbol.
+	width, height := math.Hypot(topRight.x-topLeft.x, topRight.y-topLeft.y), math.Hypot(bottomLeft.x-topLeft.x, bottomLeft.y-topLeft.y)
+	moduleWidth, moduleHeight := b.moduleSizeBetween(topLeft, topRight), b.moduleSizeBetween(topLeft, bottomLeft)
+	if moduleWidth == 0 || moduleHeight == 0 {
+		return nil
+	}
+	modules := (width/moduleWidth + height/moduleHeight) / 2
+	// The alignment pattern is looked for along the rows and columns of the image, like the finder
+	// patterns were.
+	moduleSize := (topLeft.moduleSize + topRight.moduleSize + bottomLeft.moduleSize) / 3
+	estimate := int(math.Round((modules + 7 - 17) / 4))
+
+	var codes []*Code
+	for _, version := range []int{estimate, estimate - 1, estimate + 1} {
+		if version < minVersion || version > maxVersion {
+			continue
+		}
+		c := newCode(version)
+		size := float64(c.Size)
+		// The centers of the finder patterns are 3.5 modules in from the corners of the symbol.
+		from := [4][2]float64{{3.5, 3.5}, {size - 3.5, 3.5}, {size - 3.5, size - 3.5}, {3.5, size - 3.5}}
+		to := [4][2]float64{
+			{topLeft.x, topLeft.y},
+			{topRight.x, topRight.y},
+			{topRight.x + bottomLeft.x - topLeft.x, topRight.y + bottomLeft.y - topLeft.y},
+			{bottomLeft.x, bottomLeft.y},
+		}
+		if version >= 2 {
+			// The alignment pattern in the lower right is centered 6.5 modules in from the corner.
+			affine := quadrilateralToQuadrilateral(from, to)
+			x, y := affine.apply(size-6.5, size-6.5)
+			for _, allowance := range []float64{4, 8, 16} {
+				if ax, ay, found := findAlignmentPattern(b, x, y, moduleSize, allowance*moduleSize); found {
+					from[2] = [2]float64{size - 6.5, size - 6.5}
+					to[2] = [2]float64{ax, ay}
+					break
+				}
+			}
+		}
+		t := quadrilateralToQuadrilateral(from, to)
+		for y := 0; y < c.Size; y++ {
+			for x := 0; x < c.Size; x++ {
+				px, py := t.apply(float64(x)+0.5, float64(y)+0.5)
+				c.modules[y*c.Size+x] = b.at(int(math.Floor(px)), int(math.Floor(py)))
+			}
+		}
+		codes = append(codes, c)
+	}
+	return codes
+}
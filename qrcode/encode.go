@@ -0,0 +1,382 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+// Package qrcode encodes data into QR codes and decodes it from images of them.
+package qrcode
+
+import (
+	"errors"
+)
+
+type ErrorCorrectionLevel int
+
+const (
+	Low      ErrorCorrectionLevel = iota // Recovers from 7% of the codewords being wrong.
+	Medium                               // Recovers from 15% of the codewords being wrong.
+	Quartile                             // Recovers from 25% of the codewords being wrong.
+	High                                 // Recovers from 30% of the codewords being wrong.
+)
+
+var ErrDataTooLong = errors.New("Data is too long for a QR code")
+
+// Code is a QR code symbol.
+type Code struct {
+	Version int
+	Size    int
+
+	modules  []bool // Dark modules are true, indexed by row*Size+column.
+	function []bool // Modules that are part of function patterns or format information.
+}
+
+// Dark reports whether the module at the given column and row is dark.
+func (c *Code) Dark(x, y int) bool {
+	return c.modules[y*c.Size+x]
+}
+
+func newCode(version int) *Code {
+	size := sizeOfVersion(version)
+	c := &Code{
+		Version:  version,
+		Size:     size,
+		modules:  make([]bool, size*size),
+		function: make([]bool, size*size),
+	}
+	c.drawFunctionPatterns()
+	return c
+}
+
+func (c *Code) setFunction(x, y int, dark bool) {
+	c.modules[y*c.Size+x] = dark
+	c.function[y*c.Size+x] = true
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func (c *Code) drawFunctionPatterns() {
+	for i := 0; i < c.Size; i++ {
+		c.setFunction(6, i, i%2 == 0)
+		c.setFunction(i, 6, i%2 == 0)
+	}
+
+	for _, center := range [][2]int{{3, 3}, {c.Size - 4, 3}, {3, c.Size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := center[0]+dx, center[1]+dy
+				if x < 0 || x >= c.Size || y < 0 || y >= c.Size {
+					continue
+				}
+				distance := max(abs(dx), abs(dy))
+				c.setFunction(x, y, distance != 2 && distance != 4)
+			}
+		}
+	}
+
+	positions := alignmentPositions(c.Version)
+	last := len(positions) - 1
+	for i := range positions {
+		for j := range positions {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					c.setFunction(positions[i]+dx, positions[j]+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	c.drawFormat(0)
+	if c.Version >= 7 {
+		bits := versionBits(c.Version)
+		for i := 0; i < 18; i++ {
+			dark := (bits>>i)&1 != 0
+			a, b := c.Size-11+i%3, i/3
+			c.setFunction(a, b, dark)
+			c.setFunction(b, a, dark)
+		}
+	}
+}
+
+// formatPositions returns the coordinates of the fifteen format bits, least significant first, in
+// each of the two copies of the format information.
+func formatPositions(size int) (first, second [15][2]int) {
+	for i := 0; i <= 5; i++ {
+		first[i] = [2]int{8, i}
+	}
+	first[6] = [2]int{8, 7}
+	first[7] = [2]int{8, 8}
+	first[8] = [2]int{7, 8}
+	for i := 9; i < 15; i++ {
+		first[i] = [2]int{14 - i, 8}
+	}
+	for i := 0; i < 8; i++ {
+		second[i] = [2]int{size - 1 - i, 8}
+	}
+	for i := 8; i < 15; i++ {
+		second[i] = [2]int{8, size - 15 + i}
+	}
+	return
+}
+
+func (c *Code) drawFormat(bits int) {
+	first, second := formatPositions(c.Size)
+	for i := 0; i < 15; i++ {
+		dark := (bits>>i)&1 != 0
+		c.setFunction(first[i][0], first[i][1], dark)
+		c.setFunction(second[i][0], second[i][1], dark)
+	}
+	c.setFunction(8, c.Size-8, true)
+}
+
+// dataPositions returns the coordinates of the modules that hold codewords, in the order in which
+// their bits are placed: in pairs of columns from the right, zigzagging up and down.
+func (c *Code) dataPositions() [][2]int {
+	var positions [][2]int
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vertical := 0; vertical < c.Size; vertical++ {
+			y := vertical
+			if upward {
+				y = c.Size - 1 - vertical
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if !c.function[y*c.Size+x] {
+					positions = append(positions, [2]int{x, y})
+				}
+			}
+		}
+	}
+	return positions
+}
+
+func masked(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	case 7:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+	return false
+}
+
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.function[y*c.Size+x] && masked(mask, x, y) {
+				c.modules[y*c.Size+x] = !c.modules[y*c.Size+x]
+			}
+		}
+	}
+}
+
+// penalty scores how hard the symbol might be to scan, according to the rules of ISO/IEC 18004.
+func (c *Code) penalty() int {
+	score := 0
+	finderLike := [][]bool{
+		{true, false, true, true, true, false, true, false, false, false, false},
+		{false, false, false, false, true, false, true, true, true, false, true},
+	}
+	for _, transposed := range []bool{false, true} {
+		at := func(a, b int) bool {
+			if transposed {
+				return c.Dark(b, a)
+			}
+			return c.Dark(a, b)
+		}
+		for b := 0; b < c.Size; b++ {
+			run := 1
+			for a := 1; a <= c.Size; a++ {
+				if a < c.Size && at(a, b) == at(a-1, b) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					score += 3 + run - 5
+				}
+				run = 1
+			}
+			for a := 0; a+11 <= c.Size; a++ {
+				for _, pattern := range finderLike {
+					matches := true
+					for k := range pattern {
+						if at(a+k, b) != pattern[k] {
+							matches = false
+							break
+						}
+					}
+					if matches {
+						score += 40
+					}
+				}
+			}
+		}
+	}
+	dark := 0
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.Dark(x, y) {
+				dark++
+			}
+			if x+1 < c.Size && y+1 < c.Size {
+				color := c.Dark(x, y)
+				if c.Dark(x+1, y) == color && c.Dark(x, y+1) == color && c.Dark(x+1, y+1) == color {
+					score += 3
+				}
+			}
+		}
+	}
+	total := c.Size * c.Size
+	score += ((abs(dark*20-total*10)+total-1)/total - 1) * 10
+	return score
+}
+
+type bitBuffer struct {
+	bytes []byte
+	bits  int
+}
+
+func (b *bitBuffer) append(value, length int) {
+	for i := length - 1; i >= 0; i-- {
+		if b.bits%8 == 0 {
+			b.bytes = append(b.bytes, 0)
+		}
+		if (value>>i)&1 != 0 {
+			b.bytes[b.bits/8] |= 0x80 >> (b.bits % 8)
+		}
+		b.bits++
+	}
+}
+
+func characterCountBits(version int) int {
+	if version <= 9 {
+		return 8
+	}
+	return 16
+}
+
+// Encode returns the smallest QR code that holds data in byte mode at the given error correction
+// level, choosing the mask with the lowest penalty.
+func Encode(data []byte, level ErrorCorrectionLevel) (*Code, error) {
+	version := minVersion
+	for ; version <= maxVersion; version++ {
+		if 4+characterCountBits(version)+len(data)*8 <= dataCodewords(version, level)*8 {
+			break
+		}
+	}
+	if version > maxVersion {
+		return nil, ErrDataTooLong
+	}
+
+	capacity := dataCodewords(version, level)
+	var buffer bitBuffer
+	buffer.append(0x4, 4)
+	buffer.append(len(data), characterCountBits(version))
+	for _, b := range data {
+		buffer.append(int(b), 8)
+	}
+	terminator := capacity*8 - buffer.bits
+	if terminator > 4 {
+		terminator = 4
+	}
+	buffer.append(0, terminator)
+	buffer.append(0, (8-buffer.bits%8)%8)
+	for pad := 0xec; len(buffer.bytes) < capacity; pad ^= 0xec ^ 0x11 {
+		buffer.append(pad, 8)
+	}
+
+	codewords := interleave(buffer.bytes, version, level)
+	c := newCode(version)
+	for i, position := range c.dataPositions() {
+		if i/8 < len(codewords) {
+			c.modules[position[1]*c.Size+position[0]] = codewords[i/8]&(0x80>>(i%8)) != 0
+		}
+	}
+
+	bestMask, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		c.applyMask(mask)
+		c.drawFormat(formatBits(level, mask))
+		if penalty := c.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			bestMask, bestPenalty = mask, penalty
+		}
+		c.applyMask(mask)
+	}
+	c.applyMask(bestMask)
+	c.drawFormat(formatBits(level, bestMask))
+	return c, nil
+}
+
+// blockLengths returns the number of data codewords in each error correction block. The blocks that
+// come first are one codeword shorter than the others if the codewords do not divide evenly.
+func blockLengths(version int, level ErrorCorrectionLevel) []int {
+	blocks := errorCorrectionBlocks[level][version]
+	ecc := eccCodewordsPerBlock[level][version]
+	raw := rawDataModules(version) / 8
+	shortBlocks := blocks - raw%blocks
+	lengths := make([]int, blocks)
+	for i := range lengths {
+		lengths[i] = raw/blocks - ecc
+		if i >= shortBlocks {
+			lengths[i]++
+		}
+	}
+	return lengths
+}
+
+// interleave splits data into blocks, appends error correction codewords to each, and interleaves
+// the result.
+func interleave(data []byte, version int, level ErrorCorrectionLevel) []byte {
+	ecc := eccCodewordsPerBlock[level][version]
+	lengths := blockLengths(version, level)
+	dataBlocks := make([][]byte, len(lengths))
+	eccBlocks := make([][]byte, len(lengths))
+	for i, length := range lengths {
+		dataBlocks[i], data = data[:length], data[length:]
+		eccBlocks[i] = rsEncode(dataBlocks[i], ecc)
+	}
+	var result []byte
+	for i := 0; i <= lengths[len(lengths)-1]; i++ {
+		for _, block := range dataBlocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < ecc; i++ {
+		for _, block := range eccBlocks {
+			result = append(result, block[i])
+		}
+	}
+	return result
+}
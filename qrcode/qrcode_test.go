@@ -0,0 +1,193 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package qrcode
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestTables(t *testing.T) {
+	for _, tt := range []struct {
+		version  int
+		level    ErrorCorrectionLevel
+		capacity int
+	}{
+		{1, Low, 19},
+		{1, High, 9},
+		{5, Quartile, 62},
+		{10, Medium, 216},
+		{40, Low, 2956},
+		{40, High, 1276},
+	} {
+		if c := dataCodewords(tt.version, tt.level); c != tt.capacity {
+			t.Errorf("Version %d level %d has %d data codewords, but %d were expected", tt.version, tt.level, c, tt.capacity)
+		}
+	}
+	for version, positions := range map[int][]int{
+		2:  {6, 18},
+		7:  {6, 22, 38},
+		32: {6, 34, 60, 86, 112, 138},
+		40: {6, 30, 58, 86, 114, 142, 170},
+	} {
+		if !reflect.DeepEqual(alignmentPositions(version), positions) {
+			t.Errorf("Version %d has alignment positions %v, but %v were expected", version, alignmentPositions(version), positions)
+		}
+	}
+	if versionBits(7) != 0x07c94 {
+		t.Errorf("Wrong version information: %x", versionBits(7))
+	}
+	if formatBits(Medium, 0) != 0x5412 {
+		t.Errorf("Wrong format information: %x", formatBits(Medium, 0))
+	}
+}
+
+func TestReedSolomon(t *testing.T) {
+	data := []byte("WireGuard: fast, modern, secure VPN tunnel")
+	block := append(append([]byte(nil), data...), rsEncode(data, 16)...)
+	if err := rsCorrect(block, 16); err != nil {
+		t.Fatalf("Intact block was not accepted: %v", err)
+	}
+	damaged := append([]byte(nil), block...)
+	for _, i := range []int{0, 7, 20, 33, 41, 50, 55, 57} {
+		damaged[i] ^= byte(i*37 + 1)
+	}
+	if err := rsCorrect(damaged, 16); err != nil {
+		t.Fatalf("Eight errors were not corrected: %v", err)
+	}
+	if !bytes.Equal(damaged, block) {
+		t.Errorf("Wrong correction:\nactual   %x\nexpected %x", damaged, block)
+	}
+	for i := 0; i < 9; i++ {
+		damaged[i*5] ^= 0xff
+	}
+	if err := rsCorrect(damaged, 16); err == nil && bytes.Equal(damaged, block) {
+		t.Error("Nine errors were corrected")
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	for _, length := range []int{0, 1, 17, 100, 271, 500, 1200} {
+		data := make([]byte, length)
+		random.Read(data)
+		for level := Low; level <= High; level++ {
+			c, err := Encode(data, level)
+			if err != nil {
+				t.Fatalf("Unable to encode %d bytes at level %d: %v", length, level, err)
+			}
+			for _, scale := range []int{1, 3} {
+				decoded, err := Decode(c.Image(scale))
+				if err != nil {
+					t.Fatalf("Unable to decode %d bytes at level %d, version %d, scale %d: %v", length, level, c.Version, scale, err)
+				}
+				if !bytes.Equal(decoded, data) {
+					t.Fatalf("Wrong data decoded for %d bytes at level %d, scale %d", length, level, scale)
+				}
+			}
+		}
+	}
+	if _, err := Encode(make([]byte, 2954), Low); err != ErrDataTooLong {
+		t.Errorf("Data that is too long was encoded: %v", err)
+	}
+}
+
+func TestDecodeDamaged(t *testing.T) {
+	data := []byte("[Interface]\nPrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=\n")
+	c, err := Encode(data, Medium)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := c.Image(4)
+	// Paint over a few modules in the lower right corner, away from the function patterns.
+	for y := (c.Size + quietZone - 3) * 4; y < (c.Size+quietZone-1)*4; y++ {
+		for x := (c.Size + quietZone - 4) * 4; x < (c.Size+quietZone-1)*4; x++ {
+			img.SetGray(x, y, color.Gray{0})
+		}
+	}
+	decoded, err := Decode(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded, data) {
+		t.Errorf("Wrong data decoded: %q", decoded)
+	}
+
+	if _, err := Decode(image.NewGray(image.Rect(0, 0, 10, 10))); err != ErrNotFound {
+		t.Errorf("Blank image did not fail with ErrNotFound: %v", err)
+	}
+}
+
+func TestDecodeInScene(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	for _, tt := range []struct {
+		length  int
+		corners [4][2]float64 // Where the corners of the rendered code end up, clockwise from the upper left
+	}{
+		{17, [4][2]float64{{150, 100}, {450, 100}, {450, 400}, {150, 400}}},
+		{100, [4][2]float64{{300, 40}, {540, 260}, {320, 480}, {80, 260}}},
+		{100, [4][2]float64{{120, 90}, {470, 130}, {440, 420}, {160, 380}}},
+		{271, [4][2]float64{{520, 440}, {60, 470}, {40, 30}, {500, 60}}},
+	} {
+		data := make([]byte, tt.length)
+		random.Read(data)
+		c, err := Encode(data, Medium)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code := c.Image(4)
+		size := float64(code.Bounds().Dx())
+		toCode := quadrilateralToQuadrilateral(tt.corners, [4][2]float64{{0, 0}, {size, 0}, {size, size}, {0, size}})
+		// Lay the code onto a dim gradient with some dark clutter next to it, and add noise.
+		scene := image.NewGray(image.Rect(0, 0, 600, 520))
+		for y := 0; y < 520; y++ {
+			for x := 0; x < 600; x++ {
+				l := 90 + x/10 + random.Intn(24)
+				if x >= 10 && x < 40 && y >= 10 && y < 200 {
+					l = random.Intn(40)
+				}
+				if cx, cy := toCode.apply(float64(x)+0.5, float64(y)+0.5); cx >= 0 && cy >= 0 && cx < size && cy < size {
+					l = int(code.GrayAt(int(cx), int(cy)).Y)*3/4 + 40 + random.Intn(24)
+				}
+				scene.SetGray(x, y, color.Gray{uint8(l)})
+			}
+		}
+		decoded, err := Decode(scene)
+		if err != nil {
+			t.Fatalf("Unable to decode %d bytes, version %d, at %v: %v", tt.length, c.Version, tt.corners, err)
+		}
+		if !bytes.Equal(decoded, data) {
+			t.Errorf("Wrong data decoded for %d bytes at %v", tt.length, tt.corners)
+		}
+	}
+}
+
+func TestParseSegments(t *testing.T) {
+	// Numeric "01234567" and alphanumeric "AC-42", from the examples of ISO/IEC 18004.
+	var buffer bitBuffer
+	buffer.append(0x1, 4)
+	buffer.append(8, 10)
+	buffer.append(12, 10)
+	buffer.append(345, 10)
+	buffer.append(67, 7)
+	buffer.append(0x2, 4)
+	buffer.append(5, 9)
+	buffer.append(10*45+12, 11)
+	buffer.append(41*45+4, 11)
+	buffer.append(2, 6)
+	buffer.append(0, 4)
+	decoded, err := parseSegments(buffer.bytes, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decoded) != "01234567AC-42" {
+		t.Errorf("Wrong data decoded: %q", decoded)
+	}
+}
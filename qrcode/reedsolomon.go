@@ -0,0 +1,181 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package qrcode
+
+import (
+	"errors"
+)
+
+// Arithmetic in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1, with 2 as the generator, as QR codes use.
+
+var gfExp [512]byte
+var gfLog [256]int
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		gfExp[i] = byte(x)
+		gfLog[x] = i
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	for i := 255; i < len(gfExp); i++ {
+		gfExp[i] = gfExp[i-255]
+	}
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[gfLog[a]+gfLog[b]]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[gfLog[a]+255-gfLog[b]]
+}
+
+// gfPow returns 2^e.
+func gfPow(e int) byte {
+	e %= 255
+	if e < 0 {
+		e += 255
+	}
+	return gfExp[e]
+}
+
+// rsGenerator returns the coefficients, highest degree first and without the leading 1, of the
+// polynomial (x - 2^0)(x - 2^1)...(x - 2^(degree-1)).
+func rsGenerator(degree int) []byte {
+	generator := make([]byte, degree)
+	generator[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := 0; j < degree; j++ {
+			generator[j] = gfMul(generator[j], root)
+			if j+1 < degree {
+				generator[j] ^= generator[j+1]
+			}
+		}
+		root = gfMul(root, 2)
+	}
+	return generator
+}
+
+// rsEncode returns the error correction codewords for data.
+func rsEncode(data []byte, degree int) []byte {
+	generator := rsGenerator(degree)
+	remainder := make([]byte, degree)
+	for _, b := range data {
+		factor := b ^ remainder[0]
+		copy(remainder, remainder[1:])
+		remainder[degree-1] = 0
+		for i := range remainder {
+			remainder[i] ^= gfMul(generator[i], factor)
+		}
+	}
+	return remainder
+}
+
+var errTooManyErrors = errors.New("too many errors to correct")
+
+// polyEval evaluates a polynomial whose coefficients are given lowest degree first.
+func polyEval(poly []byte, x byte) byte {
+	var y byte
+	for i := len(poly) - 1; i >= 0; i-- {
+		y = gfMul(y, x) ^ poly[i]
+	}
+	return y
+}
+
+// rsCorrect corrects errors in place in block, which consists of data codewords followed by degree
+// error correction codewords, using the Berlekamp-Massey algorithm to locate them and the Forney
+// algorithm to compute their values.
+func rsCorrect(block []byte, degree int) error {
+	n := len(block)
+	syndromes := make([]byte, degree)
+	nonzero := false
+	for i := range syndromes {
+		x := gfPow(i)
+		var y byte
+		for _, b := range block {
+			y = gfMul(y, x) ^ b
+		}
+		syndromes[i] = y
+		nonzero = nonzero || y != 0
+	}
+	if !nonzero {
+		return nil
+	}
+
+	locator, previous := []byte{1}, []byte{1}
+	errorCount, shift, previousDiscrepancy := 0, 1, byte(1)
+	for i := 0; i < degree; i++ {
+		discrepancy := syndromes[i]
+		for j := 1; j <= errorCount && j < len(locator); j++ {
+			discrepancy ^= gfMul(locator[j], syndromes[i-j])
+		}
+		if discrepancy == 0 {
+			shift++
+			continue
+		}
+		factor := gfDiv(discrepancy, previousDiscrepancy)
+		updated := make([]byte, len(locator))
+		copy(updated, locator)
+		if len(previous)+shift > len(updated) {
+			updated = append(updated, make([]byte, len(previous)+shift-len(updated))...)
+		}
+		for j, c := range previous {
+			updated[j+shift] ^= gfMul(factor, c)
+		}
+		if 2*errorCount <= i {
+			previous, previousDiscrepancy = locator, discrepancy
+			errorCount = i + 1 - errorCount
+			shift = 1
+		} else {
+			shift++
+		}
+		locator = updated
+	}
+	if 2*errorCount > degree {
+		return errTooManyErrors
+	}
+
+	evaluator := make([]byte, degree)
+	for i := range evaluator {
+		for j := 0; j <= i && j < len(locator); j++ {
+			evaluator[i] ^= gfMul(locator[j], syndromes[i-j])
+		}
+	}
+	derivative := make([]byte, len(locator))
+	for i := 1; i < len(locator); i += 2 {
+		derivative[i-1] = locator[i]
+	}
+
+	found := 0
+	for i := 0; i < n; i++ {
+		exponent := n - 1 - i
+		xInverse := gfPow(-exponent)
+		if polyEval(locator, xInverse) != 0 {
+			continue
+		}
+		denominator := polyEval(derivative, xInverse)
+		if denominator == 0 {
+			return errTooManyErrors
+		}
+		block[i] ^= gfMul(gfPow(exponent), gfDiv(polyEval(evaluator, xInverse), denominator))
+		found++
+	}
+	if found != errorCount {
+		return errTooManyErrors
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package qrcode
+
+import (
+	"image"
+	"image/color"
+	"strings"
+)
+
+// quietZone is the width, in modules, of the light border that scanners require around a symbol.
+const quietZone = 4
+
+// Image renders the code, including its quiet zone, with each module moduleSize pixels square.
+func (c *Code) Image(moduleSize int) *image.Gray {
+	if moduleSize < 1 {
+		moduleSize = 1
+	}
+	width := (c.Size + quietZone*2) * moduleSize
+	img := image.NewGray(image.Rect(0, 0, width, width))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.Dark(x, y) {
+				continue
+			}
+			for dy := 0; dy < moduleSize; dy++ {
+				for dx := 0; dx < moduleSize; dx++ {
+					img.SetGray((x+quietZone)*moduleSize+dx, (y+quietZone)*moduleSize+dy, color.Gray{0})
+				}
+			}
+		}
+	}
+	return img
+}
+
+// Text renders the code, including its quiet zone, as lines of block characters, each of which
+// covers two rows of modules. Light modules are drawn and dark modules are left blank, so that it
+// scans on the usual light-on-dark terminal.
+func (c *Code) Text() string {
+	light := func(x, y int) bool {
+		x, y = x-quietZone, y-quietZone
+		return x < 0 || y < 0 || x >= c.Size || y >= c.Size || !c.Dark(x, y)
+	}
+	width := c.Size + quietZone*2
+	var b strings.Builder
+	for y := 0; y < width; y += 2 {
+		for x := 0; x < width; x++ {
+			top, bottom := light(x, y), y+1 < width && light(x, y+1)
+			switch {
+			case top && bottom:
+				b.WriteRune('█')
+			case top:
+				b.WriteRune('▀')
+			case bottom:
+				b.WriteRune('▄')
+			default:
+				b.WriteRune(' ')
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
@@ -57,18 +57,16 @@ func cleanupAddressesOnDisconnectedInterfaces(family winipcfg.AddressFamily, add
 	}
 }
 
-func configureInterface(family winipcfg.AddressFamily, conf *conf.Config, tun *tun.NativeTun) error {
-	luid := winipcfg.LUID(tun.LUID())
-
-	estimatedRouteCount := 0
-	for _, peer := range conf.Peers {
-		estimatedRouteCount += len(peer.AllowedIPs)
+// planRoutes determines which routes should be installed for the AllowedIPs of all peers, deduplicated and
+// sorted, as well as whether a default route is present for each family. If the Table key is set to off, no
+// routes are planned, and if it is set to a metric, that metric is used for each route.
+func planRoutes(conf *conf.Config) (deduplicatedRoutes []*winipcfg.RouteData, foundDefault4, foundDefault6 bool) {
+	if conf.Interface.TableOff {
+		return
 	}
-	routes := make([]winipcfg.RouteData, 0, estimatedRouteCount)
-	addresses := make([]net.IPNet, len(conf.Interface.Addresses))
+
 	var haveV4Address, haveV6Address bool
-	for i, addr := range conf.Interface.Addresses {
-		addresses[i] = addr.IPNet()
+	for _, addr := range conf.Interface.Addresses {
 		if addr.Bits() == 32 {
 			haveV4Address = true
 		} else if addr.Bits() == 128 {
@@ -76,17 +74,20 @@ func configureInterface(family winipcfg.AddressFamily, conf *conf.Config, tun *t
 		}
 	}
 
-	foundDefault4 := false
-	foundDefault6 := false
+	estimatedRouteCount := 0
 	for _, peer := range conf.Peers {
-		for _, allowedip := range peer.AllowedIPs {
+		estimatedRouteCount += len(peer.AllowedIPs)
+	}
+	routes := make([]winipcfg.RouteData, 0, estimatedRouteCount)
+	for _, peer := range conf.Peers {
+		for _, allowedip := range peer.EffectiveAllowedIPs() {
 			allowedip.MaskSelf()
 			if (allowedip.Bits() == 32 && !haveV4Address) || (allowedip.Bits() == 128 && !haveV6Address) {
 				continue
 			}
 			route := winipcfg.RouteData{
 				Destination: allowedip.IPNet(),
-				Metric:      0,
+				Metric:      conf.Interface.TableMetric,
 			}
 			if allowedip.Bits() == 32 {
 				if allowedip.Cidr == 0 {
@@ -103,16 +104,7 @@ func configureInterface(family winipcfg.AddressFamily, conf *conf.Config, tun *t
 		}
 	}
 
-	err := luid.SetIPAddressesForFamily(family, addresses)
-	if err == windows.ERROR_OBJECT_ALREADY_EXISTS {
-		cleanupAddressesOnDisconnectedInterfaces(family, addresses)
-		err = luid.SetIPAddressesForFamily(family, addresses)
-	}
-	if err != nil {
-		return err
-	}
-
-	deduplicatedRoutes := make([]*winipcfg.RouteData, 0, len(routes))
+	deduplicatedRoutes = make([]*winipcfg.RouteData, 0, len(routes))
 	sort.Slice(routes, func(i, j int) bool {
 		if routes[i].Metric != routes[j].Metric {
 			return routes[i].Metric < routes[j].Metric
@@ -137,19 +129,41 @@ func configureInterface(family winipcfg.AddressFamily, conf *conf.Config, tun *t
 		}
 		deduplicatedRoutes = append(deduplicatedRoutes, &routes[i])
 	}
+	return
+}
+
+func configureInterface(family winipcfg.AddressFamily, conf *conf.Config, tun *tun.NativeTun, mtus *familyMTUs) error {
+	luid := winipcfg.LUID(tun.LUID())
+
+	addresses := make([]net.IPNet, len(conf.Interface.Addresses))
+	for i, addr := range conf.Interface.Addresses {
+		addresses[i] = addr.IPNet()
+	}
 
-	err = luid.SetRoutesForFamily(family, deduplicatedRoutes)
+	err := luid.SetIPAddressesForFamily(family, addresses)
+	if err == windows.ERROR_OBJECT_ALREADY_EXISTS {
+		cleanupAddressesOnDisconnectedInterfaces(family, addresses)
+		err = luid.SetIPAddressesForFamily(family, addresses)
+	}
 	if err != nil {
 		return err
 	}
 
+	routes, foundDefault4, foundDefault6 := planRoutes(conf)
+	if !conf.Interface.TableOff {
+		err = luid.SetRoutesForFamily(family, routes)
+		if err != nil {
+			return err
+		}
+	}
+
 	ipif, err := luid.IPInterface(family)
 	if err != nil {
 		return err
 	}
-	if conf.Interface.MTU > 0 {
-		ipif.NLMTU = uint32(conf.Interface.MTU)
-		tun.ForceMTU(int(ipif.NLMTU))
+	mtu := planFamilyMTU(family, conf.Interface.EffectiveMTU(family == windows.AF_INET6), nil)
+	if mtu > 0 {
+		ipif.NLMTU = mtu
 	}
 	if family == windows.AF_INET {
 		if foundDefault4 {
@@ -168,26 +182,17 @@ func configureInterface(family winipcfg.AddressFamily, conf *conf.Config, tun *t
 	if err != nil {
 		return err
 	}
+	if mtu > 0 {
+		mtus.set(family, mtu)
+	}
 
-	return luid.SetDNS(family, conf.Interface.DNS, conf.Interface.DNSSearch)
+	return applyInterfaceDNS(systemDNSBackend{luid}, family, conf)
 }
 
 func enableFirewall(conf *conf.Config, tun *tun.NativeTun) error {
-	doNotRestrict := true
-	if len(conf.Peers) == 1 {
-	nextallowedip:
-		for _, allowedip := range conf.Peers[0].AllowedIPs {
-			if allowedip.Cidr == 0 {
-				for _, b := range allowedip.IP {
-					if b != 0 {
-						continue nextallowedip
-					}
-				}
-				doNotRestrict = false
-				break
-			}
-		}
-	}
 	log.Println("Enabling firewall rules")
-	return firewall.EnableFirewall(tun.LUID(), doNotRestrict, conf.Interface.DNS)
+	if usesSplitDNS(conf) {
+		return firewall.EnableFirewall(tun.LUID(), !blocksUntunneledTraffic(conf), nil, true)
+	}
+	return firewall.EnableFirewall(tun.LUID(), !blocksUntunneledTraffic(conf), dnsServers(conf), false)
 }
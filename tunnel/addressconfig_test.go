@@ -0,0 +1,66 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package tunnel
+
+import (
+	"net"
+	"testing"
+
+	"golang.zx2c4.com/wireguard/windows/conf"
+)
+
+const routePlanInput = `[Interface]
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+Address = 10.192.122.1/24
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 0.0.0.0/0, 10.192.124.7/24, ::/0
+
+[Peer]
+PublicKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+AllowedIPs = 10.192.124.0/24
+`
+
+func TestPlanRoutes(t *testing.T) {
+	config, err := conf.FromWgQuick(routePlanInput, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routes, foundDefault4, foundDefault6 := planRoutes(config)
+	if !foundDefault4 || foundDefault6 {
+		t.Errorf("Wrong default route detection: v4=%v v6=%v", foundDefault4, foundDefault6)
+	}
+	if len(routes) != 2 {
+		t.Fatalf("Expected 2 deduplicated v4 routes, but got %d", len(routes))
+	}
+	if routes[0].Destination.String() != "0.0.0.0/0" || routes[1].Destination.String() != "10.192.124.0/24" {
+		t.Errorf("Unexpected routes: %s, %s", routes[0].Destination.String(), routes[1].Destination.String())
+	}
+	for _, route := range routes {
+		if route.Metric != 0 || !route.NextHop.Equal(net.IPv4zero) {
+			t.Errorf("Unexpected metric %d or next hop %s for automatic table", route.Metric, route.NextHop)
+		}
+	}
+
+	config.Interface.TableMetric = 42
+	routes, _, _ = planRoutes(config)
+	if len(routes) != 2 {
+		t.Fatalf("Expected 2 routes with explicit metric, but got %d", len(routes))
+	}
+	for _, route := range routes {
+		if route.Metric != 42 {
+			t.Errorf("Expected metric 42, but got %d", route.Metric)
+		}
+	}
+
+	config.Interface.TableOff = true
+	routes, foundDefault4, foundDefault6 = planRoutes(config)
+	if len(routes) != 0 || foundDefault4 || foundDefault6 {
+		t.Errorf("Expected no routes when table is off, but got %d (v4=%v v6=%v)", len(routes), foundDefault4, foundDefault6)
+	}
+}
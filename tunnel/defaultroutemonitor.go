@@ -61,49 +61,42 @@ func bindSocketRoute(family winipcfg.AddressFamily, binder conn.BindSocketToInte
 	return nil
 }
 
-func monitorDefaultRoutes(family winipcfg.AddressFamily, binder conn.BindSocketToInterface, autoMTU bool, blackholeWhenLoop bool, tun *tun.NativeTun) ([]winipcfg.ChangeCallback, error) {
-	var minMTU uint32
-	if family == windows.AF_INET {
-		minMTU = 576
-	} else if family == windows.AF_INET6 {
-		minMTU = 1280
-	}
+func monitorDefaultRoutes(family winipcfg.AddressFamily, binder conn.BindSocketToInterface, autoMTU bool, blackholeWhenLoop bool, tun *tun.NativeTun, mtus *familyMTUs, networkChanged func()) ([]winipcfg.ChangeCallback, error) {
 	ourLUID := winipcfg.LUID(tun.LUID())
 	lastLUID := winipcfg.LUID(0)
 	lastIndex := ^uint32(0)
 	lastMTU := uint32(0)
 	doIt := func() error {
+		previousLUID, previousIndex := lastLUID, lastIndex
 		err := bindSocketRoute(family, binder, ourLUID, &lastLUID, &lastIndex, blackholeWhenLoop)
 		if err != nil {
 			return err
 		}
+		if previousIndex != ^uint32(0) && (lastLUID != previousLUID || lastIndex != previousIndex) && networkChanged != nil {
+			networkChanged()
+		}
 		if !autoMTU {
 			return nil
 		}
-		mtu := uint32(0)
+		var underlying *winipcfg.MibIfRow2
 		if lastLUID != 0 {
-			iface, err := lastLUID.Interface()
+			underlying, err = lastLUID.Interface()
 			if err != nil {
 				return err
 			}
-			if iface.MTU > 0 {
-				mtu = iface.MTU
-			}
 		}
+		mtu := planFamilyMTU(family, 0, underlying)
 		if mtu > 0 && lastMTU != mtu {
 			iface, err := ourLUID.IPInterface(family)
 			if err != nil {
 				return err
 			}
-			iface.NLMTU = mtu - 80
-			if iface.NLMTU < minMTU {
-				iface.NLMTU = minMTU
-			}
+			iface.NLMTU = mtu
 			err = iface.Set()
 			if err != nil {
 				return err
 			}
-			tun.ForceMTU(int(iface.NLMTU)) // TODO: having one MTU for both v4 and v6 kind of breaks the windows model, so right now this just gets the second one which is... bad.
+			mtus.set(family, mtu)
 			lastMTU = mtu
 		}
 		return nil
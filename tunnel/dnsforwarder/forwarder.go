@@ -0,0 +1,161 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+// Package dnsforwarder implements a local DNS server, which forwards the queries of the system resolver
+// to DNS over HTTPS or DNS over TLS servers.
+package dnsforwarder
+
+import (
+	"context"
+	"encoding/binary"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+const queryTimeout = time.Second * 5
+
+type Forwarder struct {
+	upstream Upstream
+	udp      net.PacketConn
+	tcp      net.Listener
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// Listen starts a forwarder on the UDP and TCP ports of addr, which are the same, so that addr may
+// select the port 0 and still be usable as the address of a DNS server.
+func Listen(addr string, upstream Upstream) (*Forwarder, error) {
+	udp, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+	if err != nil {
+		udp.Close()
+		return nil, err
+	}
+	f := &Forwarder{upstream: upstream, udp: udp, tcp: tcp}
+	f.ctx, f.cancel = context.WithCancel(context.Background())
+	f.wg.Add(2)
+	go f.serveUDP()
+	go f.serveTCP()
+	return f, nil
+}
+
+// Addr returns the address that the forwarder listens on.
+func (f *Forwarder) Addr() *net.UDPAddr {
+	return f.udp.LocalAddr().(*net.UDPAddr)
+}
+
+// Close stops the forwarder, and waits for the queries that are being answered to be abandoned.
+func (f *Forwarder) Close() error {
+	f.cancel()
+	err := f.udp.Close()
+	f.tcp.Close()
+	f.wg.Wait()
+	return err
+}
+
+// exchange answers a query through the upstream, or with a server failure if it cannot.
+func (f *Forwarder) exchange(query []byte) []byte {
+	ctx, cancel := context.WithTimeout(f.ctx, queryTimeout)
+	defer cancel()
+	response, err := f.upstream.Exchange(ctx, query)
+	if err != nil {
+		if f.ctx.Err() == nil {
+			log.Printf("Unable to forward DNS query: %v", err)
+		}
+		return serverFailure(query)
+	}
+	return response
+}
+
+func (f *Forwarder) serveUDP() {
+	defer f.wg.Done()
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, addr, err := f.udp.ReadFrom(buf)
+		if err != nil {
+			if f.ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+		query := append([]byte(nil), buf[:n]...)
+		f.wg.Add(1)
+		go func() {
+			defer f.wg.Done()
+			if response := f.exchange(query); response != nil {
+				f.udp.WriteTo(response, addr)
+			}
+		}()
+	}
+}
+
+func (f *Forwarder) serveTCP() {
+	defer f.wg.Done()
+	for {
+		conn, err := f.tcp.Accept()
+		if err != nil {
+			if f.ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+		f.wg.Add(1)
+		go func() {
+			defer f.wg.Done()
+			defer conn.Close()
+			for {
+				conn.SetDeadline(time.Now().Add(queryTimeout * 2))
+				query, err := readTCPMessage(conn)
+				if err != nil {
+					return
+				}
+				response := f.exchange(query)
+				if response == nil || writeTCPMessage(conn, response) != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+// serverFailure makes a response to query with the SERVFAIL code, which repeats its question, or nil
+// if query is too malformed to answer.
+func serverFailure(query []byte) []byte {
+	const headerLength = 12
+	if len(query) < headerLength {
+		return nil
+	}
+	end := headerLength
+	qdcount := binary.BigEndian.Uint16(query[4:])
+	if qdcount == 1 {
+		for end < len(query) && query[end] != 0 {
+			if query[end]&0xc0 != 0 {
+				return nil
+			}
+			end += 1 + int(query[end])
+		}
+		end += 1 + 4 // The root label, type, and class
+		if end > len(query) {
+			return nil
+		}
+	} else {
+		qdcount = 0
+	}
+	response := append([]byte(nil), query[:end]...)
+	response[2] = 0x80 | query[2]&0x79 // QR, and the opcode and RD of the query
+	response[3] = 2                    // SERVFAIL
+	binary.BigEndian.PutUint16(response[4:], qdcount)
+	binary.BigEndian.PutUint16(response[6:], 0)
+	binary.BigEndian.PutUint16(response[8:], 0)
+	binary.BigEndian.PutUint16(response[10:], 0)
+	return response
+}
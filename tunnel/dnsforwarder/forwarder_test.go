@@ -0,0 +1,160 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package dnsforwarder
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testQuery is a query for the A records of example.com, with the ID 0x1234 and recursion desired.
+var testQuery = []byte{
+	0x12, 0x34, 0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0,
+	0x00, 0x01, 0x00, 0x01,
+}
+
+// answer stands in for a DNS server, by turning the query into a response without records.
+func answer(query []byte) []byte {
+	response := append([]byte(nil), query...)
+	response[2] |= 0x80
+	return response
+}
+
+func newTLSStandIn(t *testing.T, handler http.HandlerFunc) (*httptest.Server, *tls.Config) {
+	server := httptest.NewTLSServer(handler)
+	t.Cleanup(server.Close)
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	return server, &tls.Config{RootCAs: roots}
+}
+
+func exchangeUDP(t *testing.T, f *Forwarder, query []byte) []byte {
+	conn, err := net.DialUDP("udp", nil, f.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(queryTimeout * 2))
+	_, err = conn.Write(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, maxMessageSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf[:n]
+}
+
+func TestDoH(t *testing.T) {
+	server, tlsConfig := newTLSStandIn(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/dns-query" || r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		query, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(answer(query))
+	})
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	upstream, err := NewDoHUpstream("https://example.com:"+port+"/dns-query{?dns}", []net.IP{net.IPv4(127, 0, 0, 1)}, tlsConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := Listen("127.0.0.1:0", upstream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if response := exchangeUDP(t, f, testQuery); !bytes.Equal(response, answer(testQuery)) {
+		t.Errorf("Unexpected response over UDP: %x", response)
+	}
+
+	conn, err := net.Dial("tcp", f.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for i := 0; i < 2; i++ {
+		err = writeTCPMessage(conn, testQuery)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, err := readTCPMessage(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(response, answer(testQuery)) {
+			t.Errorf("Unexpected response over TCP: %x", response)
+		}
+	}
+}
+
+func TestDoT(t *testing.T) {
+	server, tlsConfig := newTLSStandIn(t, nil)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", server.TLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			query, err := readTCPMessage(conn)
+			if err == nil {
+				writeTCPMessage(conn, answer(query))
+			}
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+
+	f, err := Listen("127.0.0.1:0", NewDoTUpstream("example.com", []net.IP{net.IPv4(127, 0, 0, 1)}, uint16(portNumber), tlsConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if response := exchangeUDP(t, f, testQuery); !bytes.Equal(response, answer(testQuery)) {
+		t.Errorf("Unexpected response: %x", response)
+	}
+
+	wrongName, err := Listen("127.0.0.1:0", NewDoTUpstream("wrong.example", []net.IP{net.IPv4(127, 0, 0, 1)}, uint16(portNumber), tlsConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wrongName.Close()
+	if response := exchangeUDP(t, wrongName, testQuery); !bytes.Equal(response, serverFailure(testQuery)) {
+		t.Errorf("Expected a server failure for a certificate of another name, but got %x", response)
+	}
+}
+
+func TestServerFailure(t *testing.T) {
+	response := serverFailure(testQuery)
+	if len(response) != len(testQuery) || response[0] != 0x12 || response[1] != 0x34 || response[2] != 0x81 || response[3] != 0x02 {
+		t.Errorf("Unexpected server failure: %x", response)
+	}
+	if !bytes.Equal(response[12:], testQuery[12:]) {
+		t.Error("The question was not repeated")
+	}
+	if serverFailure(testQuery[:5]) != nil || serverFailure(testQuery[:20]) != nil {
+		t.Error("Truncated queries were answered")
+	}
+}
@@ -0,0 +1,174 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package dnsforwarder
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Upstream answers DNS queries, which are in wire format, on behalf of the forwarder.
+type Upstream interface {
+	Exchange(ctx context.Context, query []byte) (response []byte, err error)
+}
+
+const maxMessageSize = 65535
+
+// dialServers connects to the first of the servers that accepts a connection on port. The servers are
+// addresses rather than names, because the forwarder is what names would be resolved with.
+func dialServers(ctx context.Context, servers []net.IP, port string) (net.Conn, error) {
+	var dialer net.Dialer
+	var firstErr error
+	for _, server := range servers {
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(server.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr == nil {
+		firstErr = errors.New("No DNS servers to connect to")
+	}
+	return nil, firstErr
+}
+
+type dohUpstream struct {
+	url    string
+	client *http.Client
+}
+
+// NewDoHUpstream returns an Upstream that sends queries over HTTPS, as in RFC 8484, to the URL
+// template, connecting to the servers rather than to the addresses of its host name. The TLS
+// configuration is that of the default HTTP client if nil.
+func NewDoHUpstream(template string, servers []net.IP, tlsConfig *tls.Config) (Upstream, error) {
+	u, err := url.Parse(strings.TrimSuffix(template, "{?dns}"))
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "https" || len(u.Hostname()) == 0 {
+		return nil, fmt.Errorf("Invalid DNS over HTTPS URL template: %q", template)
+	}
+	port := u.Port()
+	if len(port) == 0 {
+		port = "443"
+	}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialServers(ctx, servers, port)
+		},
+		TLSClientConfig:     tlsConfig,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConnsPerHost: 2,
+		IdleConnTimeout:     time.Minute,
+	}
+	return &dohUpstream{u.String(), &http.Client{Transport: transport}}, nil
+}
+
+func (upstream *dohUpstream) Exchange(ctx context.Context, query []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, upstream.url, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := upstream.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DNS over HTTPS server returned %s", resp.Status)
+	}
+	response, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxMessageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(response) > maxMessageSize {
+		return nil, errors.New("DNS over HTTPS response is too large")
+	}
+	return response, nil
+}
+
+type dotUpstream struct {
+	servers   []net.IP
+	port      string
+	tlsConfig *tls.Config
+}
+
+// NewDoTUpstream returns an Upstream that sends queries over TLS, as in RFC 7858, to the servers,
+// verifying that their certificates are for name. The TLS configuration, if not nil, is used as a
+// template.
+func NewDoTUpstream(name string, servers []net.IP, port uint16, tlsConfig *tls.Config) Upstream {
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	} else {
+		tlsConfig = tlsConfig.Clone()
+	}
+	tlsConfig.ServerName = name
+	if port == 0 {
+		port = 853
+	}
+	return &dotUpstream{servers, strconv.Itoa(int(port)), tlsConfig}
+}
+
+// Exchange makes a connection for each query, which is simple and fine for the rate at which a single
+// machine resolves names, given that the system resolver caches answers.
+func (upstream *dotUpstream) Exchange(ctx context.Context, query []byte) ([]byte, error) {
+	if len(query) > maxMessageSize {
+		return nil, errors.New("DNS query is too large")
+	}
+	rawConn, err := dialServers(ctx, upstream.servers, upstream.port)
+	if err != nil {
+		return nil, err
+	}
+	conn := tls.Client(rawConn, upstream.tlsConfig)
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	err = writeTCPMessage(conn, query)
+	if err != nil {
+		return nil, err
+	}
+	return readTCPMessage(conn)
+}
+
+// writeTCPMessage writes a message prefixed by its length, as DNS over TCP and TLS frame them.
+func writeTCPMessage(w io.Writer, message []byte) error {
+	framed := make([]byte, 2+len(message))
+	binary.BigEndian.PutUint16(framed, uint16(len(message)))
+	copy(framed[2:], message)
+	_, err := w.Write(framed)
+	return err
+}
+
+func readTCPMessage(r io.Reader) ([]byte, error) {
+	var length [2]byte
+	_, err := io.ReadFull(r, length[:])
+	if err != nil {
+		return nil, err
+	}
+	message := make([]byte, binary.BigEndian.Uint16(length[:]))
+	_, err = io.ReadFull(r, message)
+	if err != nil {
+		return nil, err
+	}
+	return message, nil
+}
@@ -0,0 +1,56 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package tunnel
+
+import (
+	"hash/fnv"
+	"net"
+
+	"golang.zx2c4.com/wireguard/windows/conf"
+	"golang.zx2c4.com/wireguard/windows/tunnel/dnsforwarder"
+)
+
+// usesEncryptedDNS reports whether the DNS servers of a configuration are queried over HTTPS or TLS, in
+// which case the system resolver is pointed at a forwarder that does so.
+func usesEncryptedDNS(conf *conf.Config) bool {
+	return len(conf.Interface.DNS) > 0 && (len(conf.Interface.DoHTemplate) > 0 || len(conf.Interface.DoTName) > 0)
+}
+
+// dnsForwarderAddress returns the loopback address that the DNS forwarder of a tunnel listens on, which
+// differs between tunnels, so that several may run at once.
+func dnsForwarderAddress(tunnelName string) net.IP {
+	h := fnv.New32a()
+	h.Write([]byte(tunnelName))
+	sum := h.Sum32()
+	return net.IPv4(127, 53, byte(sum>>8), byte(sum)|1)
+}
+
+// dnsServers returns the servers that the system resolver should send the queries of a tunnel to.
+func dnsServers(conf *conf.Config) []net.IP {
+	if usesEncryptedDNS(conf) {
+		return []net.IP{dnsForwarderAddress(conf.Name)}
+	}
+	return conf.Interface.DNS
+}
+
+// startDNSForwarder starts the forwarder that queries the DNS servers of a tunnel over HTTPS or TLS, or
+// returns nil if it does not need one.
+func startDNSForwarder(conf *conf.Config) (*dnsforwarder.Forwarder, error) {
+	if !usesEncryptedDNS(conf) {
+		return nil, nil
+	}
+	var upstream dnsforwarder.Upstream
+	if len(conf.Interface.DoHTemplate) > 0 {
+		var err error
+		upstream, err = dnsforwarder.NewDoHUpstream(conf.Interface.DoHTemplate, conf.Interface.DNS, nil)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		upstream = dnsforwarder.NewDoTUpstream(conf.Interface.DoTName, conf.Interface.DNS, 0, nil)
+	}
+	return dnsforwarder.Listen(net.JoinHostPort(dnsForwarderAddress(conf.Name).String(), "53"), upstream)
+}
@@ -0,0 +1,215 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package tunnel
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.zx2c4.com/wireguard/windows/conf"
+)
+
+// How long a backup endpoint is used before the primary endpoint is tried again.
+const endpointFailbackInterval = time.Minute * 10
+
+type failoverPeer struct {
+	publicKey  conf.Key
+	candidates []conf.Endpoint // The endpoint of the peer followed by its backup endpoints
+	current    int             // The index of the candidate that is set on the device
+	address    conf.Endpoint   // The resolved address of the current candidate, or empty if not yet set
+	switched   time.Time       // When the current candidate was set, or the first check if none was
+	located    bool            // Whether the candidate that the device started with was looked for
+	probing    bool            // Whether the primary is being tried again, while previous works
+	previous   int
+	traffic    peerTraffic
+}
+
+// endpointFailover moves the peers that have backup endpoints to the next of them when handshakes
+// stop completing while traffic to them goes unanswered, and tries their primary endpoints again every
+// endpointFailbackInterval, returning to them when they complete a handshake.
+type endpointFailover struct {
+	device  endpointDevice
+	resolve func(host string) (string, error)
+	now     func() time.Time
+
+	peers []*failoverPeer
+
+	stop    chan bool
+	stopped sync.WaitGroup
+}
+
+func newEndpointFailover(device endpointDevice, config *conf.Config, resolve func(host string) (string, error)) *endpointFailover {
+	f := &endpointFailover{
+		device:  device,
+		resolve: resolve,
+		now:     time.Now,
+	}
+	for i := range config.Peers {
+		peer := &config.Peers[i]
+		if len(peer.BackupEndpoints) == 0 {
+			continue
+		}
+		f.peers = append(f.peers, &failoverPeer{
+			publicKey:  peer.PublicKey,
+			candidates: peer.Endpoints(),
+		})
+	}
+	return f
+}
+
+// Start checks the peers in the background every interval, until Stop is called. It does nothing if
+// no peer has backup endpoints.
+func (f *endpointFailover) Start(interval time.Duration) {
+	if len(f.peers) == 0 {
+		return
+	}
+	f.stop = make(chan bool)
+	f.stopped.Add(1)
+	go func() {
+		defer f.stopped.Done()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				f.update()
+			case <-f.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (f *endpointFailover) Stop() {
+	if f.stop == nil {
+		return
+	}
+	close(f.stop)
+	f.stopped.Wait()
+	f.stop = nil
+}
+
+// update moves each peer to another candidate if its handshakes have stopped completing, or if it is
+// time to try its primary endpoint again, and sets the endpoints that changed.
+func (f *endpointFailover) update() {
+	uapi, err := f.device.IpcGet()
+	if err != nil {
+		log.Printf("Unable to get device configuration for endpoint failover: %v", err)
+		return
+	}
+	current, err := conf.FromUAPI(strings.NewReader(uapi+"\n"), &conf.Config{})
+	if err != nil {
+		log.Printf("Unable to get device configuration for endpoint failover: %v", err)
+		return
+	}
+	now := f.now()
+	var changes strings.Builder
+	for _, p := range f.peers {
+		var currentPeer *conf.Peer
+		for j := range current.Peers {
+			if current.Peers[j].PublicKey == p.publicKey {
+				currentPeer = &current.Peers[j]
+				break
+			}
+		}
+		if currentPeer == nil {
+			continue
+		}
+		if p.switched.IsZero() {
+			p.switched = now
+		}
+		if !p.located && p.address.IsEmpty() {
+			// Start from the candidate that the device uses, which is not the first after a reload
+			// that left the endpoints alone. The device has it resolved, so hostnames are resolved
+			// to compare with it.
+			p.located = true
+			for i := range p.candidates {
+				if address, ok := f.resolveCandidate(p.candidates[i]); ok && address == currentPeer.Endpoint {
+					p.current = i
+					p.address = address
+					break
+				}
+			}
+		}
+		handshake := time.Unix(0, 0).Add(time.Duration(currentPeer.LastHandshakeTime))
+		// A handshake only counts for the current candidate if it completed after that was set, and
+		// the device has not since roamed to another address that the peer sent from.
+		responded := handshake.After(p.switched) && (p.address.IsEmpty() || currentPeer.Endpoint == p.address)
+		latest := p.switched
+		if responded {
+			latest = handshake
+		}
+		stale := p.traffic.unanswered(currentPeer) && now.Sub(latest) > endpointStaleHandshake
+
+		if p.probing {
+			if responded {
+				log.Printf("Endpoint %s responds again, so it is used instead of %s", p.candidates[0].String(), p.candidates[p.previous].String())
+				p.probing = false
+			} else if stale {
+				log.Printf("Endpoint %s still does not respond, so %s is used again", p.candidates[0].String(), p.candidates[p.previous].String())
+				p.probing = false
+				f.switchTo(p, p.previous, &changes)
+			}
+			continue
+		}
+		if stale {
+			for i := 1; i < len(p.candidates); i++ {
+				next := (p.current + i) % len(p.candidates)
+				log.Printf("Handshakes with endpoint %s stopped completing, so trying %s", p.candidates[p.current].String(), p.candidates[next].String())
+				if f.switchTo(p, next, &changes) {
+					break
+				}
+			}
+		} else if p.current != 0 && now.Sub(p.switched) >= endpointFailbackInterval {
+			log.Printf("Trying endpoint %s again", p.candidates[0].String())
+			previous := p.current
+			if f.switchTo(p, 0, &changes) {
+				p.probing = true
+				p.previous = previous
+			}
+		}
+	}
+	if changes.Len() == 0 {
+		return
+	}
+	err = f.device.IpcSet(changes.String())
+	if err != nil {
+		log.Printf("Unable to set failover endpoints: %v", err)
+	}
+}
+
+// switchTo resolves the candidate at index and writes the change to set it as the endpoint of the peer
+// to changes, or returns false if it cannot be resolved.
+func (f *endpointFailover) switchTo(p *failoverPeer, index int, changes *strings.Builder) bool {
+	address, ok := f.resolveCandidate(p.candidates[index])
+	if !ok {
+		return false
+	}
+	p.current = index
+	p.address = address
+	p.switched = f.now()
+	changes.WriteString(fmt.Sprintf("public_key=%s\nupdate_only=true\nendpoint=%s\n", p.publicKey.HexString(), p.address.String()))
+	return true
+}
+
+// resolveCandidate returns the address of a candidate, resolving it if it is a hostname, or returns
+// false if it cannot be resolved.
+func (f *endpointFailover) resolveCandidate(candidate conf.Endpoint) (conf.Endpoint, bool) {
+	host := candidate.Host
+	if net.ParseIP(host) == nil {
+		var err error
+		host, err = f.resolve(host)
+		if err != nil {
+			log.Printf("Unable to resolve %s: %v", candidate.Host, err)
+			return conf.Endpoint{}, false
+		}
+	}
+	return conf.Endpoint{Host: host, Port: candidate.Port}, true
+}
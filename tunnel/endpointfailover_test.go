@@ -0,0 +1,126 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package tunnel
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.zx2c4.com/wireguard/windows/conf"
+)
+
+const endpointFailoverInput = `[Interface]
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+Endpoint = 192.0.2.1:51820, backup.example.com:51820, 192.0.2.3:51820
+PersistentKeepalive = 25
+AllowedIPs = 10.0.0.0/24
+
+[Peer]
+PublicKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+Endpoint = 192.0.2.1:51820
+AllowedIPs = 10.0.1.0/24
+`
+
+func TestEndpointFailover(t *testing.T) {
+	config, err := conf.FromWgQuick(endpointFailoverInput, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1600000000, 0)
+	device := &fakeEndpointDevice{config: config, endpoint: "192.0.2.1:51820", handshake: now}
+	var resolveErr error
+	failover := newEndpointFailover(device, config, func(host string) (string, error) {
+		if host != "backup.example.com" {
+			t.Errorf("Unexpected lookup of %s", host)
+		}
+		return "198.51.100.2", resolveErr
+	})
+	failover.now = func() time.Time { return now }
+	if len(failover.peers) != 1 {
+		t.Fatalf("Expected only the peer with backup endpoints, but got %d", len(failover.peers))
+	}
+
+	// step advances the clock, with the latest handshake completing handshakeAgo before, and checks
+	// that update sets the expected endpoint, or none if it is empty. Unless the peer is idle, packets
+	// are sent to it, which are only answered if the handshake is recent.
+	idle := false
+	step := func(name string, advance, handshakeAgo time.Duration, expected string) {
+		t.Helper()
+		now = now.Add(advance)
+		device.handshake = now.Add(-handshakeAgo)
+		if !idle {
+			device.txBytes += 148
+			if handshakeAgo < endpointStaleHandshake {
+				device.rxBytes += 92
+			}
+		}
+		sets := len(device.sets)
+		failover.update()
+		if len(expected) == 0 {
+			if len(device.sets) != sets {
+				t.Errorf("%s: unexpected endpoint update %q", name, device.sets[sets:])
+			}
+			return
+		}
+		set := "public_key=" + config.Peers[0].PublicKey.HexString() + "\nupdate_only=true\nendpoint=" + expected + "\n"
+		if len(device.sets) != sets+1 || device.sets[sets] != set {
+			t.Errorf("%s: wrong endpoint update:\nactual   %q\nexpected %q", name, device.sets[sets:], set)
+			return
+		}
+		device.endpoint = expected
+	}
+
+	step("healthy primary", endpointCheckInterval, time.Second*10, "")
+	step("stale primary", endpointStaleHandshake+time.Second, endpointStaleHandshake+time.Second*2, "198.51.100.2:51820")
+	step("new backup", endpointCheckInterval, endpointCheckInterval, "")
+	step("healthy backup", endpointCheckInterval, time.Second*10, "")
+	step("failback probe", endpointFailbackInterval, time.Second*10, "192.0.2.1:51820")
+	step("silent primary", endpointStaleHandshake+time.Second, endpointStaleHandshake+time.Second*2, "198.51.100.2:51820")
+	step("healthy backup", endpointCheckInterval, time.Second*10, "")
+	step("failback probe", endpointFailbackInterval, time.Second*10, "192.0.2.1:51820")
+	step("recovered primary", endpointCheckInterval, time.Second*10, "")
+	if failover.peers[0].current != 0 || failover.peers[0].probing {
+		t.Errorf("Did not fail back to the primary: %+v", failover.peers[0])
+	}
+	step("recovered primary stays", endpointFailbackInterval, time.Second*10, "")
+	idle = true
+	step("idle primary", endpointStaleHandshake*2, endpointStaleHandshake*3, "")
+	idle = false
+
+	resolveErr = errors.New("no such host")
+	step("unresolvable backup", endpointStaleHandshake+time.Second, endpointStaleHandshake+time.Second*2, "192.0.2.3:51820")
+	step("stale last backup", endpointStaleHandshake+time.Second, endpointStaleHandshake+time.Second*2, "192.0.2.1:51820")
+}
+
+func TestEndpointFailoverStartsFromResolvedCandidate(t *testing.T) {
+	config, err := conf.FromWgQuick(endpointFailoverInput, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1600000000, 0)
+	device := &fakeEndpointDevice{config: config, endpoint: "198.51.100.2:51820", handshake: now}
+	failover := newEndpointFailover(device, config, func(host string) (string, error) {
+		return "198.51.100.2", nil
+	})
+	failover.now = func() time.Time { return now }
+
+	failover.update()
+	if failover.peers[0].current != 1 || len(device.sets) != 0 {
+		t.Errorf("Did not start from the backup that the device uses: %+v %q", failover.peers[0], device.sets)
+	}
+
+	now = now.Add(endpointStaleHandshake + time.Second)
+	device.txBytes += 148
+	failover.update()
+	expected := "public_key=" + config.Peers[0].PublicKey.HexString() + "\nupdate_only=true\nendpoint=192.0.2.3:51820\n"
+	if len(device.sets) != 1 || device.sets[0] != expected {
+		t.Errorf("Wrong endpoint update:\nactual   %q\nexpected %q", device.sets, expected)
+	}
+}
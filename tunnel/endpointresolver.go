@@ -0,0 +1,204 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package tunnel
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.zx2c4.com/wireguard/windows/conf"
+)
+
+const (
+	endpointResolveInterval = time.Minute * 5
+	endpointCheckInterval   = time.Second * 30
+	// This is the same as the wg-quick reresolve-dns.sh script, which is a little less than
+	// RejectAfterTime, so that it triggers before sessions expire.
+	endpointStaleHandshake = time.Second * 135
+)
+
+type endpointDevice interface {
+	IpcGet() (string, error)
+	IpcSet(uapiConf string) error
+}
+
+// endpointResolver periodically resolves the hostname endpoints of a configuration again, and updates
+// the endpoints of peers on the device if their addresses have changed.
+type endpointResolver struct {
+	device  endpointDevice
+	config  *conf.Config
+	resolve func(host string) (string, error)
+	now     func() time.Time
+
+	peers map[conf.Key]*resolvedPeer
+
+	stop    chan bool
+	stopped sync.WaitGroup
+}
+
+// peerTraffic is how much a peer had sent and received as of the previous check.
+type peerTraffic struct {
+	rxBytes conf.Bytes
+	txBytes conf.Bytes
+}
+
+// unanswered reports whether packets were sent to the peer since the previous check without any being
+// received, and remembers the counters of the peer for the next check. A peer that is merely idle, or
+// that never completed a handshake because nothing was sent to it, is not unanswered.
+func (t *peerTraffic) unanswered(peer *conf.Peer) bool {
+	unanswered := peer.TxBytes > t.txBytes && peer.RxBytes == t.rxBytes
+	t.rxBytes, t.txBytes = peer.RxBytes, peer.TxBytes
+	return unanswered
+}
+
+// resolvedPeer is what the resolver remembers about a peer between checks.
+type resolvedPeer struct {
+	lastResolved time.Time
+	traffic      peerTraffic
+	// staleBackoff is how long to wait after resolving because of a stale handshake before doing so
+	// again, which doubles each time, or zero if the handshake is not stale.
+	staleBackoff time.Duration
+}
+
+func newEndpointResolver(device endpointDevice, config *conf.Config, resolve func(host string) (string, error)) *endpointResolver {
+	r := &endpointResolver{
+		device:  device,
+		config:  config,
+		resolve: resolve,
+		now:     time.Now,
+		peers:   make(map[conf.Key]*resolvedPeer, len(config.Peers)),
+	}
+	now := r.now()
+	for i := range config.Peers {
+		r.peers[config.Peers[i].PublicKey] = &resolvedPeer{lastResolved: now}
+	}
+	return r
+}
+
+// hasHostnameEndpoint returns whether the peer has a hostname endpoint that the resolver looks after.
+// Those of peers with backup endpoints are resolved by endpointFailover whenever it sets them instead.
+func hasHostnameEndpoint(peer *conf.Peer) bool {
+	return !peer.Endpoint.IsEmpty() && net.ParseIP(peer.Endpoint.Host) == nil && len(peer.BackupEndpoints) == 0
+}
+
+// Start resolves endpoints in the background, checking every interval, until Stop is called. It does
+// nothing if no peer has a hostname endpoint.
+func (r *endpointResolver) Start(interval time.Duration) {
+	needed := false
+	for i := range r.config.Peers {
+		needed = needed || hasHostnameEndpoint(&r.config.Peers[i])
+	}
+	if !needed {
+		return
+	}
+	r.stop = make(chan bool)
+	r.stopped.Add(1)
+	go func() {
+		defer r.stopped.Done()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				r.update()
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (r *endpointResolver) Stop() {
+	if r.stop == nil {
+		return
+	}
+	close(r.stop)
+	r.stopped.Wait()
+	r.stop = nil
+}
+
+// update resolves the hostname endpoints of those peers which were last resolved longer than
+// endpointResolveInterval ago or whose handshake is stale, and sets the endpoints that changed. A
+// handshake is only stale if the traffic since the last check went unanswered. While it stays stale,
+// the endpoint is resolved with exponential backoff.
+func (r *endpointResolver) update() {
+	current, err := r.deviceConfig()
+	if err != nil {
+		log.Printf("Unable to get device configuration for endpoint resolution: %v", err)
+		return
+	}
+	now := r.now()
+	var changes strings.Builder
+	for i := range r.config.Peers {
+		peer := &r.config.Peers[i]
+		if !hasHostnameEndpoint(peer) {
+			continue
+		}
+		var currentPeer *conf.Peer
+		for j := range current.Peers {
+			if current.Peers[j].PublicKey == peer.PublicKey {
+				currentPeer = &current.Peers[j]
+				break
+			}
+		}
+		if currentPeer == nil {
+			continue
+		}
+		state := r.peers[peer.PublicKey]
+		handshake := time.Unix(0, 0).Add(time.Duration(currentPeer.LastHandshakeTime))
+		stale := state.traffic.unanswered(currentPeer) && now.Sub(handshake) > endpointStaleHandshake
+		if !stale {
+			state.staleBackoff = 0
+		}
+		sinceResolved := now.Sub(state.lastResolved)
+		switch {
+		case stale && sinceResolved >= state.staleBackoff:
+			if state.staleBackoff == 0 {
+				log.Printf("Resolving endpoint %s again, because the latest handshake is stale", peer.Endpoint.String())
+				state.staleBackoff = endpointCheckInterval
+			} else {
+				state.staleBackoff *= 2
+				if state.staleBackoff > endpointResolveInterval {
+					state.staleBackoff = endpointResolveInterval
+				}
+			}
+		case sinceResolved >= endpointResolveInterval:
+		default:
+			continue
+		}
+		state.lastResolved = now
+		resolvedIP, err := r.resolve(peer.Endpoint.Host)
+		if err != nil {
+			log.Printf("Unable to resolve %s: %v", peer.Endpoint.Host, err)
+			continue
+		}
+		resolved := conf.Endpoint{Host: resolvedIP, Port: peer.Endpoint.Port}
+		if resolved == currentPeer.Endpoint {
+			continue
+		}
+		log.Printf("Endpoint %s changed from %s to %s", peer.Endpoint.String(), currentPeer.Endpoint.String(), resolved.String())
+		changes.WriteString(fmt.Sprintf("public_key=%s\nupdate_only=true\nendpoint=%s\n", peer.PublicKey.HexString(), resolved.String()))
+	}
+	if changes.Len() == 0 {
+		return
+	}
+	err = r.device.IpcSet(changes.String())
+	if err != nil {
+		log.Printf("Unable to set changed endpoints: %v", err)
+	}
+}
+
+func (r *endpointResolver) deviceConfig() (*conf.Config, error) {
+	uapi, err := r.device.IpcGet()
+	if err != nil {
+		return nil, err
+	}
+	return conf.FromUAPI(strings.NewReader(uapi+"\n"), r.config)
+}
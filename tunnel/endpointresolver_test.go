@@ -0,0 +1,124 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package tunnel
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.zx2c4.com/wireguard/windows/conf"
+)
+
+const endpointResolverInput = `[Interface]
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+Endpoint = dynamic.example.com:51820
+AllowedIPs = 10.0.0.0/24
+
+[Peer]
+PublicKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+Endpoint = 192.0.2.1:51820
+AllowedIPs = 10.0.1.0/24
+`
+
+type fakeEndpointDevice struct {
+	config    *conf.Config
+	endpoint  string
+	handshake time.Time
+	rxBytes   uint64
+	txBytes   uint64
+	sets      []string
+}
+
+func (d *fakeEndpointDevice) IpcGet() (string, error) {
+	return fmt.Sprintf("private_key=%s\n"+
+		"public_key=%s\nendpoint=%s\nlast_handshake_time_sec=%d\nlast_handshake_time_nsec=0\nrx_bytes=%d\ntx_bytes=%d\n"+
+		"public_key=%s\nendpoint=192.0.2.1:51820\nlast_handshake_time_sec=0\nlast_handshake_time_nsec=0\n",
+		d.config.Interface.PrivateKey.HexString(),
+		d.config.Peers[0].PublicKey.HexString(), d.endpoint, d.handshake.Unix(), d.rxBytes, d.txBytes,
+		d.config.Peers[1].PublicKey.HexString()), nil
+}
+
+func (d *fakeEndpointDevice) IpcSet(uapiConf string) error {
+	d.sets = append(d.sets, uapiConf)
+	return nil
+}
+
+func TestEndpointResolver(t *testing.T) {
+	config, err := conf.FromWgQuick(endpointResolverInput, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1600000000, 0)
+	device := &fakeEndpointDevice{config: config, endpoint: "192.0.2.10:51820", handshake: now}
+	resolved := "192.0.2.10"
+	var lookups []string
+	resolver := newEndpointResolver(device, config, func(host string) (string, error) {
+		lookups = append(lookups, host)
+		return resolved, nil
+	})
+	resolver.now = func() time.Time { return now }
+	resolver.peers[config.Peers[0].PublicKey].lastResolved = now
+
+	resolver.update()
+	if len(lookups) != 0 {
+		t.Errorf("Resolved before the interval elapsed: %v", lookups)
+	}
+
+	now = now.Add(endpointResolveInterval)
+	device.handshake = now
+	resolver.update()
+	if len(lookups) != 1 || lookups[0] != "dynamic.example.com" {
+		t.Errorf("Wrong lookups after the interval elapsed: %v", lookups)
+	}
+	if len(device.sets) != 0 {
+		t.Errorf("Unchanged endpoint was set: %v", device.sets)
+	}
+
+	now = now.Add(endpointStaleHandshake + time.Second)
+	resolver.update()
+	if len(lookups) != 1 {
+		t.Errorf("The old handshake of an idle peer caused resolution: %v", lookups)
+	}
+
+	now = now.Add(endpointCheckInterval)
+	device.txBytes += 148
+	resolved = "192.0.2.20"
+	resolver.update()
+	if len(lookups) != 2 {
+		t.Errorf("Stale handshake did not cause resolution: %v", lookups)
+	}
+	expected := "public_key=" + config.Peers[0].PublicKey.HexString() + "\nupdate_only=true\nendpoint=192.0.2.20:51820\n"
+	if len(device.sets) != 1 || device.sets[0] != expected {
+		t.Errorf("Wrong endpoint update:\nactual   %q\nexpected %q", device.sets, expected)
+	}
+
+	// While the handshake stays stale, resolution backs off, to after 30 seconds, then 60, then 120.
+	device.endpoint = "192.0.2.20:51820"
+	for i, expected := range []int{3, 3, 4, 4, 4, 4} {
+		now = now.Add(endpointCheckInterval)
+		device.txBytes += 148
+		resolver.update()
+		if len(lookups) != expected {
+			t.Errorf("Wrong number of lookups after %d more checks with a stale handshake: %d, expected %d", i+1, len(lookups), expected)
+		}
+	}
+
+	now = now.Add(endpointCheckInterval)
+	device.txBytes += 148
+	device.rxBytes += 92
+	device.handshake = now
+	resolver.update()
+	now = now.Add(endpointStaleHandshake + time.Second)
+	device.txBytes += 148
+	resolver.update()
+	if len(lookups) != 5 || len(device.sets) != 1 {
+		t.Errorf("A handshake that became stale again did not cause resolution right away: %v %v", lookups, device.sets)
+	}
+}
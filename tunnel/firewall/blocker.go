@@ -101,7 +101,11 @@ func registerBaseObjects(session uintptr) (*baseObjects, error) {
 	return bo, nil
 }
 
-func EnableFirewall(luid uint64, doNotRestrict bool, restrictToDNSServers []net.IP) error {
+// EnableFirewall installs the firewall rules of a tunnel. Unless doNotRestrict is set, they block
+// traffic outside of the tunnel and DNS queries to servers other than restrictToDNSServers, if any, or
+// permit DNS queries to every server if permitAllDNS is set, since then only some names are resolved
+// through the tunnel.
+func EnableFirewall(luid uint64, doNotRestrict bool, restrictToDNSServers []net.IP, permitAllDNS bool) error {
 	if wfpSession != 0 {
 		return errors.New("The firewall has already been enabled")
 	}
@@ -123,7 +127,12 @@ func EnableFirewall(luid uint64, doNotRestrict bool, restrictToDNSServers []net.
 		}
 
 		if !doNotRestrict {
-			if len(restrictToDNSServers) > 0 {
+			if permitAllDNS {
+				err = permitDNS(session, baseObjects, 15)
+				if err != nil {
+					return wrapErr(err)
+				}
+			} else if len(restrictToDNSServers) > 0 {
 				err = blockDNS(restrictToDNSServers, session, baseObjects, 15, 14)
 				if err != nil {
 					return wrapErr(err)
@@ -31,9 +31,12 @@ type interfaceWatcherEvent struct {
 type interfaceWatcher struct {
 	errors chan interfaceWatcherError
 
-	binder conn.BindSocketToInterface
-	conf   *conf.Config
-	tun    *tun.NativeTun
+	binder         conn.BindSocketToInterface
+	conf           *conf.Config
+	tun            *tun.NativeTun
+	mtus           *familyMTUs
+	dnsPolicy      dnsPolicy
+	networkChanged func()
 
 	setupMutex              sync.Mutex
 	interfaceChangeCallback winipcfg.ChangeCallback
@@ -56,7 +59,7 @@ func hasDefaultRoute(family winipcfg.AddressFamily, peers []conf.Peer) bool {
 		v68          = [16]byte{0x80}
 	)
 	for _, peer := range peers {
-		for _, allowedip := range peer.AllowedIPs {
+		for _, allowedip := range peer.EffectiveAllowedIPs() {
 			if allowedip.Cidr == 1 && len(allowedip.IP) == 16 && allowedip.IP.Equal(v60[:]) {
 				foundV600001 = true
 			} else if allowedip.Cidr == 1 && len(allowedip.IP) == 16 && allowedip.IP.Equal(v68[:]) {
@@ -80,6 +83,13 @@ func hasDefaultRoute(family winipcfg.AddressFamily, peers []conf.Peer) bool {
 	return false
 }
 
+// blackholeWhenLoop returns whether the socket of family should drop packets rather than loop them
+// back into the tunnel when there is no other default route, which is the case when the tunnel itself
+// carries the default route.
+func (iw *interfaceWatcher) blackholeWhenLoop(family winipcfg.AddressFamily) bool {
+	return !iw.conf.Interface.TableOff && hasDefaultRoute(family, iw.conf.Peers)
+}
+
 func (iw *interfaceWatcher) setup(family winipcfg.AddressFamily) {
 	var changeCallbacks *[]winipcfg.ChangeCallback
 	var ipversion string
@@ -101,20 +111,36 @@ func (iw *interfaceWatcher) setup(family winipcfg.AddressFamily) {
 	var err error
 
 	log.Printf("Monitoring default %s routes", ipversion)
-	*changeCallbacks, err = monitorDefaultRoutes(family, iw.binder, iw.conf.Interface.MTU == 0, hasDefaultRoute(family, iw.conf.Peers), iw.tun)
+	autoMTU := iw.conf.Interface.EffectiveMTU(family == windows.AF_INET6) == 0
+	*changeCallbacks, err = monitorDefaultRoutes(family, iw.binder, autoMTU, iw.blackholeWhenLoop(family), iw.tun, iw.mtus, iw.networkChanged)
 	if err != nil {
 		iw.errors <- interfaceWatcherError{services.ErrorBindSocketsToDefaultRoutes, err}
 		return
 	}
 
 	log.Printf("Setting device %s addresses", ipversion)
-	err = configureInterface(family, iw.conf, iw.tun)
+	err = configureInterface(family, iw.conf, iw.tun, iw.mtus)
 	if err != nil {
 		iw.errors <- interfaceWatcherError{services.ErrorSetNetConfig, err}
 		return
 	}
 }
 
+// applyDNSPolicy applies the name resolution policy rules of the configuration, after the families
+// that their servers are in have been set up.
+func (iw *interfaceWatcher) applyDNSPolicy() {
+	configured := func(family winipcfg.AddressFamily) bool {
+		if family == windows.AF_INET {
+			return len(iw.changeCallbacks4) != 0
+		}
+		return len(iw.changeCallbacks6) != 0
+	}
+	err := iw.dnsPolicy.apply(systemDNSBackend{}, iw.conf, configured)
+	if err != nil {
+		iw.errors <- interfaceWatcherError{services.ErrorSetNetConfig, err}
+	}
+}
+
 func watchInterface() (*interfaceWatcher, error) {
 	iw := &interfaceWatcher{
 		errors: make(chan interfaceWatcherError, 2),
@@ -135,6 +161,7 @@ func watchInterface() (*interfaceWatcher, error) {
 			return
 		}
 		iw.setup(iface.Family)
+		iw.applyDNSPolicy()
 	})
 	if err != nil {
 		return nil, err
@@ -142,17 +169,46 @@ func watchInterface() (*interfaceWatcher, error) {
 	return iw, nil
 }
 
-func (iw *interfaceWatcher) Configure(binder conn.BindSocketToInterface, conf *conf.Config, tun *tun.NativeTun) {
+// Configure sets up the interface, once it exists, calling networkChanged when the interface of the
+// default route changes afterwards.
+func (iw *interfaceWatcher) Configure(binder conn.BindSocketToInterface, conf *conf.Config, tun *tun.NativeTun, networkChanged func()) {
 	iw.setupMutex.Lock()
 	defer iw.setupMutex.Unlock()
 
-	iw.binder, iw.conf, iw.tun = binder, conf, tun
+	iw.binder, iw.conf, iw.tun, iw.networkChanged = binder, conf, tun, networkChanged
+	iw.mtus = newFamilyMTUs(tun.ForceMTU)
 	for _, event := range iw.storedEvents {
 		if event.luid == winipcfg.LUID(iw.tun.LUID()) {
 			iw.setup(event.family)
 		}
 	}
 	iw.storedEvents = nil
+	iw.applyDNSPolicy()
+}
+
+// Reconfigure applies a changed configuration to the interface, by setting up again each family that
+// has already been set up, with the new addresses, routes, DNS servers, and MTU.
+func (iw *interfaceWatcher) Reconfigure(conf *conf.Config) {
+	iw.setupMutex.Lock()
+	defer iw.setupMutex.Unlock()
+
+	if iw.tun == nil {
+		iw.conf = conf
+		return
+	}
+	if !iw.conf.Interface.TableOff && conf.Interface.TableOff {
+		luid := winipcfg.LUID(iw.tun.LUID())
+		luid.FlushRoutes(windows.AF_INET)
+		luid.FlushRoutes(windows.AF_INET6)
+	}
+	iw.conf = conf
+	if len(iw.changeCallbacks4) != 0 {
+		iw.setup(windows.AF_INET)
+	}
+	if len(iw.changeCallbacks6) != 0 {
+		iw.setup(windows.AF_INET6)
+	}
+	iw.applyDNSPolicy()
 }
 
 func (iw *interfaceWatcher) Destroy() {
@@ -161,6 +217,7 @@ func (iw *interfaceWatcher) Destroy() {
 	changeCallbacks6 := iw.changeCallbacks6
 	interfaceChangeCallback := iw.interfaceChangeCallback
 	tun := iw.tun
+	conf := iw.conf
 	iw.setupMutex.Unlock()
 
 	if interfaceChangeCallback != nil {
@@ -197,5 +254,8 @@ func (iw *interfaceWatcher) Destroy() {
 		luid.FlushIPAddresses(windows.AF_INET6)
 		luid.FlushDNS(windows.AF_INET6)
 	}
+	if conf != nil {
+		systemDNSBackend{}.SetPolicyRules(conf.Name, nil)
+	}
 	iw.setupMutex.Unlock()
 }
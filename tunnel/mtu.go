@@ -0,0 +1,75 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package tunnel
+
+import (
+	"sync"
+
+	"golang.org/x/sys/windows"
+
+	"golang.zx2c4.com/wireguard/windows/tunnel/winipcfg"
+)
+
+// The overhead of WireGuard over IPv6, which is the largest, so that the automatic MTU fits either.
+const wireguardOverhead = 80
+
+func minimumMTU(family winipcfg.AddressFamily) uint32 {
+	if family == windows.AF_INET6 {
+		return 1280
+	}
+	return 576
+}
+
+// planFamilyMTU determines the MTU of a family of the tunnel interface, which is the configured one if
+// there is one, or else that of the underlying interface, which carries the default route, less the
+// overhead. Zero means that it cannot be determined yet, because the underlying interface is unknown.
+func planFamilyMTU(family winipcfg.AddressFamily, configured uint16, underlying *winipcfg.MibIfRow2) uint32 {
+	if configured > 0 {
+		return uint32(configured)
+	}
+	if underlying == nil || underlying.MTU == 0 {
+		return 0
+	}
+	mtu := uint32(0)
+	if underlying.MTU > wireguardOverhead {
+		mtu = underlying.MTU - wireguardOverhead
+	}
+	if min := minimumMTU(family); mtu < min {
+		mtu = min
+	}
+	return mtu
+}
+
+// familyMTUs keeps track of the MTU of each family of the tunnel interface. The tun device has a single
+// MTU for both, which must be the largest of them, so that it accepts the packets of either.
+type familyMTUs struct {
+	sync.Mutex
+	mtus     map[winipcfg.AddressFamily]uint32
+	forced   uint32
+	forceMTU func(mtu int)
+}
+
+func newFamilyMTUs(forceMTU func(mtu int)) *familyMTUs {
+	return &familyMTUs{mtus: make(map[winipcfg.AddressFamily]uint32, 2), forceMTU: forceMTU}
+}
+
+// set records the MTU of a family, and changes that of the tun device if the largest one changes.
+func (f *familyMTUs) set(family winipcfg.AddressFamily, mtu uint32) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.mtus[family] = mtu
+	largest := uint32(0)
+	for _, mtu := range f.mtus {
+		if mtu > largest {
+			largest = mtu
+		}
+	}
+	if largest > 0 && largest != f.forced {
+		f.forceMTU(int(largest))
+		f.forced = largest
+	}
+}
@@ -0,0 +1,58 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package tunnel
+
+import (
+	"testing"
+
+	"golang.org/x/sys/windows"
+
+	"golang.zx2c4.com/wireguard/windows/tunnel/winipcfg"
+)
+
+func TestPlanFamilyMTU(t *testing.T) {
+	for _, tt := range []struct {
+		family     winipcfg.AddressFamily
+		configured uint16
+		underlying *winipcfg.MibIfRow2
+		want       uint32
+	}{
+		{windows.AF_INET, 1420, &winipcfg.MibIfRow2{MTU: 9000}, 1420},
+		{windows.AF_INET, 0, nil, 0},
+		{windows.AF_INET, 0, &winipcfg.MibIfRow2{MTU: 0}, 0},
+		{windows.AF_INET, 0, &winipcfg.MibIfRow2{MTU: 1500}, 1420},
+		{windows.AF_INET6, 0, &winipcfg.MibIfRow2{MTU: 1500}, 1420},
+		{windows.AF_INET, 0, &winipcfg.MibIfRow2{MTU: 600}, 576},
+		{windows.AF_INET6, 0, &winipcfg.MibIfRow2{MTU: 1300}, 1280},
+		{windows.AF_INET6, 0, &winipcfg.MibIfRow2{MTU: 40}, 1280},
+	} {
+		if got := planFamilyMTU(tt.family, tt.configured, tt.underlying); got != tt.want {
+			t.Errorf("planFamilyMTU(%d, %d, %+v) = %d, want %d", tt.family, tt.configured, tt.underlying, got, tt.want)
+		}
+	}
+}
+
+func TestFamilyMTUs(t *testing.T) {
+	var forced []int
+	mtus := newFamilyMTUs(func(mtu int) {
+		forced = append(forced, mtu)
+	})
+	mtus.set(windows.AF_INET, 1420)
+	mtus.set(windows.AF_INET6, 1280)
+	mtus.set(windows.AF_INET, 1420)
+	mtus.set(windows.AF_INET6, 1500)
+	mtus.set(windows.AF_INET6, 1280)
+	want := []int{1420, 1500, 1420}
+	if len(forced) != len(want) {
+		t.Fatalf("The tun MTU was set to %v, want %v", forced, want)
+	}
+	for i := range want {
+		if forced[i] != want[i] {
+			t.Errorf("The tun MTU was set to %v, want %v", forced, want)
+			break
+		}
+	}
+}
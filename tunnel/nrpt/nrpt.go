@@ -0,0 +1,129 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+// Package nrpt keeps the rules that tunnels add to the local name resolution policy table of the DNS
+// client service. The table is in the registry, so the rules outlive the tunnels that add them unless
+// they are removed.
+package nrpt
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// Rule sends queries for names in its namespaces to its servers, rather than to the servers of
+// whichever interface would be used otherwise. A namespace that starts with a dot matches the names
+// under it; otherwise it matches only itself.
+type Rule struct {
+	Namespaces []string
+	Servers    []net.IP
+}
+
+// The rules of a tunnel are the subkeys of this one named by keyPrefix, the name of the tunnel, and
+// the index of the rule.
+const policyConfigKey = `SYSTEM\CurrentControlSet\Services\Dnscache\Parameters\DnsPolicyConfig`
+
+const keyPrefix = "WireGuard-"
+
+// ownerOfKey returns the name of the tunnel whose rule is kept in the subkey name, if it is one.
+func ownerOfKey(name string) (string, bool) {
+	if !strings.HasPrefix(name, keyPrefix) {
+		return "", false
+	}
+	i := strings.LastIndexByte(name, '-')
+	if i <= len(keyPrefix) || i == len(name)-1 || len(strings.Trim(name[i+1:], "0123456789")) != 0 {
+		return "", false
+	}
+	return name[len(keyPrefix):i], true
+}
+
+// Owners returns the names of the tunnels that have rules.
+func Owners() ([]string, error) {
+	parent, err := registry.OpenKey(registry.LOCAL_MACHINE, policyConfigKey, registry.ENUMERATE_SUB_KEYS)
+	if err == registry.ErrNotExist {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Unable to open name resolution policy registry key: %w", err)
+	}
+	defer parent.Close()
+	names, err := parent.ReadSubKeyNames(-1)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to enumerate name resolution policy rules: %w", err)
+	}
+	var owners []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if owner, ok := ownerOfKey(name); ok && !seen[owner] {
+			seen[owner] = true
+			owners = append(owners, owner)
+		}
+	}
+	return owners, nil
+}
+
+// SetRules replaces the rules of a tunnel, removing them if there are none, and flushes the resolver
+// cache so that the change applies to names that were looked up before.
+func SetRules(owner string, rules []Rule) error {
+	parent, _, err := registry.CreateKey(registry.LOCAL_MACHINE, policyConfigKey, registry.ENUMERATE_SUB_KEYS|registry.CREATE_SUB_KEY)
+	if err != nil {
+		return fmt.Errorf("Unable to open name resolution policy registry key: %w", err)
+	}
+	defer parent.Close()
+	names, err := parent.ReadSubKeyNames(-1)
+	if err != nil {
+		return fmt.Errorf("Unable to enumerate name resolution policy rules: %w", err)
+	}
+	changed := false
+	for _, name := range names {
+		if keyOwner, ok := ownerOfKey(name); ok && keyOwner == owner {
+			err = registry.DeleteKey(parent, name)
+			if err != nil {
+				return fmt.Errorf("Unable to remove name resolution policy rule: %w", err)
+			}
+			changed = true
+		}
+	}
+	for i, rule := range rules {
+		servers := make([]string, len(rule.Servers))
+		for j, server := range rule.Servers {
+			servers[j] = server.String()
+		}
+		key, _, err := registry.CreateKey(parent, fmt.Sprintf("%s%s-%d", keyPrefix, owner, i), registry.SET_VALUE)
+		if err != nil {
+			return fmt.Errorf("Unable to add name resolution policy rule: %w", err)
+		}
+		err = key.SetDWordValue("Version", 2)
+		if err == nil {
+			err = key.SetStringsValue("Name", rule.Namespaces)
+		}
+		if err == nil {
+			err = key.SetStringValue("GenericDNSServers", strings.Join(servers, "; "))
+		}
+		if err == nil {
+			err = key.SetStringValue("IPSECCARestriction", "")
+		}
+		if err == nil {
+			err = key.SetDWordValue("ConfigOptions", 0x8) // Generic DNS servers
+		}
+		if err == nil {
+			err = key.SetStringValue("Comment", fmt.Sprintf("WireGuard tunnel %s", owner))
+		}
+		key.Close()
+		if err != nil {
+			return fmt.Errorf("Unable to write name resolution policy rule: %w", err)
+		}
+		changed = true
+	}
+	if changed {
+		procDnsFlushResolverCache.Call()
+	}
+	return nil
+}
+
+var procDnsFlushResolverCache = windows.NewLazySystemDLL("dnsapi.dll").NewProc("DnsFlushResolverCache")
@@ -0,0 +1,33 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package nrpt
+
+import (
+	"testing"
+)
+
+func TestOwnerOfKey(t *testing.T) {
+	tests := []struct {
+		key   string
+		owner string
+		ok    bool
+	}{
+		{"WireGuard-office-0", "office", true},
+		{"WireGuard-office-12", "office", true},
+		{"WireGuard-home-office-1", "home-office", true},
+		{"WireGuard-office-", "", false},
+		{"WireGuard-office-x", "", false},
+		{"WireGuard-0", "", false},
+		{"WireGuard--0", "", false},
+		{"{3EF2E7E4-9E15-4B56-ADBD-F1B1A3A5DB6C}", "", false},
+	}
+	for _, tt := range tests {
+		owner, ok := ownerOfKey(tt.key)
+		if owner != tt.owner || ok != tt.ok {
+			t.Errorf("ownerOfKey(%q) = %q, %v, want %q, %v", tt.key, owner, ok, tt.owner, tt.ok)
+		}
+	}
+}
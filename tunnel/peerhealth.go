@@ -0,0 +1,299 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package tunnel
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.zx2c4.com/wireguard/device"
+
+	"golang.zx2c4.com/wireguard/windows/conf"
+)
+
+const (
+	healthCheckInterval = time.Second * 10
+	// A peer that is being recovered gets this long to complete a handshake, which is enough for a few
+	// of the handshake attempts that are REKEY_TIMEOUT apart, before it is recovered again.
+	healthRecoveryTimeout = time.Second * 20
+	healthMaxRecoveries   = 3
+	// Unreachable peers to which packets are still being sent are recovered again this often.
+	healthUnreachableRetry = time.Minute * 5
+	// A gap between two samples that is this much longer than the interval means that the system was
+	// asleep in between.
+	healthResumeGap = healthCheckInterval * 3
+)
+
+// keepaliveSize is the size of a keepalive, which is a transport data message without any data. Peers
+// do not answer keepalives, so they do not count as unanswered traffic.
+const keepaliveSize = 32
+
+type healthDevice interface {
+	endpointDevice
+	SendHandshake(publicKey conf.Key) error
+}
+
+type wireguardHealthDevice struct {
+	*device.Device
+}
+
+func (d wireguardHealthDevice) SendHandshake(publicKey conf.Key) error {
+	peer := d.LookupPeer(device.NoisePublicKey(publicKey))
+	if peer == nil {
+		return errors.New("Peer not found")
+	}
+	return peer.SendHandshakeInitiation(false)
+}
+
+type peerHealth struct {
+	state      conf.PeerHealthState
+	rxBytes    conf.Bytes
+	txBytes    conf.Bytes
+	recoveries int       // Recoveries since the peer was last healthy
+	recovered  time.Time // When the peer was last recovered
+}
+
+type peerHealthReport struct {
+	PublicKey         conf.Key
+	State             conf.PeerHealthState
+	LastHandshakeTime conf.HandshakeTime
+}
+
+// healthMonitor samples the latest handshake and the transfer counters of each peer, to tell which
+// peers are healthy, idle, or stuck, which are those that are sent data but do not answer. It recovers
+// stuck peers, as well as all healthy ones after the system resumes or the network changes, by setting
+// their endpoints again, resolved again if they are hostnames, and initiating a handshake. The other
+// peers are left alone.
+type healthMonitor struct {
+	device  healthDevice
+	resolve func(host string) (string, error)
+	now     func() time.Time
+
+	sync.Mutex
+	config         *conf.Config
+	peers          map[conf.Key]*peerHealth
+	reports        []peerHealthReport
+	changed        chan struct{}
+	lastSample     time.Time
+	networkChanged bool
+
+	stop    chan bool
+	stopped sync.WaitGroup
+}
+
+func newHealthMonitor(device healthDevice, config *conf.Config, resolve func(host string) (string, error)) *healthMonitor {
+	return &healthMonitor{
+		device:  device,
+		resolve: resolve,
+		now:     time.Now,
+		config:  config,
+		peers:   make(map[conf.Key]*peerHealth, len(config.Peers)),
+		changed: make(chan struct{}),
+	}
+}
+
+// Start samples the peers in the background every interval, until Stop is called.
+func (m *healthMonitor) Start(interval time.Duration) {
+	m.stop = make(chan bool)
+	m.stopped.Add(1)
+	go func() {
+		defer m.stopped.Done()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				m.update()
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (m *healthMonitor) Stop() {
+	if m.stop == nil {
+		return
+	}
+	close(m.stop)
+	m.stopped.Wait()
+	m.stop = nil
+}
+
+// Reconfigure makes the monitor resolve the endpoints of the configuration that the tunnel was reloaded
+// with. The health of the peers that remain is kept.
+func (m *healthMonitor) Reconfigure(config *conf.Config) {
+	m.Lock()
+	m.config = config
+	m.Unlock()
+}
+
+// NetworkChanged makes the next sample recover the healthy peers, as their handshakes complete over a
+// network that is no longer used.
+func (m *healthMonitor) NetworkChanged() {
+	m.Lock()
+	m.networkChanged = true
+	m.Unlock()
+}
+
+// Health returns the health of each peer as of the latest sample, along with a channel that is closed
+// when it changes.
+func (m *healthMonitor) Health() ([]peerHealthReport, <-chan struct{}) {
+	m.Lock()
+	defer m.Unlock()
+	return m.reports, m.changed
+}
+
+func (m *healthMonitor) update() {
+	uapi, err := m.device.IpcGet()
+	if err != nil {
+		log.Printf("Unable to get device configuration for peer health: %v", err)
+		return
+	}
+	current, err := conf.FromUAPI(strings.NewReader(uapi+"\n"), &conf.Config{})
+	if err != nil {
+		log.Printf("Unable to get device configuration for peer health: %v", err)
+		return
+	}
+	// This is the wall clock, rather than the monotonic one, so that time spent asleep counts.
+	now := m.now().Round(0)
+
+	m.Lock()
+	resumed := !m.lastSample.IsZero() && now.Sub(m.lastSample) > healthResumeGap
+	if resumed {
+		log.Printf("The system resumed after %v, so recovering healthy peers", now.Sub(m.lastSample).Round(time.Second))
+	} else if m.networkChanged {
+		log.Println("The network changed, so recovering healthy peers")
+	}
+	disrupted := resumed || m.networkChanged
+	elapsed := healthCheckInterval
+	if !m.lastSample.IsZero() {
+		elapsed = now.Sub(m.lastSample)
+	}
+	m.lastSample, m.networkChanged = now, false
+
+	var stuck []*conf.Peer
+	changed := len(m.reports) != len(current.Peers)
+	peers := make(map[conf.Key]*peerHealth, len(current.Peers))
+	reports := make([]peerHealthReport, 0, len(current.Peers))
+	for i := range current.Peers {
+		sample := &current.Peers[i]
+		h := m.peers[sample.PublicKey]
+		if h == nil {
+			h = &peerHealth{}
+		}
+		peers[sample.PublicKey] = h
+		handshake := time.Unix(0, 0).Add(time.Duration(sample.LastHandshakeTime))
+		fresh := sample.LastHandshakeTime != 0 && now.Sub(handshake) <= endpointStaleHandshake && handshake.After(h.recovered)
+		// A passive keepalive may follow what was last received, and persistent keepalives are sent
+		// every interval, so only what was sent beyond those is data that should have been answered.
+		keepalives := conf.Bytes(1)
+		if sample.PersistentKeepalive > 0 {
+			keepalives += conf.Bytes(elapsed / (time.Duration(sample.PersistentKeepalive) * time.Second))
+		}
+		sending, receiving := sample.TxBytes > h.txBytes+keepalives*keepaliveSize, sample.RxBytes > h.rxBytes
+		previous := h.state
+		recover := false
+
+		switch {
+		case h.state == conf.PeerHealthUnknown:
+			if fresh {
+				h.state = conf.PeerHealthy
+			} else {
+				h.state = conf.PeerIdle
+			}
+		case h.state == conf.PeerRecovering:
+			if fresh {
+				log.Printf("Peer %s recovered", sample.PublicKey.String())
+				h.state, h.recoveries = conf.PeerHealthy, 0
+			} else if now.Sub(h.recovered) >= healthRecoveryTimeout {
+				if h.recoveries < healthMaxRecoveries {
+					recover = true
+				} else {
+					log.Printf("Peer %s did not recover, so it is considered unreachable", sample.PublicKey.String())
+					h.state = conf.PeerUnreachable
+				}
+			}
+		case disrupted && h.state == conf.PeerHealthy:
+			recover = true
+		case fresh:
+			h.state, h.recoveries = conf.PeerHealthy, 0
+		case sending && !receiving:
+			if h.state != conf.PeerUnreachable {
+				log.Printf("Peer %s is sent data but does not answer, so recovering", sample.PublicKey.String())
+				recover = true
+			} else if now.Sub(h.recovered) >= healthUnreachableRetry {
+				recover = true
+			}
+		case h.state != conf.PeerUnreachable:
+			h.state = conf.PeerIdle
+		}
+		if recover {
+			stuck = append(stuck, sample)
+			h.state = conf.PeerRecovering
+			h.recoveries++
+			h.recovered = now
+		}
+		h.rxBytes, h.txBytes = sample.RxBytes, sample.TxBytes
+
+		changed = changed || h.state != previous || m.reports[i].PublicKey != sample.PublicKey
+		reports = append(reports, peerHealthReport{sample.PublicKey, h.state, sample.LastHandshakeTime})
+	}
+	m.peers = peers
+	m.reports = reports
+	if changed {
+		close(m.changed)
+		m.changed = make(chan struct{})
+	}
+	config := m.config
+	m.Unlock()
+
+	if len(stuck) > 0 {
+		m.recover(stuck, config)
+	}
+}
+
+// recover sets the endpoints of the peers, as sampled from the device, again, which makes the device
+// forget the source addresses that it sends to them from, resolving those that are hostnames in the
+// configuration again, before initiating a handshake with each of them.
+func (m *healthMonitor) recover(peers []*conf.Peer, config *conf.Config) {
+	var changes strings.Builder
+	for _, sample := range peers {
+		endpoint := sample.Endpoint
+		for i := range config.Peers {
+			peer := &config.Peers[i]
+			if peer.PublicKey != sample.PublicKey || !hasHostnameEndpoint(peer) {
+				continue
+			}
+			resolvedIP, err := m.resolve(peer.Endpoint.Host)
+			if err != nil {
+				log.Printf("Unable to resolve %s: %v", peer.Endpoint.Host, err)
+				break
+			}
+			endpoint = conf.Endpoint{Host: resolvedIP, Port: peer.Endpoint.Port}
+			break
+		}
+		if !endpoint.IsEmpty() {
+			changes.WriteString(fmt.Sprintf("public_key=%s\nupdate_only=true\nendpoint=%s\n", sample.PublicKey.HexString(), endpoint.String()))
+		}
+	}
+	if changes.Len() > 0 {
+		err := m.device.IpcSet(changes.String())
+		if err != nil {
+			log.Printf("Unable to set endpoints again: %v", err)
+		}
+	}
+	for _, sample := range peers {
+		err := m.device.SendHandshake(sample.PublicKey)
+		if err != nil {
+			log.Printf("Unable to initiate handshake with peer %s: %v", sample.PublicKey.String(), err)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package tunnel
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.zx2c4.com/wireguard/windows/conf"
+)
+
+type fakeHealthDevice struct {
+	config     *conf.Config
+	endpoints  map[conf.Key]string
+	handshakes map[conf.Key]time.Time
+	rxBytes    map[conf.Key]uint64
+	txBytes    map[conf.Key]uint64
+	sets       []string
+	initiated  []conf.Key
+}
+
+func (d *fakeHealthDevice) IpcGet() (string, error) {
+	var uapi strings.Builder
+	uapi.WriteString(fmt.Sprintf("private_key=%s\n", d.config.Interface.PrivateKey.HexString()))
+	for i := range d.config.Peers {
+		key := d.config.Peers[i].PublicKey
+		handshake := d.handshakes[key]
+		if handshake.IsZero() {
+			handshake = time.Unix(0, 0)
+		}
+		uapi.WriteString(fmt.Sprintf("public_key=%s\nendpoint=%s\nrx_bytes=%d\ntx_bytes=%d\nlast_handshake_time_sec=%d\nlast_handshake_time_nsec=0\n",
+			key.HexString(), d.endpoints[key], d.rxBytes[key], d.txBytes[key], handshake.Unix()))
+	}
+	return uapi.String(), nil
+}
+
+func (d *fakeHealthDevice) IpcSet(uapiConf string) error {
+	d.sets = append(d.sets, uapiConf)
+	return nil
+}
+
+func (d *fakeHealthDevice) SendHandshake(publicKey conf.Key) error {
+	d.initiated = append(d.initiated, publicKey)
+	return nil
+}
+
+func TestHealthMonitor(t *testing.T) {
+	config, err := conf.FromWgQuick(endpointResolverInput, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dynamic, static := config.Peers[0].PublicKey, config.Peers[1].PublicKey
+	device := &fakeHealthDevice{
+		config:     config,
+		endpoints:  map[conf.Key]string{dynamic: "192.0.2.10:51820", static: "192.0.2.1:51820"},
+		handshakes: make(map[conf.Key]time.Time),
+		rxBytes:    make(map[conf.Key]uint64),
+		txBytes:    make(map[conf.Key]uint64),
+	}
+	var lookups []string
+	monitor := newHealthMonitor(device, config, func(host string) (string, error) {
+		lookups = append(lookups, host)
+		return "192.0.2.20", nil
+	})
+	now := time.Unix(1600000000, 0)
+	monitor.now = func() time.Time { return now }
+
+	check := func(name string, dynamicState, staticState conf.PeerHealthState) {
+		t.Helper()
+		reports, _ := monitor.Health()
+		if len(reports) != 2 || reports[0].PublicKey != dynamic || reports[1].PublicKey != static {
+			t.Fatalf("%s: unexpected reports %+v", name, reports)
+		}
+		if reports[0].State != dynamicState || reports[1].State != staticState {
+			t.Errorf("%s: states are %s and %s, but %s and %s were expected", name, reports[0].State, reports[1].State, dynamicState, staticState)
+		}
+	}
+
+	device.handshakes[dynamic] = now.Add(-time.Second * 5)
+	device.rxBytes[dynamic], device.txBytes[dynamic] = 1000, 1000
+	_, changed := monitor.Health()
+	monitor.update()
+	check("first sample", conf.PeerHealthy, conf.PeerIdle)
+	select {
+	case <-changed:
+	default:
+		t.Error("The first sample did not signal a change")
+	}
+
+	_, changed = monitor.Health()
+	now = now.Add(healthCheckInterval)
+	device.handshakes[dynamic] = now
+	device.rxBytes[dynamic], device.txBytes[dynamic] = 2000, 2000
+	monitor.update()
+	check("traffic", conf.PeerHealthy, conf.PeerIdle)
+	select {
+	case <-changed:
+		t.Error("A change was signaled without one")
+	default:
+	}
+
+	now = now.Add(healthCheckInterval)
+	device.handshakes[dynamic] = now
+	device.txBytes[static] = keepaliveSize
+	monitor.update()
+	check("keepalive", conf.PeerHealthy, conf.PeerIdle)
+
+	now = now.Add(healthCheckInterval)
+	device.txBytes[static] += 148
+	monitor.update()
+	check("unanswered", conf.PeerHealthy, conf.PeerRecovering)
+	recovered := "public_key=" + static.HexString() + "\nupdate_only=true\nendpoint=192.0.2.1:51820\n"
+	if len(device.initiated) != 1 || device.initiated[0] != static || len(device.sets) != 1 || device.sets[0] != recovered {
+		t.Errorf("Stuck peer was not recovered alone: handshakes with %v, sets %q", device.initiated, device.sets)
+	}
+
+	for i := 1; i < healthMaxRecoveries; i++ {
+		now = now.Add(healthCheckInterval)
+		monitor.update()
+		now = now.Add(healthRecoveryTimeout - healthCheckInterval)
+		device.handshakes[dynamic] = now
+		monitor.update()
+		check("recovery timeout", conf.PeerHealthy, conf.PeerRecovering)
+	}
+	now = now.Add(healthRecoveryTimeout)
+	device.handshakes[dynamic] = now
+	monitor.update()
+	check("too many recoveries", conf.PeerHealthy, conf.PeerUnreachable)
+	if len(device.sets) != healthMaxRecoveries || len(device.initiated) != healthMaxRecoveries {
+		t.Errorf("Expected %d recoveries, but got %d endpoint updates and %d handshakes", healthMaxRecoveries, len(device.sets), len(device.initiated))
+	}
+
+	now = now.Add(healthCheckInterval)
+	device.handshakes[dynamic] = now
+	device.handshakes[static] = now.Add(-time.Second)
+	device.rxBytes[static] = 92
+	monitor.update()
+	check("answered", conf.PeerHealthy, conf.PeerHealthy)
+
+	device.initiated, device.sets = nil, nil
+	now = now.Add(time.Hour)
+	monitor.update()
+	check("resumed", conf.PeerRecovering, conf.PeerRecovering)
+	if len(device.initiated) != 2 || len(lookups) != 1 || lookups[0] != "dynamic.example.com" {
+		t.Errorf("Peers were not recovered after resuming: handshakes with %v, lookups of %v", device.initiated, lookups)
+	}
+	expected := "public_key=" + dynamic.HexString() + "\nupdate_only=true\nendpoint=192.0.2.20:51820\n" + recovered
+	if len(device.sets) != 1 || device.sets[0] != expected {
+		t.Errorf("Wrong endpoint update:\nactual   %q\nexpected %q", device.sets, expected)
+	}
+
+	now = now.Add(healthCheckInterval)
+	device.handshakes[dynamic] = now
+	device.handshakes[static] = now
+	monitor.update()
+	check("recovered", conf.PeerHealthy, conf.PeerHealthy)
+
+	device.initiated = nil
+	monitor.NetworkChanged()
+	now = now.Add(healthCheckInterval)
+	monitor.update()
+	check("network changed", conf.PeerRecovering, conf.PeerRecovering)
+	if len(device.initiated) != 2 {
+		t.Errorf("Peers were not recovered after the network changed: handshakes with %v", device.initiated)
+	}
+}
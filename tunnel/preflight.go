@@ -0,0 +1,208 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package tunnel
+
+import (
+	"net"
+
+	"golang.org/x/sys/windows"
+
+	"golang.zx2c4.com/wireguard/windows/conf"
+	"golang.zx2c4.com/wireguard/windows/l18n"
+	"golang.zx2c4.com/wireguard/windows/tunnel/winipcfg"
+)
+
+type localNetwork struct {
+	Interface string
+	Network   conf.IPCidr
+}
+
+// preflight holds what checking a configuration needs from the system, so that tests may replace it.
+type preflight struct {
+	resolve func(host string) (string, error)
+	listen  func(port uint16) error
+	// localNetworks returns the networks of the interfaces that are up, other than those named in skip.
+	localNetworks func(skip map[string]bool) ([]localNetwork, error)
+}
+
+var systemPreflight = preflight{
+	resolve:       conf.ResolveHostnameOnce,
+	listen:        listenUDP,
+	localNetworks: interfaceNetworks,
+}
+
+// Preflight checks the configuration in text, as the tunnel called name, for what would go wrong when
+// activating it, without creating an adapter or changing routes. Besides parsing and linting it, it
+// resolves the endpoints, checks that the ListenPort is free, and looks for routes that would take
+// over local networks or collide with those of the active tunnels. An active tunnel with the same name
+// is the one that the configuration would replace, so it is not checked against.
+func Preflight(text, name string, active []*conf.Config) *conf.PreflightReport {
+	return systemPreflight.run(text, name, active)
+}
+
+func (p *preflight) run(text, name string, active []*conf.Config) *conf.PreflightReport {
+	report := &conf.PreflightReport{}
+	config, diagnostics := conf.ValidateWithUnknownEncoding(text, name)
+	report.Diagnostics = diagnostics
+	if conf.HasErrors(diagnostics) {
+		return report
+	}
+	report.Findings = conf.Lint(config)
+	problem := func(severity conf.DiagnosticSeverity, message string) {
+		report.Problems = append(report.Problems, conf.PreflightProblem{severity, message})
+	}
+
+	for i := range config.Peers {
+		peer := &config.Peers[i]
+		for j, endpoint := range peer.Endpoints() {
+			resolved := endpoint.Host
+			if net.ParseIP(resolved) == nil {
+				var err error
+				resolved, err = p.resolve(endpoint.Host)
+				if err != nil {
+					resolved = ""
+					// Only the endpoint is resolved when activating, whereas a backup that cannot be
+					// resolved is skipped when failing over.
+					severity := conf.DiagnosticWarning
+					if j == 0 {
+						severity = conf.DiagnosticError
+					}
+					problem(severity, l18n.Sprintf("Unable to resolve endpoint %s of peer %s: %v", endpoint.String(), peer.PublicKey.String(), err))
+				}
+			}
+			report.Endpoints = append(report.Endpoints, conf.PreflightEndpoint{peer.PublicKey, endpoint, resolved})
+		}
+	}
+
+	skip := map[string]bool{name: true}
+	var others []*conf.Config
+	replacing := false
+	for _, other := range active {
+		if other.Name == name {
+			replacing = other.Interface.ListenPort == config.Interface.ListenPort
+			continue
+		}
+		skip[other.Name] = true
+		others = append(others, other)
+	}
+	if port := config.Interface.ListenPort; port != 0 {
+		taken := false
+		for _, other := range others {
+			if other.Interface.ListenPort == port {
+				problem(conf.DiagnosticError, l18n.Sprintf("ListenPort %d is already used by the active tunnel ‘%s’", port, other.Name))
+				taken = true
+			}
+		}
+		if !taken && !replacing {
+			err := p.listen(port)
+			if err != nil {
+				problem(conf.DiagnosticError, l18n.Sprintf("ListenPort %d is not available: %v", port, err))
+			}
+		}
+	}
+
+	routes, _, _ := planRoutes(config)
+	for _, route := range routes {
+		report.Routes = append(report.Routes, route.Destination)
+	}
+	report.RouteMetric = config.Interface.TableMetric
+	if len(routes) > 0 {
+		networks, err := p.localNetworks(skip)
+		if err != nil {
+			problem(conf.DiagnosticWarning, l18n.Sprintf("Unable to determine the local networks: %v", err))
+		}
+		for _, route := range routes {
+			destination := routeCidr(route)
+			for _, local := range networks {
+				// A route that is broader than a local network leaves it alone, as the more specific
+				// route of the local network wins, so only narrower ones take it over.
+				if destination.Cidr == 0 || destination.Cidr < local.Network.Cidr || !destination.Overlaps(&local.Network) {
+					continue
+				}
+				problem(conf.DiagnosticWarning, l18n.Sprintf("Route %s would take over addresses of the local network %s on ‘%s’", destination.String(), local.Network.String(), local.Interface))
+			}
+		}
+		for _, other := range others {
+			otherRoutes, _, _ := planRoutes(other)
+			for _, route := range routes {
+				destination := routeCidr(route)
+				for _, otherRoute := range otherRoutes {
+					otherDestination := routeCidr(otherRoute)
+					if destination.Overlaps(&otherDestination) {
+						problem(conf.DiagnosticWarning, l18n.Sprintf("Route %s overlaps with route %s of the active tunnel ‘%s’", destination.String(), otherDestination.String(), other.Name))
+					}
+				}
+			}
+		}
+	}
+
+	dns := planDNS(config)
+	report.DNSServers = dns.InterfaceServers
+	report.DNSSearch = dns.SearchDomains
+	for _, rule := range dns.PolicyRules {
+		report.DNSNamespaces = append(report.DNSNamespaces, rule.Namespaces...)
+		report.DNSMatchServers = append(report.DNSMatchServers, rule.Servers...)
+	}
+	if usesEncryptedDNS(config) {
+		report.DNSForwardedTo = config.Interface.DNS
+	}
+
+	report.Firewall = planFirewall(config)
+	return report
+}
+
+// planFirewall determines the mode that enableFirewall puts the firewall in.
+func planFirewall(config *conf.Config) conf.FirewallMode {
+	switch {
+	case !blocksUntunneledTraffic(config):
+		return conf.FirewallUnrestricted
+	case usesSplitDNS(config):
+		return conf.FirewallBlockExceptDNS
+	case len(dnsServers(config)) > 0:
+		return conf.FirewallBlockExceptTunnelDNS
+	default:
+		return conf.FirewallBlock
+	}
+}
+
+func routeCidr(route *winipcfg.RouteData) conf.IPCidr {
+	ones, _ := route.Destination.Mask.Size()
+	return conf.IPCidr{IP: route.Destination.IP, Cidr: uint8(ones)}
+}
+
+// listenUDP checks that a UDP port is free for both families, as the device listens on both.
+func listenUDP(port uint16) error {
+	for _, network := range []string{"udp4", "udp6"} {
+		conn, err := net.ListenUDP(network, &net.UDPAddr{Port: int(port)})
+		if err != nil {
+			return err
+		}
+		conn.Close()
+	}
+	return nil
+}
+
+func interfaceNetworks(skip map[string]bool) ([]localNetwork, error) {
+	interfaces, err := winipcfg.GetAdaptersAddresses(windows.AF_UNSPEC, winipcfg.GAAFlagDefault)
+	if err != nil {
+		return nil, err
+	}
+	var networks []localNetwork
+	for _, iface := range interfaces {
+		if iface.OperStatus != winipcfg.IfOperStatusUp || iface.IfType == winipcfg.IfTypeSoftwareLoopback || skip[iface.FriendlyName()] {
+			continue
+		}
+		for address := iface.FirstUnicastAddress; address != nil; address = address.Next {
+			network := conf.IPCidr{IP: address.Address.IP(), Cidr: address.OnLinkPrefixLength}
+			if ip4 := network.IP.To4(); ip4 != nil {
+				network.IP = ip4
+			}
+			network.MaskSelf()
+			networks = append(networks, localNetwork{iface.FriendlyName(), network})
+		}
+	}
+	return networks, nil
+}
@@ -0,0 +1,144 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package tunnel
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.zx2c4.com/wireguard/windows/conf"
+)
+
+const preflightInput = `[Interface]
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+Address = 10.0.0.2/32
+ListenPort = 51820
+DNS = 10.0.0.1
+DNSMatch = corp.example
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+Endpoint = vpn.example.com:51820, backup.example.com:51820
+PersistentKeepalive = 25
+AllowedIPs = 10.0.0.0/24, 192.168.1.128/25
+
+[Peer]
+PublicKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+Endpoint = 192.0.2.1:51820
+AllowedIPs = 172.16.0.0/16
+`
+
+const preflightActiveInput = `[Interface]
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+Address = 172.16.5.2/32
+ListenPort = 51821
+
+[Peer]
+PublicKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+Endpoint = 192.0.2.1:51820
+AllowedIPs = 172.16.5.0/24
+`
+
+func TestPreflight(t *testing.T) {
+	var listened []uint16
+	var skipped map[string]bool
+	p := preflight{
+		resolve: func(host string) (string, error) {
+			if host == "backup.example.com" {
+				return "", errors.New("no such host")
+			}
+			return "198.51.100.1", nil
+		},
+		listen: func(port uint16) error {
+			listened = append(listened, port)
+			return nil
+		},
+		localNetworks: func(skip map[string]bool) ([]localNetwork, error) {
+			skipped = skip
+			return []localNetwork{
+				{"Ethernet", conf.IPCidr{IP: []byte{192, 168, 0, 0}, Cidr: 16}},
+				{"Wi-Fi", conf.IPCidr{IP: []byte{172, 16, 9, 0}, Cidr: 24}},
+			}, nil
+		},
+	}
+	active, err := conf.FromWgQuick(preflightActiveInput, "office")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := p.run(preflightInput, "test", []*conf.Config{active})
+	if len(report.Diagnostics) != 0 || report.HasErrors() {
+		t.Errorf("Unexpected errors: %+v", report)
+	}
+	if !skipped["test"] || !skipped["office"] {
+		t.Errorf("The interfaces of the tunnels were not skipped: %v", skipped)
+	}
+	if len(listened) != 1 || listened[0] != 51820 {
+		t.Errorf("Wrong ports checked: %v", listened)
+	}
+	if len(report.Endpoints) != 3 || report.Endpoints[0].Resolved != "198.51.100.1" || len(report.Endpoints[1].Resolved) != 0 || report.Endpoints[2].Resolved != "192.0.2.1" {
+		t.Errorf("Wrong endpoints: %+v", report.Endpoints)
+	}
+	var routes []string
+	for i := range report.Routes {
+		routes = append(routes, report.Routes[i].String())
+	}
+	if strings.Join(routes, " ") != "10.0.0.0/24 172.16.0.0/16 192.168.1.128/25" {
+		t.Errorf("Wrong routes: %v", routes)
+	}
+	expected := []string{
+		"Unable to resolve endpoint backup.example.com:51820",
+		"Route 192.168.1.128/25 would take over addresses of the local network 192.168.0.0/16 on ‘Ethernet’",
+		"Route 172.16.0.0/16 overlaps with route 172.16.5.0/24 of the active tunnel ‘office’",
+	}
+	var messages []string
+	for i := range report.Problems {
+		messages = append(messages, report.Problems[i].Message)
+		if report.Problems[i].Severity != conf.DiagnosticWarning {
+			t.Errorf("Problem is not a warning: %s", report.Problems[i].Message)
+		}
+	}
+	if len(messages) != len(expected) {
+		t.Fatalf("Wrong problems: %q", messages)
+	}
+	for i := range expected {
+		if !strings.HasPrefix(messages[i], expected[i]) {
+			t.Errorf("Wrong problem:\nactual   %q\nexpected %q", messages[i], expected[i])
+		}
+	}
+	if len(report.DNSServers) != 0 || strings.Join(report.DNSNamespaces, " ") != "corp.example .corp.example" || len(report.DNSMatchServers) != 1 {
+		t.Errorf("Wrong DNS: %+v", report)
+	}
+	if report.Firewall != conf.FirewallUnrestricted {
+		t.Errorf("Wrong firewall mode: %d", report.Firewall)
+	}
+
+	active.Interface.ListenPort = 51820
+	listened = nil
+	report = p.run(preflightInput, "test", []*conf.Config{active})
+	if !report.HasErrors() || len(listened) != 0 {
+		t.Errorf("A port in use by an active tunnel was not reported: %+v", report.Problems)
+	}
+	active.Name = "test"
+	report = p.run(preflightInput, "test", []*conf.Config{active})
+	if report.HasErrors() || len(listened) != 0 || len(report.Problems) != 2 {
+		t.Errorf("The tunnel being replaced was checked against: %+v", report.Problems)
+	}
+
+	full := strings.Replace(preflightActiveInput, "AllowedIPs = 172.16.5.0/24", "AllowedIPs = 0.0.0.0/0", 1)
+	full = strings.Replace(full, "ListenPort = 51821", "ListenPort = 51821\nDNS = 172.16.5.1", 1)
+	report = p.run(full, "full", nil)
+	if report.Firewall != conf.FirewallBlockExceptTunnelDNS || len(report.Problems) != 0 {
+		t.Errorf("Wrong firewall mode %d or problems %+v", report.Firewall, report.Problems)
+	}
+
+	listened = nil
+	report = p.run("[Interface]\nPrivateKey = nope\n", "broken", nil)
+	if !report.HasErrors() || len(report.Routes) != 0 || len(listened) != 0 {
+		t.Errorf("An invalid configuration was checked further: %+v", report)
+	}
+}
@@ -0,0 +1,83 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package tunnel
+
+import (
+	"errors"
+	"net"
+
+	"golang.zx2c4.com/wireguard/windows/conf"
+)
+
+var errReloadRequiresRestart = errors.New("The changed configuration cannot be applied without restarting the tunnel")
+
+// blocksUntunneledTraffic reports whether the firewall should block traffic outside of the tunnel,
+// which is the case when a single peer takes all traffic.
+func blocksUntunneledTraffic(conf *conf.Config) bool {
+	if len(conf.Peers) != 1 || conf.Interface.TableOff {
+		return false
+	}
+nextallowedip:
+	for _, allowedip := range conf.Peers[0].EffectiveAllowedIPs() {
+		if allowedip.Cidr == 0 {
+			for _, b := range allowedip.IP {
+				if b != 0 {
+					continue nextallowedip
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+func sameIPs(a, b []net.IP) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// reloadRequiresRestart reports whether moving a running tunnel from running to stored cannot be done
+// in place. Peers, keys, addresses, routes, DNS servers and match domains, and the MTU can all be
+// changed on the fly, but PreUp and PostUp only run when the tunnel comes up, hooks may depend on the
+// identity of the interface, and the firewall rules are only installed at startup.
+func reloadRequiresRestart(running, stored *conf.Config) bool {
+	if running.Interface.PreUp != stored.Interface.PreUp || running.Interface.PostUp != stored.Interface.PostUp {
+		return true
+	}
+	if running.Interface.PrivateKey != stored.Interface.PrivateKey {
+		for _, iface := range []*conf.Interface{&running.Interface, &stored.Interface} {
+			if len(iface.PreUp) > 0 || len(iface.PostUp) > 0 || len(iface.PreDown) > 0 || len(iface.PostDown) > 0 {
+				return true
+			}
+		}
+	}
+	if running.Interface.DoHTemplate != stored.Interface.DoHTemplate || running.Interface.DoTName != stored.Interface.DoTName {
+		return true
+	}
+	if usesEncryptedDNS(running) && !sameIPs(running.Interface.DNS, stored.Interface.DNS) {
+		return true
+	}
+	blocks := blocksUntunneledTraffic(running)
+	if blocks != blocksUntunneledTraffic(stored) {
+		return true
+	}
+	if blocks {
+		if usesSplitDNS(running) != usesSplitDNS(stored) {
+			return true
+		}
+		if !sameIPs(running.Interface.DNS, stored.Interface.DNS) {
+			return true
+		}
+	}
+	return false
+}
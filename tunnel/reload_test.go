@@ -0,0 +1,68 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package tunnel
+
+import (
+	"strings"
+	"testing"
+
+	"golang.zx2c4.com/wireguard/windows/conf"
+)
+
+const reloadInput = `[Interface]
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+Address = 10.192.122.1/24
+DNS = 10.192.122.53
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 0.0.0.0/0
+`
+
+func TestReloadRequiresRestart(t *testing.T) {
+	running, err := conf.FromWgQuick(reloadInput, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		from    string
+		to      string
+		restart bool
+	}{
+		{"address", "Address = 10.192.122.1/24", "Address = 10.192.123.1/24", false},
+		{"private key", "PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=", "PrivateKey = 4Jg6EuHXqjVlh1z8TSWxV7ks6GCGl+S8xKr0ncMUAko=", false},
+		{"private key with hooks", "PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=", "PrivateKey = 4Jg6EuHXqjVlh1z8TSWxV7ks6GCGl+S8xKr0ncMUAko=\nPostDown = echo down", true},
+		{"post-down", "DNS = 10.192.122.53", "DNS = 10.192.122.53\nPostDown = echo down", false},
+		{"post-up", "DNS = 10.192.122.53", "DNS = 10.192.122.53\nPostUp = echo up", true},
+		{"dns while blocking", "DNS = 10.192.122.53", "DNS = 10.192.122.54", true},
+		{"dns match while blocking", "DNS = 10.192.122.53", "DNS = 10.192.122.53\nDNSMatch = corp.example", true},
+		{"dns over tls", "DNS = 10.192.122.53", "DNS = 10.192.122.53\nDNSOverTLS = dns.example", true},
+		{"firewall", "AllowedIPs = 0.0.0.0/0", "AllowedIPs = 0.0.0.0/1, 128.0.0.0/1", true},
+		{"table off", "DNS = 10.192.122.53\n", "DNS = 10.192.122.53\nTable = off\n", true},
+	}
+	for _, test := range tests {
+		stored, err := conf.FromWgQuick(strings.Replace(reloadInput, test.from, test.to, 1), "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if restart := reloadRequiresRestart(running, stored); restart != test.restart {
+			t.Errorf("%s: restart = %v, want %v", test.name, restart, test.restart)
+		}
+	}
+
+	unblocked, err := conf.FromWgQuick(strings.Replace(reloadInput, "0.0.0.0/0", "10.0.0.0/8", 1), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := conf.FromWgQuick(strings.Replace(unblocked.ToWgQuick(), "10.192.122.53", "10.192.122.54", 1), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloadRequiresRestart(unblocked, stored) {
+		t.Error("Changing DNS servers without a blocking firewall should not require a restart")
+	}
+}
@@ -0,0 +1,29 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package tunnel
+
+import (
+	"strings"
+
+	"golang.zx2c4.com/wireguard/windows/conf"
+)
+
+// saveRuntimeConfig writes the peers of the running device back into the stored configuration, for
+// configurations with SaveConfig set. It refuses to do so if the stored configuration was edited since
+// the tunnel was started, in which case conf.ErrConfigModified is returned and the edit wins. It must
+// only be used for tunnels that were loaded from the store, as the stored configuration is the one
+// with the name of the tunnel.
+func saveRuntimeConfig(device endpointDevice, config *conf.Config) error {
+	uapi, err := device.IpcGet()
+	if err != nil {
+		return err
+	}
+	runtime, err := conf.FromUAPI(strings.NewReader(uapi+"\n"), config)
+	if err != nil {
+		return err
+	}
+	return config.WithRuntimeState(runtime).SaveIfUnmodified(config.Document.String())
+}
@@ -26,6 +26,7 @@ import (
 	"golang.zx2c4.com/wireguard/windows/elevate"
 	"golang.zx2c4.com/wireguard/windows/ringlogger"
 	"golang.zx2c4.com/wireguard/windows/services"
+	"golang.zx2c4.com/wireguard/windows/tunnel/dnsforwarder"
 	"golang.zx2c4.com/wireguard/windows/version"
 )
 
@@ -39,6 +40,10 @@ func (service *tunnelService) Execute(args []string, r <-chan svc.ChangeRequest,
 	var dev *device.Device
 	var uapi net.Listener
 	var watcher *interfaceWatcher
+	var resolver *endpointResolver
+	var failover *endpointFailover
+	var health *healthMonitor
+	var forwarder *dnsforwarder.Forwarder
 	var nativeTun *tun.NativeTun
 	var config *conf.Config
 	var err error
@@ -87,12 +92,36 @@ func (service *tunnelService) Execute(args []string, r <-chan svc.ChangeRequest,
 		if logErr == nil && dev != nil && config != nil {
 			logErr = runScriptCommand(config.Interface.PreDown, config.Name)
 		}
+		if resolver != nil {
+			resolver.Stop()
+		}
+		if failover != nil {
+			failover.Stop()
+		}
+		if health != nil {
+			health.Stop()
+		}
 		if watcher != nil {
 			watcher.Destroy()
 		}
+		if forwarder != nil {
+			forwarder.Close()
+		}
 		if uapi != nil {
 			uapi.Close()
 		}
+		if dev != nil && config != nil && config.Interface.SaveConfig && config.Document != nil {
+			// The runtime state is written back into the stored configuration, which a tunnel started
+			// from a file elsewhere does not have, even if a stored one shares its name.
+			if !conf.IsStoredPath(service.Path) {
+				log.Println("Not saving runtime configuration, as it was not loaded from the configuration store")
+			} else {
+				log.Println("Saving runtime configuration")
+				if saveErr := saveRuntimeConfig(dev, config); saveErr != nil {
+					log.Printf("Unable to save runtime configuration: %v", saveErr)
+				}
+			}
+		}
 		if dev != nil {
 			dev.Close()
 		}
@@ -214,16 +243,33 @@ func (service *tunnelService) Execute(args []string, r <-chan svc.ChangeRequest,
 	log.Println("Bringing peers up")
 	dev.Up()
 
-	watcher.Configure(bind.(conn.BindSocketToInterface), config, nativeTun)
+	if usesEncryptedDNS(config) {
+		log.Println("Starting DNS forwarder")
+		forwarder, err = startDNSForwarder(config)
+		if err != nil {
+			serviceError = services.ErrorSetNetConfig
+			return
+		}
+	}
+
+	health = newHealthMonitor(wireguardHealthDevice{dev}, config, conf.ResolveHostnameOnce)
+	watcher.Configure(bind.(conn.BindSocketToInterface), config, nativeTun, health.NetworkChanged)
+
+	resolver = newEndpointResolver(dev, config, conf.ResolveHostnameOnce)
+	resolver.Start(endpointCheckInterval)
+	failover = newEndpointFailover(dev, config, conf.ResolveHostnameOnce)
+	failover.Start(endpointCheckInterval)
+	health.Start(healthCheckInterval)
 
 	log.Println("Listening for UAPI requests")
+	reloads := make(chan chan error)
 	go func() {
 		for {
 			conn, err := uapi.Accept()
 			if err != nil {
 				continue
 			}
-			go dev.IpcHandle(conn)
+			go handleUAPI(conn, dev, reloads, health)
 		}
 	}()
 
@@ -247,6 +293,22 @@ func (service *tunnelService) Execute(args []string, r <-chan svc.ChangeRequest,
 			default:
 				log.Printf("Unexpected service control request #%d\n", c)
 			}
+		case result := <-reloads:
+			log.Println("Reloading configuration")
+			reloaded, reloadErr := reloadConfig(service.Path, config, dev, watcher)
+			if reloadErr == nil {
+				resolver.Stop()
+				resolver = newEndpointResolver(dev, reloaded, conf.ResolveHostnameOnce)
+				resolver.Start(endpointCheckInterval)
+				failover.Stop()
+				failover = newEndpointFailover(dev, reloaded, conf.ResolveHostnameOnce)
+				failover.Start(endpointCheckInterval)
+				health.Reconfigure(reloaded)
+				config = reloaded
+			} else {
+				log.Printf("Unable to reload configuration: %v", reloadErr)
+			}
+			result <- reloadErr
 		case <-dev.Wait():
 			return
 		case e := <-watcher.errors:
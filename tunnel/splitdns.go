@@ -0,0 +1,125 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package tunnel
+
+import (
+	"net"
+	"reflect"
+	"strings"
+
+	"golang.org/x/sys/windows"
+
+	"golang.zx2c4.com/wireguard/windows/conf"
+	"golang.zx2c4.com/wireguard/windows/tunnel/nrpt"
+	"golang.zx2c4.com/wireguard/windows/tunnel/winipcfg"
+)
+
+// dnsPlan is how the DNS settings of a configuration are applied. The interface servers are used for
+// every name, while the policy rules only take over the names that they match.
+type dnsPlan struct {
+	InterfaceServers []net.IP
+	SearchDomains    []string
+	PolicyRules      []nrpt.Rule
+}
+
+// planDNS determines how the DNS settings of a configuration are applied. Without DNSMatch, the
+// servers, or the DNS forwarder if they are queried over HTTPS or TLS, are set on the interface, as
+// usual. With it, they are only used for the match domains, through a policy rule, and every other
+// name is resolved by the servers of the other interfaces.
+func planDNS(conf *conf.Config) dnsPlan {
+	plan := dnsPlan{SearchDomains: conf.Interface.DNSSearch}
+	servers := dnsServers(conf)
+	if len(conf.Interface.DNSMatch) == 0 {
+		plan.InterfaceServers = servers
+		return plan
+	}
+	if len(servers) == 0 {
+		return plan
+	}
+	var namespaces []string
+	seen := make(map[string]bool, len(conf.Interface.DNSMatch)*2)
+	add := func(namespace string) {
+		if !seen[namespace] {
+			seen[namespace] = true
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	for _, domain := range conf.Interface.DNSMatch {
+		if strings.HasPrefix(domain, "*.") {
+			add(domain[1:])
+		} else {
+			add(domain)
+			add("." + domain)
+		}
+	}
+	plan.PolicyRules = []nrpt.Rule{{namespaces, servers}}
+	return plan
+}
+
+// usesSplitDNS reports whether the DNS servers of a configuration are only used for its match domains,
+// in which case queries for other names go to the servers of other interfaces.
+func usesSplitDNS(conf *conf.Config) bool {
+	return len(conf.Interface.DNSMatch) > 0 && len(conf.Interface.DNS) > 0
+}
+
+// dnsBackend is where a dnsPlan is applied, which is the interface and the registry, except in tests.
+type dnsBackend interface {
+	SetInterfaceDNS(family winipcfg.AddressFamily, servers []net.IP, domains []string) error
+	// SetPolicyRules replaces the policy rules that belong to owner.
+	SetPolicyRules(owner string, rules []nrpt.Rule) error
+}
+
+// applyInterfaceDNS configures the DNS servers and search domains of the interface for one family.
+func applyInterfaceDNS(backend dnsBackend, family winipcfg.AddressFamily, conf *conf.Config) error {
+	plan := planDNS(conf)
+	return backend.SetInterfaceDNS(family, plan.InterfaceServers, plan.SearchDomains)
+}
+
+// dnsPolicy keeps track of the policy rules of a tunnel. Unlike the interface settings, they belong to
+// no family, so they are applied once the families are configured rather than along with each, and
+// only when they change, as that flushes the resolver cache.
+type dnsPolicy struct {
+	applied bool
+	rules   []nrpt.Rule
+}
+
+// apply replaces the policy rules of the tunnel with those of conf, removing them if there are none
+// anymore, once configured reports that the families of all their servers are configured.
+func (policy *dnsPolicy) apply(backend dnsBackend, conf *conf.Config, configured func(family winipcfg.AddressFamily) bool) error {
+	rules := planDNS(conf).PolicyRules
+	for _, rule := range rules {
+		for _, server := range rule.Servers {
+			family := winipcfg.AddressFamily(windows.AF_INET6)
+			if server.To4() != nil {
+				family = windows.AF_INET
+			}
+			if !configured(family) {
+				return nil
+			}
+		}
+	}
+	if policy.applied && reflect.DeepEqual(rules, policy.rules) {
+		return nil
+	}
+	err := backend.SetPolicyRules(conf.Name, rules)
+	if err != nil {
+		return err
+	}
+	policy.applied, policy.rules = true, rules
+	return nil
+}
+
+type systemDNSBackend struct {
+	luid winipcfg.LUID
+}
+
+func (backend systemDNSBackend) SetInterfaceDNS(family winipcfg.AddressFamily, servers []net.IP, domains []string) error {
+	return backend.luid.SetDNS(family, servers, domains)
+}
+
+func (systemDNSBackend) SetPolicyRules(owner string, rules []nrpt.Rule) error {
+	return nrpt.SetRules(owner, rules)
+}
@@ -0,0 +1,147 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package tunnel
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"golang.org/x/sys/windows"
+
+	"golang.zx2c4.com/wireguard/windows/conf"
+	"golang.zx2c4.com/wireguard/windows/tunnel/nrpt"
+	"golang.zx2c4.com/wireguard/windows/tunnel/winipcfg"
+)
+
+type fakeDNSBackend struct {
+	servers     map[winipcfg.AddressFamily][]net.IP
+	domains     []string
+	rules       map[string][]nrpt.Rule
+	ruleChanges int
+}
+
+func (backend *fakeDNSBackend) SetInterfaceDNS(family winipcfg.AddressFamily, servers []net.IP, domains []string) error {
+	backend.servers[family] = servers
+	backend.domains = domains
+	return nil
+}
+
+func (backend *fakeDNSBackend) SetPolicyRules(owner string, rules []nrpt.Rule) error {
+	if len(rules) == 0 {
+		delete(backend.rules, owner)
+	} else {
+		backend.rules[owner] = rules
+	}
+	backend.ruleChanges++
+	return nil
+}
+
+// splitDNSConfig parses a configuration with DNS servers, which only serve the match domains in
+// dnsMatch, if any.
+func splitDNSConfig(t *testing.T, dnsMatch string) *conf.Config {
+	input := "[Interface]\nPrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=\nAddress = 10.192.122.1/24\nDNS = 10.192.122.53, corp.example\n"
+	if len(dnsMatch) > 0 {
+		input += "DNSMatch = " + dnsMatch + "\n"
+	}
+	input += "\n[Peer]\nPublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=\nAllowedIPs = 0.0.0.0/0\n"
+	config, err := conf.FromWgQuick(input, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+func TestPlanDNS(t *testing.T) {
+	config := splitDNSConfig(t, "")
+	plan := planDNS(config)
+	if len(plan.InterfaceServers) != 1 || len(plan.PolicyRules) != 0 || usesSplitDNS(config) {
+		t.Errorf("Without match domains, the servers should be set on the interface: %+v", plan)
+	}
+
+	config = splitDNSConfig(t, "corp.example, *.lab.example, CORP.example.")
+	plan = planDNS(config)
+	if len(plan.InterfaceServers) != 0 || !usesSplitDNS(config) {
+		t.Errorf("With match domains, no servers should be set on the interface: %+v", plan)
+	}
+	if !reflect.DeepEqual(plan.SearchDomains, []string{"corp.example"}) {
+		t.Errorf("Unexpected search domains: %v", plan.SearchDomains)
+	}
+	if len(plan.PolicyRules) != 1 {
+		t.Fatalf("Expected 1 policy rule, but got %d", len(plan.PolicyRules))
+	}
+	if !reflect.DeepEqual(plan.PolicyRules[0].Namespaces, []string{"corp.example", ".corp.example", ".lab.example"}) {
+		t.Errorf("Unexpected namespaces: %v", plan.PolicyRules[0].Namespaces)
+	}
+	if len(plan.PolicyRules[0].Servers) != 1 || !plan.PolicyRules[0].Servers[0].Equal(net.IPv4(10, 192, 122, 53)) {
+		t.Errorf("Unexpected servers: %v", plan.PolicyRules[0].Servers)
+	}
+
+	config.Interface.DoTName = "dns.corp.example"
+	plan = planDNS(config)
+	if len(plan.PolicyRules) != 1 || len(plan.PolicyRules[0].Servers) != 1 || !plan.PolicyRules[0].Servers[0].Equal(dnsForwarderAddress("test")) {
+		t.Errorf("With DNS over TLS, queries should go to the forwarder: %+v", plan)
+	}
+	config.Interface.DoTName = ""
+
+	config.Interface.DNS = nil
+	plan = planDNS(config)
+	if len(plan.InterfaceServers) != 0 || len(plan.PolicyRules) != 0 || usesSplitDNS(config) {
+		t.Errorf("Without servers, match domains should have no effect: %+v", plan)
+	}
+}
+
+func TestApplyDNS(t *testing.T) {
+	backend := &fakeDNSBackend{servers: make(map[winipcfg.AddressFamily][]net.IP), rules: make(map[string][]nrpt.Rule)}
+	config := splitDNSConfig(t, "corp.example")
+	configured := make(map[winipcfg.AddressFamily]bool)
+	isConfigured := func(family winipcfg.AddressFamily) bool {
+		return configured[family]
+	}
+	var policy dnsPolicy
+	err := policy.apply(backend, config, isConfigured)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backend.ruleChanges != 0 {
+		t.Errorf("The policy rule was applied before the family of its server was configured")
+	}
+	for _, family := range []winipcfg.AddressFamily{windows.AF_INET, windows.AF_INET6} {
+		err = applyInterfaceDNS(backend, family, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		configured[family] = true
+	}
+	if len(backend.servers[windows.AF_INET]) != 0 || len(backend.servers[windows.AF_INET6]) != 0 {
+		t.Errorf("Servers were set on the interface: %v", backend.servers)
+	}
+	for i := 0; i < 2; i++ {
+		err = policy.apply(backend, config, isConfigured)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(backend.rules["test"]) != 1 || backend.ruleChanges != 1 {
+		t.Errorf("Expected the policy rule to be applied once, but got %v after %d changes", backend.rules, backend.ruleChanges)
+	}
+
+	config = splitDNSConfig(t, "")
+	err = applyInterfaceDNS(backend, windows.AF_INET, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backend.servers[windows.AF_INET]) != 1 {
+		t.Errorf("Servers were not set on the interface: %v", backend.servers)
+	}
+	err = policy.apply(backend, config, isConfigured)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backend.rules) != 0 {
+		t.Errorf("The policy rules were not removed: %v", backend.rules)
+	}
+}
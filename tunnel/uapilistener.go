@@ -0,0 +1,148 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package tunnel
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+
+	"golang.zx2c4.com/wireguard/device"
+
+	"golang.zx2c4.com/wireguard/windows/conf"
+)
+
+// reloadOperation asks, as the first line on a connection to the UAPI pipe of the tunnel, for the
+// stored configuration to be applied to the running tunnel. It is answered in the style of UAPI: with
+// errno=0 if the configuration was applied, with restart=true and errno=0 if the tunnel needs to be
+// restarted for it, and with an error line and a non-zero errno if applying it failed.
+const reloadOperation = "reload=1\n"
+
+// healthOperation asks, as the first line on a connection to the UAPI pipe of the tunnel, for the health
+// of its peers. It is answered in the style of UAPI, with a public_key line for each peer followed by
+// its health and latest handshake, and errno=0, and answered again each time the health of a peer
+// changes, until the connection is closed.
+const healthOperation = "health=1\n"
+
+type replayedConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+func (c *replayedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// handleUAPI serves a connection to the UAPI pipe, answering reload and health operations itself and
+// passing anything else on to the device.
+func handleUAPI(conn net.Conn, dev *device.Device, reloads chan<- chan error, health *healthMonitor) {
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return
+	}
+	if line != reloadOperation && line != healthOperation {
+		dev.IpcHandle(&replayedConn{conn, io.MultiReader(strings.NewReader(line), reader)})
+		return
+	}
+	defer conn.Close()
+	operation := line
+	for line != "\n" {
+		line, err = reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+	}
+	if operation == healthOperation {
+		serveHealth(conn, reader, dev, health)
+		return
+	}
+	result := make(chan error, 1)
+	select {
+	case reloads <- result:
+	case <-dev.Wait():
+		return
+	}
+	err = <-result
+	switch {
+	case err == nil:
+		io.WriteString(conn, "errno=0\n\n")
+	case err == errReloadRequiresRestart:
+		io.WriteString(conn, "restart=true\nerrno=0\n\n")
+	default:
+		io.WriteString(conn, "error="+strings.ReplaceAll(err.Error(), "\n", " ")+"\nerrno=1\n\n")
+	}
+}
+
+// serveHealth writes the health of the peers to conn, and again each time it changes, until either the
+// connection or the device is closed.
+func serveHealth(conn net.Conn, reader *bufio.Reader, dev *device.Device, health *healthMonitor) {
+	closed := make(chan struct{})
+	go func() {
+		reader.WriteTo(ioutil.Discard)
+		close(closed)
+	}()
+	for {
+		reports, changed := health.Health()
+		var answer strings.Builder
+		for _, report := range reports {
+			handshake := time.Duration(report.LastHandshakeTime)
+			answer.WriteString(fmt.Sprintf("public_key=%s\nhealth=%s\nlast_handshake_time_sec=%d\nlast_handshake_time_nsec=%d\n",
+				report.PublicKey.HexString(), report.State.String(), handshake/time.Second, handshake%time.Second))
+		}
+		answer.WriteString("errno=0\n\n")
+		_, err := io.WriteString(conn, answer.String())
+		if err != nil {
+			return
+		}
+		select {
+		case <-changed:
+		case <-closed:
+			return
+		case <-dev.Wait():
+			return
+		}
+	}
+}
+
+// reloadConfig applies the configuration stored at path to a tunnel that is running with the
+// configuration running, and returns the configuration it is running with afterwards. The peers are
+// diffed against what the device has, which may have changed since the tunnel started.
+func reloadConfig(path string, running *conf.Config, dev *device.Device, watcher *interfaceWatcher) (*conf.Config, error) {
+	stored, err := conf.LoadFromPath(path)
+	if err != nil {
+		return nil, err
+	}
+	stored.DeduplicateNetworkEntries()
+	if reloadRequiresRestart(running, stored) {
+		return nil, errReloadRequiresRestart
+	}
+	uapi, err := dev.IpcGet()
+	if err != nil {
+		return nil, err
+	}
+	runtime, err := conf.FromUAPI(strings.NewReader(uapi+"\n"), running)
+	if err != nil {
+		return nil, err
+	}
+	uapiConf, err := stored.ToUAPIDiff(running, runtime)
+	if err != nil {
+		return nil, err
+	}
+	if len(uapiConf) > 0 {
+		err = dev.IpcSet(uapiConf)
+		if err != nil {
+			return nil, err
+		}
+	}
+	watcher.Reconfigure(stored)
+	return stored, nil
+}
@@ -50,6 +50,8 @@ type interfaceView struct {
 	mtu          *labelTextLine
 	addresses    *labelTextLine
 	dns          *labelTextLine
+	dnsMatch     *labelTextLine
+	dnsEncrypted *labelTextLine
 	scripts      *labelTextLine
 	toggleActive *toggleActiveLine
 	lines        []widgetsLine
@@ -306,6 +308,8 @@ func newInterfaceView(parent walk.Container) (*interfaceView, error) {
 		{l18n.Sprintf("MTU:"), &iv.mtu},
 		{l18n.Sprintf("Addresses:"), &iv.addresses},
 		{l18n.Sprintf("DNS servers:"), &iv.dns},
+		{l18n.Sprintf("DNS match domains:"), &iv.dnsMatch},
+		{l18n.Sprintf("DNS encryption:"), &iv.dnsEncrypted},
 		{l18n.Sprintf("Scripts:"), &iv.scripts},
 	}
 	if iv.lines, err = createLabelTextLines(items, parent, &disposables); err != nil {
@@ -378,8 +382,17 @@ func (iv *interfaceView) apply(c *conf.Interface) {
 		iv.listenPort.hide()
 	}
 
-	if c.MTU > 0 {
-		iv.mtu.show(strconv.Itoa(int(c.MTU)))
+	if mtu4, mtu6 := c.EffectiveMTU(false), c.EffectiveMTU(true); mtu4 != mtu6 {
+		mtus := make([]string, 0, 2)
+		if mtu4 > 0 {
+			mtus = append(mtus, l18n.Sprintf("%d (IPv4)", mtu4))
+		}
+		if mtu6 > 0 {
+			mtus = append(mtus, l18n.Sprintf("%d (IPv6)", mtu6))
+		}
+		iv.mtu.show(strings.Join(mtus, l18n.EnumerationSeparator()))
+	} else if mtu4 > 0 {
+		iv.mtu.show(strconv.Itoa(int(mtu4)))
 	} else {
 		iv.mtu.hide()
 	}
@@ -405,6 +418,20 @@ func (iv *interfaceView) apply(c *conf.Interface) {
 		iv.dns.hide()
 	}
 
+	if len(c.DNSMatch) > 0 {
+		iv.dnsMatch.show(strings.Join(c.DNSMatch, l18n.EnumerationSeparator()))
+	} else {
+		iv.dnsMatch.hide()
+	}
+
+	if len(c.DoHTemplate) > 0 {
+		iv.dnsEncrypted.show(l18n.Sprintf("HTTPS (%s)", c.DoHTemplate))
+	} else if len(c.DoTName) > 0 {
+		iv.dnsEncrypted.show(l18n.Sprintf("TLS (%s)", c.DoTName))
+	} else {
+		iv.dnsEncrypted.hide()
+	}
+
 	var scriptsInUse []string
 	if len(c.PreUp) > 0 {
 		scriptsInUse = append(scriptsInUse, l18n.Sprintf("pre-up"))
@@ -646,7 +673,7 @@ func (cv *ConfView) setTunnel(tunnel *manager.Tunnel, config *conf.Config, state
 		return
 	}
 
-	title := l18n.Sprintf("Interface: %s", config.Name)
+	title := l18n.Sprintf("Interface: %s", config.Title())
 	if cv.name.Title() != title {
 		cv.SetSuspended(true)
 		defer cv.SetSuspended(false)
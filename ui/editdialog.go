@@ -22,7 +22,10 @@ type EditDialog struct {
 	*walk.Dialog
 	nameEdit                        *walk.LineEdit
 	pubkeyEdit                      *walk.LineEdit
+	tagsEdit                        *walk.LineEdit
+	folderEdit                      *walk.LineEdit
 	syntaxEdit                      *syntax.SyntaxEdit
+	diagnosticsEdit                 *walk.TextEdit
 	blockUntunneledTrafficCB        *walk.CheckBox
 	saveButton                      *walk.PushButton
 	config                          conf.Config
@@ -94,7 +97,7 @@ func newEditDialog(owner walk.Form, tunnel *manager.Tunnel) (*EditDialog, error)
 		return nil, err
 	}
 	layout.SetRange(dlg.nameEdit, walk.Rectangle{1, 0, 1, 1})
-	dlg.nameEdit.SetText(dlg.config.Name)
+	dlg.nameEdit.SetText(dlg.config.Title())
 
 	pubkeyLabel, err := walk.NewTextLabel(dlg)
 	if err != nil {
@@ -112,16 +115,54 @@ func newEditDialog(owner walk.Form, tunnel *manager.Tunnel) (*EditDialog, error)
 	dlg.pubkeyEdit.SetText(l18n.Sprintf("(unknown)"))
 	dlg.pubkeyEdit.Accessibility().SetRole(walk.AccRoleStatictext)
 
+	tagsLabel, err := walk.NewTextLabel(dlg)
+	if err != nil {
+		return nil, err
+	}
+	layout.SetRange(tagsLabel, walk.Rectangle{0, 2, 1, 1})
+	tagsLabel.SetTextAlignment(walk.AlignHFarVCenter)
+	tagsLabel.SetText(l18n.Sprintf("&Tags:"))
+
+	if dlg.tagsEdit, err = walk.NewLineEdit(dlg); err != nil {
+		return nil, err
+	}
+	layout.SetRange(dlg.tagsEdit, walk.Rectangle{1, 2, 1, 1})
+	dlg.tagsEdit.SetText(strings.Join(dlg.config.Metadata.Tags, ", "))
+	dlg.tagsEdit.SetToolTipText(l18n.Sprintf("Tags separated by commas, by which tunnels can be searched for and started together"))
+
+	folderLabel, err := walk.NewTextLabel(dlg)
+	if err != nil {
+		return nil, err
+	}
+	layout.SetRange(folderLabel, walk.Rectangle{0, 3, 1, 1})
+	folderLabel.SetTextAlignment(walk.AlignHFarVCenter)
+	folderLabel.SetText(l18n.Sprintf("&Folder:"))
+
+	if dlg.folderEdit, err = walk.NewLineEdit(dlg); err != nil {
+		return nil, err
+	}
+	layout.SetRange(dlg.folderEdit, walk.Rectangle{1, 3, 1, 1})
+	dlg.folderEdit.SetText(dlg.config.Metadata.Folder)
+	dlg.folderEdit.SetToolTipText(l18n.Sprintf("Folder in which the tunnel is listed, with subfolders separated by slashes"))
+
 	if dlg.syntaxEdit, err = syntax.NewSyntaxEdit(dlg); err != nil {
 		return nil, err
 	}
-	layout.SetRange(dlg.syntaxEdit, walk.Rectangle{0, 2, 2, 1})
+	layout.SetRange(dlg.syntaxEdit, walk.Rectangle{0, 4, 2, 1})
+
+	if dlg.diagnosticsEdit, err = walk.NewTextEditWithStyle(dlg, win.WS_VSCROLL); err != nil {
+		return nil, err
+	}
+	layout.SetRange(dlg.diagnosticsEdit, walk.Rectangle{0, 5, 2, 1})
+	dlg.diagnosticsEdit.SetReadOnly(true)
+	dlg.diagnosticsEdit.SetMinMaxSize(walk.Size{0, 60}, walk.Size{0, 60})
+	dlg.diagnosticsEdit.SetVisible(false)
 
 	buttonsContainer, err := walk.NewComposite(dlg)
 	if err != nil {
 		return nil, err
 	}
-	layout.SetRange(buttonsContainer, walk.Rectangle{0, 3, 2, 1})
+	layout.SetRange(buttonsContainer, walk.Rectangle{0, 6, 2, 1})
 	buttonsContainer.SetLayout(walk.NewHBoxLayout())
 	buttonsContainer.Layout().SetMargins(walk.Margins{})
 
@@ -135,6 +176,14 @@ func newEditDialog(owner walk.Form, tunnel *manager.Tunnel) (*EditDialog, error)
 
 	walk.NewHSpacer(buttonsContainer)
 
+	copyRemotePeerButton, err := walk.NewPushButton(buttonsContainer)
+	if err != nil {
+		return nil, err
+	}
+	copyRemotePeerButton.SetText(l18n.Sprintf("Copy &remote peer"))
+	copyRemotePeerButton.SetToolTipText(l18n.Sprintf("Copy the [Peer] section that the other side of the tunnel needs for this configuration to the clipboard"))
+	copyRemotePeerButton.Clicked().Attach(dlg.onCopyRemotePeerButtonClicked)
+
 	if dlg.saveButton, err = walk.NewPushButton(buttonsContainer); err != nil {
 		return nil, err
 	}
@@ -153,7 +202,9 @@ func newEditDialog(owner walk.Form, tunnel *manager.Tunnel) (*EditDialog, error)
 
 	dlg.syntaxEdit.PrivateKeyChanged().Attach(dlg.onSyntaxEditPrivateKeyChanged)
 	dlg.syntaxEdit.BlockUntunneledTrafficStateChanged().Attach(dlg.onBlockUntunneledTrafficStateChanged)
+	dlg.syntaxEdit.TextChanged().Attach(dlg.onSyntaxEditTextChanged)
 	dlg.syntaxEdit.SetText(dlg.config.ToWgQuick())
+	dlg.onSyntaxEditTextChanged()
 
 	// Insert a dummy label immediately preceding syntaxEdit to have screen readers read it.
 	// Otherwise they fallback to "RichEdit Control".
@@ -305,37 +356,104 @@ func (dlg *EditDialog) onSyntaxEditPrivateKeyChanged(privateKey string) {
 	}
 }
 
+// onSyntaxEditTextChanged lists the problems of the configuration below it as it is edited, which are
+// the errors that keep it from being saved, as well as the warnings and lint findings, which do not.
+func (dlg *EditDialog) onSyntaxEditTextChanged() {
+	cfg, diagnostics := conf.Validate(dlg.syntaxEdit.Text(), dlg.config.Name)
+	var messages []string
+	for i := range diagnostics {
+		messages = append(messages, diagnostics[i].Error())
+	}
+	if !conf.HasErrors(diagnostics) {
+		for _, finding := range conf.Lint(cfg) {
+			messages = append(messages, finding.String())
+		}
+	}
+	text := strings.Join(messages, "\r\n")
+	if text != dlg.diagnosticsEdit.Text() {
+		dlg.diagnosticsEdit.SetText(text)
+	}
+	dlg.diagnosticsEdit.SetVisible(len(messages) > 0)
+}
+
+func (dlg *EditDialog) onCopyRemotePeerButtonClicked() {
+	cfg, diagnostics := conf.Validate(dlg.syntaxEdit.Text(), dlg.config.Name)
+	if conf.HasErrors(diagnostics) {
+		messages := make([]string, len(diagnostics))
+		for i := range diagnostics {
+			messages[i] = diagnostics[i].Error()
+		}
+		showErrorCustom(dlg, l18n.Sprintf("Unable to copy remote peer"), strings.Join(messages, "\n"))
+		return
+	}
+	walk.Clipboard().SetText(cfg.CounterpartPeers(conf.Endpoint{}))
+}
+
 func (dlg *EditDialog) onSaveButtonClicked() {
-	newName := dlg.nameEdit.Text()
-	if newName == "" {
+	title := strings.TrimSpace(dlg.nameEdit.Text())
+	if title == "" {
 		showWarningCustom(dlg, l18n.Sprintf("Invalid name"), l18n.Sprintf("A name is required."))
 		return
 	}
-	if !conf.TunnelNameIsValid(newName) {
-		showWarningCustom(dlg, l18n.Sprintf("Invalid name"), l18n.Sprintf("Tunnel name ‘%s’ is invalid.", newName))
+
+	// The name field shows the display name of tunnels that have one. Left as it is, it keeps both
+	// the name and the display name. Set to a valid tunnel name, it renames the tunnel and drops any
+	// display name. Set to anything else, it becomes the display name, and a new tunnel gets a name
+	// derived from it.
+	newName := dlg.config.Name
+	displayName := dlg.config.Metadata.DisplayName
+	switch {
+	case len(dlg.config.Name) > 0 && title == dlg.config.Title():
+		// Unchanged.
+	case conf.TunnelNameIsValid(title):
+		newName, displayName = title, ""
+	case conf.DisplayNameIsValid(title):
+		displayName = title
+	default:
+		showWarningCustom(dlg, l18n.Sprintf("Invalid name"), l18n.Sprintf("Tunnel name ‘%s’ is invalid.", title))
+		return
+	}
+	tags, err := conf.ParseTags(dlg.tagsEdit.Text())
+	if err != nil {
+		showWarningCustom(dlg, l18n.Sprintf("Invalid tags"), err.Error())
+		return
+	}
+	folder, err := conf.ParseFolder(dlg.folderEdit.Text())
+	if err != nil {
+		showWarningCustom(dlg, l18n.Sprintf("Invalid folder"), err.Error())
 		return
 	}
-	newNameLower := strings.ToLower(newName)
 
-	if newNameLower != strings.ToLower(dlg.config.Name) {
+	if len(newName) == 0 || !strings.EqualFold(newName, dlg.config.Name) {
 		existingTunnelList, err := manager.IPCClientTunnels()
 		if err != nil {
 			showWarningCustom(dlg, l18n.Sprintf("Unable to list existing tunnels"), err.Error())
 			return
 		}
+		existingLowerTunnels := make(map[string]bool, len(existingTunnelList))
 		for _, tunnel := range existingTunnelList {
-			if strings.ToLower(tunnel.Name) == newNameLower {
-				showWarningCustom(dlg, l18n.Sprintf("Tunnel already exists"), l18n.Sprintf("Another tunnel already exists with the name ‘%s’.", newName))
-				return
-			}
+			existingLowerTunnels[strings.ToLower(tunnel.Name)] = true
+		}
+		if len(newName) == 0 {
+			newName = conf.TunnelNameFromDisplayName(displayName, func(name string) bool {
+				return existingLowerTunnels[strings.ToLower(name)]
+			})
+		} else if existingLowerTunnels[strings.ToLower(newName)] {
+			showWarningCustom(dlg, l18n.Sprintf("Tunnel already exists"), l18n.Sprintf("Another tunnel already exists with the name ‘%s’.", newName))
+			return
 		}
 	}
 
-	cfg, err := conf.FromWgQuick(dlg.syntaxEdit.Text(), newName)
-	if err != nil {
-		showErrorCustom(dlg, l18n.Sprintf("Unable to create new configuration"), err.Error())
+	cfg, diagnostics := conf.Validate(dlg.syntaxEdit.Text(), newName)
+	if conf.HasErrors(diagnostics) {
+		messages := make([]string, len(diagnostics))
+		for i := range diagnostics {
+			messages[i] = diagnostics[i].Error()
+		}
+		showErrorCustom(dlg, l18n.Sprintf("Unable to create new configuration"), strings.Join(messages, "\n"))
 		return
 	}
+	cfg.Metadata = conf.Metadata{DisplayName: displayName, Tags: tags, Folder: folder}
 
 	dlg.config = *cfg
 	dlg.Accept()
@@ -7,6 +7,7 @@ package ui
 
 import (
 	"sort"
+	"strings"
 	"sync/atomic"
 
 	"github.com/lxn/win"
@@ -22,8 +23,11 @@ type ListModel struct {
 	walk.TableModelBase
 	walk.SorterBase
 
-	tunnels           []manager.Tunnel
+	all               []manager.Tunnel // Every known tunnel.
+	tunnels           []manager.Tunnel // The tunnels that match the filter, which are the rows.
 	lastObservedState map[manager.Tunnel]manager.TunnelState
+	metadata          map[string]manager.TunnelMetadata
+	filter            string
 }
 
 var cachedListViewIconsForWidthAndState = make(map[widthAndState]*walk.Bitmap)
@@ -36,17 +40,68 @@ func (t *ListModel) Value(row, col int) interface{} {
 	if col != 0 || row < 0 || row >= len(t.tunnels) {
 		return ""
 	}
-	return t.tunnels[row].Name
+	name := t.tunnels[row].Name
+	if folder := t.metadata[name].Folder; len(folder) > 0 {
+		return folder + " › " + t.Title(name)
+	}
+	return t.Title(name)
+}
+
+// Title returns the display name of a tunnel, or its name if it does not have one.
+func (t *ListModel) Title(tunnelName string) string {
+	if displayName := t.metadata[tunnelName].DisplayName; len(displayName) > 0 {
+		return displayName
+	}
+	return tunnelName
 }
 
+// Sort groups the tunnels by folder, with those in no folder first, and sorts them by title within each.
 func (t *ListModel) Sort(col int, order walk.SortOrder) error {
 	sort.SliceStable(t.tunnels, func(i, j int) bool {
-		return conf.TunnelNameIsLess(t.tunnels[i].Name, t.tunnels[j].Name)
+		a, b := t.metadata[t.tunnels[i].Name].Folder, t.metadata[t.tunnels[j].Name].Folder
+		if a != b {
+			return len(a) == 0 || (len(b) > 0 && conf.TunnelNameIsLess(a, b))
+		}
+		return conf.TunnelNameIsLess(t.Title(t.tunnels[i].Name), t.Title(t.tunnels[j].Name))
 	})
 
 	return t.SorterBase.Sort(col, order)
 }
 
+// filterTag returns the tag of a "tag:" filter.
+func filterTag(filter string) (tag string, ok bool) {
+	filter = strings.TrimSpace(filter)
+	if len(filter) <= 4 || !strings.EqualFold(filter[:4], "tag:") {
+		return "", false
+	}
+	return strings.TrimSpace(filter[4:]), true
+}
+
+// matches reports whether a tunnel matches the filter, which is either "tag:" followed by a tag, or text
+// to look for in the title, name, folder and tags of the tunnel.
+func (t *ListModel) matches(tunnelName string) bool {
+	filter := strings.TrimSpace(t.filter)
+	if len(filter) == 0 {
+		return true
+	}
+	metadata := t.metadata[tunnelName]
+	if tag, ok := filterTag(filter); ok {
+		for _, t := range metadata.Tags {
+			if strings.EqualFold(t, tag) {
+				return true
+			}
+		}
+		return false
+	}
+	filter = strings.ToLower(filter)
+	for _, s := range append([]string{t.Title(tunnelName), tunnelName, metadata.Folder}, metadata.Tags...) {
+		if strings.Contains(strings.ToLower(s), filter) {
+			return true
+		}
+	}
+	return false
+}
+
 type ListView struct {
 	*walk.TableView
 
@@ -71,6 +126,7 @@ func NewListView(parent walk.Container) (*ListView, error) {
 
 	model := new(ListModel)
 	model.lastObservedState = make(map[manager.Tunnel]manager.TunnelState)
+	model.metadata = make(map[string]manager.TunnelMetadata)
 	tv.SetModel(model)
 	tv.SetLastColumnStretched(true)
 	tv.SetHeaderHidden(true)
@@ -199,10 +255,46 @@ func (tv *ListView) onTunnelChange(tunnel *manager.Tunnel, state manager.TunnelS
 	})
 }
 
-func (tv *ListView) onTunnelsChange() {
-	if atomic.LoadInt32(&tv.tunnelsUpdateSuspended) == 0 {
-		tv.Load(true)
+func (tv *ListView) onTunnelsChange(changes []conf.StoreChange) {
+	if atomic.LoadInt32(&tv.tunnelsUpdateSuspended) != 0 {
+		return
+	}
+	var metadata map[string]manager.TunnelMetadata
+	for _, change := range changes {
+		if change.Type != conf.StoreChangeRemoved {
+			metadata, _ = manager.IPCClientTunnelMetadata()
+			break
+		}
 	}
+	tv.Synchronize(func() {
+		if metadata != nil {
+			tv.model.metadata = metadata
+		}
+		var removed, added []manager.Tunnel
+		selectedName := ""
+		if current := tv.CurrentTunnel(); current != nil {
+			selectedName = current.Name
+		}
+		reselect := ""
+		for _, change := range changes {
+			switch change.Type {
+			case conf.StoreChangeAdded:
+				added = append(added, manager.Tunnel{Name: change.Name})
+			case conf.StoreChangeRemoved:
+				removed = append(removed, manager.Tunnel{Name: change.Name})
+			case conf.StoreChangeRenamed:
+				removed = append(removed, manager.Tunnel{Name: change.OldName})
+				added = append(added, manager.Tunnel{Name: change.Name})
+				if change.OldName == selectedName {
+					reselect = change.Name
+				}
+			}
+		}
+		tv.updateTunnels(removed, added)
+		if len(reselect) > 0 {
+			tv.selectTunnel(reselect)
+		}
+	})
 }
 
 func (tv *ListView) SetSuspendTunnelsUpdate(suspend bool) {
@@ -219,40 +311,22 @@ func (tv *ListView) Load(asyncUI bool) {
 	if err != nil {
 		return
 	}
+	metadata, _ := manager.IPCClientTunnelMetadata()
 	doUI := func() {
+		if metadata != nil {
+			tv.model.metadata = metadata
+		}
 		newTunnels := make(map[manager.Tunnel]bool, len(tunnels))
-		oldTunnels := make(map[manager.Tunnel]bool, len(tv.model.tunnels))
 		for _, tunnel := range tunnels {
 			newTunnels[tunnel] = true
 		}
-		for i := len(tv.model.tunnels); i > 0; {
-			i--
-			tunnel := tv.model.tunnels[i]
-			oldTunnels[tunnel] = true
+		var removed []manager.Tunnel
+		for _, tunnel := range tv.model.all {
 			if !newTunnels[tunnel] {
-				tv.model.tunnels = append(tv.model.tunnels[:i], tv.model.tunnels[i+1:]...)
-				tv.model.PublishRowsRemoved(i, i) // TODO: Do we have to call that everytime or can we pass a range?
-				delete(tv.model.lastObservedState, tunnel)
-			}
-		}
-		didAdd := false
-		firstTunnelName := ""
-		for tunnel := range newTunnels {
-			if !oldTunnels[tunnel] {
-				if len(firstTunnelName) == 0 || !conf.TunnelNameIsLess(firstTunnelName, tunnel.Name) {
-					firstTunnelName = tunnel.Name
-				}
-				tv.model.tunnels = append(tv.model.tunnels, tunnel)
-				didAdd = true
-			}
-		}
-		if didAdd {
-			tv.model.PublishRowsReset()
-			tv.model.Sort(tv.model.SortedColumn(), tv.model.SortOrder())
-			if len(tv.SelectedIndexes()) == 0 {
-				tv.selectTunnel(firstTunnelName)
+				removed = append(removed, tunnel)
 			}
 		}
+		tv.updateTunnels(removed, tunnels)
 	}
 	if asyncUI {
 		tv.Synchronize(doUI)
@@ -261,6 +335,78 @@ func (tv *ListView) Load(asyncUI bool) {
 	}
 }
 
+// AllTunnels returns every known tunnel, including those that the filter hides.
+func (tv *ListView) AllTunnels() []manager.Tunnel {
+	return tv.model.all
+}
+
+// Title returns the display name of a tunnel, or its name if it does not have one.
+func (tv *ListView) Title(tunnelName string) string {
+	return tv.model.Title(tunnelName)
+}
+
+// SetFilter shows only the tunnels that match filter, as described by ListModel.matches.
+func (tv *ListView) SetFilter(filter string) {
+	tv.model.filter = filter
+	tv.updateTunnels(nil, nil)
+}
+
+// FilterTag returns the tag that the filter selects, if it has the form "tag:" followed by a tag.
+func (tv *ListView) FilterTag() (tag string, ok bool) {
+	return filterTag(tv.model.filter)
+}
+
+// updateTunnels removes and adds tunnels, ignoring those that are already absent or present, and
+// rebuilds the rows. The selection is kept if it is still shown; otherwise the first added tunnel is
+// selected.
+func (tv *ListView) updateTunnels(removed []manager.Tunnel, added []manager.Tunnel) {
+	selectedName := ""
+	if current := tv.CurrentTunnel(); current != nil {
+		selectedName = current.Name
+	}
+
+	removedTunnels := make(map[manager.Tunnel]bool, len(removed))
+	for _, tunnel := range removed {
+		removedTunnels[tunnel] = true
+	}
+	oldTunnels := make(map[manager.Tunnel]bool, len(tv.model.all))
+	all := make([]manager.Tunnel, 0, len(tv.model.all)+len(added))
+	for _, tunnel := range tv.model.all {
+		if removedTunnels[tunnel] {
+			delete(tv.model.lastObservedState, tunnel)
+			continue
+		}
+		oldTunnels[tunnel] = true
+		all = append(all, tunnel)
+	}
+	firstTunnelName := ""
+	for _, tunnel := range added {
+		if !oldTunnels[tunnel] {
+			if len(firstTunnelName) == 0 || !conf.TunnelNameIsLess(tv.model.Title(firstTunnelName), tv.model.Title(tunnel.Name)) {
+				firstTunnelName = tunnel.Name
+			}
+			all = append(all, tunnel)
+			oldTunnels[tunnel] = true
+		}
+	}
+	tv.model.all = all
+
+	tv.model.tunnels = make([]manager.Tunnel, 0, len(tv.model.all))
+	for _, tunnel := range tv.model.all {
+		if tv.model.matches(tunnel.Name) {
+			tv.model.tunnels = append(tv.model.tunnels, tunnel)
+		}
+	}
+	tv.model.PublishRowsReset()
+	tv.model.Sort(tv.model.SortedColumn(), tv.model.SortOrder())
+
+	if len(selectedName) > 0 && !removedTunnels[manager.Tunnel{Name: selectedName}] {
+		tv.selectTunnel(selectedName)
+	} else if len(tv.SelectedIndexes()) == 0 {
+		tv.selectTunnel(firstTunnelName)
+	}
+}
+
 func (tv *ListView) selectTunnel(tunnelName string) {
 	for i, tunnel := range tv.model.tunnels {
 		if tunnel.Name == tunnelName {
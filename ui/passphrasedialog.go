@@ -0,0 +1,132 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package ui
+
+import (
+	"github.com/lxn/walk"
+
+	"golang.zx2c4.com/wireguard/windows/l18n"
+)
+
+type PassphraseDialog struct {
+	*walk.Dialog
+	passphraseEdit *walk.LineEdit
+	confirmEdit    *walk.LineEdit
+	passphrase     string
+}
+
+// runPassphraseDialog asks for a passphrase, twice if confirm is set, returning false if the user cancels.
+func runPassphraseDialog(owner walk.Form, title string, confirm bool) (string, bool) {
+	dlg, err := newPassphraseDialog(owner, title, confirm)
+	if showError(err, owner) {
+		return "", false
+	}
+
+	if dlg.Run() == walk.DlgCmdOK {
+		return dlg.passphrase, true
+	}
+
+	return "", false
+}
+
+func newPassphraseDialog(owner walk.Form, title string, confirm bool) (*PassphraseDialog, error) {
+	var err error
+	var disposables walk.Disposables
+	defer disposables.Treat()
+
+	dlg := new(PassphraseDialog)
+
+	layout := walk.NewGridLayout()
+	layout.SetSpacing(6)
+	layout.SetMargins(walk.Margins{10, 10, 10, 10})
+	layout.SetColumnStretchFactor(1, 3)
+
+	if dlg.Dialog, err = walk.NewDialog(owner); err != nil {
+		return nil, err
+	}
+	disposables.Add(dlg)
+	dlg.SetIcon(owner.Icon())
+	dlg.SetTitle(title)
+	dlg.SetLayout(layout)
+	dlg.SetMinMaxSize(walk.Size{350, 0}, walk.Size{0, 0})
+
+	passphraseLabel, err := walk.NewTextLabel(dlg)
+	if err != nil {
+		return nil, err
+	}
+	layout.SetRange(passphraseLabel, walk.Rectangle{0, 0, 1, 1})
+	passphraseLabel.SetTextAlignment(walk.AlignHFarVCenter)
+	passphraseLabel.SetText(l18n.Sprintf("&Passphrase:"))
+
+	if dlg.passphraseEdit, err = walk.NewLineEdit(dlg); err != nil {
+		return nil, err
+	}
+	layout.SetRange(dlg.passphraseEdit, walk.Rectangle{1, 0, 1, 1})
+	dlg.passphraseEdit.SetPasswordMode(true)
+
+	row := 1
+	if confirm {
+		confirmLabel, err := walk.NewTextLabel(dlg)
+		if err != nil {
+			return nil, err
+		}
+		layout.SetRange(confirmLabel, walk.Rectangle{0, 1, 1, 1})
+		confirmLabel.SetTextAlignment(walk.AlignHFarVCenter)
+		confirmLabel.SetText(l18n.Sprintf("&Confirm passphrase:"))
+
+		if dlg.confirmEdit, err = walk.NewLineEdit(dlg); err != nil {
+			return nil, err
+		}
+		layout.SetRange(dlg.confirmEdit, walk.Rectangle{1, 1, 1, 1})
+		dlg.confirmEdit.SetPasswordMode(true)
+		row++
+	}
+
+	buttonsContainer, err := walk.NewComposite(dlg)
+	if err != nil {
+		return nil, err
+	}
+	layout.SetRange(buttonsContainer, walk.Rectangle{0, row, 2, 1})
+	buttonsContainer.SetLayout(walk.NewHBoxLayout())
+	buttonsContainer.Layout().SetMargins(walk.Margins{})
+
+	walk.NewHSpacer(buttonsContainer)
+
+	okButton, err := walk.NewPushButton(buttonsContainer)
+	if err != nil {
+		return nil, err
+	}
+	okButton.SetText(l18n.Sprintf("OK"))
+	okButton.Clicked().Attach(dlg.onOKButtonClicked)
+
+	cancelButton, err := walk.NewPushButton(buttonsContainer)
+	if err != nil {
+		return nil, err
+	}
+	cancelButton.SetText(l18n.Sprintf("Cancel"))
+	cancelButton.Clicked().Attach(dlg.Cancel)
+
+	dlg.SetCancelButton(cancelButton)
+	dlg.SetDefaultButton(okButton)
+
+	disposables.Spare()
+
+	return dlg, nil
+}
+
+func (dlg *PassphraseDialog) onOKButtonClicked() {
+	passphrase := dlg.passphraseEdit.Text()
+	if passphrase == "" {
+		showWarningCustom(dlg, l18n.Sprintf("Invalid passphrase"), l18n.Sprintf("The passphrase must not be empty."))
+		return
+	}
+	if dlg.confirmEdit != nil && dlg.confirmEdit.Text() != passphrase {
+		showWarningCustom(dlg, l18n.Sprintf("Invalid passphrase"), l18n.Sprintf("The passphrases do not match."))
+		return
+	}
+	dlg.passphrase = passphrase
+	dlg.Accept()
+}
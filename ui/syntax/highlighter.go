@@ -24,6 +24,8 @@ const (
 	highlightPort
 	highlightMTU
 	highlightKeepalive
+	highlightTable
+	highlightSaveConfig
 	highlightComment
 	highlightDelimiter
 	highlightCmd
@@ -77,6 +79,10 @@ func (s stringSpan) isSame(c string) bool {
 	return true
 }
 
+func (s stringSpan) hasCaselessPrefix(c string) bool {
+	return s.len >= len(c) && stringSpan{s.s, len(c)}.isCaselessSame(c)
+}
+
 func (s stringSpan) isCaselessSame(c string) bool {
 	if s.len != len(c) {
 		return false
@@ -263,6 +269,17 @@ func (s stringSpan) isValidPersistentKeepAlive() bool {
 	return s.isValidUint(false, 0, 65535)
 }
 
+func (s stringSpan) isValidTable() bool {
+	if s.isSame("off") || s.isSame("auto") {
+		return true
+	}
+	return s.isValidUint(false, 0, 4294967295)
+}
+
+func (s stringSpan) isValidSaveConfig() bool {
+	return s.isSame("true") || s.isSame("false")
+}
+
 // It's probably not worthwhile to try to validate a bash expression. So instead we just demand non-zero length.
 func (s stringSpan) isValidPrePostUpDown() bool {
 	return s.len != 0
@@ -359,7 +376,12 @@ const (
 	fieldListenPort
 	fieldAddress
 	fieldDNS
+	fieldDNSMatch
+	fieldDNSOverHTTPS
+	fieldDNSOverTLS
 	fieldMTU
+	fieldTable
+	fieldSaveConfig
 	fieldPreUp
 	fieldPostUp
 	fieldPreDown
@@ -368,6 +390,7 @@ const (
 	fieldPublicKey
 	fieldPresharedKey
 	fieldAllowedIPs
+	fieldDisallowedIPs
 	fieldEndpoint
 	fieldPersistentKeepalive
 	fieldInvalid
@@ -393,14 +416,26 @@ func (s stringSpan) field() field {
 		return fieldAddress
 	case s.isCaselessSame("DNS"):
 		return fieldDNS
-	case s.isCaselessSame("MTU"):
+	case s.isCaselessSame("DNSMatch"):
+		return fieldDNSMatch
+	case s.isCaselessSame("DNSOverHTTPS"):
+		return fieldDNSOverHTTPS
+	case s.isCaselessSame("DNSOverTLS"):
+		return fieldDNSOverTLS
+	case s.isCaselessSame("MTU"), s.isCaselessSame("IPv4MTU"), s.isCaselessSame("IPv6MTU"):
 		return fieldMTU
+	case s.isCaselessSame("Table"):
+		return fieldTable
+	case s.isCaselessSame("SaveConfig"):
+		return fieldSaveConfig
 	case s.isCaselessSame("PublicKey"):
 		return fieldPublicKey
 	case s.isCaselessSame("PresharedKey"):
 		return fieldPresharedKey
 	case s.isCaselessSame("AllowedIPs"):
 		return fieldAllowedIPs
+	case s.isCaselessSame("DisallowedIPs"):
+		return fieldDisallowedIPs
 	case s.isCaselessSame("Endpoint"):
 		return fieldEndpoint
 	case s.isCaselessSame("PersistentKeepalive"):
@@ -446,7 +481,31 @@ func (hsa *highlightSpanArray) highlightMultivalueValue(parent stringSpan, s str
 		} else {
 			hsa.append(parent.s, s, highlightError)
 		}
-	case fieldAddress, fieldAllowedIPs:
+	case fieldDNSMatch:
+		if s.len > 2 && *s.s == '*' && *s.at(1) == '.' {
+			s = stringSpan{s.at(2), s.len - 2}
+		}
+		if s.isValidHostname() {
+			hsa.append(parent.s, s, highlightHost)
+		} else {
+			hsa.append(parent.s, s, highlightError)
+		}
+	case fieldEndpoint:
+		if !s.isValidEndpoint() {
+			hsa.append(parent.s, s, highlightError)
+			break
+		}
+		colon := s.len
+		for colon > 0 {
+			colon--
+			if *s.at(colon) == ':' {
+				break
+			}
+		}
+		hsa.append(parent.s, stringSpan{s.s, colon}, highlightHost)
+		hsa.append(parent.s, stringSpan{s.at(colon), 1}, highlightDelimiter)
+		hsa.append(parent.s, stringSpan{s.at(colon + 1), s.len - colon - 1}, highlightPort)
+	case fieldAddress, fieldAllowedIPs, fieldDisallowedIPs:
 		if !s.isValidNetwork() {
 			hsa.append(parent.s, s, highlightError)
 			break
@@ -508,28 +567,21 @@ func (hsa *highlightSpanArray) highlightValue(parent stringSpan, s stringSpan, s
 		hsa.append(parent.s, s, validateHighlight(s.isValidKey(), highlightPresharedKey))
 	case fieldMTU:
 		hsa.append(parent.s, s, validateHighlight(s.isValidMTU(), highlightMTU))
+	case fieldTable:
+		hsa.append(parent.s, s, validateHighlight(s.isValidTable(), highlightTable))
+	case fieldSaveConfig:
+		hsa.append(parent.s, s, validateHighlight(s.isValidSaveConfig(), highlightSaveConfig))
 	case fieldPreUp, fieldPostUp, fieldPreDown, fieldPostDown:
 		hsa.append(parent.s, s, validateHighlight(s.isValidPrePostUpDown(), highlightCmd))
+	case fieldDNSOverHTTPS:
+		hsa.append(parent.s, s, validateHighlight(s.len > len("https://") && s.hasCaselessPrefix("https://"), highlightHost))
+	case fieldDNSOverTLS:
+		hsa.append(parent.s, s, validateHighlight(s.isValidHostname(), highlightHost))
 	case fieldListenPort:
 		hsa.append(parent.s, s, validateHighlight(s.isValidPort(), highlightPort))
 	case fieldPersistentKeepalive:
 		hsa.append(parent.s, s, validateHighlight(s.isValidPersistentKeepAlive(), highlightKeepalive))
-	case fieldEndpoint:
-		if !s.isValidEndpoint() {
-			hsa.append(parent.s, s, highlightError)
-			break
-		}
-		colon := s.len
-		for colon > 0 {
-			colon--
-			if *s.at(colon) == ':' {
-				break
-			}
-		}
-		hsa.append(parent.s, stringSpan{s.s, colon}, highlightHost)
-		hsa.append(parent.s, stringSpan{s.at(colon), 1}, highlightDelimiter)
-		hsa.append(parent.s, stringSpan{s.at(colon + 1), s.len - colon - 1}, highlightPort)
-	case fieldAddress, fieldDNS, fieldAllowedIPs:
+	case fieldAddress, fieldDNS, fieldDNSMatch, fieldAllowedIPs, fieldDisallowedIPs, fieldEndpoint:
 		hsa.highlightMultivalue(parent, s, section)
 	default:
 		hsa.append(parent.s, s, highlightError)
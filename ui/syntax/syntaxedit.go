@@ -101,6 +101,8 @@ var stylemap = map[highlight]spanStyle{
 	highlightPort:         spanStyle{color: win.RGB(0x81, 0x5F, 0x03)},
 	highlightMTU:          spanStyle{color: win.RGB(0x1C, 0x00, 0xCF)},
 	highlightKeepalive:    spanStyle{color: win.RGB(0x1C, 0x00, 0xCF)},
+	highlightTable:        spanStyle{color: win.RGB(0x1C, 0x00, 0xCF)},
+	highlightSaveConfig:   spanStyle{color: win.RGB(0x1C, 0x00, 0xCF)},
 	highlightComment:      spanStyle{color: win.RGB(0x53, 0x65, 0x79), effects: win.CFE_ITALIC},
 	highlightDelimiter:    spanStyle{color: win.RGB(0x00, 0x00, 0x00)},
 	highlightCmd:          spanStyle{color: win.RGB(0x63, 0x75, 0x89)},
@@ -123,6 +125,11 @@ func (se *SyntaxEdit) evaluateUntunneledBlocking(cfg string, spans []highlightSp
 		switch span.t {
 		case highlightError:
 			goto done
+		case highlightTable:
+			if cfg[span.s:span.s+span.len] == "off" {
+				goto done
+			}
+			break
 		case highlightSection:
 			if !strings.EqualFold(cfg[span.s:span.s+span.len], "[Peer]") {
 				break
@@ -24,8 +24,12 @@ type Tray struct {
 	*walk.NotifyIcon
 
 	// Current known tunnels by name
-	tunnels                  map[string]*walk.Action
-	tunnelsAreInBreakoutMenu bool
+	tunnels  map[string]*walk.Action
+	metadata map[string]manager.TunnelMetadata
+
+	// What the tunnels section of the context menu is currently made of
+	tunnelsMenuActions []*walk.Action
+	tunnelsMenus       []*walk.Menu
 
 	mtw *ManageTunnelsWindow
 
@@ -39,8 +43,9 @@ func NewTray(mtw *ManageTunnelsWindow) (*Tray, error) {
 	var err error
 
 	tray := &Tray{
-		mtw:     mtw,
-		tunnels: make(map[string]*walk.Action),
+		mtw:      mtw,
+		tunnels:  make(map[string]*walk.Action),
+		metadata: make(map[string]manager.TunnelMetadata),
 	}
 
 	tray.NotifyIcon, err = walk.NewNotifyIcon(mtw)
@@ -105,7 +110,7 @@ func (tray *Tray) setup() error {
 	}
 	tray.tunnelChangedCB = manager.IPCClientRegisterTunnelChange(tray.onTunnelChange)
 	tray.tunnelsChangedCB = manager.IPCClientRegisterTunnelsChange(tray.onTunnelsChange)
-	tray.onTunnelsChange()
+	tray.loadTunnels()
 	globalState, _ := manager.IPCClientGlobalState()
 	tray.updateGlobalState(globalState)
 
@@ -124,12 +129,16 @@ func (tray *Tray) Dispose() error {
 	return tray.NotifyIcon.Dispose()
 }
 
-func (tray *Tray) onTunnelsChange() {
+func (tray *Tray) loadTunnels() {
 	tunnels, err := manager.IPCClientTunnels()
 	if err != nil {
 		return
 	}
+	metadata, _ := manager.IPCClientTunnelMetadata()
 	tray.mtw.Synchronize(func() {
+		if metadata != nil {
+			tray.metadata = metadata
+		}
 		tunnelSet := make(map[string]bool, len(tunnels))
 		for _, tunnel := range tunnels {
 			tunnelSet[tunnel.Name] = true
@@ -142,23 +151,64 @@ func (tray *Tray) onTunnelsChange() {
 				tray.removeTunnelAction(trayTunnel)
 			}
 		}
+		tray.rebuildTunnelsMenu()
 	})
 }
 
+func (tray *Tray) onTunnelsChange(changes []conf.StoreChange) {
+	var metadata map[string]manager.TunnelMetadata
+	for _, change := range changes {
+		if change.Type != conf.StoreChangeRemoved {
+			metadata, _ = manager.IPCClientTunnelMetadata()
+			break
+		}
+	}
+	tray.mtw.Synchronize(func() {
+		if metadata != nil {
+			tray.metadata = metadata
+		}
+		for _, change := range changes {
+			switch change.Type {
+			case conf.StoreChangeRemoved:
+				if tray.tunnels[change.Name] != nil {
+					tray.removeTunnelAction(change.Name)
+				}
+			case conf.StoreChangeRenamed:
+				if tray.tunnels[change.OldName] != nil {
+					tray.removeTunnelAction(change.OldName)
+				}
+				fallthrough
+			case conf.StoreChangeAdded:
+				if tray.tunnels[change.Name] == nil {
+					tray.addTunnelAction(&manager.Tunnel{Name: change.Name})
+				}
+			}
+		}
+		tray.rebuildTunnelsMenu()
+	})
+}
+
+func (tray *Tray) title(tunnelName string) string {
+	if displayName := tray.metadata[tunnelName].DisplayName; len(displayName) > 0 {
+		return displayName
+	}
+	return tunnelName
+}
+
 func (tray *Tray) sortedTunnels() []string {
 	var names []string
 	for name := range tray.tunnels {
 		names = append(names, name)
 	}
 	sort.SliceStable(names, func(i, j int) bool {
-		return conf.TunnelNameIsLess(names[i], names[j])
+		return conf.TunnelNameIsLess(tray.title(names[i]), tray.title(names[j]))
 	})
 	return names
 }
 
 func (tray *Tray) addTunnelAction(tunnel *manager.Tunnel) {
 	tunnelAction := walk.NewAction()
-	tunnelAction.SetText(tunnel.Name)
+	tunnelAction.SetText(tray.title(tunnel.Name))
 	tunnelAction.SetEnabled(true)
 	tunnelAction.SetCheckable(true)
 	tclosure := *tunnel
@@ -184,23 +234,6 @@ func (tray *Tray) addTunnelAction(tunnel *manager.Tunnel) {
 	})
 	tray.tunnels[tunnel.Name] = tunnelAction
 
-	var (
-		idx  int
-		name string
-	)
-	for idx, name = range tray.sortedTunnels() {
-		if name == tunnel.Name {
-			break
-		}
-	}
-
-	if tray.tunnelsAreInBreakoutMenu {
-		tray.ContextMenu().Actions().At(trayTunnelActionsOffset).Menu().Actions().Insert(idx, tunnelAction)
-	} else {
-		tray.ContextMenu().Actions().Insert(trayTunnelActionsOffset+idx, tunnelAction)
-	}
-	tray.rebalanceTunnelsMenu()
-
 	go func() {
 		state, err := tclosure.State()
 		if err != nil {
@@ -212,44 +245,169 @@ func (tray *Tray) addTunnelAction(tunnel *manager.Tunnel) {
 	}()
 }
 
+// removeTunnelAction forgets about a tunnel. The caller must then call rebuildTunnelsMenu.
 func (tray *Tray) removeTunnelAction(tunnelName string) {
-	if tray.tunnelsAreInBreakoutMenu {
-		tray.ContextMenu().Actions().At(trayTunnelActionsOffset).Menu().Actions().Remove(tray.tunnels[tunnelName])
-	} else {
-		tray.ContextMenu().Actions().Remove(tray.tunnels[tunnelName])
-	}
 	delete(tray.tunnels, tunnelName)
-	tray.rebalanceTunnelsMenu()
 }
 
-func (tray *Tray) rebalanceTunnelsMenu() {
-	if tray.tunnelsAreInBreakoutMenu && len(tray.tunnels) <= 10 {
-		menuAction := tray.ContextMenu().Actions().At(trayTunnelActionsOffset)
-		idx := 1
-		for _, name := range tray.sortedTunnels() {
-			tray.ContextMenu().Actions().Insert(trayTunnelActionsOffset+idx, tray.tunnels[name])
-			idx++
-		}
-		tray.ContextMenu().Actions().Remove(menuAction)
-		menuAction.Menu().Dispose()
-		tray.tunnelsAreInBreakoutMenu = false
-	} else if !tray.tunnelsAreInBreakoutMenu && len(tray.tunnels) > 10 {
-		menu, err := walk.NewMenu()
+// rebuildTunnelsMenu lays out the tunnel actions again, in submenus for their folders, followed by a
+// submenu of bulk actions for each tag. When there are more than ten entries, they all move to a
+// breakout menu.
+func (tray *Tray) rebuildTunnelsMenu() {
+	for _, action := range tray.tunnelsMenuActions {
+		tray.ContextMenu().Actions().Remove(action)
+	}
+	for _, menu := range tray.tunnelsMenus {
+		menu.Dispose()
+	}
+	tray.tunnelsMenuActions = nil
+	tray.tunnelsMenus = nil
+
+	names := tray.sortedTunnels()
+	for _, name := range names {
+		tray.tunnels[name].SetText(tray.title(name))
+	}
+	entries := tray.folderEntries("", names)
+	if tagsAction := tray.tagsAction(names); tagsAction != nil {
+		entries = append(entries, tagsAction)
+	}
+
+	if len(entries) > 10 {
+		menu, err := tray.newTunnelsMenu(entries)
 		if err != nil {
 			return
 		}
-		for _, name := range tray.sortedTunnels() {
-			action := tray.tunnels[name]
-			menu.Actions().Add(action)
-			tray.ContextMenu().Actions().Remove(action)
+		menuAction := walk.NewMenuAction(menu)
+		menuAction.SetText(l18n.Sprintf("&Tunnels"))
+		entries = []*walk.Action{menuAction}
+	}
+	for i, action := range entries {
+		tray.ContextMenu().Actions().Insert(trayTunnelActionsOffset+i, action)
+	}
+	tray.tunnelsMenuActions = entries
+}
+
+// folderEntries returns the actions of the tunnels directly in folder, followed by submenus for its
+// subfolders. The names must already be sorted.
+func (tray *Tray) folderEntries(folder string, names []string) []*walk.Action {
+	var entries []*walk.Action
+	var subfolders []string
+	subfolderTunnels := make(map[string][]string)
+	for _, name := range names {
+		tunnelFolder := tray.metadata[name].Folder
+		if tunnelFolder == folder {
+			entries = append(entries, tray.tunnels[name])
+			continue
+		}
+		var rest string
+		if len(folder) == 0 {
+			rest = tunnelFolder
+		} else if strings.HasPrefix(tunnelFolder, folder+"/") {
+			rest = tunnelFolder[len(folder)+1:]
+		} else {
+			continue
+		}
+		subfolder := rest
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			subfolder = rest[:i]
 		}
-		menuAction, err := tray.ContextMenu().Actions().InsertMenu(trayTunnelActionsOffset, menu)
+		if _, ok := subfolderTunnels[subfolder]; !ok {
+			subfolders = append(subfolders, subfolder)
+		}
+		subfolderTunnels[subfolder] = append(subfolderTunnels[subfolder], name)
+	}
+	sort.SliceStable(subfolders, func(i, j int) bool {
+		return conf.TunnelNameIsLess(subfolders[i], subfolders[j])
+	})
+	for _, subfolder := range subfolders {
+		path := subfolder
+		if len(folder) > 0 {
+			path = folder + "/" + subfolder
+		}
+		menu, err := tray.newTunnelsMenu(tray.folderEntries(path, subfolderTunnels[subfolder]))
 		if err != nil {
-			return
+			continue
 		}
-		menuAction.SetText(l18n.Sprintf("&Tunnels"))
-		tray.tunnelsAreInBreakoutMenu = true
+		menuAction := walk.NewMenuAction(menu)
+		menuAction.SetText(strings.ReplaceAll(subfolder, "&", "&&"))
+		entries = append(entries, menuAction)
+	}
+	return entries
+}
+
+// tagsAction returns a submenu with actions to activate and deactivate the tunnels of each tag, or nil
+// if no tunnel has a tag.
+func (tray *Tray) tagsAction(names []string) *walk.Action {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		for _, tag := range tray.metadata[name].Tags {
+			if lower := strings.ToLower(tag); !seen[lower] {
+				seen[lower] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		return conf.TunnelNameIsLess(tags[i], tags[j])
+	})
+	var tagEntries []*walk.Action
+	for _, tag := range tags {
+		tag := tag
+		activateAction := walk.NewAction()
+		activateAction.SetText(l18n.Sprintf("&Activate all"))
+		activateAction.Triggered().Attach(func() {
+			tray.runTagged(tag, manager.IPCClientStartTagged, l18n.Sprintf("Failed to activate tunnels"))
+		})
+		deactivateAction := walk.NewAction()
+		deactivateAction.SetText(l18n.Sprintf("&Deactivate all"))
+		deactivateAction.Triggered().Attach(func() {
+			tray.runTagged(tag, manager.IPCClientStopTagged, l18n.Sprintf("Failed to deactivate tunnels"))
+		})
+		menu, err := tray.newTunnelsMenu([]*walk.Action{activateAction, deactivateAction})
+		if err != nil {
+			continue
+		}
+		menuAction := walk.NewMenuAction(menu)
+		menuAction.SetText(strings.ReplaceAll(tag, "&", "&&"))
+		tagEntries = append(tagEntries, menuAction)
+	}
+	menu, err := tray.newTunnelsMenu(tagEntries)
+	if err != nil {
+		return nil
+	}
+	menuAction := walk.NewMenuAction(menu)
+	menuAction.SetText(l18n.Sprintf("Ta&gs"))
+	return menuAction
+}
+
+func (tray *Tray) runTagged(tag string, f func(string) error, errorTitle string) {
+	go func() {
+		err := f(tag)
+		if err != nil {
+			tray.mtw.Synchronize(func() {
+				raise(tray.mtw.Handle())
+				tray.mtw.tabs.SetCurrentIndex(0)
+				showErrorCustom(tray.mtw, errorTitle, err.Error())
+			})
+		}
+	}()
+}
+
+// newTunnelsMenu makes a menu of actions, which is disposed of by the next rebuildTunnelsMenu.
+func (tray *Tray) newTunnelsMenu(actions []*walk.Action) (*walk.Menu, error) {
+	menu, err := walk.NewMenu()
+	if err != nil {
+		return nil, err
+	}
+	for _, action := range actions {
+		menu.Actions().Add(action)
 	}
+	tray.tunnelsMenus = append(tray.tunnelsMenus, menu)
+	return menu, nil
 }
 
 func (tray *Tray) onTunnelChange(tunnel *manager.Tunnel, state manager.TunnelState, globalState manager.TunnelState, err error) {
@@ -6,10 +6,9 @@
 package ui
 
 import (
-	"archive/zip"
 	"errors"
 	"fmt"
-	"io"
+	"image/png"
 	"os"
 	"path/filepath"
 	"sort"
@@ -20,6 +19,7 @@ import (
 	"golang.zx2c4.com/wireguard/windows/conf"
 	"golang.zx2c4.com/wireguard/windows/l18n"
 	"golang.zx2c4.com/wireguard/windows/manager"
+	"golang.zx2c4.com/wireguard/windows/qrcode"
 )
 
 type TunnelsPage struct {
@@ -27,6 +27,7 @@ type TunnelsPage struct {
 
 	listView      *ListView
 	listContainer walk.Container
+	filterEdit    *walk.LineEdit
 	listToolbar   *walk.ToolBar
 	confView      *ConfView
 	fillerButton  *walk.PushButton
@@ -56,9 +57,17 @@ func NewTunnelsPage() (*TunnelsPage, error) {
 	vlayout.SetSpacing(0)
 	tp.listContainer.SetLayout(vlayout)
 
+	if tp.filterEdit, err = walk.NewLineEdit(tp.listContainer); err != nil {
+		return nil, err
+	}
+	tp.filterEdit.SetCueBanner(l18n.Sprintf("Filter, or tag:name"))
+
 	if tp.listView, err = NewListView(tp.listContainer); err != nil {
 		return nil, err
 	}
+	tp.filterEdit.TextChanged().Attach(func() {
+		tp.listView.SetFilter(tp.filterEdit.Text())
+	})
 
 	if tp.currentTunnelContainer, err = walk.NewComposite(tp); err != nil {
 		return nil, err
@@ -224,7 +233,37 @@ func (tp *TunnelsPage) CreateToolbar() error {
 	exportAction2.Triggered().Attach(tp.onExportTunnels)
 	exportAction2.SetVisible(IsAdmin)
 	contextMenu.Actions().Add(exportAction2)
+	exportQRAction := walk.NewAction()
+	exportQRAction.SetText(l18n.Sprintf("Export selected tunnel to &QR code…"))
+	exportQRAction.Triggered().Attach(tp.onExportTunnelQR)
+	exportQRAction.SetVisible(IsAdmin)
+	contextMenu.Actions().Add(exportQRAction)
+	copyRemotePeerAction := walk.NewAction()
+	copyRemotePeerAction.SetText(l18n.Sprintf("Copy &remote peer of selected tunnel"))
+	copyRemotePeerAction.Triggered().Attach(tp.onCopyRemotePeer)
+	copyRemotePeerAction.SetVisible(IsAdmin)
+	contextMenu.Actions().Add(copyRemotePeerAction)
+	exportClientsAction := walk.NewAction()
+	exportClientsAction.SetText(l18n.Sprintf("Export &client configurations of selected tunnel…"))
+	exportClientsAction.Triggered().Attach(tp.onExportClientConfigs)
+	exportClientsAction.SetVisible(IsAdmin)
+	contextMenu.Actions().Add(exportClientsAction)
 	contextMenu.Actions().Add(walk.NewSeparatorAction())
+	startTaggedAction := walk.NewAction()
+	startTaggedAction.Triggered().Attach(func() { tp.onTagged(true) })
+	contextMenu.Actions().Add(startTaggedAction)
+	stopTaggedAction := walk.NewAction()
+	stopTaggedAction.Triggered().Attach(func() { tp.onTagged(false) })
+	contextMenu.Actions().Add(stopTaggedAction)
+	setTaggedOptions := func() {
+		tag, ok := tp.listView.FilterTag()
+		startTaggedAction.SetText(l18n.Sprintf("&Activate tunnels tagged %s", strings.ReplaceAll(tag, "&", "&&")))
+		stopTaggedAction.SetText(l18n.Sprintf("&Deactivate tunnels tagged %s", strings.ReplaceAll(tag, "&", "&&")))
+		startTaggedAction.SetVisible(ok)
+		stopTaggedAction.SetVisible(ok)
+	}
+	tp.filterEdit.TextChanged().Attach(setTaggedOptions)
+	setTaggedOptions()
 	editAction := walk.NewAction()
 	editAction.SetText(l18n.Sprintf("Edit &selected tunnel…"))
 	editAction.SetShortcut(walk.Shortcut{walk.ModControl, walk.KeyE})
@@ -256,11 +295,14 @@ func (tp *TunnelsPage) CreateToolbar() error {
 		toggleAction.SetEnabled(selected == 1)
 		selectAllAction.SetEnabled(selected < all)
 		editAction.SetEnabled(selected == 1)
+		exportQRAction.SetEnabled(selected == 1)
+		copyRemotePeerAction.SetEnabled(selected == 1)
+		exportClientsAction.SetEnabled(selected == 1)
 	}
 	tp.listView.SelectedIndexesChanged().Attach(setSelectionOrientedOptions)
 	setSelectionOrientedOptions()
 	setExport := func() {
-		all := len(tp.listView.model.tunnels)
+		all := len(tp.listView.AllTunnels())
 		exportAction.SetEnabled(all > 0)
 		exportAction2.SetEnabled(all > 0)
 	}
@@ -273,6 +315,30 @@ func (tp *TunnelsPage) CreateToolbar() error {
 	return nil
 }
 
+// onTagged activates or deactivates every tunnel with the tag that the filter selects.
+func (tp *TunnelsPage) onTagged(start bool) {
+	tag, ok := tp.listView.FilterTag()
+	if !ok {
+		return
+	}
+	go func() {
+		var err error
+		var title string
+		if start {
+			err = manager.IPCClientStartTagged(tag)
+			title = l18n.Sprintf("Failed to activate tunnels")
+		} else {
+			err = manager.IPCClientStopTagged(tag)
+			title = l18n.Sprintf("Failed to deactivate tunnels")
+		}
+		if err != nil {
+			tp.Synchronize(func() {
+				showErrorCustom(tp.Form(), title, err.Error())
+			})
+		}
+	}()
+}
+
 func (tp *TunnelsPage) updateConfView() {
 	tp.confView.SetTunnel(tp.listView.CurrentTunnel())
 }
@@ -284,9 +350,20 @@ func (tp *TunnelsPage) importFiles(paths []string) {
 				walk.MsgBox(tp.Form(), title, message, flags)
 			})
 		}
+		syncedPassphrase := func(title string) (passphrase string, ok bool) {
+			done := make(chan struct{})
+			tp.Synchronize(func() {
+				passphrase, ok = runPassphraseDialog(tp.Form(), title, false)
+				close(done)
+			})
+			<-done
+			return
+		}
 		type unparsedConfig struct {
-			Name   string
-			Config string
+			Name        string
+			DisplayName string
+			Config      string
+			JSON        bool
 		}
 
 		var (
@@ -295,42 +372,51 @@ func (tp *TunnelsPage) importFiles(paths []string) {
 		)
 
 		for _, path := range paths {
-			switch strings.ToLower(filepath.Ext(path)) {
-			case ".conf":
+			switch ext := strings.ToLower(filepath.Ext(path)); ext {
+			case ".conf", ".json":
 				textConfig, err := os.ReadFile(path)
 				if err != nil {
 					lastErr = err
 					continue
 				}
+				unparsedConfigs = append(unparsedConfigs, unparsedConfig{Name: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)), Config: string(textConfig), JSON: ext == ".json"})
+			case ".png", ".jpg", ".jpeg", ".gif":
+				textConfig, err := qrcode.DecodeFile(path)
+				if err != nil {
+					lastErr = err
+					continue
+				}
 				unparsedConfigs = append(unparsedConfigs, unparsedConfig{Name: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)), Config: string(textConfig)})
-			case ".zip":
-				// 1 .conf + 1 error .zip edge case?
-				r, err := zip.OpenReader(path)
+			case ".zip", conf.EncryptedBundleExtension:
+				data, err := os.ReadFile(path)
 				if err != nil {
 					lastErr = err
 					continue
 				}
-
-				for _, f := range r.File {
-					if strings.ToLower(filepath.Ext(f.Name)) != ".conf" {
-						continue
-					}
-
-					rc, err := f.Open()
-					if err != nil {
-						lastErr = err
+				var passphrase string
+				if conf.IsEncryptedBundle(data) {
+					var ok bool
+					passphrase, ok = syncedPassphrase(l18n.Sprintf("Decrypt ‘%s’", filepath.Base(path)))
+					if !ok {
 						continue
 					}
-					textConfig, err := io.ReadAll(rc)
-					rc.Close()
-					if err != nil {
-						lastErr = err
-						continue
+				}
+				files, err := conf.ReadBundle(data, passphrase)
+				for err == conf.ErrWrongPassphrase {
+					var ok bool
+					passphrase, ok = syncedPassphrase(l18n.Sprintf("Wrong passphrase for ‘%s’", filepath.Base(path)))
+					if !ok {
+						break
 					}
-					unparsedConfigs = append(unparsedConfigs, unparsedConfig{Name: strings.TrimSuffix(filepath.Base(f.Name), filepath.Ext(f.Name)), Config: string(textConfig)})
+					files, err = conf.ReadBundle(data, passphrase)
+				}
+				if err != nil {
+					lastErr = err
+					continue
+				}
+				for _, f := range files {
+					unparsedConfigs = append(unparsedConfigs, unparsedConfig{Name: f.Name, Config: string(f.Contents), JSON: f.JSON})
 				}
-
-				r.Close()
 			}
 		}
 
@@ -356,27 +442,55 @@ func (tp *TunnelsPage) importFiles(paths []string) {
 		for _, tunnel := range existingTunnelList {
 			existingLowerTunnels[strings.ToLower(tunnel.Name)] = true
 		}
+		importedLowerTunnels := make(map[string]bool, len(unparsedConfigs))
+		for i := range unparsedConfigs {
+			if conf.TunnelNameIsValid(unparsedConfigs[i].Name) {
+				importedLowerTunnels[strings.ToLower(unparsedConfigs[i].Name)] = true
+			}
+		}
+		for i := range unparsedConfigs {
+			// Files whose names cannot name a tunnel get a fresh name, and keep theirs as the display name.
+			unparsedConfigs[i].Name, unparsedConfigs[i].DisplayName = conf.NameForImport(unparsedConfigs[i].Name, func(name string) bool {
+				return existingLowerTunnels[strings.ToLower(name)] || importedLowerTunnels[strings.ToLower(name)]
+			})
+			importedLowerTunnels[strings.ToLower(unparsedConfigs[i].Name)] = true
+		}
 
 		configCount := 0
+		var findings []string
 		tp.listView.SetSuspendTunnelsUpdate(true)
 		for _, unparsedConfig := range unparsedConfigs {
 			if existingLowerTunnels[strings.ToLower(unparsedConfig.Name)] {
 				lastErr = errors.New(l18n.Sprintf("Another tunnel already exists with the name ‘%s’", unparsedConfig.Name))
 				continue
 			}
-			config, err := conf.FromWgQuickWithUnknownEncoding(unparsedConfig.Config, unparsedConfig.Name)
+			var config *conf.Config
+			if unparsedConfig.JSON {
+				config, err = conf.FromJSON(unparsedConfig.Config, unparsedConfig.Name)
+			} else {
+				config, err = conf.FromWgQuickWithUnknownEncoding(unparsedConfig.Config, unparsedConfig.Name)
+			}
 			if err != nil {
 				lastErr = err
 				continue
 			}
+			if len(config.Metadata.DisplayName) == 0 {
+				config.Metadata.DisplayName = unparsedConfig.DisplayName
+			}
 			_, err = manager.IPCClientNewTunnel(config)
 			if err != nil {
 				lastErr = err
 				continue
 			}
 			configCount++
+			for _, finding := range conf.Lint(config) {
+				findings = append(findings, fmt.Sprintf("%s: %s", config.Title(), finding.String()))
+			}
 		}
 		tp.listView.SetSuspendTunnelsUpdate(false)
+		if len(findings) > 0 {
+			syncedMsgBox(l18n.Sprintf("Configuration problems"), l18n.Sprintf("The imported configuration may not work as intended:\n\n%s", strings.Join(findings, "\n")), walk.MsgBoxIconWarning)
+		}
 
 		m, n := configCount, len(unparsedConfigs)
 		switch {
@@ -392,27 +506,21 @@ func (tp *TunnelsPage) importFiles(paths []string) {
 	}()
 }
 
-func (tp *TunnelsPage) exportTunnels(filePath string) {
+func (tp *TunnelsPage) exportTunnels(filePath string, asJSON bool, passphrase string) {
 	writeFileWithOverwriteHandling(tp.Form(), filePath, func(file *os.File) error {
-		writer := zip.NewWriter(file)
-
-		for _, tunnel := range tp.listView.model.tunnels {
+		configs := make([]*conf.Config, 0, len(tp.listView.AllTunnels()))
+		for _, tunnel := range tp.listView.AllTunnels() {
 			cfg, err := tunnel.StoredConfig()
 			if err != nil {
 				return fmt.Errorf("onExportTunnels: tunnel.StoredConfig failed: %w", err)
 			}
-
-			w, err := writer.Create(tunnel.Name + ".conf")
-			if err != nil {
-				return fmt.Errorf("onExportTunnels: writer.Create failed: %w", err)
-			}
-
-			if _, err := w.Write(([]byte)(cfg.ToWgQuick())); err != nil {
-				return fmt.Errorf("onExportTunnels: cfg.ToWgQuick failed: %w", err)
-			}
+			configs = append(configs, &cfg)
 		}
 
-		return writer.Close()
+		if err := conf.WriteBundle(file, configs, asJSON, passphrase); err != nil {
+			return fmt.Errorf("onExportTunnels: conf.WriteBundle failed: %w", err)
+		}
+		return nil
 	})
 }
 
@@ -456,6 +564,40 @@ func (tp *TunnelsPage) onEditTunnel() {
 
 	if config := runEditDialog(tp.Form(), tunnel); config != nil {
 		go func() {
+			if config.Name == tunnel.Name {
+				// Keep the tunnel running, and let the tunnel service apply what it can in place.
+				_, err := manager.IPCClientNewTunnel(config)
+				if err != nil {
+					tp.Synchronize(func() {
+						showErrorCustom(tp.Form(), l18n.Sprintf("Unable to save tunnel"), err.Error())
+					})
+					return
+				}
+				restart, err := tunnel.Reload()
+				if err != nil {
+					tp.Synchronize(func() {
+						showErrorCustom(tp.Form(), l18n.Sprintf("Unable to apply configuration to running tunnel"), err.Error())
+					})
+					// What was applied before the failure is undone by restarting.
+					restart = true
+				}
+				if !restart {
+					return
+				}
+				err = tunnel.Stop()
+				if err == nil {
+					err = tunnel.WaitForStop()
+				}
+				if err == nil {
+					err = tunnel.Start()
+				}
+				if err != nil {
+					tp.Synchronize(func() {
+						showErrorCustom(tp.Form(), l18n.Sprintf("Failed to activate tunnel"), err.Error())
+					})
+				}
+				return
+			}
 			priorState, err := tunnel.State()
 			tunnel.Delete()
 			tunnel.WaitForStop()
@@ -486,7 +628,7 @@ func (tp *TunnelsPage) onDelete() {
 		title = l18n.Sprintf("Delete %d tunnels", tunnelCount)
 		question = l18n.Sprintf("Are you sure you would like to delete %d tunnels?", tunnelCount)
 	} else {
-		tunnelName := tp.listView.model.tunnels[indices[0]].Name
+		tunnelName := tp.listView.model.Title(tp.listView.model.tunnels[indices[0]].Name)
 		title = l18n.Sprintf("Delete tunnel ‘%s’", tunnelName)
 		question = l18n.Sprintf("Are you sure you would like to delete tunnel ‘%s’?", tunnelName)
 	}
@@ -548,7 +690,7 @@ func (tp *TunnelsPage) onSelectAll() {
 
 func (tp *TunnelsPage) onImport() {
 	dlg := walk.FileDialog{
-		Filter: l18n.Sprintf("Configuration Files (*.zip, *.conf)|*.zip;*.conf|All Files (*.*)|*.*"),
+		Filter: l18n.Sprintf("Configuration Files (*.zip, *.wgbundle, *.conf, *.json)|*.zip;*.wgbundle;*.conf;*.json|QR Code Images (*.png, *.jpg, *.gif)|*.png;*.jpg;*.jpeg;*.gif|All Files (*.*)|*.*"),
 		Title:  l18n.Sprintf("Import tunnel(s) from file"),
 	}
 
@@ -561,7 +703,7 @@ func (tp *TunnelsPage) onImport() {
 
 func (tp *TunnelsPage) onExportTunnels() {
 	dlg := walk.FileDialog{
-		Filter: l18n.Sprintf("Configuration ZIP Files (*.zip)|*.zip"),
+		Filter: l18n.Sprintf("Configuration ZIP Files (*.zip)|*.zip|JSON Configuration ZIP Files (*.zip)|*.zip|Encrypted Configuration Bundles (*.wgbundle)|*.wgbundle"),
 		Title:  l18n.Sprintf("Export tunnels to zip"),
 	}
 
@@ -569,11 +711,106 @@ func (tp *TunnelsPage) onExportTunnels() {
 		return
 	}
 
+	if dlg.FilterIndex == 3 {
+		passphrase, ok := runPassphraseDialog(tp.Form(), l18n.Sprintf("Encrypt exported tunnels"), true)
+		if !ok {
+			return
+		}
+		if !strings.HasSuffix(dlg.FilePath, conf.EncryptedBundleExtension) {
+			dlg.FilePath += conf.EncryptedBundleExtension
+		}
+		tp.exportTunnels(dlg.FilePath, false, passphrase)
+		return
+	}
+
 	if !strings.HasSuffix(dlg.FilePath, ".zip") {
 		dlg.FilePath += ".zip"
 	}
 
-	tp.exportTunnels(dlg.FilePath)
+	tp.exportTunnels(dlg.FilePath, dlg.FilterIndex == 2, "")
+}
+
+func (tp *TunnelsPage) onExportTunnelQR() {
+	tunnel := tp.listView.CurrentTunnel()
+	if tunnel == nil {
+		return
+	}
+	cfg, err := tunnel.StoredConfig()
+	if err != nil {
+		showErrorCustom(tp.Form(), l18n.Sprintf("Unable to export QR code"), err.Error())
+		return
+	}
+	code, err := qrcode.Encode([]byte(cfg.ToWgQuick()), qrcode.Low)
+	if err != nil {
+		showErrorCustom(tp.Form(), l18n.Sprintf("Unable to export QR code"), err.Error())
+		return
+	}
+
+	dlg := walk.FileDialog{
+		Filter:   l18n.Sprintf("PNG Images (*.png)|*.png"),
+		FilePath: exportFileName(cfg.Title(), tunnel.Name) + ".png",
+		Title:    l18n.Sprintf("Export tunnel to QR code"),
+	}
+
+	if ok, _ := dlg.ShowSave(tp.Form()); !ok {
+		return
+	}
+
+	if !strings.HasSuffix(dlg.FilePath, ".png") {
+		dlg.FilePath += ".png"
+	}
+
+	writeFileWithOverwriteHandling(tp.Form(), dlg.FilePath, func(file *os.File) error {
+		return png.Encode(file, code.Image(8))
+	})
+}
+
+func (tp *TunnelsPage) onCopyRemotePeer() {
+	tunnel := tp.listView.CurrentTunnel()
+	if tunnel == nil {
+		return
+	}
+	cfg, err := tunnel.StoredConfig()
+	if err != nil {
+		showErrorCustom(tp.Form(), l18n.Sprintf("Unable to copy remote peer"), err.Error())
+		return
+	}
+	walk.Clipboard().SetText(cfg.CounterpartPeers(conf.Endpoint{}))
+}
+
+// onExportClientConfigs writes a skeleton of the configuration of each peer of the selected tunnel, as
+// a client of it, to a folder, for the server side of client tunnels.
+func (tp *TunnelsPage) onExportClientConfigs() {
+	tunnel := tp.listView.CurrentTunnel()
+	if tunnel == nil {
+		return
+	}
+	cfg, err := tunnel.StoredConfig()
+	if err != nil {
+		showErrorCustom(tp.Form(), l18n.Sprintf("Unable to export client configurations"), err.Error())
+		return
+	}
+	if len(cfg.Peers) == 0 {
+		showErrorCustom(tp.Form(), l18n.Sprintf("Unable to export client configurations"), l18n.Sprintf("The tunnel has no peers."))
+		return
+	}
+
+	dlg := walk.FileDialog{
+		Title: l18n.Sprintf("Export client configurations to folder"),
+	}
+	if ok, _ := dlg.ShowBrowseFolder(tp.Form()); !ok {
+		return
+	}
+
+	baseName := exportFileName(cfg.Title(), tunnel.Name)
+	for i := range cfg.Peers {
+		text := cfg.CounterpartConfig(i, conf.Endpoint{})
+		filePath := filepath.Join(dlg.FilePath, fmt.Sprintf("%s-client-%d.conf", baseName, i+1))
+		writeFileWithOverwriteHandling(tp.Form(), filePath, func(file *os.File) error {
+			_, err := file.WriteString(text)
+			return err
+		})
+	}
 }
 
 func (tp *TunnelsPage) swapFiller(enabled bool) bool {
@@ -605,3 +842,11 @@ func (tp *TunnelsPage) onSelectedTunnelsChanged() {
 		tp.fillerHandler = tp.onDelete
 	}
 }
+
+// exportFileName returns title, which may be a display name, if it can name a file, and name otherwise.
+func exportFileName(title, name string) string {
+	if strings.ContainsAny(title, "\\/:*?\"<>|") {
+		return name
+	}
+	return title
+}
@@ -0,0 +1,615 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.zx2c4.com/wireguard/windows/conf"
+	"golang.zx2c4.com/wireguard/windows/manager"
+)
+
+// The wg commands are meant for scripts that were written for wg, so unlike the other commands, they
+// write their errors to standard error rather than showing a message box, and their text output is that
+// of wg, byte for byte, which is why neither is translated. Both go to the console that we are run from,
+// as main attaches to it, unless they are redirected.
+
+func wgFatalf(format string, v ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", v...)
+	os.Exit(1)
+}
+
+func wgUsage(usage string) {
+	wgFatalf("Usage: %s %s", os.Args[0], usage)
+}
+
+// wgJSONFlag removes the --json flag from args, returning whether it was there.
+func wgJSONFlag(args []string) ([]string, bool) {
+	var rest []string
+	found := false
+	for _, arg := range args {
+		if arg == "--json" {
+			found = true
+		} else {
+			rest = append(rest, arg)
+		}
+	}
+	return rest, found
+}
+
+func wgWriteJSON(v interface{}) {
+	b, _ := json.MarshalIndent(v, "", "  ")
+	os.Stdout.Write(append(b, '\n'))
+}
+
+var wgShowFields = map[string]bool{
+	"public-key":           true,
+	"private-key":          true,
+	"listen-port":          true,
+	"fwmark":               true,
+	"peers":                true,
+	"preshared-keys":       true,
+	"endpoints":            true,
+	"allowed-ips":          true,
+	"latest-handshakes":    true,
+	"transfer":             true,
+	"persistent-keepalive": true,
+	"dump":                 true,
+}
+
+// wgShowInterface is the JSON representation of a running tunnel that show gives. Like the text
+// output, it leaves out the private and preshared keys, which showconf gives.
+type wgShowInterface struct {
+	Name       string       `json:"Name"`
+	PublicKey  string       `json:"PublicKey,omitempty"`
+	ListenPort int          `json:"ListenPort,omitempty"`
+	Peers      []wgShowPeer `json:"Peers"`
+}
+
+type wgShowPeer struct {
+	PublicKey           string   `json:"PublicKey"`
+	HasPresharedKey     bool     `json:"HasPresharedKey,omitempty"`
+	Endpoint            string   `json:"Endpoint,omitempty"`
+	AllowedIPs          []string `json:"AllowedIPs"`
+	LatestHandshake     int64    `json:"LatestHandshake,omitempty"` // In seconds since the Unix epoch
+	TransferRx          uint64   `json:"TransferRx"`
+	TransferTx          uint64   `json:"TransferTx"`
+	PersistentKeepalive int      `json:"PersistentKeepalive,omitempty"`
+}
+
+func wgShow(args []string) {
+	const usage = "show { <interface> | all | interfaces } [public-key | private-key | listen-port | fwmark | peers | preshared-keys | endpoints | allowed-ips | latest-handshakes | transfer | persistent-keepalive | dump] [--json]"
+	args, jsonOutput := wgJSONFlag(args)
+	if len(args) > 2 || (len(args) == 2 && (jsonOutput || !wgShowFields[args[1]])) {
+		wgUsage(usage)
+	}
+	which := "all"
+	if len(args) > 0 {
+		which = args[0]
+	}
+	var names []string
+	if which == "all" || which == "interfaces" {
+		var err error
+		names, err = manager.ActiveTunnelNames()
+		if err != nil {
+			wgFatalf("Unable to list interfaces: %v", err)
+		}
+	} else {
+		names = []string{which}
+	}
+	if which == "interfaces" {
+		if len(args) > 1 {
+			wgUsage(usage)
+		}
+		if jsonOutput {
+			if names == nil {
+				names = []string{}
+			}
+			wgWriteJSON(names)
+		} else if len(names) > 0 {
+			fmt.Println(strings.Join(names, " "))
+		}
+		return
+	}
+
+	failed := false
+	var configs []*conf.Config
+	for _, name := range names {
+		config, err := manager.ReadTunnelRuntimeConfig(name, &conf.Config{Name: name})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to access interface %s: %v\n", name, err)
+			failed = true
+			continue
+		}
+		configs = append(configs, config)
+	}
+	switch {
+	case jsonOutput:
+		interfaces := make([]wgShowInterface, 0, len(configs))
+		for _, config := range configs {
+			interfaces = append(interfaces, wgShowJSON(config))
+		}
+		wgWriteJSON(interfaces)
+	case len(args) == 2:
+		for _, config := range configs {
+			wgUglyPrint(os.Stdout, config, args[1], which == "all")
+		}
+	default:
+		for i, config := range configs {
+			if i > 0 {
+				fmt.Println()
+			}
+			wgPrettyPrint(os.Stdout, config)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func wgShowJSON(config *conf.Config) wgShowInterface {
+	iface := wgShowInterface{
+		Name:       config.Name,
+		ListenPort: int(config.Interface.ListenPort),
+		Peers:      []wgShowPeer{},
+	}
+	if !config.Interface.PrivateKey.IsZero() {
+		iface.PublicKey = config.Interface.PrivateKey.Public().String()
+	}
+	for i := range config.Peers {
+		peer := &config.Peers[i]
+		p := wgShowPeer{
+			PublicKey:           peer.PublicKey.String(),
+			HasPresharedKey:     !peer.PresharedKey.IsZero(),
+			AllowedIPs:          []string{},
+			LatestHandshake:     wgHandshakeSeconds(peer.LastHandshakeTime),
+			TransferRx:          uint64(peer.RxBytes),
+			TransferTx:          uint64(peer.TxBytes),
+			PersistentKeepalive: int(peer.PersistentKeepalive),
+		}
+		if !peer.Endpoint.IsEmpty() {
+			p.Endpoint = peer.Endpoint.String()
+		}
+		for j := range peer.AllowedIPs {
+			p.AllowedIPs = append(p.AllowedIPs, peer.AllowedIPs[j].String())
+		}
+		iface.Peers = append(iface.Peers, p)
+	}
+	return iface
+}
+
+func wgHandshakeSeconds(t conf.HandshakeTime) int64 {
+	return int64(time.Duration(t) / time.Second)
+}
+
+// wgMaybeKey renders a key as wg does, which is "(none)" if it is not set.
+func wgMaybeKey(k *conf.Key) string {
+	if k.IsZero() {
+		return "(none)"
+	}
+	return k.String()
+}
+
+func wgPublicKey(config *conf.Config) string {
+	if config.Interface.PrivateKey.IsZero() {
+		return "(none)"
+	}
+	return config.Interface.PrivateKey.Public().String()
+}
+
+func wgPrettyTime(left int64) string {
+	units := []struct {
+		name    string
+		seconds int64
+	}{
+		{"year", 365 * 24 * 60 * 60},
+		{"day", 24 * 60 * 60},
+		{"hour", 60 * 60},
+		{"minute", 60},
+		{"second", 1},
+	}
+	var parts []string
+	for _, unit := range units {
+		n := left / unit.seconds
+		left %= unit.seconds
+		if n == 0 {
+			continue
+		}
+		plural := "s"
+		if n == 1 {
+			plural = ""
+		}
+		parts = append(parts, fmt.Sprintf("%d %s%s", n, unit.name, plural))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func wgAgo(t conf.HandshakeTime) string {
+	then, now := wgHandshakeSeconds(t), time.Now().Unix()
+	if then == now {
+		return "Now"
+	} else if then > now {
+		return "(System clock wound backward; connection problems may ensue.)"
+	}
+	return wgPrettyTime(now-then) + " ago"
+}
+
+func wgBytes(b conf.Bytes) string {
+	if b < 1024 {
+		return fmt.Sprintf("%d B", b)
+	} else if b < 1024*1024 {
+		return fmt.Sprintf("%.2f KiB", float64(b)/1024)
+	} else if b < 1024*1024*1024 {
+		return fmt.Sprintf("%.2f MiB", float64(b)/(1024*1024))
+	} else if b < 1024*1024*1024*1024 {
+		return fmt.Sprintf("%.2f GiB", float64(b)/(1024*1024*1024))
+	}
+	return fmt.Sprintf("%.2f TiB", float64(b)/(1024*1024*1024)/1024)
+}
+
+// wgPrettyPrint writes a running tunnel as wg show does, with the peers that completed a handshake
+// most recently first.
+func wgPrettyPrint(w io.Writer, config *conf.Config) {
+	fmt.Fprintf(w, "interface: %s\n", config.Name)
+	if !config.Interface.PrivateKey.IsZero() {
+		fmt.Fprintf(w, "  public key: %s\n", wgPublicKey(config))
+		fmt.Fprintf(w, "  private key: (hidden)\n")
+	}
+	if config.Interface.ListenPort > 0 {
+		fmt.Fprintf(w, "  listening port: %d\n", config.Interface.ListenPort)
+	}
+	peers := make([]*conf.Peer, len(config.Peers))
+	for i := range config.Peers {
+		peers[i] = &config.Peers[i]
+	}
+	sort.SliceStable(peers, func(i, j int) bool {
+		a, b := peers[i].LastHandshakeTime, peers[j].LastHandshakeTime
+		if a.IsEmpty() || b.IsEmpty() {
+			return !a.IsEmpty() && b.IsEmpty()
+		}
+		return a > b
+	})
+	for _, peer := range peers {
+		fmt.Fprintf(w, "\npeer: %s\n", peer.PublicKey.String())
+		if !peer.PresharedKey.IsZero() {
+			fmt.Fprintf(w, "  preshared key: (hidden)\n")
+		}
+		if !peer.Endpoint.IsEmpty() {
+			fmt.Fprintf(w, "  endpoint: %s\n", peer.Endpoint.String())
+		}
+		allowedIPs := make([]string, len(peer.AllowedIPs))
+		for i := range peer.AllowedIPs {
+			allowedIPs[i] = peer.AllowedIPs[i].String()
+		}
+		if len(allowedIPs) == 0 {
+			allowedIPs = []string{"(none)"}
+		}
+		fmt.Fprintf(w, "  allowed ips: %s\n", strings.Join(allowedIPs, ", "))
+		if !peer.LastHandshakeTime.IsEmpty() {
+			fmt.Fprintf(w, "  latest handshake: %s\n", wgAgo(peer.LastHandshakeTime))
+		}
+		if peer.RxBytes > 0 || peer.TxBytes > 0 {
+			fmt.Fprintf(w, "  transfer: %s received, %s sent\n", wgBytes(peer.RxBytes), wgBytes(peer.TxBytes))
+		}
+		if peer.PersistentKeepalive > 0 {
+			fmt.Fprintf(w, "  persistent keepalive: every %s\n", wgPrettyTime(int64(peer.PersistentKeepalive)))
+		}
+	}
+}
+
+// wgUglyPrint writes one field of a running tunnel as wg show does, prefixing each line with the name
+// of the tunnel if withInterface is set.
+func wgUglyPrint(w io.Writer, config *conf.Config, field string, withInterface bool) {
+	prefix := func() {
+		if withInterface {
+			fmt.Fprintf(w, "%s\t", config.Name)
+		}
+	}
+	keepalive := func(peer *conf.Peer) string {
+		if peer.PersistentKeepalive == 0 {
+			return "off"
+		}
+		return strconv.Itoa(int(peer.PersistentKeepalive))
+	}
+	allowedIPs := func(peer *conf.Peer, separator string) string {
+		if len(peer.AllowedIPs) == 0 {
+			return "(none)"
+		}
+		s := make([]string, len(peer.AllowedIPs))
+		for i := range peer.AllowedIPs {
+			s[i] = peer.AllowedIPs[i].String()
+		}
+		return strings.Join(s, separator)
+	}
+	endpoint := func(peer *conf.Peer) string {
+		if peer.Endpoint.IsEmpty() {
+			return "(none)"
+		}
+		return peer.Endpoint.String()
+	}
+
+	switch field {
+	case "public-key":
+		prefix()
+		fmt.Fprintf(w, "%s\n", wgPublicKey(config))
+		return
+	case "private-key":
+		prefix()
+		fmt.Fprintf(w, "%s\n", wgMaybeKey(&config.Interface.PrivateKey))
+		return
+	case "listen-port":
+		prefix()
+		fmt.Fprintf(w, "%d\n", config.Interface.ListenPort)
+		return
+	case "fwmark":
+		prefix()
+		fmt.Fprintf(w, "off\n")
+		return
+	case "dump":
+		prefix()
+		fmt.Fprintf(w, "%s\t%s\t%d\toff\n", wgMaybeKey(&config.Interface.PrivateKey), wgPublicKey(config), config.Interface.ListenPort)
+	}
+	for i := range config.Peers {
+		peer := &config.Peers[i]
+		prefix()
+		switch field {
+		case "peers":
+			fmt.Fprintf(w, "%s\n", peer.PublicKey.String())
+		case "preshared-keys":
+			fmt.Fprintf(w, "%s\t%s\n", peer.PublicKey.String(), wgMaybeKey(&peer.PresharedKey))
+		case "endpoints":
+			fmt.Fprintf(w, "%s\t%s\n", peer.PublicKey.String(), endpoint(peer))
+		case "allowed-ips":
+			fmt.Fprintf(w, "%s\t%s\n", peer.PublicKey.String(), allowedIPs(peer, " "))
+		case "latest-handshakes":
+			fmt.Fprintf(w, "%s\t%d\n", peer.PublicKey.String(), wgHandshakeSeconds(peer.LastHandshakeTime))
+		case "transfer":
+			fmt.Fprintf(w, "%s\t%d\t%d\n", peer.PublicKey.String(), peer.RxBytes, peer.TxBytes)
+		case "persistent-keepalive":
+			fmt.Fprintf(w, "%s\t%s\n", peer.PublicKey.String(), keepalive(peer))
+		case "dump":
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%d\t%s\n", peer.PublicKey.String(), wgMaybeKey(&peer.PresharedKey), endpoint(peer),
+				allowedIPs(peer, ","), wgHandshakeSeconds(peer.LastHandshakeTime), peer.RxBytes, peer.TxBytes, keepalive(peer))
+		}
+	}
+}
+
+func wgShowConf(args []string) {
+	args, jsonOutput := wgJSONFlag(args)
+	if len(args) != 1 {
+		wgUsage("showconf <interface> [--json]")
+	}
+	config, err := manager.ReadTunnelRuntimeConfig(args[0], &conf.Config{Name: args[0]})
+	if err != nil {
+		wgFatalf("Unable to access interface %s: %v", args[0], err)
+	}
+	if jsonOutput {
+		os.Stdout.WriteString(config.ToJSON())
+		return
+	}
+	var output strings.Builder
+	output.WriteString("[Interface]\n")
+	if config.Interface.ListenPort > 0 {
+		output.WriteString(fmt.Sprintf("ListenPort = %d\n", config.Interface.ListenPort))
+	}
+	if !config.Interface.PrivateKey.IsZero() {
+		output.WriteString(fmt.Sprintf("PrivateKey = %s\n", config.Interface.PrivateKey.String()))
+	}
+	for i := range config.Peers {
+		peer := &config.Peers[i]
+		output.WriteString(fmt.Sprintf("\n[Peer]\nPublicKey = %s\n", peer.PublicKey.String()))
+		if !peer.PresharedKey.IsZero() {
+			output.WriteString(fmt.Sprintf("PresharedKey = %s\n", peer.PresharedKey.String()))
+		}
+		if len(peer.AllowedIPs) > 0 {
+			allowedIPs := make([]string, len(peer.AllowedIPs))
+			for j := range peer.AllowedIPs {
+				allowedIPs[j] = peer.AllowedIPs[j].String()
+			}
+			output.WriteString(fmt.Sprintf("AllowedIPs = %s\n", strings.Join(allowedIPs, ", ")))
+		}
+		if !peer.Endpoint.IsEmpty() {
+			output.WriteString(fmt.Sprintf("Endpoint = %s\n", peer.Endpoint.String()))
+		}
+		if peer.PersistentKeepalive > 0 {
+			output.WriteString(fmt.Sprintf("PersistentKeepalive = %d\n", peer.PersistentKeepalive))
+		}
+	}
+	os.Stdout.WriteString(output.String())
+}
+
+// wgReadKeyFile reads a key from a file as wg set does, where an empty file stands for no key.
+func wgReadKeyFile(path string) (*conf.Key, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := strings.TrimSpace(string(contents))
+	if len(s) == 0 {
+		return &conf.Key{}, nil
+	}
+	k, err := conf.NewPrivateKeyFromString(s)
+	if err != nil {
+		return nil, fmt.Errorf("Key is not the correct length or format: %s", path)
+	}
+	return k, nil
+}
+
+// wgSetUAPI translates the arguments of wg set, after the interface, to the lines of a UAPI set
+// operation.
+func wgSetUAPI(args []string) (string, error) {
+	var output strings.Builder
+	inPeer := false
+	for len(args) > 0 {
+		option := args[0]
+		needsValue := option != "remove"
+		if needsValue && len(args) < 2 {
+			return "", fmt.Errorf("Missing value for %s", option)
+		}
+		value := ""
+		if needsValue {
+			value = args[1]
+			args = args[2:]
+		} else {
+			args = args[1:]
+		}
+		if option == "peer" {
+			k, err := conf.NewPrivateKeyFromString(value)
+			if err != nil {
+				return "", fmt.Errorf("Invalid peer public key: %s", value)
+			}
+			output.WriteString(fmt.Sprintf("public_key=%s\n", k.HexString()))
+			inPeer = true
+			continue
+		}
+		if !inPeer {
+			switch option {
+			case "listen-port":
+				port, err := strconv.ParseUint(value, 10, 16)
+				if err != nil {
+					return "", fmt.Errorf("Invalid port: %s", value)
+				}
+				output.WriteString(fmt.Sprintf("listen_port=%d\n", port))
+			case "fwmark":
+				if value != "off" && value != "0" {
+					return "", errors.New("fwmark is not supported on Windows")
+				}
+			case "private-key":
+				k, err := wgReadKeyFile(value)
+				if err != nil {
+					return "", err
+				}
+				output.WriteString(fmt.Sprintf("private_key=%s\n", k.HexString()))
+			default:
+				return "", fmt.Errorf("Invalid argument: %s", option)
+			}
+			continue
+		}
+		switch option {
+		case "remove":
+			output.WriteString("remove=true\n")
+		case "preshared-key":
+			k, err := wgReadKeyFile(value)
+			if err != nil {
+				return "", err
+			}
+			output.WriteString(fmt.Sprintf("preshared_key=%s\n", k.HexString()))
+		case "endpoint":
+			e, err := conf.ParseEndpoint(value)
+			if err != nil {
+				return "", err
+			}
+			if net.ParseIP(e.Host) == nil {
+				e.Host, err = conf.ResolveHostnameOnce(e.Host)
+				if err != nil {
+					return "", fmt.Errorf("Unable to resolve endpoint %s: %v", value, err)
+				}
+			}
+			output.WriteString(fmt.Sprintf("endpoint=%s\n", e.String()))
+		case "persistent-keepalive":
+			keepalive := uint64(0)
+			if value != "off" {
+				var err error
+				keepalive, err = strconv.ParseUint(value, 10, 16)
+				if err != nil {
+					return "", fmt.Errorf("Invalid persistent keepalive: %s", value)
+				}
+			}
+			output.WriteString(fmt.Sprintf("persistent_keepalive_interval=%d\n", keepalive))
+		case "allowed-ips":
+			output.WriteString("replace_allowed_ips=true\n")
+			for _, s := range strings.Split(value, ",") {
+				s = strings.TrimSpace(s)
+				if len(s) == 0 {
+					continue
+				}
+				ip, network, err := net.ParseCIDR(s)
+				if err != nil && !strings.Contains(s, "/") {
+					if ip = net.ParseIP(s); ip != nil {
+						bits := net.IPv6len * 8
+						if ip.To4() != nil {
+							bits = net.IPv4len * 8
+						}
+						err = nil
+						network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+					}
+				}
+				if err != nil {
+					return "", fmt.Errorf("Invalid allowed IP: %s", s)
+				}
+				if ip4 := ip.To4(); ip4 != nil {
+					ip = ip4
+				}
+				ones, _ := network.Mask.Size()
+				allowedIP := conf.IPCidr{IP: ip, Cidr: uint8(ones)}
+				output.WriteString(fmt.Sprintf("allowed_ip=%s\n", allowedIP.String()))
+			}
+		default:
+			return "", fmt.Errorf("Invalid argument: %s", option)
+		}
+	}
+	return output.String(), nil
+}
+
+func wgSet(args []string) {
+	const usage = "set <interface> [listen-port <port>] [fwmark <mark>] [private-key <file path>] [peer <base64 public key> [remove] [preshared-key <file path>] [endpoint <ip>:<port>] [persistent-keepalive <interval seconds>] [allowed-ips <ip1>/<cidr1>[,<ip2>/<cidr2>]...] ]..."
+	if len(args) < 2 {
+		wgUsage(usage)
+	}
+	uapi, err := wgSetUAPI(args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		wgUsage(usage)
+	}
+	err = manager.SetTunnelRuntimeConfig(args[0], uapi)
+	if err != nil {
+		wgFatalf("Unable to modify interface %s: %v", args[0], err)
+	}
+}
+
+func wgGenKey(args []string, preshared bool) {
+	if len(args) != 0 {
+		if preshared {
+			wgUsage("genpsk")
+		}
+		wgUsage("genkey")
+	}
+	var k *conf.Key
+	var err error
+	if preshared {
+		k, err = conf.NewPresharedKey()
+	} else {
+		k, err = conf.NewPrivateKey()
+	}
+	if err != nil {
+		wgFatalf("Unable to generate key: %v", err)
+	}
+	fmt.Println(k.String())
+}
+
+func wgPubKey(args []string) {
+	if len(args) != 0 {
+		wgUsage("pubkey")
+	}
+	b, err := io.ReadAll(io.LimitReader(os.Stdin, 1024))
+	if err != nil {
+		wgFatalf("Unable to read private key from standard input: %v", err)
+	}
+	k, err := conf.NewPrivateKeyFromString(strings.TrimSpace(string(b)))
+	if err != nil {
+		wgFatalf("Key is not the correct length or format")
+	}
+	fmt.Println(k.Public().String())
+}
@@ -0,0 +1,202 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2019-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.zx2c4.com/wireguard/windows/conf"
+)
+
+const (
+	testPrivateKey   = "yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk="
+	testPeerKey      = "xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg="
+	testPresharedKey = "TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0="
+)
+
+func TestWgPrettyTime(t *testing.T) {
+	tests := []struct {
+		seconds int64
+		want    string
+	}{
+		{0, ""},
+		{1, "1 second"},
+		{25, "25 seconds"},
+		{61, "1 minute, 1 second"},
+		{2 * 60 * 60, "2 hours"},
+		{24*60*60 + 60*60 + 2*60, "1 day, 1 hour, 2 minutes"},
+		{2*365*24*60*60 + 3, "2 years, 3 seconds"},
+	}
+	for _, test := range tests {
+		if got := wgPrettyTime(test.seconds); got != test.want {
+			t.Errorf("wgPrettyTime(%d) = %q, want %q", test.seconds, got, test.want)
+		}
+	}
+}
+
+func TestWgBytes(t *testing.T) {
+	tests := []struct {
+		bytes conf.Bytes
+		want  string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.00 KiB"},
+		{1536, "1.50 KiB"},
+		{1024 * 1024, "1.00 MiB"},
+		{5 * 1024 * 1024 * 1024, "5.00 GiB"},
+		{2 * 1024 * 1024 * 1024 * 1024, "2.00 TiB"},
+	}
+	for _, test := range tests {
+		if got := wgBytes(test.bytes); got != test.want {
+			t.Errorf("wgBytes(%d) = %q, want %q", test.bytes, got, test.want)
+		}
+	}
+}
+
+func TestWgUglyPrintDump(t *testing.T) {
+	privateKey, err := conf.NewPrivateKeyFromString(testPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peerKey, err := conf.NewPrivateKeyFromString(testPeerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	presharedKey, err := conf.NewPrivateKeyFromString(testPresharedKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &conf.Config{
+		Name: "wg0",
+		Interface: conf.Interface{
+			PrivateKey: *privateKey,
+			ListenPort: 51820,
+		},
+		Peers: []conf.Peer{
+			{
+				PublicKey:    *peerKey,
+				PresharedKey: *presharedKey,
+				Endpoint:     conf.Endpoint{Host: "192.0.2.1", Port: 51820},
+				AllowedIPs: []conf.IPCidr{
+					{IP: net.IPv4(10, 0, 0, 0).To4(), Cidr: 24},
+					{IP: net.ParseIP("fd00::"), Cidr: 64},
+				},
+				PersistentKeepalive: 25,
+				LastHandshakeTime:   conf.HandshakeTime(1600000000 * time.Second),
+				RxBytes:             1234,
+				TxBytes:             5678,
+			},
+			{
+				PublicKey: *privateKey.Public(),
+			},
+		},
+	}
+	lines := []string{
+		testPrivateKey + "\t" + privateKey.Public().String() + "\t51820\toff",
+		testPeerKey + "\t" + testPresharedKey + "\t192.0.2.1:51820\t10.0.0.0/24,fd00::/64\t1600000000\t1234\t5678\t25",
+		privateKey.Public().String() + "\t(none)\t(none)\t(none)\t0\t0\t0\toff",
+	}
+
+	tests := []struct {
+		withInterface bool
+		prefix        string
+	}{
+		{false, ""},
+		{true, "wg0\t"},
+	}
+	for _, test := range tests {
+		var b strings.Builder
+		wgUglyPrint(&b, config, "dump", test.withInterface)
+		want := test.prefix + strings.Join(lines, "\n"+test.prefix) + "\n"
+		if got := b.String(); got != want {
+			t.Errorf("wgUglyPrint(dump, withInterface=%v) = %q, want %q", test.withInterface, got, want)
+		}
+	}
+}
+
+func TestWgSetUAPI(t *testing.T) {
+	dir := t.TempDir()
+	emptyKeyFile := filepath.Join(dir, "empty.key")
+	err := os.WriteFile(emptyKeyFile, []byte("\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "private.key")
+	err = os.WriteFile(keyFile, []byte(testPrivateKey+"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	badKeyFile := filepath.Join(dir, "bad.key")
+	err = os.WriteFile(badKeyFile, []byte("not a key\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, _ := conf.NewPrivateKeyFromString(testPrivateKey)
+	peerKey, _ := conf.NewPrivateKeyFromString(testPeerKey)
+	peer := "public_key=" + peerKey.HexString() + "\n"
+	zeroKey := strings.Repeat("0", 64)
+
+	tests := []struct {
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{args: []string{"listen-port", "51820"}, want: "listen_port=51820\n"},
+		{args: []string{"listen-port", "65536"}, wantErr: true},
+		{args: []string{"listen-port"}, wantErr: true},
+		{args: []string{"fwmark", "off"}, want: ""},
+		{args: []string{"fwmark", "0x1234"}, wantErr: true},
+		{args: []string{"private-key", keyFile}, want: "private_key=" + privateKey.HexString() + "\n"},
+		{args: []string{"private-key", emptyKeyFile}, want: "private_key=" + zeroKey + "\n"},
+		{args: []string{"private-key", badKeyFile}, wantErr: true},
+		{args: []string{"bogus", "value"}, wantErr: true},
+		{args: []string{"peer", "not a key"}, wantErr: true},
+		{args: []string{"peer", testPeerKey, "remove"}, want: peer + "remove=true\n"},
+		{args: []string{"peer", testPeerKey, "preshared-key", emptyKeyFile}, want: peer + "preshared_key=" + zeroKey + "\n"},
+		{args: []string{"peer", testPeerKey, "endpoint", "192.0.2.1:51820"}, want: peer + "endpoint=192.0.2.1:51820\n"},
+		{args: []string{"peer", testPeerKey, "endpoint", "[2001:db8::1]:51820"}, want: peer + "endpoint=[2001:db8::1]:51820\n"},
+		{args: []string{"peer", testPeerKey, "persistent-keepalive", "25"}, want: peer + "persistent_keepalive_interval=25\n"},
+		{args: []string{"peer", testPeerKey, "persistent-keepalive", "off"}, want: peer + "persistent_keepalive_interval=0\n"},
+		{args: []string{"peer", testPeerKey, "persistent-keepalive", "forever"}, wantErr: true},
+		{args: []string{"peer", testPeerKey, "allowed-ips", ""}, want: peer + "replace_allowed_ips=true\n"},
+		{
+			args: []string{"peer", testPeerKey, "allowed-ips", "10.0.0.1, 10.0.0.0/24,fd00::/64,fd00::1,::ffff:192.0.2.1"},
+			want: peer + "replace_allowed_ips=true\n" +
+				"allowed_ip=10.0.0.1/32\n" +
+				"allowed_ip=10.0.0.0/24\n" +
+				"allowed_ip=fd00::/64\n" +
+				"allowed_ip=fd00::1/128\n" +
+				"allowed_ip=192.0.2.1/32\n",
+		},
+		{args: []string{"peer", testPeerKey, "allowed-ips", "10.0.0.0/33"}, wantErr: true},
+		{args: []string{"peer", testPeerKey, "allowed-ips", "10.0.0"}, wantErr: true},
+		{args: []string{"peer", testPeerKey, "listen-port", "51820"}, wantErr: true},
+		{
+			args: []string{"listen-port", "51820", "peer", testPeerKey, "allowed-ips", "0.0.0.0/0", "peer", testPeerKey, "remove"},
+			want: "listen_port=51820\n" + peer + "replace_allowed_ips=true\nallowed_ip=0.0.0.0/0\n" + peer + "remove=true\n",
+		},
+	}
+	for _, test := range tests {
+		got, err := wgSetUAPI(test.args)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("wgSetUAPI(%q) = %q, want an error", test.args, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("wgSetUAPI(%q) failed: %v", test.args, err)
+		} else if got != test.want {
+			t.Errorf("wgSetUAPI(%q) = %q, want %q", test.args, got, test.want)
+		}
+	}
+}